@@ -79,6 +79,8 @@ func checkSlackCmdF(cmd *cobra.Command, args []string) error {
 		logger.Info("Debug mode enabled")
 	}
 	slackTransformer := slack.NewTransformer("test", logger)
+	// corrupt files are reported in the log instead of stopping the check
+	slackTransformer.Options.SkipCorruptFiles = true
 
 	valid := slackTransformer.Precheck(zipReader)
 	if !valid {
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/mattermost/mmetl/services/importdiff"
+	"github.com/spf13/cobra"
+)
+
+var DiffCmd = &cobra.Command{
+	Use:     "diff <a.jsonl> <b.jsonl>",
+	Short:   "Compares two import files.",
+	Long:    "Compares two Mattermost import files and reports the users, channels and posts added, removed or changed from the first one to the second one.",
+	Example: "  diff bulk-export.jsonl bulk-export-new.jsonl --attachments-dir-a data --attachments-dir-b data-new",
+	Args:    cobra.ExactArgs(2),
+	RunE:    diffCmdF,
+}
+
+func init() {
+	DiffCmd.Flags().String("attachments-dir-a", "", "the attachments directory of the first import. If set along with --attachments-dir-b, attachments are compared by checksum besides their path")
+	DiffCmd.Flags().String("attachments-dir-b", "", "the attachments directory of the second import")
+
+	RootCmd.AddCommand(
+		DiffCmd,
+	)
+}
+
+func diffCmdF(cmd *cobra.Command, args []string) error {
+	attachmentsDirA, _ := cmd.Flags().GetString("attachments-dir-a")
+	attachmentsDirB, _ := cmd.Flags().GetString("attachments-dir-b")
+
+	// checksums are only comparable if both sides have them
+	if attachmentsDirA == "" || attachmentsDirB == "" {
+		attachmentsDirA, attachmentsDirB = "", ""
+	}
+
+	a, err := readImportFile(args[0], attachmentsDirA)
+	if err != nil {
+		return err
+	}
+
+	b, err := readImportFile(args[1], attachmentsDirB)
+	if err != nil {
+		return err
+	}
+
+	return importdiff.WriteSummary(cmd.OutOrStdout(), importdiff.Diff(a, b))
+}
+
+func readImportFile(filePath, attachmentsDir string) (*importdiff.Import, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return importdiff.ReadImport(file, attachmentsDir)
+}
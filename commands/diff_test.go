@@ -0,0 +1,33 @@
+package commands_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mmetl/commands"
+)
+
+func TestDiff(t *testing.T) {
+	workDir := t.TempDir()
+	a := filepath.Join(workDir, "a.jsonl")
+	b := filepath.Join(workDir, "b.jsonl")
+	require.NoError(t, os.WriteFile(a, []byte(`{"type":"post","post":{"team":"myteam","channel":"general","user":"alice","message":"hello","create_at":1}}`+"\n"), 0600))
+	require.NoError(t, os.WriteFile(b, []byte(`{"type":"post","post":{"team":"myteam","channel":"general","user":"alice","message":"bye","create_at":1}}`+"\n"), 0600))
+
+	buf := &bytes.Buffer{}
+	c := commands.RootCmd
+	c.SetOut(buf)
+	defer c.SetOut(nil)
+	c.SetArgs([]string{"diff", a, b})
+
+	require.NoError(t, c.Execute())
+	require.Equal(t, `users: 0 added, 0 removed, 0 changed
+channels: 0 added, 0 removed, 0 changed
+posts: 0 added, 0 removed, 1 changed
+~ post myteam/general/alice/1
+`, buf.String())
+}
@@ -2,12 +2,22 @@ package commands
 
 import (
 	"archive/zip"
+	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/mattermost/mattermost/server/public/model"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
@@ -16,6 +26,37 @@ import (
 
 const attachmentsInternal = "bulk-export-attachments"
 
+const (
+	outputFormatBulk  = "bulk"
+	outputFormatMmctl = "mmctl"
+)
+
+const (
+	attachmentsLayoutFlat   = "flat"
+	attachmentsLayoutByDate = "by-date"
+)
+
+const (
+	deadUserPostsPlaceholder = "keep-as-placeholder"
+	deadUserPostsDrop        = "drop"
+)
+
+const (
+	botThreadRepliesReparent = "reparent"
+	botThreadRepliesDrop     = "drop"
+)
+
+const (
+	orphanRepliesDrop    = "drop"
+	orphanRepliesPromote = "promote"
+)
+
+const (
+	dmModeDirect  = "direct"
+	dmModeArchive = "archive"
+	dmModeSkip    = "skip"
+)
+
 var TransformCmd = &cobra.Command{
 	Use:   "transform",
 	Short: "Transforms export files into Mattermost import files",
@@ -31,22 +72,100 @@ var TransformSlackCmd = &cobra.Command{
 }
 
 func init() {
-	TransformSlackCmd.Flags().StringP("team", "t", "", "an existing team in Mattermost to import the data into")
-	if err := TransformSlackCmd.MarkFlagRequired("team"); err != nil {
-		panic(err)
-	}
+	TransformSlackCmd.Flags().StringP("team", "t", "", "an existing team in Mattermost to import the data into. Defaults to the name of the Slack workspace if the export includes it")
 	TransformSlackCmd.Flags().StringP("file", "f", "", "the Slack export file to transform")
-	if err := TransformSlackCmd.MarkFlagRequired("file"); err != nil {
-		panic(err)
-	}
+	TransformSlackCmd.Flags().String("merge-export-dir", "", "A directory with several Slack export zip files of the same workspace, such as the exports of consecutive periods, to merge into a single import. Users are deduplicated by email and posts present in several exports are imported once")
+	TransformSlackCmd.MarkFlagsOneRequired("file", "merge-export-dir")
+	TransformSlackCmd.MarkFlagsMutuallyExclusive("file", "merge-export-dir")
 	TransformSlackCmd.Flags().StringP("output", "o", "bulk-export.jsonl", "the output path")
-	TransformSlackCmd.Flags().StringP("attachments-dir", "d", "data", "the path for the attachments directory")
+	TransformSlackCmd.Flags().String("output-format", outputFormatBulk, "the format of the output. \"bulk\" writes the import file next to the attachments directory, and \"mmctl\" writes a zip file with the import file and the attachments to import with mmctl")
+	TransformSlackCmd.Flags().StringP("attachments-dir", "d", "data", "the path for the attachments directory. It can live on a different volume than the output file, and should be packaged as the data directory of the import")
+	TransformSlackCmd.Flags().String("attachments-layout", attachmentsLayoutFlat, "how to lay out the attachments directory. \"flat\" puts all the attachments in the same directory, and \"by-date\" in a directory for the day of their post")
+	TransformSlackCmd.Flags().String("timezone", "UTC", "the timezone used to find the day of the posts, such as America/New_York. It should match the timezone of the Slack workspace")
 	TransformSlackCmd.Flags().BoolP("skip-convert-posts", "c", false, "Skips converting mentions and post markup. Only for testing purposes")
 	TransformSlackCmd.Flags().BoolP("skip-attachments", "a", false, "Skips copying the attachments from the import file")
+	TransformSlackCmd.Flags().String("users-file", "", "A CSV file with a Slack user id or username and an email per row, used to fill the emails missing from the export")
+	TransformSlackCmd.Flags().String("auth-service", "", "The authentication service of the imported users, one of email, gitlab, ldap, saml, google or office365, so their accounts are linked to the SSO provider. The auth data of each user is their email unless set in --auth-data-file")
+	TransformSlackCmd.Flags().String("auth-data-file", "", "A CSV file with a Slack user id or username, the auth data and, optionally, the auth service of the user per row")
+	TransformSlackCmd.Flags().Bool("quote-broadcast-mentions", false, "Converts the @channel, @here and @all mentions, which Slack's @everyone becomes, to code spans, so they are kept in the messages but don't notify anyone")
+	TransformSlackCmd.Flags().String("replace-mentions-file", "", "A CSV file with a regular expression and its replacement per row, applied in order to the posts after converting the user and channel mentions. Useful for custom tokens of legacy integrations")
 	TransformSlackCmd.Flags().Bool("skip-empty-emails", false, "Ignore empty email addresses from the import file. Note that this results in invalid data.")
 	TransformSlackCmd.Flags().String("default-email-domain", "", "If this flag is provided: When a user's email address is empty, the output's email address will be generated from their username and the provided domain.")
+	TransformSlackCmd.Flags().Bool("no-default-email-exit", false, "Skips the users without an email address instead of stopping the transformation when neither --default-email-domain nor --skip-empty-emails is set. Their posts are imported with a placeholder user, and they are listed in the sanitize report")
 	TransformSlackCmd.Flags().BoolP("allow-download", "l", false, "Allows downloading the attachments for the import file")
+	TransformSlackCmd.Flags().String("attachment-url-template", "", "Builds the download URL of the files that have none in the export from this template, replacing {id} with the file id and {name} with the file name, e.g. https://files.slack.com/files-pri/T0123-{id}/download/{name}. Requires --allow-download")
+	TransformSlackCmd.Flags().String("slack-token", "", "A Slack token to authorize the downloads of the URLs built with --attachment-url-template")
+	TransformSlackCmd.Flags().Bool("prefer-thumbnails", false, "Downloads the thumbnails of the images instead of the originals, to save bandwidth. The originals are downloaded by default")
+	TransformSlackCmd.Flags().String("thumbnails-report", "thumbnails.csv", "The CSV file that lists the variant downloaded for each file with --prefer-thumbnails")
+	TransformSlackCmd.Flags().Bool("only-active-users", false, "Leaves the deactivated users out of the import")
+	TransformSlackCmd.Flags().String("dead-user-posts", deadUserPostsPlaceholder, "What to do with the posts of the users left out by --only-active-users. Can be \"keep-as-placeholder\" to attribute them to placeholder users, or \"drop\" to leave them and the replies to their threads out")
+	TransformSlackCmd.Flags().Bool("exclude-bots", false, "Leaves the bot users and the messages of bots and apps out of the import")
+	TransformSlackCmd.Flags().String("bot-thread-replies", botThreadRepliesReparent, "What to do with the replies to the threads started by a bot left out by --exclude-bots. Can be \"reparent\" to start a new thread with the first reply, or \"drop\" to leave them out")
+	TransformSlackCmd.Flags().Bool("drop-empty-threads", false, "Drops the thread roots that have no replies left after leaving out users or bots and that are empty or system messages, such as joins or deleted messages")
+	TransformSlackCmd.Flags().String("orphan-replies", orphanRepliesDrop, "What to do with the replies whose thread root is missing from the export, as in partial exports. Can be \"drop\" to leave them out, or \"promote\" to import them as standalone posts")
+	TransformSlackCmd.Flags().Bool("seed-context-post", false, "Adds a first post to each public and private channel with its topic and purpose in Slack, by the creator of the channel, so they are kept in the history if the header is changed later on")
+	TransformSlackCmd.Flags().Bool("include-free-tier-truncation-note", false, "Adds a first post to each public and private channel noting the date of its oldest message, as the exports of free workspaces only include part of the history")
+	TransformSlackCmd.Flags().Bool("summarize-reminders", false, "Lists the reminders set up in each channel, with their owner and time, in a single post instead of leaving them out")
+	TransformSlackCmd.Flags().String("checkpoint", "", "A file where the progress of the transformation is recorded, so an interrupted run can be resumed by running it again with the same flags. It is removed once the transformation succeeds")
+	TransformSlackCmd.Flags().String("limit-attachments-total-size", "", "The maximum total size of the attachments, in bytes or with a KiB, MiB, GiB or TiB suffix. The files that would exceed it are skipped, linked from their post with --include-file-urls, and listed in --skipped-attachments-report")
+	TransformSlackCmd.Flags().String("skipped-attachments-report", "skipped-attachments.csv", "The CSV file that lists the attachments skipped by --limit-attachments-total-size")
+	TransformSlackCmd.Flags().String("export-users-csv", "", "A CSV file where the username, email, name, position and roles of the users of the import are written, for the admins who provision users out of band, such as through SSO")
+	TransformSlackCmd.Flags().String("placeholder-report", "", "A CSV file where every placeholder user created for the users missing from the export is recorded, with their Slack id and the profile found in their posts, to reach out to the people behind them")
+	TransformSlackCmd.Flags().String("sanitize-report", "", "A CSV file where every channel and user field truncated or renamed to be valid in Mattermost is recorded, for auditing")
+	TransformSlackCmd.Flags().String("transform-hook", "", "A command, run with sh -c, that receives the transformed data as JSONL on its standard input and writes it back, possibly modified, to its standard output before the import file is written. Each line has a type (user, public_channel, private_channel, group_channel, direct_channel or post) and the user, channel or post. The output is validated, and the transformation fails if the command does")
+	TransformSlackCmd.Flags().Bool("parse-only", false, "Writes the parsed Slack export as JSON to the output file without transforming it, to debug issues with the format of the export")
+	TransformSlackCmd.Flags().Bool("link-canvases", false, "Adds links to the Slack canvases and lists of each channel to its header")
+	TransformSlackCmd.Flags().String("attachment-base-url", "", "Links the attachments from their posts under this URL instead of importing them, for media hosted externally. The files are still written to the attachments directory to be uploaded separately")
+	TransformSlackCmd.Flags().String("attachment-manifest", "attachments-manifest.csv", "The CSV file that lists the attachments to upload and their URL when --attachment-base-url is set")
+	TransformSlackCmd.Flags().Bool("hash-usernames", false, "Replaces the usernames with stable hashes salted with --hash-salt, for compliance tests")
+	TransformSlackCmd.Flags().String("hash-salt", "", "The salt for --hash-usernames. Runs with the same salt produce the same hashes")
+	TransformSlackCmd.Flags().Bool("hash-emails", false, "Hashes the emails too when --hash-usernames is set, keeping their domain")
+	TransformSlackCmd.Flags().Bool("import-categories", false, "Imports the channels in the starred sidebar section of each user as favorites, if the export includes the sidebar sections")
 	TransformSlackCmd.Flags().BoolP("discard-invalid-props", "p", false, "Skips converting posts with invalid props instead discarding the props themselves")
+	TransformSlackCmd.Flags().Bool("preserve-ts-precision", false, "Renumbers the timestamps of the posts of each channel so the posts sent within the same millisecond, and the parts of split messages, keep the order of their original Slack timestamps")
+	TransformSlackCmd.Flags().Bool("spread-reaction-timestamps", false, "Gives each reaction its own timestamp right after its post instead of sharing the post's timestamp")
+	TransformSlackCmd.Flags().Int("concurrent-channels", 1, "The number of channels whose posts are transformed at the same time")
+	TransformSlackCmd.Flags().Int("thread-reply-limit", 0, "Imports at most this many replies for each thread, keeping the earliest ones and noting how many more there were in a last reply. 0 means no limit")
+	TransformSlackCmd.Flags().String("utf8-normalize", "", "The Unicode normalization form, nfc, nfd, nfkc or nfkd, applied to channel names and attachment paths before dropping the characters that aren't ASCII. nfkc and nfkd turn fullwidth letters and ligatures into ASCII, and nfd and nfkd keep the base letter of accented characters. By default file names use nfkd and channel names aren't normalized")
+	TransformSlackCmd.Flags().Int("reaction-users-limit", 0, "Imports at most this many users for each emoji reacted to a post, noting the total count in the post. 0 means no limit")
+	TransformSlackCmd.Flags().Int("post-limit", 0, "Stops after producing this many posts, counting replies, for quick smoke tests. Threads are kept whole, so fewer posts may be produced. 0 means no limit")
+	TransformSlackCmd.Flags().Int("min-members", 2, "Skips the direct and group channels with fewer valid members than this, to leave out one-off conversations")
+	TransformSlackCmd.Flags().Duration("merge-consecutive-messages", 0, "Merges the messages that an author sends within this time of their previous one into a single post, e.g. 1m. Messages aren't merged across threads")
+	TransformSlackCmd.Flags().String("validate-usernames-against-server", "", "The URL of the Mattermost server the data will be imported into. The usernames and emails of the users are looked up on it, and the ones already taken are logged, as the import would update those users instead of creating new ones")
+	TransformSlackCmd.Flags().String("server-token", "", "A personal access token of the server of --validate-usernames-against-server, allowed to look up users")
+	TransformSlackCmd.Flags().Bool("channel-topic-history", false, "Adds a post to each channel that lists the changes of its topic, purpose and name in order, besides the post of each change")
+	TransformSlackCmd.Flags().String("huddle-without-room", slack.HuddleWithoutRoomImport, "What is done with the huddles whose room data is missing from the export: \"import\" them as calls attributed to the author of the post, or to Slackbot, starting and ending at the time of the post, or \"skip\" them")
+	TransformSlackCmd.Flags().String("file-caption", slack.FileCaptionNone, "The message of the file shares posted without one: \"none\", \"filename\" for the name of each file, or \"title\" for their title, falling back to the name")
+	TransformSlackCmd.Flags().Duration("post-create-at-offset", 0, "Shifts the time of every post, reply and reaction by this duration, e.g. 8760h to move the history a year later or -24h a day earlier, to import historical data into a recent window of a test instance. The order of the posts is kept")
+	TransformSlackCmd.Flags().String("sort-channels", "", "Orders the channels in the import, which sets their order in the sidebar: \"name\", \"created\" from the oldest, or \"posts\" from the most active. By default the order of the export is kept")
+	TransformSlackCmd.Flags().String("message-prefix-template", "", "Prepends this template to the message of every post, e.g. \"[{date} {time}] {user}: \", to keep the attribution when threads are flattened or channels merged. {user}, {date}, {time} and {channel} are replaced by the username of the author, the day and time of the post in --timezone and the channel name. Longer messages are still split at --max-message-length")
+	TransformSlackCmd.Flags().Int("max-message-length", model.PostMessageMaxRunesV2, "The maximum number of characters of a post. Longer messages are split into a post and continuation replies. Defaults to the server limit, so the messages the server would reject are split instead")
+	TransformSlackCmd.Flags().Bool("strict-parse", false, "Fails if the channels, users or posts files of the export have missing or mistyped fields")
+	TransformSlackCmd.Flags().Bool("skip-corrupt", false, "Skips the channel posts files that can't be parsed instead of failing. The skipped files are listed in the log")
+	TransformSlackCmd.Flags().String("channel-name-map-file", "", "A CSV file with the name of a public or private channel in Slack and its new name in Mattermost per row, to rename channels in bulk. The new names are used as is, without --channel-name-prefix")
+	TransformSlackCmd.Flags().StringArray("rename-user", []string{}, "Renames a Slack user in the import, in the form old=new. Can be used multiple times")
+	TransformSlackCmd.Flags().Bool("namespace-grid-usernames", false, "Appends the workspace id to the usernames that different users of an Enterprise Grid export share, so they remain distinct users if the imports of several workspaces are merged")
+	TransformSlackCmd.Flags().Bool("normalize-usernames", false, "Turns the usernames that aren't valid in Mattermost into valid ones, lowercasing them and removing the invalid characters. Clashing usernames are numbered")
+	TransformSlackCmd.Flags().Bool("expand-usergroups", false, "Replaces the mentions of user groups with the mentions of their members, using the usergroups.json file of the export")
+	TransformSlackCmd.Flags().Bool("include-file-urls", false, "Adds a link to the Slack file to the message of the post when the file itself can't be imported")
+	TransformSlackCmd.Flags().String("archive-dead-dms", "", "The name of a private channel to move the direct messages between deleted users to, as those direct channels can't be imported. Requires --archive-dead-dms-admin")
+	TransformSlackCmd.Flags().String("archive-dead-dms-admin", "", "The username of the active user that owns the channel of --archive-dead-dms, and the only one able to read it at first")
+	TransformSlackCmd.Flags().String("dm-mode", dmModeDirect, "How to import the direct and group messages. Can be \"direct\" to import them as direct channels, \"archive\" to import each conversation as a private channel of its members, for servers that don't allow importing direct messages, or \"skip\" to leave them out")
+	TransformSlackCmd.Flags().String("placeholder-seed", "", "A seed to derive the passwords of the placeholder users from, so they are the same across runs over the same export")
+	TransformSlackCmd.Flags().String("skip-channels-without-posts-since", "", "Skips the public and private channels without posts since a date, such as 2023-01-31, or for a duration, such as 720h or 365d")
+	TransformSlackCmd.Flags().Bool("keep-empty-channels", true, "Whether to import the public and private channels that have no posts and no members")
+	TransformSlackCmd.Flags().StringArray("team-from-channel-prefix", []string{}, "Imports the public and private channels whose Slack name starts with a prefix into another team, in the form prefix=team. The teams are created by the import and the users join the teams of their channels. Can be used multiple times")
+	TransformSlackCmd.Flags().StringSlice("channel-only-by-id", []string{}, "Imports only the channels with these Slack ids, such as C024BE91L, and their posts. Ids don't change when a channel is renamed. Can be a comma separated list or used multiple times")
+	TransformSlackCmd.Flags().StringArray("channel-type", []string{}, "Overrides the type of a public or private Slack channel, in the form name=O for public or name=P for private. Can be used multiple times")
+	TransformSlackCmd.Flags().String("channel-purpose-prefix", "", "Text to add before the purpose of every public and private channel, such as \"[Imported from Slack]\"")
+	TransformSlackCmd.Flags().String("channel-purpose-suffix", "", "Text to add after the purpose of every public and private channel")
+	TransformSlackCmd.Flags().Bool("channel-members-from-posts", false, "Adds the users that posted in each public and private channel to its members, for partial exports whose member lists are incomplete")
+	TransformSlackCmd.Flags().Bool("channel-header-from-purpose", false, "Uses the purpose of the public and private channels without a topic as their header")
+	TransformSlackCmd.Flags().String("channel-name-prefix", "", "A prefix to add to the name of every public and private channel, to avoid clashes with existing channels in the team")
+	TransformSlackCmd.Flags().StringArray("team-from-slack-team", []string{}, "Imports the public and private channels of an Enterprise Grid export into another team by the Slack workspace their posts belong to, in the form workspace-id=team, such as T024BE7LD=engineering. The workspace of a channel is the one most of its posts carry, and channels without a clear one are logged. Can be used multiple times")
+	TransformSlackCmd.Flags().Bool("fail-on-warning", false, "Fails the transformation after writing the output if any data-quality warning was logged")
+	TransformSlackCmd.Flags().StringSlice("fail-on-warning-categories", []string{}, "Restricts --fail-on-warning to the given warning categories. Valid values: truncation, placeholder, file, unsupported, corrupt, other")
+	TransformSlackCmd.Flags().String("progress-json", "", "A file to append the progress of the transformation to, as a JSON object per line with the phase, the done and total items and a timestamp, for tools that wrap the command. Use fd:N to write to an open file descriptor instead")
 	TransformSlackCmd.Flags().Bool("debug", false, "Whether to show debug logs or not")
 
 	TransformCmd.AddCommand(
@@ -61,16 +180,312 @@ func init() {
 func transformSlackCmdF(cmd *cobra.Command, args []string) error {
 	team, _ := cmd.Flags().GetString("team")
 	inputFilePath, _ := cmd.Flags().GetString("file")
+	mergeExportDir, _ := cmd.Flags().GetString("merge-export-dir")
 	outputFilePath, _ := cmd.Flags().GetString("output")
+	outputFormat, _ := cmd.Flags().GetString("output-format")
 	attachmentsDir, _ := cmd.Flags().GetString("attachments-dir")
+	attachmentsLayout, _ := cmd.Flags().GetString("attachments-layout")
+	timezone, _ := cmd.Flags().GetString("timezone")
 	skipConvertPosts, _ := cmd.Flags().GetBool("skip-convert-posts")
 	skipAttachments, _ := cmd.Flags().GetBool("skip-attachments")
+	usersFile, _ := cmd.Flags().GetString("users-file")
+	authService, _ := cmd.Flags().GetString("auth-service")
+	authDataFile, _ := cmd.Flags().GetString("auth-data-file")
+	replaceMentionsFile, _ := cmd.Flags().GetString("replace-mentions-file")
+	quoteBroadcastMentions, _ := cmd.Flags().GetBool("quote-broadcast-mentions")
 	skipEmptyEmails, _ := cmd.Flags().GetBool("skip-empty-emails")
 	defaultEmailDomain, _ := cmd.Flags().GetString("default-email-domain")
+	noDefaultEmailExit, _ := cmd.Flags().GetBool("no-default-email-exit")
 	allowDownload, _ := cmd.Flags().GetBool("allow-download")
+	preferThumbnails, _ := cmd.Flags().GetBool("prefer-thumbnails")
+	thumbnailsReport, _ := cmd.Flags().GetString("thumbnails-report")
+	attachmentURLTemplate, _ := cmd.Flags().GetString("attachment-url-template")
+	slackToken, _ := cmd.Flags().GetString("slack-token")
+	importCategories, _ := cmd.Flags().GetBool("import-categories")
+	onlyActiveUsers, _ := cmd.Flags().GetBool("only-active-users")
+	checkpointFile, _ := cmd.Flags().GetString("checkpoint")
+	parseOnly, _ := cmd.Flags().GetBool("parse-only")
+	transformHook, _ := cmd.Flags().GetString("transform-hook")
+	linkCanvases, _ := cmd.Flags().GetBool("link-canvases")
+	attachmentBaseURL, _ := cmd.Flags().GetString("attachment-base-url")
+	attachmentManifest, _ := cmd.Flags().GetString("attachment-manifest")
+	sanitizeReport, _ := cmd.Flags().GetString("sanitize-report")
+	placeholderReport, _ := cmd.Flags().GetString("placeholder-report")
+	exportUsersCSV, _ := cmd.Flags().GetString("export-users-csv")
+	attachmentsSizeLimitValue, _ := cmd.Flags().GetString("limit-attachments-total-size")
+	skippedAttachmentsReport, _ := cmd.Flags().GetString("skipped-attachments-report")
+	hashUsernames, _ := cmd.Flags().GetBool("hash-usernames")
+	hashSalt, _ := cmd.Flags().GetString("hash-salt")
+	hashEmails, _ := cmd.Flags().GetBool("hash-emails")
+	deadUserPosts, _ := cmd.Flags().GetString("dead-user-posts")
+	excludeBots, _ := cmd.Flags().GetBool("exclude-bots")
+	botThreadReplies, _ := cmd.Flags().GetString("bot-thread-replies")
+	orphanReplies, _ := cmd.Flags().GetString("orphan-replies")
+	dropEmptyThreads, _ := cmd.Flags().GetBool("drop-empty-threads")
+	summarizeReminders, _ := cmd.Flags().GetBool("summarize-reminders")
+	truncationNote, _ := cmd.Flags().GetBool("include-free-tier-truncation-note")
+	seedContextPost, _ := cmd.Flags().GetBool("seed-context-post")
 	discardInvalidProps, _ := cmd.Flags().GetBool("discard-invalid-props")
+	spreadReactionTimestamps, _ := cmd.Flags().GetBool("spread-reaction-timestamps")
+	preserveTimestampPrecision, _ := cmd.Flags().GetBool("preserve-ts-precision")
+	concurrentChannels, _ := cmd.Flags().GetInt("concurrent-channels")
+	minMembers, _ := cmd.Flags().GetInt("min-members")
+	postLimit, _ := cmd.Flags().GetInt("post-limit")
+	reactionUsersLimit, _ := cmd.Flags().GetInt("reaction-users-limit")
+	threadReplyLimit, _ := cmd.Flags().GetInt("thread-reply-limit")
+	utf8Normalize, _ := cmd.Flags().GetString("utf8-normalize")
+	keepEmptyChannels, _ := cmd.Flags().GetBool("keep-empty-channels")
+	skipChannelsWithoutPostsSince, _ := cmd.Flags().GetString("skip-channels-without-posts-since")
+	archiveDeadDMs, _ := cmd.Flags().GetString("archive-dead-dms")
+	archiveDeadDMsAdmin, _ := cmd.Flags().GetString("archive-dead-dms-admin")
+	dmMode, _ := cmd.Flags().GetString("dm-mode")
+	placeholderSeed, _ := cmd.Flags().GetString("placeholder-seed")
+	maxMessageLength, _ := cmd.Flags().GetInt("max-message-length")
+	mergeConsecutiveMessages, _ := cmd.Flags().GetDuration("merge-consecutive-messages")
+	messagePrefixTemplate, _ := cmd.Flags().GetString("message-prefix-template")
+	sortChannels, _ := cmd.Flags().GetString("sort-channels")
+	postCreateAtOffset, _ := cmd.Flags().GetDuration("post-create-at-offset")
+	fileCaption, _ := cmd.Flags().GetString("file-caption")
+	huddleWithoutRoom, _ := cmd.Flags().GetString("huddle-without-room")
+	channelTopicHistory, _ := cmd.Flags().GetBool("channel-topic-history")
+	serverURL, _ := cmd.Flags().GetString("validate-usernames-against-server")
+	serverToken, _ := cmd.Flags().GetString("server-token")
+	strictParse, _ := cmd.Flags().GetBool("strict-parse")
+	skipCorrupt, _ := cmd.Flags().GetBool("skip-corrupt")
+	renameUsers, _ := cmd.Flags().GetStringArray("rename-user")
+	channelNameMapFile, _ := cmd.Flags().GetString("channel-name-map-file")
+	normalizeUsernames, _ := cmd.Flags().GetBool("normalize-usernames")
+	namespaceGridUsernames, _ := cmd.Flags().GetBool("namespace-grid-usernames")
+	expandUserGroups, _ := cmd.Flags().GetBool("expand-usergroups")
+	includeFileURLs, _ := cmd.Flags().GetBool("include-file-urls")
+	channelNamePrefix, _ := cmd.Flags().GetString("channel-name-prefix")
+	channelMembersFromPosts, _ := cmd.Flags().GetBool("channel-members-from-posts")
+	channelHeaderFromPurpose, _ := cmd.Flags().GetBool("channel-header-from-purpose")
+	channelPurposePrefix, _ := cmd.Flags().GetString("channel-purpose-prefix")
+	channelPurposeSuffix, _ := cmd.Flags().GetString("channel-purpose-suffix")
+	channelTypeOverrides, _ := cmd.Flags().GetStringArray("channel-type")
+	channelPrefixTeamMappings, _ := cmd.Flags().GetStringArray("team-from-channel-prefix")
+	slackTeamMappings, _ := cmd.Flags().GetStringArray("team-from-slack-team")
+	failOnWarning, _ := cmd.Flags().GetBool("fail-on-warning")
+	progressJSON, _ := cmd.Flags().GetString("progress-json")
+	failOnWarningCategories, _ := cmd.Flags().GetStringSlice("fail-on-warning-categories")
+	channelOnlyById, _ := cmd.Flags().GetStringSlice("channel-only-by-id")
 	debug, _ := cmd.Flags().GetBool("debug")
 
+	warningCategories, err := parseWarningCategories(failOnWarningCategories)
+	if err != nil {
+		return err
+	}
+
+	if outputFormat != outputFormatBulk && outputFormat != outputFormatMmctl {
+		return fmt.Errorf("Invalid output format \"%s\", it should be either \"%s\" or \"%s\"", outputFormat, outputFormatBulk, outputFormatMmctl)
+	}
+
+	if attachmentsLayout != attachmentsLayoutFlat && attachmentsLayout != attachmentsLayoutByDate {
+		return fmt.Errorf("Invalid attachments layout \"%s\", it should be either \"%s\" or \"%s\"", attachmentsLayout, attachmentsLayoutFlat, attachmentsLayoutByDate)
+	}
+
+	if attachmentBaseURL != "" {
+		if u, parseErr := url.Parse(attachmentBaseURL); parseErr != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid attachment base URL \"%s\", it should be an http or https URL", attachmentBaseURL)
+		}
+	}
+
+	if attachmentURLTemplate != "" {
+		if !allowDownload {
+			return fmt.Errorf("The --attachment-url-template flag can only be used along with --allow-download")
+		}
+		if u, parseErr := url.Parse(attachmentURLTemplate); parseErr != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid attachment URL template \"%s\", it should be an http or https URL", attachmentURLTemplate)
+		}
+		if !strings.Contains(attachmentURLTemplate, "{id}") {
+			return fmt.Errorf("Invalid attachment URL template \"%s\", it should contain the {id} placeholder", attachmentURLTemplate)
+		}
+	}
+
+	var attachmentsSizeLimit int64
+	if attachmentsSizeLimitValue != "" {
+		if attachmentsSizeLimit, err = parseSize(attachmentsSizeLimitValue); err != nil {
+			return err
+		}
+	}
+
+	if serverURL != "" && serverToken == "" {
+		return fmt.Errorf("The --server-token flag is required along with --validate-usernames-against-server")
+	}
+
+	if slackToken != "" && attachmentURLTemplate == "" {
+		return fmt.Errorf("The --slack-token flag can only be used along with --attachment-url-template")
+	}
+
+	if utf8.RuneCountInString(channelPurposePrefix)+utf8.RuneCountInString(channelPurposeSuffix) >= model.ChannelPurposeMaxRunes {
+		return fmt.Errorf("The channel purpose prefix and suffix must be shorter than %d characters together", model.ChannelPurposeMaxRunes)
+	}
+
+	if hashUsernames && hashSalt == "" {
+		return fmt.Errorf("The --hash-salt flag is required when --hash-usernames is set")
+	}
+
+	if hashEmails && !hashUsernames {
+		return fmt.Errorf("The --hash-emails flag can only be used along with --hash-usernames")
+	}
+
+	if deadUserPosts != deadUserPostsPlaceholder && deadUserPosts != deadUserPostsDrop {
+		return fmt.Errorf("Invalid dead user posts policy \"%s\", it should be either \"%s\" or \"%s\"", deadUserPosts, deadUserPostsPlaceholder, deadUserPostsDrop)
+	}
+
+	if botThreadReplies != botThreadRepliesReparent && botThreadReplies != botThreadRepliesDrop {
+		return fmt.Errorf("Invalid bot thread replies policy \"%s\", it should be either \"%s\" or \"%s\"", botThreadReplies, botThreadRepliesReparent, botThreadRepliesDrop)
+	}
+
+	if orphanReplies != orphanRepliesDrop && orphanReplies != orphanRepliesPromote {
+		return fmt.Errorf("Invalid orphan replies policy \"%s\", it should be either \"%s\" or \"%s\"", orphanReplies, orphanRepliesDrop, orphanRepliesPromote)
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return fmt.Errorf("Invalid timezone \"%s\": %w", timezone, err)
+	}
+
+	var staleChannelsCutoff time.Time
+	if skipChannelsWithoutPostsSince != "" {
+		if staleChannelsCutoff, err = parseCutoff(skipChannelsWithoutPostsSince, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	if concurrentChannels < 1 {
+		return fmt.Errorf("Concurrent channels must be at least 1, got %d", concurrentChannels)
+	}
+
+	if minMembers < 2 {
+		return fmt.Errorf("Min members must be at least 2, got %d", minMembers)
+	}
+
+	if postLimit < 0 {
+		return fmt.Errorf("Post limit must not be negative, got %d", postLimit)
+	}
+
+	if _, ok := slack.NormalizationForms[utf8Normalize]; utf8Normalize != "" && !ok {
+		return fmt.Errorf("Invalid normalization form %q, it must be one of nfc, nfd, nfkc or nfkd", utf8Normalize)
+	}
+
+	if threadReplyLimit < 0 {
+		return fmt.Errorf("Thread reply limit must not be negative, got %d", threadReplyLimit)
+	}
+
+	if reactionUsersLimit < 0 {
+		return fmt.Errorf("Reaction users limit must not be negative, got %d", reactionUsersLimit)
+	}
+
+	if dmMode != dmModeDirect && dmMode != dmModeArchive && dmMode != dmModeSkip {
+		return fmt.Errorf("Invalid DM mode \"%s\", it should be \"%s\", \"%s\" or \"%s\"", dmMode, dmModeDirect, dmModeArchive, dmModeSkip)
+	}
+
+	if archiveDeadDMs != "" && !slack.IsValidChannelName(archiveDeadDMs) {
+		return fmt.Errorf("Archive channel name \"%s\" can only contain alphanumeric characters, dashes and underscores", archiveDeadDMs)
+	}
+
+	if archiveDeadDMs != "" && archiveDeadDMsAdmin == "" {
+		return fmt.Errorf("The --archive-dead-dms flag requires --archive-dead-dms-admin to own the archive channel")
+	}
+
+	if archiveDeadDMsAdmin != "" && archiveDeadDMs == "" {
+		return fmt.Errorf("The --archive-dead-dms-admin flag can only be used along with --archive-dead-dms")
+	}
+
+	if err = slack.ValidateMaxMessageLength(maxMessageLength); err != nil {
+		return err
+	}
+
+	if err = slack.ValidateMessagePrefixTemplate(messagePrefixTemplate); err != nil {
+		return err
+	}
+
+	if fileCaption != slack.FileCaptionNone && fileCaption != slack.FileCaptionFilename && fileCaption != slack.FileCaptionTitle {
+		return fmt.Errorf("Invalid file caption \"%s\", it should be \"%s\", \"%s\" or \"%s\"", fileCaption, slack.FileCaptionNone, slack.FileCaptionFilename, slack.FileCaptionTitle)
+	}
+
+	if huddleWithoutRoom != slack.HuddleWithoutRoomImport && huddleWithoutRoom != slack.HuddleWithoutRoomSkip {
+		return fmt.Errorf("Invalid huddle handling \"%s\", it should be \"%s\" or \"%s\"", huddleWithoutRoom, slack.HuddleWithoutRoomImport, slack.HuddleWithoutRoomSkip)
+	}
+
+	if sortChannels != "" && sortChannels != slack.ChannelSortName && sortChannels != slack.ChannelSortCreated && sortChannels != slack.ChannelSortPosts {
+		return fmt.Errorf("Invalid channel order \"%s\", it should be \"%s\", \"%s\" or \"%s\"", sortChannels, slack.ChannelSortName, slack.ChannelSortCreated, slack.ChannelSortPosts)
+	}
+
+	if mergeConsecutiveMessages < 0 {
+		return fmt.Errorf("The merge window can't be negative, got %s", mergeConsecutiveMessages)
+	}
+
+	userRenames, err := parseRenames(renameUsers)
+	if err != nil {
+		return err
+	}
+
+	var channelRenames map[string]string
+	if channelNameMapFile != "" {
+		if channelRenames, err = readChannelNameMapFile(channelNameMapFile); err != nil {
+			return err
+		}
+	}
+
+	var userEmails map[string]string
+	if usersFile != "" {
+		if userEmails, err = readUserEmailsFile(usersFile); err != nil {
+			return err
+		}
+	}
+
+	if authService != "" && !isValidAuthService(authService) {
+		return fmt.Errorf("Invalid auth service %q", authService)
+	}
+
+	var userAuth map[string]slack.UserAuth
+	if authDataFile != "" {
+		if userAuth, err = readUserAuthFile(authDataFile); err != nil {
+			return err
+		}
+		for user, auth := range userAuth {
+			if auth.Service != "" && !isValidAuthService(auth.Service) {
+				return fmt.Errorf("Invalid auth service %q for the user %s in the auth data file", auth.Service, user)
+			}
+		}
+	}
+
+	var checkpoint *slack.Checkpoint
+	if checkpointFile != "" {
+		if checkpoint, err = slack.LoadCheckpoint(checkpointFile); err != nil {
+			return err
+		}
+	}
+
+	var mentionReplacements []slack.MentionReplacement
+	if replaceMentionsFile != "" {
+		if mentionReplacements, err = readMentionReplacementsFile(replaceMentionsFile); err != nil {
+			return err
+		}
+	}
+
+	if channelNamePrefix != "" && !slack.IsValidChannelNamePrefix(channelNamePrefix) {
+		return fmt.Errorf("Channel name prefix \"%s\" can only contain alphanumeric characters, dashes and underscores", channelNamePrefix)
+	}
+
+	channelTypes, err := parseChannelTypes(channelTypeOverrides)
+	if err != nil {
+		return err
+	}
+
+	channelPrefixTeams, err := parseChannelPrefixTeams(channelPrefixTeamMappings)
+	if err != nil {
+		return err
+	}
+
+	slackTeamTeams, err := parseSlackTeamTeams(slackTeamMappings)
+	if err != nil {
+		return err
+	}
+
 	// output file
 	if fileInfo, err := os.Stat(outputFilePath); err != nil && !os.IsNotExist(err) {
 		return err
@@ -81,7 +496,11 @@ func transformSlackCmdF(cmd *cobra.Command, args []string) error {
 	// attachments dir
 	attachmentsFullDir := path.Join(attachmentsDir, attachmentsInternal)
 
-	if !skipAttachments {
+	if !skipAttachments && !parseOnly {
+		if err := validateAttachmentsDir(attachmentsDir, outputFilePath); err != nil {
+			return err
+		}
+
 		if fileInfo, err := os.Stat(attachmentsFullDir); os.IsNotExist(err) {
 			if createErr := os.MkdirAll(attachmentsFullDir, 0755); createErr != nil {
 				return createErr
@@ -93,21 +512,32 @@ func transformSlackCmdF(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// input file
-	fileReader, err := os.Open(inputFilePath)
-	if err != nil {
-		return err
+	// input files
+	inputFilePaths := []string{inputFilePath}
+	if mergeExportDir != "" {
+		if inputFilePaths, err = exportFilesInDir(mergeExportDir); err != nil {
+			return err
+		}
 	}
-	defer fileReader.Close()
 
-	zipFileInfo, err := fileReader.Stat()
-	if err != nil {
-		return err
-	}
+	zipReaders := []*zip.Reader{}
+	for _, inputFilePath := range inputFilePaths {
+		fileReader, err := os.Open(inputFilePath)
+		if err != nil {
+			return err
+		}
+		defer fileReader.Close()
 
-	zipReader, err := zip.NewReader(fileReader, zipFileInfo.Size())
-	if err != nil || zipReader.File == nil {
-		return err
+		zipFileInfo, err := fileReader.Stat()
+		if err != nil {
+			return err
+		}
+
+		zipReader, err := zip.NewReader(fileReader, zipFileInfo.Size())
+		if err != nil || zipReader.File == nil {
+			return err
+		}
+		zipReaders = append(zipReaders, zipReader)
 	}
 
 	logger := log.New()
@@ -125,10 +555,120 @@ func transformSlackCmdF(cmd *cobra.Command, args []string) error {
 		logger.Info("Debug mode enabled")
 	}
 	slackTransformer := slack.NewTransformer(team, logger)
+	if progressJSON != "" {
+		progressFile, err := openProgressFile(progressJSON)
+		if err != nil {
+			return err
+		}
+		defer progressFile.Close()
+		slackTransformer.Options.Progress = slack.JSONProgressWriter(progressFile)
+	}
+	slackTransformer.Options.SpreadReactionTimestamps = spreadReactionTimestamps
+	slackTransformer.Options.ReactionUsersLimit = reactionUsersLimit
+	slackTransformer.Options.ThreadReplyLimit = threadReplyLimit
+	slackTransformer.Options.UTF8Normalization = utf8Normalize
+	slackTransformer.Options.PreserveTimestampPrecision = preserveTimestampPrecision
+	slackTransformer.Options.ChannelNamePrefix = channelNamePrefix
+	slackTransformer.Options.ChannelHeaderFromPurpose = channelHeaderFromPurpose
+	slackTransformer.Options.ChannelMembersFromPosts = channelMembersFromPosts
+	slackTransformer.Options.ChannelPurposePrefix = channelPurposePrefix
+	slackTransformer.Options.ChannelPurposeSuffix = channelPurposeSuffix
+	slackTransformer.Options.ChannelTypes = channelTypes
+	slackTransformer.Options.ChannelPrefixTeams = channelPrefixTeams
+	slackTransformer.Options.SlackTeamTeams = slackTeamTeams
+	slackTransformer.Options.IncludeFileURLs = includeFileURLs
+	slackTransformer.Options.PreferThumbnails = preferThumbnails
+	slackTransformer.Options.AttachmentURLTemplate = attachmentURLTemplate
+	slackTransformer.Options.SlackToken = slackToken
+	slackTransformer.Options.ImportCategories = importCategories
+	slackTransformer.Options.OnlyActiveUsers = onlyActiveUsers
+	slackTransformer.Options.DropInactiveUserPosts = deadUserPosts == deadUserPostsDrop
+	slackTransformer.Options.SkipUsersWithoutEmail = noDefaultEmailExit
+	slackTransformer.Options.ExcludeBots = excludeBots
+	slackTransformer.Options.DropBotThreadReplies = botThreadReplies == botThreadRepliesDrop
+	slackTransformer.Options.PromoteOrphanReplies = orphanReplies == orphanRepliesPromote
+	slackTransformer.Options.DropEmptyThreads = dropEmptyThreads
+	slackTransformer.Options.SummarizeReminders = summarizeReminders
+	slackTransformer.Options.ChannelTopicHistory = channelTopicHistory
+	slackTransformer.Options.TruncationNote = truncationNote
+	slackTransformer.Options.SeedContextPost = seedContextPost
+	slackTransformer.Options.Checkpoint = checkpoint
+	slackTransformer.Options.LinkCanvases = linkCanvases
+	slackTransformer.Options.AttachmentsSizeLimit = attachmentsSizeLimit
+	slackTransformer.Options.AttachmentBaseURL = attachmentBaseURL
+	slackTransformer.Options.HashUsernames = hashUsernames
+	slackTransformer.Options.HashSalt = hashSalt
+	slackTransformer.Options.HashEmails = hashEmails
+	slackTransformer.Options.SkipCorruptFiles = skipCorrupt
+	slackTransformer.Options.StrictParse = strictParse
+	slackTransformer.Options.MaxMessageLength = maxMessageLength
+	slackTransformer.Options.MergeConsecutiveMessages = mergeConsecutiveMessages
+	slackTransformer.Options.MessagePrefixTemplate = messagePrefixTemplate
+	slackTransformer.Options.SortChannels = sortChannels
+	slackTransformer.Options.PostCreateAtOffset = postCreateAtOffset
+	slackTransformer.Options.FileCaption = fileCaption
+	slackTransformer.Options.HuddleWithoutRoom = huddleWithoutRoom
+	slackTransformer.Options.ConcurrentChannels = concurrentChannels
+	slackTransformer.Options.MinMembers = minMembers
+	slackTransformer.Options.PostLimit = postLimit
+	slackTransformer.Options.ChannelOnlyById = channelOnlyById
+	slackTransformer.Options.DiscardEmptyChannels = !keepEmptyChannels
+	slackTransformer.Options.SkipChannelsWithoutPostsSince = staleChannelsCutoff
+	slackTransformer.Options.ArchiveDeadDMs = archiveDeadDMs
+	slackTransformer.Options.ArchiveDeadDMsAdmin = archiveDeadDMsAdmin
+	slackTransformer.Options.ArchiveDirectChannels = dmMode == dmModeArchive
+	slackTransformer.Options.SkipDirectChannels = dmMode == dmModeSkip
+	slackTransformer.Options.PlaceholderSeed = placeholderSeed
+	slackTransformer.Options.AttachmentsByDate = attachmentsLayout == attachmentsLayoutByDate
+	slackTransformer.Options.Location = location
+	slackTransformer.Options.ExpandUserGroups = expandUserGroups
+	slackTransformer.Options.UserRenames = userRenames
+	slackTransformer.Options.ChannelRenames = channelRenames
+	slackTransformer.Options.NormalizeUsernames = normalizeUsernames
+	slackTransformer.Options.NamespaceGridUsernames = namespaceGridUsernames
+	slackTransformer.Options.UserEmails = userEmails
+	slackTransformer.Options.AuthService = authService
+	slackTransformer.Options.UserAuth = userAuth
+	slackTransformer.Options.MentionReplacements = mentionReplacements
+	slackTransformer.Options.QuoteBroadcastMentions = quoteBroadcastMentions
 
-	slackExport, err := slackTransformer.ParseSlackExportFile(zipReader, skipConvertPosts)
-	if err != nil {
-		return err
+	slackExports := []*slack.SlackExport{}
+	for i, zipReader := range zipReaders {
+		if len(zipReaders) > 1 {
+			slackTransformer.Logger.Infof("Parsing the export %s", inputFilePaths[i])
+		}
+		// merged exports are converted once merged, so the mentions of
+		// duplicated users point to the user kept
+		slackExport, err := slackTransformer.ParseSlackExportFile(zipReader, skipConvertPosts || mergeExportDir != "")
+		if err != nil {
+			return err
+		}
+		slackExports = append(slackExports, slackExport)
+	}
+	slackExport := slackExports[0]
+	if mergeExportDir != "" {
+		slackExport = slackTransformer.MergeSlackExports(slackExports)
+		if !skipConvertPosts {
+			slackTransformer.ConvertSlackExportPosts(slackExport)
+		}
+	}
+
+	if parseOnly {
+		if err = writeParsedExport(slackExport, outputFilePath); err != nil {
+			return err
+		}
+		slackTransformer.Logger.Info("Parsed export written to " + outputFilePath)
+		return nil
+	}
+
+	if team == "" {
+		team = slack.TeamNameFromWorkspace(slackExport.Workspace)
+		if team == "" {
+			return fmt.Errorf("The export doesn't include a valid workspace name, please provide the team with --team")
+		}
+		slackTransformer.Logger.Infof("Using the team %s from the workspace name in the export", team)
+		slackTransformer.TeamName = team
+		slackExport.TeamName = team
 	}
 
 	err = slackTransformer.Transform(slackExport, attachmentsDir, skipAttachments, discardInvalidProps, allowDownload, skipEmptyEmails, defaultEmailDomain)
@@ -136,15 +676,421 @@ func transformSlackCmdF(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	if err = slackTransformer.Export(outputFilePath); err != nil {
+	if transformHook != "" {
+		if err = slackTransformer.RunTransformHook(transformHook); err != nil {
+			return err
+		}
+	}
+
+	if serverURL != "" {
+		client := model.NewAPIv4Client(serverURL)
+		client.SetToken(serverToken)
+		conflicts, err := slackTransformer.CheckUsersAgainstServer(context.Background(), client)
+		if err != nil {
+			return err
+		}
+		slackTransformer.Logger.Infof("Found %d usernames and emails already taken on the server", len(conflicts))
+	}
+
+	if outputFormat == outputFormatMmctl {
+		err = slackTransformer.ExportZip(outputFilePath, attachmentsDir)
+	} else {
+		err = slackTransformer.Export(outputFilePath)
+	}
+	if err != nil {
 		return err
 	}
 
+	if preferThumbnails {
+		if err = writeThumbnailsReport(slackTransformer, thumbnailsReport); err != nil {
+			return err
+		}
+	}
+
+	if attachmentBaseURL != "" {
+		if err = writeAttachmentManifest(slackTransformer, attachmentManifest); err != nil {
+			return err
+		}
+	}
+
+	if sanitizeReport != "" {
+		if err = writeSanitizeReport(slackTransformer, sanitizeReport); err != nil {
+			return err
+		}
+	}
+
+	if placeholderReport != "" {
+		if err = writePlaceholderReport(slackTransformer, slackExport, placeholderReport); err != nil {
+			return err
+		}
+	}
+
+	if exportUsersCSV != "" {
+		if err = writeUsersCSV(slackTransformer, exportUsersCSV); err != nil {
+			return err
+		}
+	}
+
+	if attachmentsSizeLimit > 0 {
+		if err = writeSkippedAttachmentsReport(slackTransformer, skippedAttachmentsReport); err != nil {
+			return err
+		}
+	}
+
+	if checkpointFile != "" {
+		if err = os.Remove(checkpointFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if failOnWarning {
+		if count := slackTransformer.WarningCount(warningCategories...); count > 0 {
+			return fmt.Errorf("Transformation finished with %d warnings and --fail-on-warning is set. Check transform-slack.log for details", count)
+		}
+	}
+
 	slackTransformer.Logger.Info("Transformation succeeded!")
 
 	return nil
 }
 
+func writeParsedExport(slackExport *slack.SlackExport, outputPath string) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(slackExport); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeThumbnailsReport(slackTransformer *slack.Transformer, reportPath string) error {
+	file, err := os.Create(reportPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := slack.WriteDownloadedFilesReport(file, slackTransformer.DownloadedFiles()); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeAttachmentManifest(slackTransformer *slack.Transformer, manifestPath string) error {
+	file, err := os.Create(manifestPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := slackTransformer.WriteAttachmentManifest(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeSanitizeReport(slackTransformer *slack.Transformer, reportPath string) error {
+	file, err := os.Create(reportPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := slack.WriteSanitizeReport(file, slackTransformer.SanitizeChanges()); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeUsersCSV(slackTransformer *slack.Transformer, csvPath string) error {
+	file, err := os.Create(csvPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := slackTransformer.ExportUsersCSV(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writePlaceholderReport(slackTransformer *slack.Transformer, slackExport *slack.SlackExport, reportPath string) error {
+	file, err := os.Create(reportPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := slack.WritePlaceholderReport(file, slackTransformer.PlaceholderUsers(slackExport.Posts)); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeSkippedAttachmentsReport(slackTransformer *slack.Transformer, reportPath string) error {
+	file, err := os.Create(reportPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := slack.WriteSkippedAttachmentsReport(file, slackTransformer.SkippedAttachments()); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// sizeSuffixes are the multipliers of the suffixes accepted by parseSize.
+var sizeSuffixes = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+}
+
+// parseSize parses a positive size in bytes, optionally with a binary
+// suffix such as MiB.
+func parseSize(value string) (int64, error) {
+	number, multiplier := value, int64(1)
+	for _, s := range sizeSuffixes {
+		if strings.HasSuffix(value, s.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(value, s.suffix)), s.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size <= 0 || size > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("Invalid size \"%s\", it should be a positive number of bytes, optionally followed by KiB, MiB, GiB or TiB", value)
+	}
+	return size * multiplier, nil
+}
+
+func readUserEmailsFile(usersFile string) (map[string]string, error) {
+	file, err := os.Open(usersFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return slack.ParseUserEmailsFile(file)
+}
+
+// exportFilesInDir returns the paths of the zip files of a directory,
+// sorted by name.
+func exportFilesInDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".zip") {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("The directory \"%s\" has no Slack export zip files", dir)
+	}
+	return paths, nil
+}
+
+// openProgressFile opens the file to append the progress events to, or
+// the file descriptor N if the value is fd:N.
+func openProgressFile(value string) (*os.File, error) {
+	if fd, ok := strings.CutPrefix(value, "fd:"); ok {
+		n, err := strconv.Atoi(fd)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid progress file descriptor %q", fd)
+		}
+		return os.NewFile(uintptr(n), "progress"), nil
+	}
+	return os.OpenFile(value, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+func readChannelNameMapFile(channelNameMapFile string) (map[string]string, error) {
+	file, err := os.Open(channelNameMapFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return slack.ParseChannelNameMapFile(file)
+}
+
+func readUserAuthFile(authDataFile string) (map[string]slack.UserAuth, error) {
+	file, err := os.Open(authDataFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return slack.ParseUserAuthFile(file)
+}
+
+// isValidAuthService reports whether service is an authentication service
+// users can be imported with.
+func isValidAuthService(service string) bool {
+	switch service {
+	case model.UserAuthServiceEmail, model.UserAuthServiceGitlab, model.UserAuthServiceLdap, model.UserAuthServiceSaml, model.ServiceGoogle, model.ServiceOffice365:
+		return true
+	}
+	return false
+}
+
+func readMentionReplacementsFile(replaceMentionsFile string) ([]slack.MentionReplacement, error) {
+	file, err := os.Open(replaceMentionsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return slack.ParseMentionReplacementsFile(file)
+}
+
+// parseCutoff parses a date in the form YYYY-MM-DD, or a duration before
+// now. Durations accept a "d" suffix for days besides the units of
+// time.ParseDuration.
+func parseCutoff(value string, now time.Time) (time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date, nil
+	}
+
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return time.Time{}, fmt.Errorf("Invalid date or duration \"%s\", it should be a date like 2023-01-31 or a duration like 720h or 365d", value)
+	}
+	return now.Add(-duration), nil
+}
+
+// parseRenames parses a list of old=new pairs.
+func parseRenames(renames []string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, rename := range renames {
+		oldName, newName, found := strings.Cut(rename, "=")
+		if !found || oldName == "" || newName == "" {
+			return nil, fmt.Errorf("Invalid rename \"%s\", it should be in the form old=new", rename)
+		}
+		if _, ok := result[oldName]; ok {
+			return nil, fmt.Errorf("\"%s\" is renamed more than once", oldName)
+		}
+		result[oldName] = newName
+	}
+	return result, nil
+}
+
+// parseChannelTypes parses a list of name=type pairs, where the type is O
+// for public channels or P for private ones.
+func parseChannelTypes(overrides []string) (map[string]model.ChannelType, error) {
+	result := map[string]model.ChannelType{}
+	for _, override := range overrides {
+		name, channelType, found := strings.Cut(override, "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("Invalid channel type \"%s\", it should be in the form name=O or name=P", override)
+		}
+		if channelType != string(model.ChannelTypeOpen) && channelType != string(model.ChannelTypePrivate) {
+			return nil, fmt.Errorf("Invalid channel type \"%s\" for channel %s, it should be O or P", channelType, name)
+		}
+		if _, ok := result[name]; ok {
+			return nil, fmt.Errorf("The type of channel %s is overridden more than once", name)
+		}
+		result[name] = model.ChannelType(channelType)
+	}
+	return result, nil
+}
+
+func parseChannelPrefixTeams(mappings []string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, mapping := range mappings {
+		prefix, team, found := strings.Cut(mapping, "=")
+		if !found || prefix == "" {
+			return nil, fmt.Errorf("Invalid channel prefix team \"%s\", it should be in the form prefix=team", mapping)
+		}
+		if !model.IsValidTeamName(team) || model.IsReservedTeamName(team) {
+			return nil, fmt.Errorf("Invalid team name \"%s\" for channel prefix %s", team, prefix)
+		}
+		if _, ok := result[prefix]; ok {
+			return nil, fmt.Errorf("The team of channel prefix %s is set more than once", prefix)
+		}
+		result[prefix] = team
+	}
+	return result, nil
+}
+
+func parseSlackTeamTeams(mappings []string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, mapping := range mappings {
+		slackTeam, team, found := strings.Cut(mapping, "=")
+		if !found || slackTeam == "" {
+			return nil, fmt.Errorf("Invalid Slack team mapping \"%s\", it should be in the form workspace-id=team", mapping)
+		}
+		if !model.IsValidTeamName(team) || model.IsReservedTeamName(team) {
+			return nil, fmt.Errorf("Invalid team name \"%s\" for Slack workspace %s", team, slackTeam)
+		}
+		if _, ok := result[slackTeam]; ok {
+			return nil, fmt.Errorf("The team of Slack workspace %s is set more than once", slackTeam)
+		}
+		result[slackTeam] = team
+	}
+	return result, nil
+}
+
+func parseWarningCategories(names []string) ([]slack.WarningCategory, error) {
+	categories := []slack.WarningCategory{}
+	for _, name := range names {
+		category := slack.WarningCategory(name)
+		if !slices.Contains(slack.WarningCategories, category) {
+			return nil, fmt.Errorf("Invalid warning category \"%s\"", name)
+		}
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
+
+// validateAttachmentsDir checks that the attachments directory and the
+// output file can be packaged independently. Attachment paths are always
+// written relative to the attachments directory, so the only invalid
+// layout is one where the output file would end up being packaged as an
+// attachment itself.
+func validateAttachmentsDir(attachmentsDir, outputFilePath string) error {
+	absAttachmentsDir, err := filepath.Abs(attachmentsDir)
+	if err != nil {
+		return err
+	}
+	absOutputFilePath, err := filepath.Abs(outputFilePath)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(absAttachmentsDir, absOutputFilePath)
+	if err != nil {
+		// paths on different volumes can't contain each other
+		return nil
+	}
+	if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+		return fmt.Errorf("Output file \"%s\" can't be inside the attachments directory \"%s\"", outputFilePath, attachmentsDir)
+	}
+
+	return nil
+}
+
 var customLogFormatter = &log.JSONFormatter{
 	CallerPrettyfier: func(frame *runtime.Frame) (function string, file string) {
 		fileName := path.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/mattermost/mmetl/services/matrix"
+)
+
+var TransformMatrixCmd = &cobra.Command{
+	Use:     "matrix",
+	Short:   "Transforms a Matrix export.",
+	Long:    "Transforms the JSON export of a Matrix room, or a zip file with the export of several rooms, into a Mattermost export JSONL file.",
+	Example: "  transform matrix --team myteam --file my_room.json --output mm_export.json",
+	Args:    cobra.NoArgs,
+	RunE:    transformMatrixCmdF,
+}
+
+func init() {
+	TransformMatrixCmd.Flags().StringP("team", "t", "", "an existing team in Mattermost to import the data into")
+	if err := TransformMatrixCmd.MarkFlagRequired("team"); err != nil {
+		panic(err)
+	}
+	TransformMatrixCmd.Flags().StringP("file", "f", "", "the Matrix room export JSON file, or a zip file with several of them, to transform")
+	if err := TransformMatrixCmd.MarkFlagRequired("file"); err != nil {
+		panic(err)
+	}
+	TransformMatrixCmd.Flags().StringP("output", "o", "bulk-export.jsonl", "the output path")
+	TransformMatrixCmd.Flags().Bool("debug", false, "Whether to show debug logs or not")
+
+	TransformCmd.AddCommand(
+		TransformMatrixCmd,
+	)
+}
+
+func transformMatrixCmdF(cmd *cobra.Command, args []string) error {
+	team, _ := cmd.Flags().GetString("team")
+	inputFilePath, _ := cmd.Flags().GetString("file")
+	outputFilePath, _ := cmd.Flags().GetString("output")
+	debug, _ := cmd.Flags().GetBool("debug")
+
+	logger := log.New()
+	logFile, err := os.OpenFile("transform-matrix.log", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	logger.SetOutput(logFile)
+	logger.SetFormatter(customLogFormatter)
+	logger.SetReportCaller(true)
+
+	if debug {
+		logger.Level = log.DebugLevel
+		logger.Info("Debug mode enabled")
+	}
+
+	rooms, err := matrix.ParseExportFile(inputFilePath)
+	if err != nil {
+		return err
+	}
+
+	matrixTransformer := matrix.NewTransformer(team, logger)
+	matrixTransformer.Transform(rooms)
+
+	if err := matrixTransformer.Export(outputFilePath); err != nil {
+		return err
+	}
+
+	logger.Info("Transformation succeeded!")
+
+	return nil
+}
@@ -2,13 +2,24 @@ package commands_test
 
 import (
 	"archive/zip"
+	"encoding/json"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
 
 	"testing"
 
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
 	"github.com/mattermost/mmetl/commands"
+	"github.com/mattermost/mmetl/internal/testlib"
+	"github.com/mattermost/mmetl/services/slack"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/require"
 )
 
@@ -96,8 +107,8 @@ func TestYourCommandFunction(t *testing.T) {
 			expectedOutput: `{"type":"version","version":1}
 {"type":"channel","channel":{"team":"myteam","name":"general","display_name":"general","type":"O","header":"Work matters","purpose":"Company wide announcements and work-based matters"}}
 {"type":"channel","channel":{"team":"myteam","name":"random","display_name":"random","type":"O","header":"Anything goes!","purpose":"Non-work related chit-chat"}}
-{"type":"user","user":{"username":"JohnDoe","email":"john.doe@example.com","auth_service":null,"nickname":"","first_name":"John","last_name":"Doe","position":"Software Engineer","roles":"system_user","locale":null,"teams":[{"name":"myteam","roles":"team_user","channels":[{"name":"general","roles":"channel_user"},{"name":"random","roles":"channel_user"}]}]}}
-{"type":"user","user":{"username":"JaneSmith","email":"jane.smith@example.com","auth_service":null,"nickname":"","first_name":"Jane","last_name":"Smith","position":"Product Manager","roles":"system_user","locale":null,"teams":[{"name":"myteam","roles":"team_user","channels":[{"name":"general","roles":"channel_user"},{"name":"random","roles":"channel_user"}]}]}}
+{"type":"user","user":{"username":"JohnDoe","email":"john.doe@example.com","auth_service":null,"nickname":"","first_name":"John","last_name":"Doe","position":"Software Engineer","roles":"system_user","locale":null,"teams":[{"name":"myteam","roles":"team_user","channels":[{"name":"general","roles":"channel_user channel_admin"},{"name":"random","roles":"channel_user"}]}]}}
+{"type":"user","user":{"username":"JaneSmith","email":"jane.smith@example.com","auth_service":null,"nickname":"","first_name":"Jane","last_name":"Smith","position":"Product Manager","roles":"system_user","locale":null,"teams":[{"name":"myteam","roles":"team_user","channels":[{"name":"general","roles":"channel_user"},{"name":"random","roles":"channel_user channel_admin"}]}]}}
 `,
 		},
 	} {
@@ -244,3 +255,593 @@ func addFileToZip(archive *zip.Writer, filePath, fileName string) error {
 
 	return nil
 }
+
+func TestTransformSlackAttachmentsDir(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json":    `[{"id": "U1", "name": "john", "profile": {"real_name": "John Doe", "email": "john@example.com"}}]`,
+		"general/2020-01-01.json": `[{
+			"user": "U1",
+			"text": "a file",
+			"ts": "1577836800.000000",
+			"type": "message",
+			"subtype": "file_share",
+			"files": [{"id": "F1", "name": "report.txt"}]
+		}]`,
+		"__uploads/F1/report.txt": "file contents",
+	}
+
+	t.Run("attachments are written to a directory outside the output path", func(t *testing.T) {
+		workDir := t.TempDir()
+		attachmentsDir := t.TempDir()
+		inputFilePath := filepath.Join(workDir, "input.zip")
+		outputFilePath := filepath.Join(workDir, "output.jsonl")
+		defer os.Remove("transform-slack.log")
+		require.NoError(t, createTestZipFileFromMap(inputFilePath, files))
+
+		err := executeTransformSlack(
+			"--team", "myteam",
+			"--file", inputFilePath,
+			"--output", outputFilePath,
+			"--attachments-dir", attachmentsDir,
+		)
+		require.NoError(t, err)
+
+		output, err := os.ReadFile(outputFilePath)
+		require.NoError(t, err)
+		require.Contains(t, string(output), `"path":"bulk-export-attachments/F1_report.txt"`)
+
+		contents, err := os.ReadFile(filepath.Join(attachmentsDir, "bulk-export-attachments", "F1_report.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "file contents", string(contents))
+	})
+
+	t.Run("the output file can't be inside the attachments directory", func(t *testing.T) {
+		attachmentsDir := t.TempDir()
+		inputFilePath := filepath.Join(t.TempDir(), "input.zip")
+		defer os.Remove("transform-slack.log")
+		require.NoError(t, createTestZipFileFromMap(inputFilePath, files))
+
+		err := executeTransformSlack(
+			"--team", "myteam",
+			"--file", inputFilePath,
+			"--output", filepath.Join(attachmentsDir, "output.jsonl"),
+			"--attachments-dir", attachmentsDir,
+		)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "can't be inside the attachments directory")
+	})
+}
+
+func TestTransformSlackOutputFormat(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json":    `[{"id": "U1", "name": "john", "profile": {"real_name": "John Doe", "email": "john@example.com"}}]`,
+		"general/2020-01-01.json": `[{
+			"user": "U1",
+			"text": "a file",
+			"ts": "1577836800.000000",
+			"type": "message",
+			"subtype": "file_share",
+			"files": [{"id": "F1", "name": "report.txt"}]
+		}]`,
+		"__uploads/F1/report.txt": "file contents",
+	}
+
+	// attachmentPaths returns the attachment paths of the posts of an
+	// import file
+	attachmentPaths := func(t *testing.T, importFile []byte) []string {
+		paths := []string{}
+		for _, line := range strings.Split(strings.TrimSpace(string(importFile)), "\n") {
+			var importLine struct {
+				Type string `json:"type"`
+				Post *struct {
+					Attachments []struct {
+						Path string `json:"path"`
+					} `json:"attachments"`
+				} `json:"post"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(line), &importLine))
+			if importLine.Type != "post" {
+				continue
+			}
+			for _, attachment := range importLine.Post.Attachments {
+				paths = append(paths, attachment.Path)
+			}
+		}
+		return paths
+	}
+
+	t.Run("the bulk format references the attachments relative to the attachments directory", func(t *testing.T) {
+		workDir := t.TempDir()
+		attachmentsDir := t.TempDir()
+		inputFilePath := filepath.Join(workDir, "input.zip")
+		outputFilePath := filepath.Join(workDir, "output.jsonl")
+		defer os.Remove("transform-slack.log")
+		require.NoError(t, createTestZipFileFromMap(inputFilePath, files))
+
+		err := executeTransformSlack(
+			"--team", "myteam",
+			"--file", inputFilePath,
+			"--output", outputFilePath,
+			"--attachments-dir", attachmentsDir,
+			"--output-format", "bulk",
+		)
+		require.NoError(t, err)
+
+		output, err := os.ReadFile(outputFilePath)
+		require.NoError(t, err)
+		paths := attachmentPaths(t, output)
+		require.Len(t, paths, 1)
+
+		contents, err := os.ReadFile(filepath.Join(attachmentsDir, paths[0]))
+		require.NoError(t, err)
+		require.Equal(t, "file contents", string(contents))
+	})
+
+	t.Run("the mmctl format packages the import file and the attachments in a zip file", func(t *testing.T) {
+		workDir := t.TempDir()
+		inputFilePath := filepath.Join(workDir, "input.zip")
+		outputFilePath := filepath.Join(workDir, "output.zip")
+		defer os.Remove("transform-slack.log")
+		require.NoError(t, createTestZipFileFromMap(inputFilePath, files))
+
+		err := executeTransformSlack(
+			"--team", "myteam",
+			"--file", inputFilePath,
+			"--output", outputFilePath,
+			"--attachments-dir", t.TempDir(),
+			"--output-format", "mmctl",
+		)
+		require.NoError(t, err)
+
+		zipReader, err := zip.OpenReader(outputFilePath)
+		require.NoError(t, err)
+		defer zipReader.Close()
+
+		readZipFile := func(name string) []byte {
+			file, err := zipReader.Open(name)
+			require.NoError(t, err)
+			defer file.Close()
+			contents, err := io.ReadAll(file)
+			require.NoError(t, err)
+			return contents
+		}
+
+		paths := attachmentPaths(t, readZipFile("import.jsonl"))
+		require.Len(t, paths, 1)
+		require.Equal(t, "file contents", string(readZipFile("data/"+paths[0])))
+		require.Len(t, zipReader.File, 2)
+	})
+
+	t.Run("unknown output formats are rejected", func(t *testing.T) {
+		workDir := t.TempDir()
+		inputFilePath := filepath.Join(workDir, "input.zip")
+		defer os.Remove("transform-slack.log")
+		require.NoError(t, createTestZipFileFromMap(inputFilePath, files))
+
+		err := executeTransformSlack(
+			"--team", "myteam",
+			"--file", inputFilePath,
+			"--output", filepath.Join(workDir, "output.jsonl"),
+			"--skip-attachments",
+			"--output-format", "tar",
+		)
+		require.EqualError(t, err, `Invalid output format "tar", it should be either "bulk" or "mmctl"`)
+	})
+}
+
+func TestTransformSlackSkipChannelsWithoutPostsSince(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[
+			{"id": "C1", "name": "stale", "members": ["U1"]},
+			{"id": "C2", "name": "recent", "members": ["U1"]}
+		]`,
+		"users.json":             `[{"id": "U1", "name": "john", "profile": {"real_name": "John Doe", "email": "john@example.com"}}]`,
+		"stale/2020-01-01.json":  `[{"user": "U1", "text": "old news", "ts": "1577836800.000000", "type": "message"}]`,
+		"recent/2023-06-01.json": `[{"user": "U1", "text": "fresh", "ts": "1685577600.000000", "type": "message"}]`,
+	}
+
+	for name, tc := range map[string]struct {
+		since            string
+		expectedChannels []string
+		expectedError    string
+	}{
+		"a date skips the channels without posts since then": {
+			since:            "2023-01-01",
+			expectedChannels: []string{"recent"},
+		},
+		"a duration in days is accepted": {
+			since:            "36500d",
+			expectedChannels: []string{"stale", "recent"},
+		},
+		"invalid values are rejected": {
+			since:         "last year",
+			expectedError: `Invalid date or duration "last year", it should be a date like 2023-01-31 or a duration like 720h or 365d`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			workDir := t.TempDir()
+			inputFilePath := filepath.Join(workDir, "input.zip")
+			outputFilePath := filepath.Join(workDir, "output.jsonl")
+			defer os.Remove("transform-slack.log")
+			require.NoError(t, createTestZipFileFromMap(inputFilePath, files))
+
+			err := executeTransformSlack(
+				"--team", "myteam",
+				"--file", inputFilePath,
+				"--output", outputFilePath,
+				"--skip-attachments",
+				"--skip-channels-without-posts-since", tc.since,
+			)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+
+			output, err := os.ReadFile(outputFilePath)
+			require.NoError(t, err)
+			for _, channel := range []string{"stale", "recent"} {
+				require.Equal(t, slices.Contains(tc.expectedChannels, channel), strings.Contains(string(output), `"name":"`+channel+`"`), channel)
+			}
+		})
+	}
+}
+
+// executeTransformSlack runs the transform slack command with the given
+// flags, resetting any flag set by a previous execution first.
+func executeTransformSlack(flags ...string) error {
+	commands.TransformSlackCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if sliceValue, ok := f.Value.(pflag.SliceValue); ok {
+			_ = sliceValue.Replace([]string{})
+		} else {
+			_ = f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+
+	c := commands.RootCmd
+	c.SetArgs(append([]string{"transform", "slack"}, flags...))
+	return c.Execute()
+}
+
+func createTestZipFileFromMap(zipFilePath string, files map[string]string) error {
+	data, err := testlib.ZipFiles(files)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(zipFilePath, data, 0600)
+}
+
+func TestTransformSlackFailOnWarning(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json":    `[{"id": "U1", "name": "john", "profile": {"real_name": "John Doe", "email": "john@example.com"}}]`,
+		"general/2020-01-01.json": `[
+			{"user": "U1", "text": "hello", "ts": "1577836800.000000", "type": "message"},
+			{"user": "UMISSING", "text": "hi", "ts": "1577836801.000000", "type": "message"}
+		]`,
+	}
+
+	for name, tc := range map[string]struct {
+		flags         []string
+		expectedError string
+	}{
+		"without the flag the transformation succeeds": {},
+		"a placeholder user makes the transformation fail": {
+			flags:         []string{"--fail-on-warning"},
+			expectedError: "Transformation finished with 1 warnings and --fail-on-warning is set. Check transform-slack.log for details",
+		},
+		"warnings outside of the selected categories are ignored": {
+			flags: []string{"--fail-on-warning", "--fail-on-warning-categories", "truncation,file"},
+		},
+		"warnings in the selected categories make the transformation fail": {
+			flags:         []string{"--fail-on-warning", "--fail-on-warning-categories", "placeholder"},
+			expectedError: "Transformation finished with 1 warnings and --fail-on-warning is set. Check transform-slack.log for details",
+		},
+		"invalid categories are rejected": {
+			flags:         []string{"--fail-on-warning", "--fail-on-warning-categories", "invalid"},
+			expectedError: `Invalid warning category "invalid"`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			workDir := t.TempDir()
+			inputFilePath := filepath.Join(workDir, "input.zip")
+			defer os.Remove("transform-slack.log")
+			require.NoError(t, createTestZipFileFromMap(inputFilePath, files))
+
+			flags := append([]string{
+				"--team", "myteam",
+				"--file", inputFilePath,
+				"--output", filepath.Join(workDir, "output.jsonl"),
+				"--skip-attachments",
+			}, tc.flags...)
+			err := executeTransformSlack(flags...)
+
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTransformSlackMaxMessageLength(t *testing.T) {
+	long := strings.Repeat("word ", model.PostMessageMaxRunesV2/5+10)
+	files := map[string]string{
+		"channels.json":           `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json":              `[{"id": "U1", "name": "john", "profile": {"email": "john@example.com"}}]`,
+		"general/2020-01-01.json": `[{"user": "U1", "text": "` + long + `", "ts": "1577836800.000000", "type": "message"}]`,
+	}
+
+	workDir := t.TempDir()
+	inputFilePath := filepath.Join(workDir, "input.zip")
+	defer os.Remove("transform-slack.log")
+	require.NoError(t, createTestZipFileFromMap(inputFilePath, files))
+
+	for name, tc := range map[string]struct {
+		Flags     []string
+		MaxLength int
+	}{
+		"messages over the server limit are split by default": {nil, model.PostMessageMaxRunesV2},
+		"messages are split at the given length":              {[]string{"--max-message-length", "1000"}, 1000},
+	} {
+		t.Run(name, func(t *testing.T) {
+			outputFilePath := filepath.Join(t.TempDir(), "output.jsonl")
+			require.NoError(t, executeTransformSlack(append([]string{
+				"--team", "myteam",
+				"--file", inputFilePath,
+				"--output", outputFilePath,
+				"--skip-attachments",
+			}, tc.Flags...)...))
+
+			data, err := os.ReadFile(outputFilePath)
+			require.NoError(t, err)
+
+			messages := []string{}
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				var importLine imports.LineImportData
+				require.NoError(t, json.Unmarshal([]byte(line), &importLine))
+				if importLine.Type != "post" {
+					continue
+				}
+				messages = append(messages, *importLine.Post.Message)
+				for _, reply := range *importLine.Post.Replies {
+					messages = append(messages, *reply.Message)
+				}
+			}
+
+			require.Greater(t, len(messages), 1)
+			for _, message := range messages {
+				require.LessOrEqual(t, utf8.RuneCountInString(message), tc.MaxLength)
+			}
+			require.Equal(t, strings.Join(strings.Fields(long), " "), strings.Join(strings.Fields(strings.Join(messages, " ")), " "))
+		})
+	}
+}
+
+func TestTransformSlackTeamFromWorkspace(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json":    `[{"id": "U1", "name": "john", "profile": {"real_name": "John Doe", "email": "john@example.com"}}]`,
+	}
+
+	for name, tc := range map[string]struct {
+		workspace     string
+		flags         []string
+		expectedTeam  string
+		expectedError string
+	}{
+		"the team is derived from the workspace name": {
+			workspace:    `{"id": "T1", "name": "Acme Corp!", "domain": "acme"}`,
+			expectedTeam: "acme-corp",
+		},
+		"the team flag takes precedence": {
+			workspace:    `{"id": "T1", "name": "Acme Corp!", "domain": "acme"}`,
+			flags:        []string{"--team", "myteam"},
+			expectedTeam: "myteam",
+		},
+		"the team is required without a workspace name": {
+			expectedError: "The export doesn't include a valid workspace name, please provide the team with --team",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			workDir := t.TempDir()
+			inputFilePath := filepath.Join(workDir, "input.zip")
+			outputFilePath := filepath.Join(workDir, "output.jsonl")
+			defer os.Remove("transform-slack.log")
+
+			exportFiles := maps.Clone(files)
+			if tc.workspace != "" {
+				exportFiles["team.json"] = tc.workspace
+			}
+			require.NoError(t, createTestZipFileFromMap(inputFilePath, exportFiles))
+
+			err := executeTransformSlack(append([]string{
+				"--file", inputFilePath,
+				"--output", outputFilePath,
+				"--skip-attachments",
+			}, tc.flags...)...)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+
+			output, err := os.ReadFile(outputFilePath)
+			require.NoError(t, err)
+			require.Contains(t, string(output), `{"team":"`+tc.expectedTeam+`","name":"general"`)
+		})
+	}
+}
+
+func TestTransformSlackParseOnly(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1", "U2"], "purpose": {"value": "General chat"}, "topic": {"value": "Hello"}}]`,
+		"groups.json":   `[{"id": "G1", "name": "secret", "members": ["U1"]}]`,
+		"users.json": `[
+			{"id": "U1", "name": "john", "profile": {"real_name": "John Doe", "email": "john@example.com"}},
+			{"id": "U2", "name": "jane", "is_bot": true, "profile": {"real_name": "Jane Doe", "email": "jane@example.com"}}
+		]`,
+		"general/2020-01-01.json": `[{"user": "U1", "text": "hello", "ts": "1577836800.000000", "type": "message"}]`,
+	}
+
+	workDir := t.TempDir()
+	inputFilePath := filepath.Join(workDir, "input.zip")
+	outputFilePath := filepath.Join(workDir, "parsed.json")
+	attachmentsDir := filepath.Join(workDir, "data")
+	defer os.Remove("transform-slack.log")
+	require.NoError(t, createTestZipFileFromMap(inputFilePath, files))
+
+	// the team isn't needed as nothing is transformed
+	require.NoError(t, executeTransformSlack(
+		"--file", inputFilePath,
+		"--output", outputFilePath,
+		"--attachments-dir", attachmentsDir,
+		"--parse-only",
+	))
+	require.NoDirExists(t, attachmentsDir)
+
+	output, err := os.ReadFile(outputFilePath)
+	require.NoError(t, err)
+	var parsed slack.SlackExport
+	require.NoError(t, json.Unmarshal(output, &parsed))
+
+	zipReader, err := zip.OpenReader(inputFilePath)
+	require.NoError(t, err)
+	defer zipReader.Close()
+	expected, err := slack.NewTransformer("", log.New()).ParseSlackExportFile(&zipReader.Reader, false)
+	require.NoError(t, err)
+
+	require.Len(t, parsed.Users, 2)
+	require.Equal(t, expected.Users, parsed.Users)
+	require.Equal(t, expected.PublicChannels, parsed.PublicChannels)
+	require.Equal(t, expected.PrivateChannels, parsed.PrivateChannels)
+	require.Len(t, parsed.Posts, 1)
+	require.Equal(t, expected.Posts["general"], parsed.Posts["general"])
+}
+
+func TestTransformSlackProgressJSON(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[
+			{"id": "C1", "name": "general", "members": ["U1"]},
+			{"id": "C2", "name": "random", "members": ["U1"]}
+		]`,
+		"users.json": `[{"id": "U1", "name": "john", "profile": {"real_name": "John Doe", "email": "john@example.com"}}]`,
+		"general/2020-01-01.json": `[
+			{"user": "U1", "text": "hello", "ts": "1577836800.000000", "type": "message"},
+			{"user": "U1", "text": "again", "ts": "1577836801.000000", "type": "message"}
+		]`,
+		"random/2020-01-01.json": `[{"user": "U1", "text": "hi", "ts": "1577836802.000000", "type": "message"}]`,
+	}
+
+	workDir := t.TempDir()
+	inputFilePath := filepath.Join(workDir, "input.zip")
+	progressFilePath := filepath.Join(workDir, "progress.jsonl")
+	defer os.Remove("transform-slack.log")
+	require.NoError(t, createTestZipFileFromMap(inputFilePath, files))
+
+	// events are appended to the existing content
+	require.NoError(t, os.WriteFile(progressFilePath, []byte(`{"phase":"previous"}`+"\n"), 0600))
+
+	require.NoError(t, executeTransformSlack(
+		"--team", "myteam",
+		"--file", inputFilePath,
+		"--output", filepath.Join(workDir, "output.jsonl"),
+		"--skip-attachments",
+		"--progress-json", progressFilePath,
+	))
+
+	data, err := os.ReadFile(progressFilePath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Equal(t, `{"phase":"previous"}`, lines[0])
+
+	last := map[string]slack.ProgressEvent{}
+	phases := []string{}
+	for _, line := range lines[1:] {
+		var event slack.ProgressEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &event), line)
+		require.False(t, event.Timestamp.IsZero(), line)
+		require.LessOrEqual(t, event.Done, event.Total, line)
+		if !slices.Contains(phases, event.Phase) {
+			phases = append(phases, event.Phase)
+		}
+		last[event.Phase] = event
+	}
+
+	require.Equal(t, []string{slack.ProgressPhaseUsers, slack.ProgressPhaseChannels, slack.ProgressPhasePosts, slack.ProgressPhaseExport}, phases)
+	require.Equal(t, 1, last[slack.ProgressPhaseUsers].Done)
+	require.Equal(t, 2, last[slack.ProgressPhaseChannels].Done)
+	require.Equal(t, 2, last[slack.ProgressPhasePosts].Done)
+	require.Equal(t, 3, last[slack.ProgressPhaseExport].Total)
+	require.Equal(t, 3, last[slack.ProgressPhaseExport].Done)
+}
+
+func TestTransformSlackMergeExportDir(t *testing.T) {
+	exportDir := t.TempDir()
+	require.NoError(t, createTestZipFileFromMap(filepath.Join(exportDir, "2020-01.zip"), map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1", "U2"]}]`,
+		"users.json": `[
+			{"id": "U1", "name": "john", "profile": {"email": "john@example.com"}},
+			{"id": "U2", "name": "jane", "profile": {"email": "jane@example.com"}}
+		]`,
+		"general/2020-01-31.json": `[
+			{"user": "U1", "text": "january", "ts": "1580428800.000000", "type": "message", "client_msg_id": "m1"},
+			{"user": "U2", "text": "overlap", "ts": "1580515200.000000", "type": "message", "client_msg_id": "m2"}
+		]`,
+	}))
+	require.NoError(t, createTestZipFileFromMap(filepath.Join(exportDir, "2020-02.zip"), map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1", "U3"]}]`,
+		"users.json": `[
+			{"id": "U1", "name": "john", "profile": {"email": "john@example.com"}},
+			{"id": "U3", "name": "jane", "profile": {"email": "jane@example.com"}}
+		]`,
+		"general/2020-02-01.json": `[
+			{"user": "U3", "text": "overlap", "ts": "1580515200.000000", "type": "message", "client_msg_id": "m2"},
+			{"user": "U3", "text": "february <@U3|jane>", "ts": "1580601600.000000", "type": "message", "client_msg_id": "m3"}
+		]`,
+	}))
+	// other files of the directory are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(exportDir, "notes.txt"), []byte("notes"), 0600))
+
+	outputFilePath := filepath.Join(t.TempDir(), "output.jsonl")
+	defer os.Remove("transform-slack.log")
+	require.NoError(t, executeTransformSlack(
+		"--team", "myteam",
+		"--merge-export-dir", exportDir,
+		"--output", outputFilePath,
+		"--skip-attachments",
+	))
+
+	data, err := os.ReadFile(outputFilePath)
+	require.NoError(t, err)
+
+	usernames := []string{}
+	messages := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var importLine imports.LineImportData
+		require.NoError(t, json.Unmarshal([]byte(line), &importLine))
+		switch importLine.Type {
+		case "user":
+			usernames = append(usernames, *importLine.User.Username)
+		case "post":
+			messages = append(messages, *importLine.Post.Message)
+		}
+	}
+	require.ElementsMatch(t, []string{"john", "jane"}, usernames)
+	// the mention of the duplicate is converted once merged
+	require.Equal(t, []string{"january", "overlap", "february @jane"}, messages)
+
+	t.Run("a directory without exports fails", func(t *testing.T) {
+		err := executeTransformSlack("--team", "myteam", "--merge-export-dir", t.TempDir(), "--output", outputFilePath)
+		require.ErrorContains(t, err, "has no Slack export zip files")
+	})
+
+	t.Run("the flag can't be used along with --file", func(t *testing.T) {
+		err := executeTransformSlack("--team", "myteam", "--merge-export-dir", exportDir, "--file", filepath.Join(exportDir, "2020-01.zip"))
+		require.ErrorContains(t, err, "if any flags in the group [file merge-export-dir] are set none of the others can be")
+	})
+}
@@ -5,6 +5,8 @@ package commands
 
 import (
 	"fmt"
+	"runtime"
+
 	"github.com/spf13/cobra"
 )
 
@@ -22,8 +24,16 @@ var VersionCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(VersionCmd)
+
+	// enables the --version flag on the root command
+	RootCmd.Version = Version
+	RootCmd.SetVersionTemplate(versionString() + "\n")
+}
+
+func versionString() string {
+	return "mmetl " + Version + " -- " + BuildHash + " -- " + runtime.Version()
 }
 
 func versionCmdF(cmd *cobra.Command, args []string) {
-	fmt.Println("mmetl " + Version + " -- " + BuildHash)
+	fmt.Fprintln(cmd.OutOrStdout(), versionString())
 }
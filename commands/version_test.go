@@ -0,0 +1,34 @@
+package commands_test
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mmetl/commands"
+)
+
+func TestVersion(t *testing.T) {
+	for _, args := range [][]string{{"version"}, {"--version"}} {
+		t.Run(args[0], func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			c := commands.RootCmd
+			c.SetOut(buf)
+			defer func() {
+				c.SetOut(nil)
+				if f := c.Flags().Lookup("version"); f != nil {
+					_ = f.Value.Set("false")
+					f.Changed = false
+				}
+			}()
+			c.SetArgs(args)
+
+			require.NoError(t, c.Execute())
+			require.Contains(t, buf.String(), "mmetl "+commands.Version)
+			require.Contains(t, buf.String(), commands.BuildHash)
+			require.Contains(t, buf.String(), runtime.Version())
+		})
+	}
+}
@@ -0,0 +1,28 @@
+// Package testlib holds the helpers shared by the tests of several
+// packages.
+package testlib
+
+import (
+	"archive/zip"
+	"bytes"
+)
+
+// ZipFiles returns a zip archive holding the given contents by file name,
+// such as a Slack export.
+func ZipFiles(files map[string]string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	for name, data := range files {
+		writer, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write([]byte(data)); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
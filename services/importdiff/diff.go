@@ -0,0 +1,254 @@
+// Package importdiff compares two Mattermost bulk import files, such as
+// the ones produced by transforming the same export with different flags.
+package importdiff
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChangeType is the kind of difference found for an entity.
+type ChangeType string
+
+const (
+	ChangeTypeAdded   ChangeType = "added"
+	ChangeTypeRemoved ChangeType = "removed"
+	ChangeTypeChanged ChangeType = "changed"
+)
+
+// Group is the family of entities a change belongs to.
+type Group string
+
+const (
+	GroupUsers    Group = "users"
+	GroupChannels Group = "channels"
+	GroupPosts    Group = "posts"
+)
+
+// Groups lists the groups in the order they are reported.
+var Groups = []Group{GroupUsers, GroupChannels, GroupPosts}
+
+// Change is a difference for a single entity, identified by a key that
+// doesn't depend on the order of the lines in the import.
+type Change struct {
+	Group Group
+	Key   string
+	Type  ChangeType
+}
+
+// entity is a line of an import, canonicalised so that two equivalent
+// lines compare equal.
+type entity struct {
+	group Group
+	data  string
+}
+
+// Import holds the entities of an import file by key.
+type Import struct {
+	entities map[string]entity
+}
+
+// ReadImport reads an import file from r. When attachmentsDir is set, the
+// attachments of the posts are compared by checksum besides their path,
+// reading them from that directory.
+func ReadImport(r io.Reader, attachmentsDir string) (*Import, error) {
+	result := &Import{entities: map[string]entity{}}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+		var line map[string]interface{}
+		if err := decoder.Decode(&line); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse line %d", lineNumber)
+		}
+
+		lineType, _ := line["type"].(string)
+		group, key := identify(lineType, line)
+		if key == "" {
+			continue
+		}
+
+		if group == GroupPosts && attachmentsDir != "" {
+			addChecksums(line, attachmentsDir)
+		}
+
+		data, err := json.Marshal(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode line %d", lineNumber)
+		}
+
+		// lines with the same identity are told apart by their order
+		uniqueKey := key
+		for i := 2; ; i++ {
+			if _, ok := result.entities[uniqueKey]; !ok {
+				break
+			}
+			uniqueKey = fmt.Sprintf("%s#%d", key, i)
+		}
+		result.entities[uniqueKey] = entity{group: group, data: string(data)}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// identify returns the group and the key of a line, or an empty key for
+// the lines that aren't compared.
+func identify(lineType string, line map[string]interface{}) (Group, string) {
+	object, _ := line[lineType].(map[string]interface{})
+	if object == nil {
+		return "", ""
+	}
+	field := func(name string) string {
+		return fmt.Sprint(object[name])
+	}
+
+	switch lineType {
+	case "user":
+		return GroupUsers, "user " + field("username")
+	case "channel":
+		return GroupChannels, "channel " + field("team") + "/" + field("name")
+	case "direct_channel":
+		return GroupChannels, "direct_channel " + members(object["members"])
+	case "post":
+		return GroupPosts, "post " + field("team") + "/" + field("channel") + "/" + field("user") + "/" + field("create_at")
+	case "direct_post":
+		return GroupPosts, "direct_post " + members(object["channel_members"]) + "/" + field("user") + "/" + field("create_at")
+	}
+	return "", ""
+}
+
+func members(value interface{}) string {
+	list, _ := value.([]interface{})
+	names := make([]string, 0, len(list))
+	for _, name := range list {
+		names = append(names, fmt.Sprint(name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// addChecksums adds the checksum of the attachments of a post and its
+// replies, so a file that changes without changing its path is noticed.
+func addChecksums(line map[string]interface{}, attachmentsDir string) {
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if attachments, ok := v["attachments"].([]interface{}); ok {
+				for _, attachment := range attachments {
+					if attachment, ok := attachment.(map[string]interface{}); ok {
+						if path, ok := attachment["path"].(string); ok {
+							attachment["checksum"] = checksum(filepath.Join(attachmentsDir, path))
+						}
+					}
+				}
+			}
+			for _, nested := range v {
+				walk(nested)
+			}
+		case []interface{}:
+			for _, nested := range v {
+				walk(nested)
+			}
+		}
+	}
+	walk(line)
+}
+
+// checksum returns the SHA-256 of a file, or "missing" if it can't be read.
+func checksum(filePath string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "missing"
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "missing"
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Diff returns the changes needed to go from a to b, sorted by group and
+// key.
+func Diff(a, b *Import) []Change {
+	changes := []Change{}
+	for key, before := range a.entities {
+		after, ok := b.entities[key]
+		if !ok {
+			changes = append(changes, Change{Group: before.group, Key: key, Type: ChangeTypeRemoved})
+		} else if before.data != after.data {
+			changes = append(changes, Change{Group: before.group, Key: key, Type: ChangeTypeChanged})
+		}
+	}
+	for key, after := range b.entities {
+		if _, ok := a.entities[key]; !ok {
+			changes = append(changes, Change{Group: after.group, Key: key, Type: ChangeTypeAdded})
+		}
+	}
+
+	groupOrder := map[Group]int{}
+	for i, group := range Groups {
+		groupOrder[group] = i
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Group != changes[j].Group {
+			return groupOrder[changes[i].Group] < groupOrder[changes[j].Group]
+		}
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// WriteSummary writes a human-readable summary of the changes: a count
+// per group followed by each change, marked with +, - or ~.
+func WriteSummary(w io.Writer, changes []Change) error {
+	counts := map[Group]map[ChangeType]int{}
+	for _, group := range Groups {
+		counts[group] = map[ChangeType]int{}
+	}
+	for _, change := range changes {
+		counts[change.Group][change.Type]++
+	}
+
+	for _, group := range Groups {
+		if _, err := fmt.Fprintf(w, "%s: %d added, %d removed, %d changed\n", group, counts[group][ChangeTypeAdded], counts[group][ChangeTypeRemoved], counts[group][ChangeTypeChanged]); err != nil {
+			return err
+		}
+	}
+
+	markers := map[ChangeType]string{
+		ChangeTypeAdded:   "+",
+		ChangeTypeRemoved: "-",
+		ChangeTypeChanged: "~",
+	}
+	for _, change := range changes {
+		if _, err := fmt.Fprintf(w, "%s %s\n", markers[change.Type], change.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package importdiff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const baseImport = `{"type":"version","version":1}
+{"type":"channel","channel":{"team":"myteam","name":"general","display_name":"general","type":"O"}}
+{"type":"user","user":{"username":"alice","email":"alice@example.com","teams":[{"name":"myteam","channels":[{"name":"general"}]}]}}
+{"type":"post","post":{"team":"myteam","channel":"general","user":"alice","message":"hello","create_at":1577836800000}}
+{"type":"post","post":{"team":"myteam","channel":"general","user":"alice","message":"world","create_at":1577836801000,"attachments":[{"path":"bulk-export-attachments/F1_file.txt"}]}}
+{"type":"direct_post","direct_post":{"channel_members":["bob","alice"],"user":"alice","message":"hi","create_at":1577836802000}}
+`
+
+func readImport(t *testing.T, data, attachmentsDir string) *Import {
+	t.Helper()
+
+	result, err := ReadImport(strings.NewReader(data), attachmentsDir)
+	require.NoError(t, err)
+	return result
+}
+
+func TestDiff(t *testing.T) {
+	t.Run("identical imports have no changes", func(t *testing.T) {
+		// the order of the lines and of the fields doesn't matter
+		lines := strings.Split(strings.TrimSpace(baseImport), "\n")
+		reordered := strings.Join([]string{lines[0], lines[3], lines[2], lines[1], lines[5], lines[4]}, "\n")
+		reordered = strings.Replace(reordered, `{"username":"alice","email":"alice@example.com",`, `{"email":"alice@example.com","username":"alice",`, 1)
+
+		require.Empty(t, Diff(readImport(t, baseImport, ""), readImport(t, reordered, "")))
+	})
+
+	t.Run("a single changed post is reported", func(t *testing.T) {
+		changed := strings.Replace(baseImport, `"message":"hello"`, `"message":"hello!"`, 1)
+
+		require.Equal(t, []Change{
+			{Group: GroupPosts, Key: "post myteam/general/alice/1577836800000", Type: ChangeTypeChanged},
+		}, Diff(readImport(t, baseImport, ""), readImport(t, changed, "")))
+	})
+
+	t.Run("added and removed entities are reported", func(t *testing.T) {
+		changed := strings.Replace(baseImport, `"username":"alice"`, `"username":"alice2"`, 1)
+		changed += `{"type":"direct_channel","direct_channel":{"members":["bob","alice"]}}` + "\n"
+
+		changes := Diff(readImport(t, baseImport, ""), readImport(t, changed, ""))
+		require.Equal(t, []Change{
+			{Group: GroupUsers, Key: "user alice", Type: ChangeTypeRemoved},
+			{Group: GroupUsers, Key: "user alice2", Type: ChangeTypeAdded},
+			{Group: GroupChannels, Key: "direct_channel alice,bob", Type: ChangeTypeAdded},
+		}, changes)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, WriteSummary(buf, changes))
+		require.Equal(t, `users: 1 added, 1 removed, 0 changed
+channels: 1 added, 0 removed, 0 changed
+posts: 0 added, 0 removed, 0 changed
+- user alice
++ user alice2
++ direct_channel alice,bob
+`, buf.String())
+	})
+
+	t.Run("attachments are compared by checksum", func(t *testing.T) {
+		writeAttachment := func(content string) string {
+			dir := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "bulk-export-attachments"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "bulk-export-attachments", "F1_file.txt"), []byte(content), 0600))
+			return dir
+		}
+		dirA := writeAttachment("first")
+		dirB := writeAttachment("second")
+
+		require.Empty(t, Diff(readImport(t, baseImport, ""), readImport(t, baseImport, "")))
+		require.Empty(t, Diff(readImport(t, baseImport, dirA), readImport(t, baseImport, writeAttachment("first"))))
+		require.Equal(t, []Change{
+			{Group: GroupPosts, Key: "post myteam/general/alice/1577836801000", Type: ChangeTypeChanged},
+		}, Diff(readImport(t, baseImport, dirA), readImport(t, baseImport, dirB)))
+	})
+
+	t.Run("invalid lines are rejected", func(t *testing.T) {
+		_, err := ReadImport(strings.NewReader("{\"type\":\"version\"}\nnot json\n"), "")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse line 2")
+	})
+}
@@ -0,0 +1,218 @@
+package matrix
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const matrixToPrefix = "https://matrix.to/#/"
+
+var extraNewlinesRegexp = regexp.MustCompile(`\n{3,}`)
+
+// HTMLToMarkdown converts the HTML formatted body of a message to
+// markdown. Mentions of users, which Matrix clients link to matrix.to,
+// are converted to the Mattermost mentions of the usernames given by
+// Matrix user id, and the quote of the original message that rich
+// replies include is left out.
+func HTMLToMarkdown(body string, usernames map[string]string) (string, error) {
+	context := &html.Node{Type: html.ElementNode, DataAtom: atom.Div, Data: "div"}
+	nodes, err := html.ParseFragment(strings.NewReader(body), context)
+	if err != nil {
+		return "", err
+	}
+
+	c := &htmlConverter{usernames: usernames}
+	var b strings.Builder
+	for _, node := range nodes {
+		b.WriteString(c.render(node))
+	}
+
+	return strings.TrimSpace(extraNewlinesRegexp.ReplaceAllString(b.String(), "\n\n")), nil
+}
+
+type htmlConverter struct {
+	usernames map[string]string
+}
+
+func (c *htmlConverter) renderChildren(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(c.render(child))
+	}
+	return b.String()
+}
+
+func (c *htmlConverter) render(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		// the whitespace between block elements is only formatting
+		if strings.TrimSpace(n.Data) == "" && strings.Contains(n.Data, "\n") {
+			return ""
+		}
+		return strings.ReplaceAll(n.Data, "\n", " ")
+	case html.ElementNode:
+	default:
+		return c.renderChildren(n)
+	}
+
+	switch n.Data {
+	case "mx-reply":
+		return ""
+	case "br":
+		return "\n"
+	case "p", "div":
+		return c.renderChildren(n) + "\n\n"
+	case "strong", "b":
+		return wrapInline(c.renderChildren(n), "**")
+	case "em", "i":
+		return wrapInline(c.renderChildren(n), "_")
+	case "del", "s", "strike":
+		return wrapInline(c.renderChildren(n), "~~")
+	case "code":
+		return "`" + textContent(n) + "`"
+	case "pre":
+		return c.renderCodeBlock(n)
+	case "a":
+		return c.renderLink(n)
+	case "blockquote":
+		return prefixLines(strings.TrimSpace(c.renderChildren(n)), "> ", "> ") + "\n\n"
+	case "ul", "ol":
+		if n.Parent != nil && n.Parent.Type == html.ElementNode && n.Parent.Data == "li" {
+			return "\n" + c.renderList(n)
+		}
+		return c.renderList(n) + "\n"
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(n.Data[1:])
+		return strings.Repeat("#", level) + " " + strings.TrimSpace(c.renderChildren(n)) + "\n\n"
+	case "hr":
+		return "---\n\n"
+	case "img":
+		return attribute(n, "alt")
+	}
+	return c.renderChildren(n)
+}
+
+func (c *htmlConverter) renderCodeBlock(n *html.Node) string {
+	language := ""
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.Data == "code" {
+			for _, class := range strings.Fields(attribute(child, "class")) {
+				if lang, ok := strings.CutPrefix(class, "language-"); ok {
+					language = lang
+				}
+			}
+		}
+	}
+	return "```" + language + "\n" + strings.TrimSuffix(textContent(n), "\n") + "\n```\n\n"
+}
+
+func (c *htmlConverter) renderLink(n *html.Node) string {
+	href := attribute(n, "href")
+	text := c.renderChildren(n)
+
+	if id, ok := strings.CutPrefix(href, matrixToPrefix); ok && strings.HasPrefix(id, "@") {
+		if username, ok := c.usernames[id]; ok {
+			return "@" + username
+		}
+	}
+
+	if href == "" || text == href {
+		return text
+	}
+	if text == "" {
+		return href
+	}
+	return "[" + text + "](" + href + ")"
+}
+
+func (c *htmlConverter) renderList(n *html.Node) string {
+	ordered := n.Data == "ol"
+	number := 1
+	if start, err := strconv.Atoi(attribute(n, "start")); err == nil {
+		number = start
+	}
+
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || child.Data != "li" {
+			continue
+		}
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		item := strings.TrimSpace(extraNewlinesRegexp.ReplaceAllString(c.renderChildren(child), "\n\n"))
+		b.WriteString(prefixLines(item, marker, strings.Repeat(" ", len(marker))) + "\n")
+	}
+	return b.String()
+}
+
+// wrapInline wraps text in a markdown delimiter, keeping the surrounding
+// spaces outside of it as markdown requires.
+func wrapInline(text, delimiter string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + delimiter + trimmed + delimiter + text[start+len(trimmed):]
+}
+
+// prefixLines prefixes the first line of text with first and the rest with
+// rest, leaving empty lines unprefixed except in quotes.
+func prefixLines(text, first, rest string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		if line == "" && strings.TrimSpace(prefix) == "" {
+			continue
+		}
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(textContent(child))
+	}
+	return b.String()
+}
+
+func attribute(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// stripReplyFallback removes the quote of the original message that rich
+// replies prepend to their plain text body.
+func stripReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	if i < len(lines) && lines[i] == "" {
+		i++
+	}
+	return strings.Join(lines[i:], "\n")
+}
@@ -0,0 +1,39 @@
+package matrix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	usernames := map[string]string{"@bob:example.org": "bob"}
+
+	testCases := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{name: "inline formatting", html: "<b>bold</b>, <em>italic </em>and <del>gone</del>", expected: "**bold**, _italic_ and ~~gone~~"},
+		{name: "inline code", html: "run <code>make &amp;&amp; test</code>", expected: "run `make && test`"},
+		{name: "code block", html: "<pre><code class=\"language-go\">func main() {\n}\n</code></pre>", expected: "```go\nfunc main() {\n}\n```"},
+		{name: "link", html: "see <a href=\"https://example.com\">the docs</a>", expected: "see [the docs](https://example.com)"},
+		{name: "bare link", html: "<a href=\"https://example.com\">https://example.com</a>", expected: "https://example.com"},
+		{name: "user mention", html: "hi <a href=\"https://matrix.to/#/@bob:example.org\">Bob</a>", expected: "hi @bob"},
+		{name: "unknown user mention", html: "hi <a href=\"https://matrix.to/#/@eve:example.org\">Eve</a>", expected: "hi [Eve](https://matrix.to/#/@eve:example.org)"},
+		{name: "line breaks and paragraphs", html: "<p>one<br>two</p>\n<p>three</p>", expected: "one\ntwo\n\nthree"},
+		{name: "quote", html: "<blockquote>\n<p>quoted<br>text</p>\n</blockquote>\n<p>answer</p>", expected: "> quoted\n> text\n\nanswer"},
+		{name: "lists", html: "<ul>\n<li>one</li>\n<li>two<ol start=\"3\"><li>three</li></ol></li>\n</ul>", expected: "- one\n- two\n  3. three"},
+		{name: "heading", html: "<h2>Title</h2>text", expected: "## Title\n\ntext"},
+		{name: "reply fallback", html: "<mx-reply><blockquote>original</blockquote></mx-reply>reply", expected: "reply"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			markdown, err := HTMLToMarkdown(tc.html, usernames)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, markdown)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package matrix
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	EventTypeMessage    = "m.room.message"
+	EventTypeMember     = "m.room.member"
+	EventTypeName       = "m.room.name"
+	EventTypeTopic      = "m.room.topic"
+	EventTypeJoinRules  = "m.room.join_rules"
+	RelationTypeReplace = "m.replace"
+	RelationTypeThread  = "m.thread"
+	FormatHTML          = "org.matrix.custom.html"
+	MembershipJoin      = "join"
+	JoinRulePublic      = "public"
+)
+
+// RoomExport is a room exported as JSON, in the format of the chat export
+// of Element, which bridges and recorders also follow.
+type RoomExport struct {
+	RoomName    string  `json:"room_name"`
+	RoomCreator string  `json:"room_creator"`
+	Topic       string  `json:"topic"`
+	Messages    []Event `json:"messages"`
+}
+
+// RoomId returns the id of the room from its events, as the export
+// doesn't include it otherwise.
+func (r *RoomExport) RoomId() string {
+	for _, event := range r.Messages {
+		if event.RoomId != "" {
+			return event.RoomId
+		}
+	}
+	return ""
+}
+
+type Event struct {
+	Type           string       `json:"type"`
+	EventId        string       `json:"event_id"`
+	RoomId         string       `json:"room_id"`
+	Sender         string       `json:"sender"`
+	OriginServerTS int64        `json:"origin_server_ts"`
+	StateKey       *string      `json:"state_key"`
+	Content        EventContent `json:"content"`
+}
+
+// EventContent holds the fields of the content of the events that are
+// transformed. Messages use the first group of fields and room state
+// events the second.
+type EventContent struct {
+	MsgType       string        `json:"msgtype"`
+	Body          string        `json:"body"`
+	Format        string        `json:"format"`
+	FormattedBody string        `json:"formatted_body"`
+	RelatesTo     *RelatesTo    `json:"m.relates_to"`
+	NewContent    *EventContent `json:"m.new_content"`
+
+	Name        string `json:"name"`
+	Topic       string `json:"topic"`
+	Membership  string `json:"membership"`
+	Displayname string `json:"displayname"`
+	JoinRule    string `json:"join_rule"`
+}
+
+type RelatesTo struct {
+	RelType   string     `json:"rel_type"`
+	EventId   string     `json:"event_id"`
+	InReplyTo *InReplyTo `json:"m.in_reply_to"`
+}
+
+type InReplyTo struct {
+	EventId string `json:"event_id"`
+}
+
+// ReplyTo returns the id of the event that a message replies to, either as
+// a rich reply or in a thread, or an empty string if it isn't a reply.
+func (c *EventContent) ReplyTo() string {
+	if c.RelatesTo == nil {
+		return ""
+	}
+	if c.RelatesTo.RelType == RelationTypeThread {
+		return c.RelatesTo.EventId
+	}
+	if c.RelatesTo.InReplyTo != nil {
+		return c.RelatesTo.InReplyTo.EventId
+	}
+	return ""
+}
+
+// Replaces returns the id of the message that an edit replaces, or an
+// empty string if the message isn't an edit.
+func (c *EventContent) Replaces() string {
+	if c.RelatesTo == nil || c.RelatesTo.RelType != RelationTypeReplace {
+		return ""
+	}
+	return c.RelatesTo.EventId
+}
+
+func ParseRoomExport(data io.Reader) (*RoomExport, error) {
+	room := &RoomExport{}
+	if err := json.NewDecoder(data).Decode(room); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// ParseExportFile parses a room export JSON file, or a zip file with the
+// JSON export of several rooms.
+func ParseExportFile(filePath string) ([]*RoomExport, error) {
+	if strings.EqualFold(path.Ext(filePath), ".zip") {
+		zipReader, err := zip.OpenReader(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer zipReader.Close()
+		return ParseExportZip(&zipReader.Reader)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	room, err := ParseRoomExport(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", filePath)
+	}
+	return []*RoomExport{room}, nil
+}
+
+// ParseExportZip parses the JSON files of a zip file as room exports, in
+// the order of their names.
+func ParseExportZip(zipReader *zip.Reader) ([]*RoomExport, error) {
+	files := []*zip.File{}
+	for _, file := range zipReader.File {
+		if !file.FileInfo().IsDir() && strings.EqualFold(path.Ext(file.Name), ".json") {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	rooms := []*RoomExport{}
+	for _, file := range files {
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		room, err := ParseRoomExport(reader)
+		reader.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", file.Name)
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, nil
+}
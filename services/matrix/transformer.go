@@ -0,0 +1,358 @@
+package matrix
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mattermost/mmetl/services/slack"
+)
+
+var invalidUsernameCharacters = regexp.MustCompile(`[^a-z0-9.\-_]`)
+var invalidChannelNameCharacters = regexp.MustCompile(`[^a-z0-9\-_]+`)
+
+// Transformer transforms Matrix room exports into the same intermediate
+// data as the Slack transformer, so they are exported the same way.
+type Transformer struct {
+	TeamName     string
+	Intermediate *slack.Intermediate
+	Logger       log.FieldLogger
+}
+
+func NewTransformer(teamName string, logger log.FieldLogger) *Transformer {
+	return &Transformer{
+		TeamName:     teamName,
+		Intermediate: &slack.Intermediate{UsersById: map[string]*slack.IntermediateUser{}},
+		Logger:       logger,
+	}
+}
+
+// Transform transforms the rooms into channels, the users that took part
+// in them into users and their messages into posts.
+func (t *Transformer) Transform(rooms []*RoomExport) {
+	t.TransformUsers(rooms)
+	t.TransformChannels(rooms)
+	t.TransformPosts(rooms)
+	t.populateUserMemberships()
+}
+
+// TransformUsers creates a user for every sender and member of the rooms,
+// named after the localpart of their Matrix id. As the exports have no
+// emails, the email is made of the localpart and the server of the id.
+func (t *Transformer) TransformUsers(rooms []*RoomExport) {
+	t.Logger.Info("Transforming users")
+
+	displayNames := map[string]string{}
+	for _, room := range rooms {
+		for _, event := range room.Messages {
+			if event.Sender != "" {
+				if _, ok := displayNames[event.Sender]; !ok {
+					displayNames[event.Sender] = ""
+				}
+			}
+			if event.Type == EventTypeMember && event.StateKey != nil && *event.StateKey != "" && event.Content.Membership == MembershipJoin {
+				displayNames[*event.StateKey] = event.Content.Displayname
+			}
+		}
+	}
+
+	userIds := make([]string, 0, len(displayNames))
+	for userId := range displayNames {
+		userIds = append(userIds, userId)
+	}
+	sort.Strings(userIds)
+
+	taken := map[string]bool{}
+	for _, userId := range userIds {
+		localpart, server := splitUserId(userId)
+		username := uniqueName(normalizeUsername(localpart), taken)
+		if username != localpart {
+			t.Logger.Infof("Matrix user %s is imported with the username %s", userId, username)
+		}
+
+		t.Intermediate.UsersById[userId] = &slack.IntermediateUser{
+			Id:        userId,
+			Username:  username,
+			FirstName: displayNames[userId],
+			Email:     strings.ToLower(localpart + "@" + server),
+			Password:  model.NewId(),
+		}
+	}
+}
+
+// TransformChannels creates a channel for each room. Rooms that anyone
+// can join are imported as public channels and the rest as private ones.
+func (t *Transformer) TransformChannels(rooms []*RoomExport) {
+	t.Logger.Info("Transforming channels")
+
+	taken := map[string]bool{}
+	for _, room := range rooms {
+		roomId := room.RoomId()
+		roomName := room.RoomName
+		topic := room.Topic
+		channelType := model.ChannelTypePrivate
+		membership := map[string]string{}
+		for _, event := range room.Messages {
+			switch event.Type {
+			case EventTypeName:
+				if roomName == "" {
+					roomName = event.Content.Name
+				}
+			case EventTypeTopic:
+				if topic == "" {
+					topic = event.Content.Topic
+				}
+			case EventTypeJoinRules:
+				if event.Content.JoinRule == JoinRulePublic {
+					channelType = model.ChannelTypeOpen
+				} else {
+					channelType = model.ChannelTypePrivate
+				}
+			case EventTypeMember:
+				if event.StateKey != nil {
+					membership[*event.StateKey] = event.Content.Membership
+				}
+			}
+			if _, ok := membership[event.Sender]; !ok && event.Sender != "" {
+				membership[event.Sender] = MembershipJoin
+			}
+		}
+
+		members := []string{}
+		for userId, state := range membership {
+			if _, ok := t.Intermediate.UsersById[userId]; ok && state == MembershipJoin {
+				members = append(members, userId)
+			}
+		}
+		sort.Strings(members)
+
+		localpart, _ := strings.CutPrefix(roomId, "!")
+		localpart, _, _ = strings.Cut(localpart, ":")
+		name := uniqueName(slack.SlackConvertChannelName(channelName(roomName), localpart), taken)
+
+		channel := &slack.IntermediateChannel{
+			Id:           roomId,
+			OriginalName: roomId,
+			Name:         name,
+			DisplayName:  roomName,
+			Members:      members,
+			Purpose:      topic,
+			Type:         channelType,
+			Creator:      room.RoomCreator,
+		}
+		t.sanitiseChannel(channel)
+
+		if channelType == model.ChannelTypeOpen {
+			t.Intermediate.PublicChannels = append(t.Intermediate.PublicChannels, channel)
+		} else {
+			t.Intermediate.PrivateChannels = append(t.Intermediate.PrivateChannels, channel)
+		}
+	}
+}
+
+// sanitiseChannel truncates the fields of a channel to the lengths that
+// Mattermost accepts. Unlike Slack channels, rooms have free form names,
+// so their display names are kept as is otherwise.
+func (t *Transformer) sanitiseChannel(channel *slack.IntermediateChannel) {
+	logger := t.Logger.WithField("channel", channel.Name)
+	if len(channel.Name) > model.ChannelNameMaxLength {
+		logger.Warnf("Channel %s handle exceeds the maximum length. It was truncated, dropping %d characters.", channel.DisplayName, len(channel.Name)-model.ChannelNameMaxLength)
+		channel.Name = channel.Name[:model.ChannelNameMaxLength]
+	}
+	if strings.TrimSpace(channel.DisplayName) == "" {
+		channel.DisplayName = channel.Name
+	}
+	if length := utf8.RuneCountInString(channel.DisplayName); length > model.ChannelDisplayNameMaxRunes {
+		logger.Warnf("Channel %s display name exceeds the maximum length. It was truncated, dropping %d characters.", channel.DisplayName, length-model.ChannelDisplayNameMaxRunes)
+		channel.DisplayName = truncateRunes(channel.DisplayName, model.ChannelDisplayNameMaxRunes)
+	}
+	if length := utf8.RuneCountInString(channel.Purpose); length > model.ChannelPurposeMaxRunes {
+		logger.Warnf("Channel %s purpose exceeds the maximum length. It was truncated, dropping %d characters.", channel.DisplayName, length-model.ChannelPurposeMaxRunes)
+		channel.Purpose = truncateRunes(channel.Purpose, model.ChannelPurposeMaxRunes)
+	}
+}
+
+// TransformPosts transforms the messages of each room into posts. Replies
+// and messages in a thread are added to the thread of the message they
+// reply to, and edits replace the message they edit. Messages longer than
+// the server limit are split into continuation replies, as the Slack
+// transformer does.
+func (t *Transformer) TransformPosts(rooms []*RoomExport) {
+	t.Logger.Info("Transforming posts")
+
+	splitter := slack.NewTransformer(t.TeamName, t.Logger)
+
+	usernames := map[string]string{}
+	for userId, user := range t.Intermediate.UsersById {
+		usernames[userId] = user.Username
+	}
+
+	channels := map[string]*slack.IntermediateChannel{}
+	for _, channel := range t.channels() {
+		channels[channel.Id] = channel
+	}
+
+	for _, room := range rooms {
+		channel := channels[room.RoomId()]
+		if channel == nil {
+			continue
+		}
+		logger := t.Logger.WithField("channel", channel.Name)
+
+		events := make([]Event, len(room.Messages))
+		copy(events, room.Messages)
+		sort.SliceStable(events, func(i, j int) bool { return events[i].OriginServerTS < events[j].OriginServerTS })
+
+		posts := []*slack.IntermediatePost{}
+		postsByEventId := map[string]*slack.IntermediatePost{}
+		rootEventIds := map[string]string{}
+		timestamps := map[int64]bool{}
+		for _, event := range events {
+			if event.Type != EventTypeMessage || event.Content.MsgType == "" {
+				continue
+			}
+
+			if replaced := event.Content.Replaces(); replaced != "" {
+				if post, ok := postsByEventId[replaced]; ok && event.Content.NewContent != nil {
+					post.Message = t.convertMessage(logger, event.Content.NewContent, false, usernames)
+				}
+				continue
+			}
+
+			author, ok := t.Intermediate.UsersById[event.Sender]
+			if !ok {
+				logger.Warnf("Skipping the message %s as its sender %s is not a user", event.EventId, event.Sender)
+				continue
+			}
+
+			createAt := event.OriginServerTS
+			for timestamps[createAt] {
+				createAt++
+			}
+			timestamps[createAt] = true
+
+			replyTo := event.Content.ReplyTo()
+			post := &slack.IntermediatePost{
+				User:     author.Username,
+				Channel:  channel.Name,
+				Message:  t.convertMessage(logger, &event.Content, replyTo != "", usernames),
+				CreateAt: createAt,
+			}
+			postsByEventId[event.EventId] = post
+
+			rootEventId, ok := rootEventIds[replyTo]
+			root := postsByEventId[rootEventId]
+			if replyTo == "" || !ok || root == nil {
+				if replyTo != "" {
+					logger.Warnf("The message %s replies to %s, which is not in the export. It will be imported as a new thread.", event.EventId, replyTo)
+				}
+				rootEventIds[event.EventId] = event.EventId
+				posts = append(posts, post)
+				continue
+			}
+			rootEventIds[event.EventId] = rootEventId
+			root.Replies = append(root.Replies, post)
+		}
+
+		for _, post := range posts {
+			splitter.SplitLongPost(post, timestamps)
+		}
+
+		t.Intermediate.Posts = append(t.Intermediate.Posts, posts...)
+	}
+}
+
+// convertMessage returns the markdown message of a message content,
+// converted from its HTML body when it has one.
+func (t *Transformer) convertMessage(logger log.FieldLogger, content *EventContent, isReply bool, usernames map[string]string) string {
+	message := content.Body
+	if isReply {
+		message = stripReplyFallback(message)
+	}
+	if content.Format == FormatHTML && content.FormattedBody != "" {
+		converted, err := HTMLToMarkdown(content.FormattedBody, usernames)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to convert the HTML body of a message, using its plain text body")
+		} else {
+			message = converted
+		}
+	}
+
+	switch content.MsgType {
+	case "m.emote":
+		message = "_" + message + "_"
+	case "m.image", "m.file", "m.video", "m.audio":
+		logger.Warnf("The file %s can't be imported from a Matrix export. Only its name is kept.", content.Body)
+	}
+	return message
+}
+
+func (t *Transformer) populateUserMemberships() {
+	for _, channel := range t.channels() {
+		for _, userId := range channel.Members {
+			user := t.Intermediate.UsersById[userId]
+			user.Memberships = append(user.Memberships, channel.Name)
+			if channel.Creator == userId {
+				user.AdminMemberships = append(user.AdminMemberships, channel.Name)
+			}
+		}
+	}
+}
+
+// Export writes the intermediate data as a Mattermost import file.
+func (t *Transformer) Export(outputFilePath string) error {
+	exporter := slack.NewTransformer(t.TeamName, t.Logger)
+	exporter.Intermediate = t.Intermediate
+	return exporter.Export(outputFilePath)
+}
+
+// splitUserId splits a Matrix user id like @alice:example.org into its
+// localpart and server name.
+func splitUserId(userId string) (localpart, server string) {
+	localpart, server, _ = strings.Cut(strings.TrimPrefix(userId, "@"), ":")
+	return localpart, server
+}
+
+func normalizeUsername(localpart string) string {
+	username := invalidUsernameCharacters.ReplaceAllString(strings.ToLower(localpart), "_")
+	if username == "" || !model.IsValidUsername(username) {
+		username = "matrix_" + username
+	}
+	if len(username) > model.UserNameMaxLength {
+		username = username[:model.UserNameMaxLength]
+	}
+	return username
+}
+
+func truncateRunes(s string, i int) string {
+	runes := []rune(s)
+	if len(runes) > i {
+		return string(runes[:i])
+	}
+	return s
+}
+
+func channelName(roomName string) string {
+	return strings.Trim(invalidChannelNameCharacters.ReplaceAllString(strings.ToLower(roomName), "-"), "-")
+}
+
+// uniqueName returns name, or name numbered with a suffix if it's already
+// taken, and marks the result as taken.
+func uniqueName(name string, taken map[string]bool) string {
+	result := name
+	for i := 2; taken[result]; i++ {
+		result = fmt.Sprintf("%s-%d", name, i)
+	}
+	taken[result] = true
+	return result
+}
+
+func (t *Transformer) channels() []*slack.IntermediateChannel {
+	channels := append([]*slack.IntermediateChannel{}, t.Intermediate.PublicChannels...)
+	return append(channels, t.Intermediate.PrivateChannels...)
+}
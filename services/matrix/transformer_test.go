@@ -0,0 +1,118 @@
+package matrix
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformRoomExport(t *testing.T) {
+	rooms, err := ParseExportFile("testdata/room.json")
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+
+	transformer := NewTransformer("test", log.New())
+	transformer.Transform(rooms)
+
+	t.Run("users", func(t *testing.T) {
+		require.Len(t, transformer.Intermediate.UsersById, 3)
+		alice := transformer.Intermediate.UsersById["@alice:example.org"]
+		assert.Equal(t, "alice", alice.Username)
+		assert.Equal(t, "Alice Liddell", alice.FirstName)
+		assert.Equal(t, "alice@example.org", alice.Email)
+		assert.Equal(t, []string{"project-updates"}, alice.Memberships)
+		assert.Equal(t, []string{"project-updates"}, alice.AdminMemberships)
+
+		bob := transformer.Intermediate.UsersById["@Bob.Smith:matrix.org"]
+		assert.Equal(t, "bob.smith", bob.Username)
+		assert.Empty(t, bob.AdminMemberships)
+	})
+
+	t.Run("channels", func(t *testing.T) {
+		require.Len(t, transformer.Intermediate.PublicChannels, 1)
+		assert.Empty(t, transformer.Intermediate.PrivateChannels)
+		channel := transformer.Intermediate.PublicChannels[0]
+		assert.Equal(t, "project-updates", channel.Name)
+		assert.Equal(t, "Project Updates", channel.DisplayName)
+		assert.Equal(t, "Weekly status of the project", channel.Purpose)
+		assert.Equal(t, model.ChannelTypeOpen, channel.Type)
+		assert.Equal(t, []string{"@Bob.Smith:matrix.org", "@alice:example.org", "@carol:example.org"}, channel.Members)
+	})
+
+	t.Run("reply thread", func(t *testing.T) {
+		posts := transformer.Intermediate.Posts
+		require.Len(t, posts, 2)
+
+		root := posts[0]
+		assert.Equal(t, "alice", root.User)
+		assert.Equal(t, "project-updates", root.Channel)
+		assert.Equal(t, "The **release** is ready, @bob.smith please check", root.Message)
+		assert.Equal(t, int64(1695219800000), root.CreateAt)
+
+		// the reply to the reply is part of the same thread
+		require.Len(t, root.Replies, 2)
+		assert.Equal(t, "bob.smith", root.Replies[0].User)
+		assert.Equal(t, "Looks good to me", root.Replies[0].Message)
+		assert.Equal(t, "alice", root.Replies[1].User)
+		assert.Equal(t, "Thanks! Merging _now_", root.Replies[1].Message)
+
+		assert.Equal(t, "carol", posts[1].User)
+		assert.Equal(t, "Unrelated message", posts[1].Message)
+		assert.Empty(t, posts[1].Replies)
+	})
+}
+
+func TestTransformRoomExportMissingReplyTarget(t *testing.T) {
+	room := &RoomExport{
+		RoomName: "Random",
+		Messages: []Event{
+			{Type: EventTypeMessage, RoomId: "!room:example.org", EventId: "$1", Sender: "@alice:example.org", OriginServerTS: 1000,
+				Content: EventContent{MsgType: "m.text", Body: "> <@bob:example.org> gone\n\nreply", RelatesTo: &RelatesTo{InReplyTo: &InReplyTo{EventId: "$missing"}}}},
+			{Type: EventTypeMessage, RoomId: "!room:example.org", EventId: "$2", Sender: "@alice:example.org", OriginServerTS: 1000,
+				Content: EventContent{MsgType: "m.emote", Body: "waves"}},
+		},
+	}
+
+	transformer := NewTransformer("test", log.New())
+	transformer.Transform([]*RoomExport{room})
+
+	require.Len(t, transformer.Intermediate.PrivateChannels, 1)
+	require.Len(t, transformer.Intermediate.Posts, 2)
+	assert.Equal(t, "reply", transformer.Intermediate.Posts[0].Message)
+	assert.Equal(t, "_waves_", transformer.Intermediate.Posts[1].Message)
+	// posts at the same time get distinct timestamps
+	assert.Equal(t, int64(1001), transformer.Intermediate.Posts[1].CreateAt)
+}
+
+func TestTransformRoomExportLongMessage(t *testing.T) {
+	long := strings.TrimSpace(strings.Repeat("word ", model.PostMessageMaxRunesV2/5+10))
+	room := &RoomExport{
+		RoomName: "Random",
+		Messages: []Event{
+			{Type: EventTypeMessage, RoomId: "!room:example.org", EventId: "$1", Sender: "@alice:example.org", OriginServerTS: 1000,
+				Content: EventContent{MsgType: "m.text", Body: long}},
+			{Type: EventTypeMessage, RoomId: "!room:example.org", EventId: "$2", Sender: "@bob:example.org", OriginServerTS: 5000,
+				Content: EventContent{MsgType: "m.text", Body: "a reply", RelatesTo: &RelatesTo{InReplyTo: &InReplyTo{EventId: "$1"}}}},
+		},
+	}
+
+	transformer := NewTransformer("test", log.New())
+	transformer.Transform([]*RoomExport{room})
+
+	// the message is split instead of truncated, and the continuation
+	// comes before the reply
+	require.Len(t, transformer.Intermediate.Posts, 1)
+	root := transformer.Intermediate.Posts[0]
+	require.Len(t, root.Replies, 2)
+	assert.Equal(t, "alice", root.Replies[0].User)
+	assert.Equal(t, "a reply", root.Replies[1].Message)
+	assert.Greater(t, root.Replies[1].CreateAt, root.Replies[0].CreateAt)
+
+	assert.Equal(t, long, root.Message+" "+root.Replies[0].Message)
+	assert.LessOrEqual(t, utf8.RuneCountInString(root.Message), model.PostMessageMaxRunesV2)
+}
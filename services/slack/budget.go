@@ -0,0 +1,119 @@
+package slack
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// SkippedAttachment is a file left out of the import as it would have
+// exceeded Options.AttachmentsSizeLimit. Size is -1 when unknown.
+type SkippedAttachment struct {
+	FileId   string
+	Name     string
+	Size     int64
+	Channel  string
+	CreateAt int64
+}
+
+// attachmentSize returns the size of a file, taken from the export if it
+// is included in it, or -1 if it isn't known.
+func attachmentSize(file *SlackFile, uploads map[string]*zip.File) int64 {
+	if zipFile, ok := uploads[file.Id]; ok {
+		return int64(zipFile.UncompressedSize64)
+	}
+	if file.Size > 0 {
+		return file.Size
+	}
+	return -1
+}
+
+// reserveAttachmentSize counts the size of a file against
+// AttachmentsSizeLimit and reports whether it fits. Files shared in
+// several posts are only counted once. Files of unknown size fit while
+// the limit isn't reached, and are counted by addAttachmentSize once
+// written.
+func (t *Transformer) reserveAttachmentSize(fileId string, size int64) bool {
+	t.attachmentsMutex.Lock()
+	defer t.attachmentsMutex.Unlock()
+
+	if _, ok := t.budgetedFiles[fileId]; ok {
+		return true
+	}
+	if size < 0 {
+		if t.attachmentsSize >= t.Options.AttachmentsSizeLimit {
+			return false
+		}
+	} else if t.attachmentsSize+size > t.Options.AttachmentsSizeLimit {
+		return false
+	}
+
+	if t.budgetedFiles == nil {
+		t.budgetedFiles = map[string]int64{}
+	}
+	t.budgetedFiles[fileId] = size
+	t.attachmentsSize += max(size, 0)
+	return true
+}
+
+// addAttachmentSize counts the size of a file whose size wasn't known
+// when it was reserved.
+func (t *Transformer) addAttachmentSize(fileId string, size int64) {
+	t.attachmentsMutex.Lock()
+	defer t.attachmentsMutex.Unlock()
+	if reserved, ok := t.budgetedFiles[fileId]; ok && reserved < 0 {
+		t.budgetedFiles[fileId] = size
+		t.attachmentsSize += size
+	}
+}
+
+// releaseAttachmentSize gives back the size reserved for a file that
+// couldn't be added.
+func (t *Transformer) releaseAttachmentSize(fileId string) {
+	t.attachmentsMutex.Lock()
+	defer t.attachmentsMutex.Unlock()
+	if reserved, ok := t.budgetedFiles[fileId]; ok {
+		delete(t.budgetedFiles, fileId)
+		t.attachmentsSize -= max(reserved, 0)
+	}
+}
+
+func (t *Transformer) recordSkippedAttachment(skipped SkippedAttachment) {
+	t.attachmentsMutex.Lock()
+	defer t.attachmentsMutex.Unlock()
+	t.skippedAttachments = append(t.skippedAttachments, skipped)
+}
+
+// SkippedAttachments returns the files left out of the import as they
+// would have exceeded AttachmentsSizeLimit, in the order they were found.
+func (t *Transformer) SkippedAttachments() []SkippedAttachment {
+	t.attachmentsMutex.Lock()
+	defer t.attachmentsMutex.Unlock()
+	return slices.Clone(t.skippedAttachments)
+}
+
+// WriteSkippedAttachmentsReport writes the skipped attachments as a CSV
+// file with the id, name and size of each file and the channel and
+// timestamp of its post.
+func WriteSkippedAttachmentsReport(w io.Writer, skipped []SkippedAttachment) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"file_id", "name", "size", "channel", "create_at"}); err != nil {
+		return err
+	}
+	for _, attachment := range skipped {
+		record := []string{
+			attachment.FileId,
+			attachment.Name,
+			strconv.FormatInt(attachment.Size, 10),
+			attachment.Channel,
+			strconv.FormatInt(attachment.CreateAt, 10),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,233 @@
+package slack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Checkpoint records the work done by a transformation, so a run that is
+// interrupted can be resumed without transforming again the channels that
+// were completed or downloading again their files. Resuming is only
+// correct with the same export and flags as the interrupted run.
+//
+// The checkpoint file holds JSON records, one per line, that are appended
+// as the channels complete and the files are downloaded, so the cost of
+// saving it doesn't grow with the posts recorded so far. The record of a
+// channel carries the users, placeholders, sanitize changes and warnings
+// added since the previous one. With several concurrent channels, that
+// includes the ones added so far by the channels in progress.
+type Checkpoint struct {
+	mu   sync.Mutex
+	path string
+
+	// Channels holds the posts of the completed channels by name.
+	Channels map[string][]*IntermediatePost
+	// Users holds the users recorded so far, including the placeholders
+	// created for the completed channels.
+	Users map[string]*IntermediateUser
+	// Files holds the ids of the downloaded files.
+	Files map[string]bool
+	// PlaceholderKinds holds the kind of the placeholder users created
+	// for the completed channels by their id.
+	PlaceholderKinds map[string]string
+	// SanitizeChanges holds the changes made to the users created for
+	// the completed channels.
+	SanitizeChanges []SanitizeChange
+	// Warnings holds the warnings logged while transforming the posts of
+	// the completed channels.
+	Warnings []Warning
+
+	// sanitizeOffset and warningsOffset are the number of sanitize
+	// changes and warnings of the transformer already recorded, or that
+	// belong to the steps before the posts, which a resumed run repeats.
+	sanitizeOffset int
+	warningsOffset int
+}
+
+// checkpointRecord is a line of the checkpoint file, either a completed
+// channel or a downloaded file.
+type checkpointRecord struct {
+	Channel          string                       `json:"channel,omitempty"`
+	Posts            []*IntermediatePost          `json:"posts,omitempty"`
+	Users            map[string]*IntermediateUser `json:"users,omitempty"`
+	Files            []string                     `json:"files,omitempty"`
+	PlaceholderKinds map[string]string            `json:"placeholder_kinds,omitempty"`
+	SanitizeChanges  []SanitizeChange             `json:"sanitize_changes,omitempty"`
+	Warnings         []Warning                    `json:"warnings,omitempty"`
+}
+
+// LoadCheckpoint reads the checkpoint at filePath, or returns an empty one
+// that will be saved there if the file doesn't exist. A last record cut
+// short by an interruption is discarded.
+func LoadCheckpoint(filePath string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{
+		path:             filePath,
+		Channels:         map[string][]*IntermediatePost{},
+		Users:            map[string]*IntermediateUser{},
+		Files:            map[string]bool{},
+		PlaceholderKinds: map[string]string{},
+	}
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the checkpoint")
+	}
+
+	// every record ends with a newline, so anything after the last one
+	// is a record whose write was interrupted
+	complete := data[:bytes.LastIndexByte(data, '\n')+1]
+	reader := bufio.NewReader(bytes.NewReader(complete))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		var record checkpointRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, errors.Wrap(err, "failed to parse the checkpoint")
+		}
+		checkpoint.apply(record)
+	}
+
+	if len(complete) < len(data) {
+		if err := os.Truncate(filePath, int64(len(complete))); err != nil {
+			return nil, errors.Wrap(err, "failed to discard the interrupted record of the checkpoint")
+		}
+	}
+	return checkpoint, nil
+}
+
+func (c *Checkpoint) apply(record checkpointRecord) {
+	if record.Channel != "" {
+		c.Channels[record.Channel] = record.Posts
+	}
+	for id, user := range record.Users {
+		c.Users[id] = user
+	}
+	for _, fileID := range record.Files {
+		c.Files[fileID] = true
+	}
+	for id, kind := range record.PlaceholderKinds {
+		c.PlaceholderKinds[id] = kind
+	}
+	c.SanitizeChanges = append(c.SanitizeChanges, record.SanitizeChanges...)
+	c.Warnings = append(c.Warnings, record.Warnings...)
+}
+
+// channelPosts returns the posts of a completed channel.
+func (c *Checkpoint) channelPosts(channelName string) ([]*IntermediatePost, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	posts, ok := c.Channels[channelName]
+	return posts, ok
+}
+
+// restoreCheckpoint adds the state of a checkpoint that the completed
+// channels left in the transformer: the users missing from it, which are
+// the placeholders created for their posts, along with the kind of the
+// placeholders, the sanitize changes and the warnings.
+func (t *Transformer) restoreCheckpoint(checkpoint *Checkpoint) {
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+
+	t.usersMutex.Lock()
+	for id, user := range checkpoint.Users {
+		if _, ok := t.Intermediate.UsersById[id]; !ok {
+			t.Intermediate.UsersById[id] = user
+		}
+	}
+	for id, kind := range checkpoint.PlaceholderKinds {
+		t.recordPlaceholderUser(id, kind)
+	}
+	t.usersMutex.Unlock()
+
+	t.recordSanitizeChanges(checkpoint.SanitizeChanges)
+	t.warnings.restore(checkpoint.Warnings)
+
+	checkpoint.sanitizeOffset = len(t.SanitizeChanges())
+	checkpoint.warningsOffset = t.warnings.len()
+}
+
+// completeCheckpointChannel records the posts of a channel along with the
+// state added to the transformer since the previous record, and appends
+// the record to the checkpoint file.
+func (t *Transformer) completeCheckpointChannel(checkpoint *Checkpoint, channelName string, posts []*IntermediatePost) error {
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+
+	record := checkpointRecord{
+		Channel:          channelName,
+		Posts:            posts,
+		Users:            map[string]*IntermediateUser{},
+		PlaceholderKinds: map[string]string{},
+	}
+
+	t.usersMutex.RLock()
+	for id, user := range t.Intermediate.UsersById {
+		if _, ok := checkpoint.Users[id]; !ok {
+			record.Users[id] = user
+		}
+	}
+	for id, kind := range t.placeholderKinds {
+		if _, ok := checkpoint.PlaceholderKinds[id]; !ok {
+			record.PlaceholderKinds[id] = kind
+		}
+	}
+	t.usersMutex.RUnlock()
+
+	sanitizeChanges := t.SanitizeChanges()
+	record.SanitizeChanges = sanitizeChanges[checkpoint.sanitizeOffset:]
+	record.Warnings = t.warnings.since(checkpoint.warningsOffset)
+
+	if err := checkpoint.append(record); err != nil {
+		return err
+	}
+
+	checkpoint.apply(record)
+	checkpoint.sanitizeOffset = len(sanitizeChanges)
+	checkpoint.warningsOffset += len(record.Warnings)
+	return nil
+}
+
+func (c *Checkpoint) hasFile(fileID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Files[fileID]
+}
+
+// addFile records a downloaded file, so it isn't downloaded again even if
+// its channel is interrupted.
+func (c *Checkpoint) addFile(fileID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Files[fileID] = true
+	return c.append(checkpointRecord{Files: []string{fileID}})
+}
+
+// append writes a record at the end of the checkpoint file in a single
+// write, so an interruption leaves at most an incomplete last line.
+func (c *Checkpoint) append(record checkpointRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the checkpoint")
+	}
+
+	file, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to save the checkpoint")
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return errors.Wrap(err, "failed to save the checkpoint")
+	}
+	return errors.Wrap(file.Close(), "failed to save the checkpoint")
+}
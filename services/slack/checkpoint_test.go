@@ -0,0 +1,124 @@
+package slack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformCheckpoint(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte("report"))
+	}))
+	defer server.Close()
+
+	slackExport := func(alphaText string) *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "user1", Profile: SlackProfile{Email: "user1@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "alpha", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+				{Id: "C2", Name: "beta", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			},
+			Posts: map[string][]SlackPost{
+				// U9 is missing from the export, so a placeholder is created
+				"alpha": {{User: "U9", Text: alphaText, TimeStamp: "1577836800.000000", Type: "message"}},
+				"beta": {{User: "U1", Text: "a file", TimeStamp: "1577836801.000000", Type: "message", SubType: "file_share",
+					Files: []*SlackFile{{Id: "F1", Name: "report.txt", Size: -1, DownloadURL: server.URL + "/report.txt"}}}},
+			},
+		}
+	}
+
+	attachmentsDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(attachmentsDir, attachmentsInternal), 0755))
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	transform := func(t *testing.T, alphaText string) *Transformer {
+		checkpoint, err := LoadCheckpoint(checkpointPath)
+		require.NoError(t, err)
+
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.Checkpoint = checkpoint
+		require.NoError(t, slackTransformer.Transform(slackExport(alphaText), attachmentsDir, false, false, true, false, ""))
+		return slackTransformer
+	}
+
+	// the first run completes both channels, and is then cut back to
+	// an interruption after completing alpha, while writing beta
+	firstRun := transform(t, "hello")
+	require.EqualValues(t, 1, requests.Load())
+
+	checkpoint, err := LoadCheckpoint(checkpointPath)
+	require.NoError(t, err)
+	assert.Len(t, checkpoint.Channels, 2)
+	assert.True(t, checkpoint.Files["F1"])
+	assert.Contains(t, checkpoint.Users, "U9")
+	assert.Equal(t, map[string]string{"U9": PlaceholderKindMissing}, checkpoint.PlaceholderKinds)
+
+	data, err := os.ReadFile(checkpointPath)
+	require.NoError(t, err)
+	records := strings.SplitAfter(string(data), "\n")
+	require.Len(t, records, 4)
+	require.Contains(t, records[0], `"channel":"alpha"`)
+	require.Equal(t, `{"files":["F1"]}`+"\n", records[1])
+	require.NoError(t, os.WriteFile(checkpointPath, []byte(records[0]+records[1]+records[2][:len(records[2])/2]), 0600))
+
+	// the resumed run takes alpha from the checkpoint instead of the
+	// export, and doesn't download the file of beta again
+	resumedRun := transform(t, "changed in the export")
+	assert.EqualValues(t, 1, requests.Load())
+
+	require.Len(t, resumedRun.Intermediate.Posts, 2)
+	assert.Equal(t, "hello", resumedRun.Intermediate.Posts[0].Message)
+	assert.Equal(t, "u9", resumedRun.Intermediate.Posts[0].User)
+	require.Contains(t, resumedRun.Intermediate.UsersById, "U9")
+	assert.Equal(t, firstRun.Intermediate.UsersById["U9"].Password, resumedRun.Intermediate.UsersById["U9"].Password)
+	assert.Equal(t, firstRun.Intermediate.Posts, resumedRun.Intermediate.Posts)
+
+	// the state that the placeholder of alpha left is restored too
+	posts := slackExport("hello").Posts
+	require.Len(t, firstRun.PlaceholderUsers(posts), 1)
+	assert.Equal(t, firstRun.PlaceholderUsers(posts), resumedRun.PlaceholderUsers(posts))
+	assert.Equal(t, firstRun.SanitizeChanges(), resumedRun.SanitizeChanges())
+	require.NotZero(t, firstRun.WarningCount(WarningCategoryPlaceholder))
+	assert.Equal(t, firstRun.WarningCount(), resumedRun.WarningCount())
+	assert.Equal(t, firstRun.WarningCount(WarningCategoryPlaceholder), resumedRun.WarningCount(WarningCategoryPlaceholder))
+
+	contents, err := os.ReadFile(filepath.Join(attachmentsDir, resumedRun.Intermediate.Posts[1].Attachments[0]))
+	require.NoError(t, err)
+	assert.Equal(t, "report", string(contents))
+
+	// the interrupted record was replaced by the one of the resumed run
+	checkpoint, err = LoadCheckpoint(checkpointPath)
+	require.NoError(t, err)
+	assert.Len(t, checkpoint.Channels, 2)
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	t.Run("a missing checkpoint is empty", func(t *testing.T) {
+		checkpoint, err := LoadCheckpoint(filepath.Join(t.TempDir(), "checkpoint.json"))
+		require.NoError(t, err)
+		assert.Empty(t, checkpoint.Channels)
+		assert.Empty(t, checkpoint.Files)
+	})
+
+	t.Run("a corrupt checkpoint is rejected", func(t *testing.T) {
+		checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+		require.NoError(t, os.WriteFile(checkpointPath, []byte("{\n"), 0600))
+
+		_, err := LoadCheckpoint(checkpointPath)
+		require.ErrorContains(t, err, "failed to parse the checkpoint")
+	})
+}
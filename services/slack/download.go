@@ -25,17 +25,20 @@ var ErrOverlapNotEqual = errors.New("download: the downloaded file doesn't match
 // When the check fails, the function returns an error and doesn't silently re-download
 // the whole file. If the server doesn't support resumable downloads, the existing file will
 // be truncated and re-downloaded.
-func downloadInto(filename, url string, size int64) error {
+//
+// The token, if not empty, is sent as a bearer token to authorize the
+// download.
+func downloadInto(filename, url string, size int64, token string) error {
 	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0660)
 	if err != nil {
 		return fmt.Errorf("download: error opening the destination file: %w", err)
 	}
 	defer file.Close()
 
-	return resumeDownload(file, size, url)
+	return resumeDownload(file, size, url, token)
 }
 
-func resumeDownload(existing *os.File, size int64, downloadURL string) error {
+func resumeDownload(existing *os.File, size int64, downloadURL, token string) error {
 	existingSize, overlap, err := calculateSize(existing, size)
 	if err != nil {
 		return err
@@ -46,7 +49,7 @@ func resumeDownload(existing *os.File, size int64, downloadURL string) error {
 	}
 
 	start := existingSize - overlap // calculateSize makes sure this can't be negative
-	req, err := createRequest(downloadURL, start)
+	req, err := createRequest(downloadURL, start, token)
 	if err != nil {
 		return err
 	}
@@ -146,7 +149,7 @@ func calculateSize(existing *os.File, size int64) (existingSize, overlap int64,
 	return existingSize, overlap, nil
 }
 
-func createRequest(url string, start int64) (*http.Request, error) {
+func createRequest(url string, start int64, token string) (*http.Request, error) {
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("download: error creating HTTP request: %w", err)
@@ -154,6 +157,9 @@ func createRequest(url string, start int64) (*http.Request, error) {
 
 	req.Header.Set("User-Agent", "mmetl/1.0")
 	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
 	return req, nil
 }
@@ -29,7 +29,7 @@ func TestDownload(t *testing.T) {
 		fileName := filepath.Join(os.TempDir(), "download-test")
 		defer os.Remove(fileName)
 
-		require.NoError(t, downloadInto(fileName, srv.URL+"/no_resume", int64(len(mockData))))
+		require.NoError(t, downloadInto(fileName, srv.URL+"/no_resume", int64(len(mockData)), ""))
 		tempFile, _ := os.ReadFile(fileName)
 		require.Equal(t, mockData, tempFile)
 	})
@@ -39,7 +39,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, []byte{}, 0660))
 
-		require.NoError(t, downloadInto(fileName, srv.URL+"/resume", int64(len(mockData))))
+		require.NoError(t, downloadInto(fileName, srv.URL+"/resume", int64(len(mockData)), ""))
 		tempFile, _ := os.ReadFile(fileName)
 		require.Equal(t, mockData, tempFile)
 	})
@@ -49,7 +49,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, mockData[:8], 0660))
 
-		require.NoError(t, downloadInto(fileName, srv.URL+"/resume", int64(len(mockData))))
+		require.NoError(t, downloadInto(fileName, srv.URL+"/resume", int64(len(mockData)), ""))
 		tempFile, _ := os.ReadFile(fileName)
 		require.Equal(t, mockData, tempFile)
 	})
@@ -59,7 +59,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, mockData[:1024*512], 0660))
 
-		require.NoError(t, downloadInto(fileName, srv.URL+"/resume", int64(len(mockData))))
+		require.NoError(t, downloadInto(fileName, srv.URL+"/resume", int64(len(mockData)), ""))
 		tempFile, _ := os.ReadFile(fileName)
 		require.Equal(t, mockData, tempFile)
 	})
@@ -69,7 +69,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, mockData, 0660))
 
-		require.NoError(t, downloadInto(fileName, srv.URL+"/resume", int64(len(mockData))))
+		require.NoError(t, downloadInto(fileName, srv.URL+"/resume", int64(len(mockData)), ""))
 		tempFile, _ := os.ReadFile(fileName)
 		require.Equal(t, mockData, tempFile)
 	})
@@ -79,7 +79,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, []byte{}, 0660))
 
-		require.NoError(t, downloadInto(fileName, srv.URL+"/no_resume", int64(len(mockData))))
+		require.NoError(t, downloadInto(fileName, srv.URL+"/no_resume", int64(len(mockData)), ""))
 		tempFile, _ := os.ReadFile(fileName)
 		require.Equal(t, mockData, tempFile)
 	})
@@ -89,7 +89,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, mockData[:8], 0660))
 
-		require.NoError(t, downloadInto(fileName, srv.URL+"/no_resume", int64(len(mockData))))
+		require.NoError(t, downloadInto(fileName, srv.URL+"/no_resume", int64(len(mockData)), ""))
 		tempFile, _ := os.ReadFile(fileName)
 		require.Equal(t, mockData, tempFile)
 	})
@@ -99,7 +99,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, mockData[:1024*512], 0660))
 
-		require.NoError(t, downloadInto(fileName, srv.URL+"/no_resume", int64(len(mockData))))
+		require.NoError(t, downloadInto(fileName, srv.URL+"/no_resume", int64(len(mockData)), ""))
 		tempFile, _ := os.ReadFile(fileName)
 		require.Equal(t, mockData, tempFile)
 	})
@@ -109,7 +109,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, mockData, 0660))
 
-		require.NoError(t, downloadInto(fileName, srv.URL+"/no_resume", int64(len(mockData))))
+		require.NoError(t, downloadInto(fileName, srv.URL+"/no_resume", int64(len(mockData)), ""))
 		tempFile, _ := os.ReadFile(fileName)
 		require.Equal(t, mockData, tempFile)
 	})
@@ -119,7 +119,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, mockData[:8], 0660))
 
-		require.Error(t, downloadInto(fileName, srv.URL+"/wrong_resume", int64(len(mockData))))
+		require.Error(t, downloadInto(fileName, srv.URL+"/wrong_resume", int64(len(mockData)), ""))
 	})
 
 	t.Run("unsuccessful resume, half file", func(t *testing.T) {
@@ -127,7 +127,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, mockData[:1024*512], 0660))
 
-		require.Error(t, downloadInto(fileName, srv.URL+"/wrong_resume", int64(len(mockData))))
+		require.Error(t, downloadInto(fileName, srv.URL+"/wrong_resume", int64(len(mockData)), ""))
 	})
 
 	t.Run("successful resume from wrong file with an already downloaded file", func(t *testing.T) {
@@ -135,7 +135,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, mockData, 0660))
 
-		require.NoError(t, downloadInto(fileName, srv.URL+"/wrong_resume", int64(len(mockData))))
+		require.NoError(t, downloadInto(fileName, srv.URL+"/wrong_resume", int64(len(mockData)), ""))
 		tempFile, _ := os.ReadFile(fileName)
 		require.Equal(t, mockData, tempFile)
 	})
@@ -145,7 +145,7 @@ func TestDownload(t *testing.T) {
 		defer os.Remove(fileName)
 		require.NoError(t, os.WriteFile(fileName, mockData[:1024*512], 0660))
 
-		require.Error(t, downloadInto(fileName, srv.URL+"/wrong_path", int64(len(mockData))))
+		require.Error(t, downloadInto(fileName, srv.URL+"/wrong_path", int64(len(mockData)), ""))
 	})
 }
 
@@ -1,12 +1,17 @@
 package slack
 
 import (
+	"archive/zip"
+	"encoding/csv"
 	"encoding/json"
 	"io"
 	"log"
 	"math"
 	"os"
+	"path"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -21,6 +26,17 @@ const (
 
 var isValidChannelNameCharacters = regexp.MustCompile(`^[a-zA-Z0-9\-_]+$`).MatchString
 
+// IsValidChannelNamePrefix checks that a prefix keeps channel names valid
+// once prepended.
+func IsValidChannelNamePrefix(prefix string) bool {
+	return isValidChannelNameCharacters(prefix) && len(prefix) < model.ChannelNameMaxLength
+}
+
+// IsValidChannelName checks that a name can be used as is for a channel.
+func IsValidChannelName(name string) bool {
+	return isValidChannelNameCharacters(name) && len(name) > 1 && len(name) <= model.ChannelNameMaxLength
+}
+
 func truncateRunes(s string, i int) string {
 	runes := []rune(s)
 	if len(runes) > i {
@@ -98,16 +114,66 @@ func GetImportLineFromDirectChannel(team string, channel *IntermediateChannel) *
 	}
 }
 
+// GetImportLineFromTeam returns the line that creates a team the channels
+// are routed to. The teams are invite only, as their members are added by
+// the import.
+func GetImportLineFromTeam(team string) *imports.LineImportData {
+	return &imports.LineImportData{
+		Type: "team",
+		Team: &imports.TeamImportData{
+			Name:        model.NewString(team),
+			DisplayName: model.NewString(team),
+			Type:        model.NewString(model.TeamInvite),
+		},
+	}
+}
+
 func GetImportLineFromUser(user *IntermediateUser, team string) *imports.LineImportData {
-	channelMemberships := []imports.UserChannelImportData{}
+	return GetImportLineFromUserTeams(user, team, nil)
+}
+
+// GetImportLineFromUserTeams returns the line of a user whose channels can
+// belong to different teams. channelTeams maps the channels that aren't
+// in the given team to their team, and the user joins each team they have
+// a channel in besides the given team.
+func GetImportLineFromUserTeams(user *IntermediateUser, team string, channelTeams map[string]string) *imports.LineImportData {
+	teamNames := []string{team}
+	channelMembershipsByTeam := map[string][]imports.UserChannelImportData{team: {}}
 	for _, channelName := range user.Memberships {
-		channelMemberships = append(channelMemberships, imports.UserChannelImportData{
+		channelTeam := team
+		if otherTeam, ok := channelTeams[channelName]; ok {
+			channelTeam = otherTeam
+		}
+		if _, ok := channelMembershipsByTeam[channelTeam]; !ok {
+			teamNames = append(teamNames, channelTeam)
+		}
+
+		roles := model.ChannelUserRoleId
+		if slices.Contains(user.AdminMemberships, channelName) {
+			roles += " " + model.ChannelAdminRoleId
+		}
+
+		channelMembership := imports.UserChannelImportData{
 			Name:  model.NewString(channelName),
-			Roles: model.NewString(model.ChannelUserRoleId),
+			Roles: model.NewString(roles),
+		}
+		if slices.Contains(user.Favorites, channelName) {
+			channelMembership.Favorite = model.NewBool(true)
+		}
+		channelMembershipsByTeam[channelTeam] = append(channelMembershipsByTeam[channelTeam], channelMembership)
+	}
+
+	teams := []imports.UserTeamImportData{}
+	for _, teamName := range teamNames {
+		channelMemberships := channelMembershipsByTeam[teamName]
+		teams = append(teams, imports.UserTeamImportData{
+			Name:     model.NewString(teamName),
+			Channels: &channelMemberships,
+			Roles:    model.NewString(model.TeamUserRoleId),
 		})
 	}
 
-	return &imports.LineImportData{
+	line := &imports.LineImportData{
 		Type: "user",
 		User: &imports.UserImportData{
 			Username:  model.NewString(user.Username),
@@ -117,15 +183,14 @@ func GetImportLineFromUser(user *IntermediateUser, team string) *imports.LineImp
 			LastName:  model.NewString(user.LastName),
 			Position:  model.NewString(user.Position),
 			Roles:     model.NewString(model.SystemUserRoleId),
-			Teams: &[]imports.UserTeamImportData{
-				{
-					Name:     model.NewString(team),
-					Channels: &channelMemberships,
-					Roles:    model.NewString(model.TeamUserRoleId),
-				},
-			},
+			Teams:     &teams,
 		},
 	}
+	if user.AuthService != "" {
+		line.User.AuthService = model.NewString(user.AuthService)
+		line.User.AuthData = model.NewString(user.AuthData)
+	}
+	return line
 }
 
 func GetAttachmentImportDataFromPaths(paths []string) []imports.AttachmentImportData {
@@ -139,6 +204,24 @@ func GetAttachmentImportDataFromPaths(paths []string) []imports.AttachmentImport
 	return attachments
 }
 
+// GetReactionImportDataFromReactions returns nil when there are no
+// reactions so the field is omitted from the import line.
+func GetReactionImportDataFromReactions(reactions []*IntermediateReaction) *[]imports.ReactionImportData {
+	if len(reactions) == 0 {
+		return nil
+	}
+
+	reactionsImportData := []imports.ReactionImportData{}
+	for _, reaction := range reactions {
+		reactionsImportData = append(reactionsImportData, imports.ReactionImportData{
+			User:      model.NewString(reaction.User),
+			EmojiName: model.NewString(reaction.EmojiName),
+			CreateAt:  model.NewInt64(reaction.CreateAt),
+		})
+	}
+	return &reactionsImportData
+}
+
 // This function returns a slice of replies containing all the
 // attachments above the maximum number of attachments per post.
 // The attachments that would fit in a post need to be processed
@@ -195,6 +278,7 @@ func GetImportLineFromPost(post *IntermediatePost, team string) *imports.LineImp
 			Message:     &reply.Message,
 			CreateAt:    &reply.CreateAt,
 			Attachments: &replyAttachments,
+			Reactions:   GetReactionImportDataFromReactions(reply.Reactions),
 		}
 		replies = append(replies, newReply)
 	}
@@ -212,6 +296,8 @@ func GetImportLineFromPost(post *IntermediatePost, team string) *imports.LineImp
 				Replies:        &replies,
 				Attachments:    &postAttachments,
 				Type:           &post.Type,
+				Reactions:      GetReactionImportDataFromReactions(post.Reactions),
+				IsPinned:       isPinnedImportData(post),
 			},
 		}
 	} else {
@@ -227,6 +313,8 @@ func GetImportLineFromPost(post *IntermediatePost, team string) *imports.LineImp
 				Replies:     &replies,
 				Attachments: &postAttachments,
 				Type:        &post.Type,
+				Reactions:   GetReactionImportDataFromReactions(post.Reactions),
+				IsPinned:    isPinnedImportData(post),
 			},
 		}
 	}
@@ -234,6 +322,15 @@ func GetImportLineFromPost(post *IntermediatePost, team string) *imports.LineImp
 	return newPost
 }
 
+// isPinnedImportData returns the pinned flag of a post, leaving it out of
+// the import line for the posts that aren't pinned.
+func isPinnedImportData(post *IntermediatePost) *bool {
+	if !post.IsPinned {
+		return nil
+	}
+	return model.NewBool(true)
+}
+
 func ExportWriteLine(writer io.Writer, line *imports.LineImportData) error {
 	b, err := json.Marshal(line)
 	if err != nil {
@@ -257,10 +354,47 @@ func (t *Transformer) ExportVersion(writer io.Writer) error {
 	return ExportWriteLine(writer, versionLine)
 }
 
+// channelTeams returns the team of the public and private channels that
+// are imported into a team other than the team of the transformation, by
+// channel name.
+func (t *Transformer) channelTeams() map[string]string {
+	channelTeams := map[string]string{}
+	for _, channel := range append(slices.Clone(t.Intermediate.PublicChannels), t.Intermediate.PrivateChannels...) {
+		if channel.Team != "" {
+			channelTeams[channel.Name] = channel.Team
+		}
+	}
+	return channelTeams
+}
+
+// ExportTeams writes the teams that channels are routed to, sorted by
+// name. The team of the transformation is expected to exist already.
+func (t *Transformer) ExportTeams(writer io.Writer) error {
+	teams := []string{}
+	for _, team := range t.channelTeams() {
+		if team != t.TeamName && !slices.Contains(teams, team) {
+			teams = append(teams, team)
+		}
+	}
+	sort.Strings(teams)
+
+	for _, team := range teams {
+		if err := ExportWriteLine(writer, GetImportLineFromTeam(team)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // valid for open or private, as they export with no members
 func (t *Transformer) ExportChannels(channels []*IntermediateChannel, writer io.Writer) error {
 	for _, channel := range channels {
-		line := GetImportLineFromChannel(t.TeamName, channel)
+		team := t.TeamName
+		if channel.Team != "" {
+			team = channel.Team
+		}
+		line := GetImportLineFromChannel(team, channel)
 		if err := ExportWriteLine(writer, line); err != nil {
 			return err
 		}
@@ -269,6 +403,56 @@ func (t *Transformer) ExportChannels(channels []*IntermediateChannel, writer io.
 	return nil
 }
 
+// Orders of the exported channels.
+const (
+	ChannelSortName    = "name"
+	ChannelSortCreated = "created"
+	ChannelSortPosts   = "posts"
+)
+
+// SortChannels returns the channels of several lists in a single list,
+// stably sorted by Options.SortChannels: by name, from the oldest to the
+// newest, with the channels of unknown age last, or from the one with
+// most posts, counting replies, to the one with fewest.
+func (t *Transformer) SortChannels(lists ...[]*IntermediateChannel) []*IntermediateChannel {
+	channels := []*IntermediateChannel{}
+	for _, list := range lists {
+		channels = append(channels, list...)
+	}
+
+	switch t.Options.SortChannels {
+	case ChannelSortName:
+		sort.SliceStable(channels, func(i, j int) bool {
+			return channels[i].Name < channels[j].Name
+		})
+	case ChannelSortCreated:
+		sort.SliceStable(channels, func(i, j int) bool {
+			if channels[i].CreateAt == 0 || channels[j].CreateAt == 0 {
+				return channels[j].CreateAt == 0 && channels[i].CreateAt != 0
+			}
+			return channels[i].CreateAt < channels[j].CreateAt
+		})
+	case ChannelSortPosts:
+		type channelKey struct {
+			name     string
+			isDirect bool
+		}
+		counts := map[channelKey]int{}
+		for _, post := range t.Intermediate.Posts {
+			counts[channelKey{post.Channel, post.IsDirect}] += 1 + len(post.Replies)
+		}
+		count := func(channel *IntermediateChannel) int {
+			isDirect := channel.Type == model.ChannelTypeDirect || channel.Type == model.ChannelTypeGroup
+			return counts[channelKey{channel.Name, isDirect}]
+		}
+		sort.SliceStable(channels, func(i, j int) bool {
+			return count(channels[i]) > count(channels[j])
+		})
+	}
+
+	return channels
+}
+
 // valid for group or direct, as they export with members
 func (t *Transformer) ExportDirectChannels(channels []*IntermediateChannel, writer io.Writer) error {
 	for _, channel := range channels {
@@ -282,8 +466,15 @@ func (t *Transformer) ExportDirectChannels(channels []*IntermediateChannel, writ
 }
 
 func (t *Transformer) ExportUsers(writer io.Writer) error {
-	for _, user := range t.Intermediate.UsersById {
-		line := GetImportLineFromUser(user, t.TeamName)
+	userIds := make([]string, 0, len(t.Intermediate.UsersById))
+	for userId := range t.Intermediate.UsersById {
+		userIds = append(userIds, userId)
+	}
+	sort.Strings(userIds)
+
+	channelTeams := t.channelTeams()
+	for _, userId := range userIds {
+		line := GetImportLineFromUserTeams(t.Intermediate.UsersById[userId], t.TeamName, channelTeams)
 		if err := ExportWriteLine(writer, line); err != nil {
 			return err
 		}
@@ -292,13 +483,56 @@ func (t *Transformer) ExportUsers(writer io.Writer) error {
 	return nil
 }
 
+// ExportUsersCSV writes the users of the import as a CSV file, sorted by
+// id, with their username, email, name, position and system roles, for
+// the admins who provision the users out of band.
+func (t *Transformer) ExportUsersCSV(w io.Writer) error {
+	userIds := make([]string, 0, len(t.Intermediate.UsersById))
+	for userId := range t.Intermediate.UsersById {
+		userIds = append(userIds, userId)
+	}
+	sort.Strings(userIds)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"username", "email", "first_name", "last_name", "position", "roles"}); err != nil {
+		return err
+	}
+	for _, userId := range userIds {
+		user := t.Intermediate.UsersById[userId]
+		record := []string{
+			user.Username,
+			user.Email,
+			user.FirstName,
+			user.LastName,
+			user.Position,
+			model.SystemUserRoleId,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
 func (t *Transformer) ExportPosts(writer io.Writer) error {
-	for _, post := range t.Intermediate.Posts {
-		line := GetImportLineFromPost(post, t.TeamName)
+	channelTeams := t.channelTeams()
+	total := len(t.Intermediate.Posts)
+	t.reportProgress(ProgressPhaseExport, 0, total)
+	for i, post := range t.Intermediate.Posts {
+		team := t.TeamName
+		if channelTeam, ok := channelTeams[post.Channel]; ok {
+			team = channelTeam
+		}
+		line := GetImportLineFromPost(post, team)
 		if err := ExportWriteLine(writer, line); err != nil {
 			return err
 		}
+		if done := i + 1; done%exportProgressInterval == 0 && done < total {
+			t.reportProgress(ProgressPhaseExport, done, total)
+		}
 	}
+	t.reportProgress(ProgressPhaseExport, total, total)
 	return nil
 }
 
@@ -309,18 +543,103 @@ func (t *Transformer) Export(outputFilePath string) error {
 	}
 	defer outputFile.Close()
 
+	return t.ExportTo(outputFile)
+}
+
+// mmctlImportFileName and mmctlDataDir are the locations of the import
+// file and the attachments inside of an import zip file for mmctl.
+const (
+	mmctlImportFileName = "import.jsonl"
+	mmctlDataDir        = "data"
+)
+
+// ExportZip writes an import zip file for mmctl, with the import file at
+// the root and the attachments of the posts, read from attachmentsDir,
+// under the data directory. The attachment paths of the import file are
+// relative to the data directory, as with the plain bulk import.
+func (t *Transformer) ExportZip(outputFilePath, attachmentsDir string) error {
+	outputFile, err := os.Create(outputFilePath)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	zipWriter := zip.NewWriter(outputFile)
+
+	importWriter, err := zipWriter.Create(mmctlImportFileName)
+	if err != nil {
+		return err
+	}
+	if err := t.ExportTo(importWriter); err != nil {
+		return err
+	}
+
+	t.Logger.Info("Adding attachments to the zip file")
+	for _, attachment := range collectAttachmentPaths(t.Intermediate.Posts) {
+		if err := addFileToZip(zipWriter, path.Join(attachmentsDir, attachment), path.Join(mmctlDataDir, attachment)); err != nil {
+			return errors.Wrapf(err, "failed to add attachment %s to the zip file", attachment)
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	return outputFile.Close()
+}
+
+// collectAttachmentPaths returns the attachments of the posts and their
+// replies, without duplicates and sorted.
+func collectAttachmentPaths(posts []*IntermediatePost) []string {
+	seen := map[string]bool{}
+	for _, post := range posts {
+		for _, attachment := range post.Attachments {
+			seen[attachment] = true
+		}
+		for _, reply := range post.Replies {
+			for _, attachment := range reply.Attachments {
+				seen[attachment] = true
+			}
+		}
+	}
+
+	attachments := make([]string, 0, len(seen))
+	for attachment := range seen {
+		attachments = append(attachments, attachment)
+	}
+	sort.Strings(attachments)
+	return attachments
+}
+
+func addFileToZip(zipWriter *zip.Writer, filePath, name string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer, err := zipWriter.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// ExportTo writes the import lines of the transformed data to writer.
+func (t *Transformer) ExportTo(outputFile io.Writer) error {
 	t.Logger.Info("Exporting version")
 	if err := t.ExportVersion(outputFile); err != nil {
 		return err
 	}
 
-	t.Logger.Info("Exporting public channels")
-	if err := t.ExportChannels(t.Intermediate.PublicChannels, outputFile); err != nil {
+	t.Logger.Info("Exporting teams")
+	if err := t.ExportTeams(outputFile); err != nil {
 		return err
 	}
 
-	t.Logger.Info("Exporting private channels")
-	if err := t.ExportChannels(t.Intermediate.PrivateChannels, outputFile); err != nil {
+	t.Logger.Info("Exporting public and private channels")
+	if err := t.ExportChannels(t.SortChannels(t.Intermediate.PublicChannels, t.Intermediate.PrivateChannels), outputFile); err != nil {
 		return err
 	}
 
@@ -329,13 +648,8 @@ func (t *Transformer) Export(outputFilePath string) error {
 		return err
 	}
 
-	t.Logger.Info("Exporting group channels")
-	if err := t.ExportDirectChannels(t.Intermediate.GroupChannels, outputFile); err != nil {
-		return err
-	}
-
-	t.Logger.Info("Exporting direct channels")
-	if err := t.ExportDirectChannels(t.Intermediate.DirectChannels, outputFile); err != nil {
+	t.Logger.Info("Exporting group and direct channels")
+	if err := t.ExportDirectChannels(t.SortChannels(t.Intermediate.GroupChannels, t.Intermediate.DirectChannels), outputFile); err != nil {
 		return err
 	}
 
@@ -1,8 +1,15 @@
 package slack
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
 	"testing"
 
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,3 +43,233 @@ func TestSlackConvertTimeStamp(t *testing.T) {
 		})
 	}
 }
+
+func TestGetImportLineFromPostReactions(t *testing.T) {
+	t.Run("posts without reactions omit the field", func(t *testing.T) {
+		line := GetImportLineFromPost(&IntermediatePost{User: "u1", Channel: "c1"}, "team")
+		require.Nil(t, line.Post.Reactions)
+	})
+
+	t.Run("reactions are exported for posts and replies", func(t *testing.T) {
+		post := &IntermediatePost{
+			User:      "u1",
+			Channel:   "c1",
+			CreateAt:  1,
+			Reactions: []*IntermediateReaction{{User: "u2", EmojiName: "+1", CreateAt: 2}},
+			Replies: []*IntermediatePost{
+				{User: "u2", CreateAt: 3, Reactions: []*IntermediateReaction{{User: "u1", EmojiName: "tada", CreateAt: 4}}},
+			},
+		}
+
+		line := GetImportLineFromPost(post, "team")
+		require.NotNil(t, line.Post.Reactions)
+		require.Len(t, *line.Post.Reactions, 1)
+		require.Equal(t, "u2", *(*line.Post.Reactions)[0].User)
+		require.Equal(t, "+1", *(*line.Post.Reactions)[0].EmojiName)
+		require.Equal(t, int64(2), *(*line.Post.Reactions)[0].CreateAt)
+
+		replies := *line.Post.Replies
+		require.Len(t, replies, 1)
+		require.NotNil(t, replies[0].Reactions)
+		require.Equal(t, "tada", *(*replies[0].Reactions)[0].EmojiName)
+	})
+}
+
+func TestExportChannelPrefixTeams(t *testing.T) {
+	slackTransformer := NewTransformer("company", log.New())
+	slackTransformer.Options.ChannelPrefixTeams = map[string]string{
+		"eng-":       "engineering",
+		"eng-leads-": "leads",
+		"sales-":     "sales",
+	}
+
+	slackExport := &SlackExport{
+		Users: []SlackUser{
+			{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+			{Id: "U2", Username: "bob", Profile: SlackProfile{Email: "bob@example.com"}},
+			{Id: "U3", Username: "carol", Profile: SlackProfile{Email: "carol@example.com"}},
+		},
+		PublicChannels: []SlackChannel{
+			{Id: "C1", Name: "general", Members: []string{"U1", "U2", "U3"}, Type: model.ChannelTypeOpen},
+			{Id: "C2", Name: "eng-backend", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+			{Id: "C3", Name: "sales-emea", Members: []string{"U3"}, Type: model.ChannelTypeOpen},
+		},
+		PrivateChannels: []SlackChannel{
+			{Id: "G1", Name: "eng-leads-private", Members: []string{"U1"}, Type: model.ChannelTypePrivate},
+		},
+		Posts: map[string][]SlackPost{
+			"general":     {{User: "U1", Text: "hello", TimeStamp: "1695219800.000000", Type: "message"}},
+			"eng-backend": {{User: "U2", Text: "deploy", TimeStamp: "1695219810.000000", Type: "message"}},
+			"sales-emea":  {{User: "U3", Text: "deal", TimeStamp: "1695219820.000000", Type: "message"}},
+		},
+	}
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, slackTransformer.ExportTo(buf))
+
+	teams := []string{}
+	channelTeams := map[string]string{}
+	postTeams := map[string]string{}
+	userTeams := map[string]map[string][]string{}
+	for _, data := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var line imports.LineImportData
+		require.NoError(t, json.Unmarshal([]byte(data), &line))
+		switch line.Type {
+		case "team":
+			teams = append(teams, *line.Team.Name)
+			require.Equal(t, model.TeamInvite, *line.Team.Type)
+		case "channel":
+			channelTeams[*line.Channel.Name] = *line.Channel.Team
+		case "post":
+			postTeams[*line.Post.Message] = *line.Post.Team
+		case "user":
+			memberships := map[string][]string{}
+			for _, team := range *line.User.Teams {
+				channels := []string{}
+				for _, channel := range *team.Channels {
+					channels = append(channels, *channel.Name)
+				}
+				memberships[*team.Name] = channels
+			}
+			userTeams[*line.User.Username] = memberships
+		}
+	}
+
+	// the team of the transformation already exists
+	require.Equal(t, []string{"engineering", "leads", "sales"}, teams)
+	require.Equal(t, map[string]string{
+		"general":           "company",
+		"eng-backend":       "engineering",
+		"sales-emea":        "sales",
+		"eng-leads-private": "leads",
+	}, channelTeams)
+	require.Equal(t, map[string]string{"hello": "company", "deploy": "engineering", "deal": "sales"}, postTeams)
+	require.Equal(t, map[string]map[string][]string{
+		"alice": {"company": {"general"}, "engineering": {"eng-backend"}, "leads": {"eng-leads-private"}},
+		"bob":   {"company": {"general"}, "engineering": {"eng-backend"}},
+		"carol": {"company": {"general"}, "sales": {"sales-emea"}},
+	}, userTeams)
+}
+
+func TestExportUserAuth(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.AuthService = model.UserAuthServiceSaml
+	slackTransformer.Options.UserAuth = map[string]UserAuth{
+		"U2":    {Data: "bob-saml"},
+		"carol": {Service: model.UserAuthServiceGitlab, Data: "42"},
+	}
+	slackTransformer.TransformUsers([]SlackUser{
+		{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+		{Id: "U2", Username: "bob", Profile: SlackProfile{Email: "bob@example.com"}},
+		{Id: "U3", Username: "carol", Profile: SlackProfile{Email: "carol@example.com"}},
+	}, false, "")
+
+	for _, tc := range []struct {
+		UserId  string
+		Service string
+		Data    string
+	}{
+		{"U1", model.UserAuthServiceSaml, "alice@example.com"},
+		{"U2", model.UserAuthServiceSaml, "bob-saml"},
+		{"U3", model.UserAuthServiceGitlab, "42"},
+	} {
+		line := GetImportLineFromUser(slackTransformer.Intermediate.UsersById[tc.UserId], "test")
+		require.NotNil(t, line.User.AuthService, tc.UserId)
+		require.Equal(t, tc.Service, *line.User.AuthService, tc.UserId)
+		require.Equal(t, tc.Data, *line.User.AuthData, tc.UserId)
+		require.Nil(t, imports.ValidateUserImportData(line.User), tc.UserId)
+	}
+
+	t.Run("users are imported without auth by default", func(t *testing.T) {
+		line := GetImportLineFromUser(&IntermediateUser{Username: "dave", Email: "dave@example.com"}, "test")
+		require.Nil(t, line.User.AuthService)
+		require.Nil(t, line.User.AuthData)
+	})
+}
+
+func TestExportSortChannels(t *testing.T) {
+	slackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+				{Id: "U2", Username: "bob", Profile: SlackProfile{Email: "bob@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "random", Created: 1600000100, Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+				{Id: "C2", Name: "general", Created: 1600000300, Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+				{Id: "C3", Name: "unknown-age", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+			},
+			PrivateChannels: []SlackChannel{
+				{Id: "G1", Name: "leads", Created: 1600000200, Members: []string{"U1", "U2"}, Type: model.ChannelTypePrivate},
+			},
+			Posts: map[string][]SlackPost{
+				"random": {
+					{User: "U1", Text: "one", TimeStamp: "1695219800.000000", Type: "message"},
+					{User: "U2", Text: "two", TimeStamp: "1695219810.000000", Type: "message"},
+				},
+				"leads": {
+					{User: "U1", Text: "root", TimeStamp: "1695219820.000000", Type: "message", ThreadTS: "1695219820.000000"},
+					{User: "U2", Text: "reply", TimeStamp: "1695219830.000000", Type: "message", ThreadTS: "1695219820.000000"},
+					{User: "U1", Text: "another reply", TimeStamp: "1695219840.000000", Type: "message", ThreadTS: "1695219820.000000"},
+				},
+				"general": {{User: "U1", Text: "hello", TimeStamp: "1695219850.000000", Type: "message"}},
+			},
+		}
+	}
+
+	testCases := []struct {
+		order    string
+		expected []string
+	}{
+		{order: "", expected: []string{"random", "general", "unknown-age", "leads"}},
+		{order: ChannelSortName, expected: []string{"general", "leads", "random", "unknown-age"}},
+		{order: ChannelSortCreated, expected: []string{"random", "leads", "general", "unknown-age"}},
+		{order: ChannelSortPosts, expected: []string{"leads", "random", "general", "unknown-age"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.order, func(t *testing.T) {
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.SortChannels = tc.order
+			slackTransformer.Options.DiscardEmptyChannels = false
+			require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+			buf := &bytes.Buffer{}
+			require.NoError(t, slackTransformer.ExportTo(buf))
+
+			channels := []string{}
+			for _, data := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var line imports.LineImportData
+				require.NoError(t, json.Unmarshal([]byte(data), &line))
+				if line.Type == "channel" {
+					channels = append(channels, *line.Channel.Name)
+				}
+			}
+			require.Equal(t, tc.expected, channels)
+		})
+	}
+}
+
+func TestExportUsersCSV(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.TransformUsers([]SlackUser{
+		{Id: "U2", Username: "bob", Profile: SlackProfile{RealName: "Bob Jones", Title: "Engineer", Email: "bob@example.com"}},
+		{Id: "U1", Username: "alice", Profile: SlackProfile{RealName: "Alice Smith", Email: "alice@example.com"}},
+		{Id: "U3", Username: "carol", Profile: SlackProfile{Email: "carol@example.com"}},
+	}, false, "")
+
+	var b bytes.Buffer
+	require.NoError(t, slackTransformer.ExportUsersCSV(&b))
+
+	records, err := csv.NewReader(&b).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, []string{"username", "email", "first_name", "last_name", "position", "roles"}, records[0])
+	require.Len(t, records, 4)
+
+	for i, userId := range []string{"U1", "U2", "U3"} {
+		user := slackTransformer.Intermediate.UsersById[userId]
+		require.Equal(t, []string{user.Username, user.Email, user.FirstName, user.LastName, user.Position, model.SystemUserRoleId}, records[i+1])
+	}
+	require.Equal(t, []string{"bob", "bob@example.com", "Bob", "Jones", "Engineer", model.SystemUserRoleId}, records[2])
+}
@@ -0,0 +1,154 @@
+package slack
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// GetChannelTeams assigns each channel of an Enterprise Grid export to the
+// workspace its posts belong to, using the team attribute of the posts.
+// Posts without the attribute are ignored and the team with most posts
+// wins. Channels where the vote is tied, or where no post carries the
+// attribute, are left unassigned.
+func (t *Transformer) GetChannelTeams(posts map[string][]SlackPost) map[string]string {
+	channelTeams := map[string]string{}
+
+	for channelName, channelPosts := range posts {
+		votes := map[string]int{}
+		missing := 0
+		for _, post := range channelPosts {
+			if post.Team == "" {
+				missing++
+				continue
+			}
+			votes[post.Team]++
+		}
+
+		if len(votes) == 0 {
+			t.Logger.Debugf("Channel %s has no posts with a team attribute", channelName)
+			continue
+		}
+
+		teams := make([]string, 0, len(votes))
+		for team := range votes {
+			teams = append(teams, team)
+		}
+		sort.Slice(teams, func(i, j int) bool {
+			if votes[teams[i]] == votes[teams[j]] {
+				return teams[i] < teams[j]
+			}
+			return votes[teams[i]] > votes[teams[j]]
+		})
+
+		if len(teams) > 1 && votes[teams[0]] == votes[teams[1]] {
+			t.Logger.Warnf("Unable to assign channel %s to a team as its posts are evenly split between teams %s and %s", channelName, teams[0], teams[1])
+			continue
+		}
+
+		if missing > 0 || len(teams) > 1 {
+			t.Logger.Debugf("Assigning channel %s to team %s with %d of %d posts", channelName, teams[0], votes[teams[0]], len(channelPosts))
+		}
+		channelTeams[channelName] = teams[0]
+	}
+
+	return channelTeams
+}
+
+// NamespaceDuplicateUsernames appends the workspace of each user to the
+// usernames that several users of an Enterprise Grid export share, as
+// the import identifies users by username and would otherwise merge them
+// into one. Users of the same workspace, or without one, get their id
+// appended instead. The users.json of the organization lists every user,
+// so the separate imports of each workspace get the same usernames. It
+// has to run before the mentions of the posts are converted.
+func (t *Transformer) NamespaceDuplicateUsernames(users []SlackUser) {
+	type workspaceUsername struct {
+		username  string
+		workspace string
+	}
+	idsByUsername := map[string]map[string]bool{}
+	usersByWorkspace := map[workspaceUsername]int{}
+	for _, user := range users {
+		if idsByUsername[user.Username] == nil {
+			idsByUsername[user.Username] = map[string]bool{}
+		}
+		idsByUsername[user.Username][user.Id] = true
+		usersByWorkspace[workspaceUsername{user.Username, user.TeamId}]++
+	}
+
+	namespaced := func(username, namespace string) string {
+		suffix := "-" + strings.ToLower(namespace)
+		return truncateRunes(username, model.UserNameMaxLength-len(suffix)) + suffix
+	}
+
+	usernames := make([]string, len(users))
+	for i, user := range users {
+		usernames[i] = user.Username
+		if len(idsByUsername[user.Username]) < 2 {
+			continue
+		}
+
+		username := namespaced(user.Username, user.Id)
+		if user.TeamId != "" && usersByWorkspace[workspaceUsername{user.Username, user.TeamId}] == 1 {
+			if candidate := namespaced(user.Username, user.TeamId); idsByUsername[candidate] == nil {
+				username = candidate
+			}
+		}
+
+		t.Logger.Infof("Renaming the user %s with id %s to %s as other users of the export have the same username", user.Username, user.Id, username)
+		usernames[i] = username
+	}
+
+	for i := range users {
+		users[i].Username = usernames[i]
+	}
+}
+
+// ReconcileConversations takes the members of the direct and group
+// conversations from dms.json and mpims.json, where Enterprise Grid
+// exports keep their membership, for the copies of them listed among the
+// public or private channels, falling back to the members of those copies
+// when the conversation has none. The posts of the folders named after
+// the id of a conversation that has a name are moved to the folder named
+// after it, which is the one the transformation looks for.
+func (t *Transformer) ReconcileConversations(slackExport *SlackExport) {
+	conversations := map[string]*SlackChannel{}
+	for _, channels := range [][]SlackChannel{slackExport.DirectChannels, slackExport.GroupChannels} {
+		for i := range channels {
+			conversations[channels[i].Id] = &channels[i]
+		}
+	}
+
+	for _, channels := range [][]SlackChannel{slackExport.PublicChannels, slackExport.PrivateChannels} {
+		for i := range channels {
+			conversation, ok := conversations[channels[i].Id]
+			if !ok {
+				continue
+			}
+			switch {
+			case len(conversation.Members) > 0:
+				if !slices.Equal(channels[i].Members, conversation.Members) {
+					t.Logger.Debugf("Using the members of the conversation %s from its top level file", conversation.Id)
+					channels[i].Members = conversation.Members
+				}
+			case len(channels[i].Members) > 0:
+				t.Logger.Debugf("Using the members of the conversation %s from its channel list as its top level file has none", conversation.Id)
+				conversation.Members = channels[i].Members
+			}
+		}
+	}
+
+	for _, conversation := range conversations {
+		name := getOriginalName(*conversation)
+		posts, ok := slackExport.Posts[conversation.Id]
+		if name == conversation.Id || !ok {
+			continue
+		}
+		t.Logger.Infof("Reading the posts of the conversation %s from the folder %s named after its id", name, conversation.Id)
+		slackExport.Posts[name] = append(slackExport.Posts[name], posts...)
+		delete(slackExport.Posts, conversation.Id)
+	}
+}
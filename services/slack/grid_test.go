@@ -0,0 +1,170 @@
+package slack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetChannelTeams(t *testing.T) {
+	logger := log.New()
+	buf := &bytes.Buffer{}
+	logger.SetOutput(buf)
+	slackTransformer := NewTransformer("test", logger)
+
+	posts := map[string][]SlackPost{
+		"consistent": {{Team: "T1"}, {Team: "T1"}},
+		"mixed":      {{Team: "T1"}, {Team: "T2"}, {}, {Team: "T2"}, {}},
+		"tied":       {{Team: "T1"}, {Team: "T2"}, {}},
+		"missing":    {{}, {}},
+	}
+
+	channelTeams := slackTransformer.GetChannelTeams(posts)
+
+	require.Equal(t, map[string]string{"consistent": "T1", "mixed": "T2"}, channelTeams)
+	require.Contains(t, buf.String(), "Unable to assign channel tied to a team as its posts are evenly split between teams T1 and T2")
+}
+
+func TestTransformGridChannelTeams(t *testing.T) {
+	logger := log.New()
+	buf := &bytes.Buffer{}
+	logger.SetOutput(buf)
+	slackTransformer := NewTransformer("company", logger)
+	slackTransformer.Options.SlackTeamTeams = map[string]string{"T1": "east", "T2": "west"}
+
+	post := func(team, text string) SlackPost {
+		return SlackPost{User: "U1", Team: team, Text: text, TimeStamp: "1695219800.000000", Type: "message"}
+	}
+	slackExport := &SlackExport{
+		Users: []SlackUser{{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}}},
+		PublicChannels: []SlackChannel{
+			{Id: "C1", Name: "consistent", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			{Id: "C2", Name: "mixed", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			{Id: "C3", Name: "tied", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			{Id: "C4", Name: "missing", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			{Id: "C5", Name: "unmapped", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+		},
+		Posts: map[string][]SlackPost{
+			"consistent": {post("T1", "a"), post("T1", "b")},
+			"mixed":      {post("T1", "a"), post("T2", "b"), post("", "c"), post("T2", "d"), post("", "e")},
+			"tied":       {post("T1", "a"), post("T2", "b"), post("", "c")},
+			"missing":    {post("", "a"), post("", "b")},
+			"unmapped":   {post("T3", "a")},
+		},
+	}
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	channelTeams := map[string]string{}
+	for _, channel := range slackTransformer.Intermediate.PublicChannels {
+		channelTeams[channel.Name] = channel.Team
+	}
+	require.Equal(t, map[string]string{
+		"consistent": "east",
+		"mixed":      "west",
+		"tied":       "",
+		"missing":    "",
+		"unmapped":   "",
+	}, channelTeams)
+	require.Contains(t, buf.String(), "Unable to assign channel tied to a team as its posts are evenly split between teams T1 and T2")
+}
+
+func TestNamespaceGridUsernames(t *testing.T) {
+	zipReader := createZipReader(t, map[string]string{
+		"users.json": `[
+			{"id": "U1", "team_id": "T1", "name": "alice", "profile": {"email": "alice@one.example.com"}},
+			{"id": "U2", "team_id": "T2", "name": "alice", "profile": {"email": "alice@two.example.com"}},
+			{"id": "U3", "team_id": "T1", "name": "bob", "profile": {"email": "bob@example.com"}}
+		]`,
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1", "U2", "U3"]}]`,
+		"general/2020-01-01.json": `[
+			{"type": "message", "user": "U1", "text": "hi <@U2>", "ts": "1577836800.000000"},
+			{"type": "message", "user": "U2", "text": "hi <@U1>", "ts": "1577836801.000000"}
+		]`,
+	})
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.NamespaceGridUsernames = true
+	slackExport, err := slackTransformer.ParseSlackExportFile(zipReader, false)
+	require.NoError(t, err)
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	users := slackTransformer.Intermediate.UsersById
+	require.Len(t, users, 3)
+	require.Equal(t, "alice-t1", users["U1"].Username)
+	require.Equal(t, "alice-t2", users["U2"].Username)
+	require.Equal(t, "bob", users["U3"].Username)
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 2)
+	require.Equal(t, "alice-t1", posts[0].User)
+	require.Equal(t, "hi @alice-t2", posts[0].Message)
+	require.Equal(t, "alice-t2", posts[1].User)
+	require.Equal(t, "hi @alice-t1", posts[1].Message)
+}
+
+func TestNamespaceDuplicateUsernamesSameWorkspace(t *testing.T) {
+	users := []SlackUser{
+		{Id: "U1", TeamId: "T1", Username: "alice"},
+		{Id: "U2", TeamId: "T1", Username: "alice"},
+		{Id: "U3", Username: "carol"},
+		{Id: "U4", Username: "carol"},
+	}
+
+	NewTransformer("test", log.New()).NamespaceDuplicateUsernames(users)
+
+	usernames := []string{}
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+	require.Equal(t, []string{"alice-u1", "alice-u2", "carol-u3", "carol-u4"}, usernames)
+}
+
+func TestReconcileGridConversations(t *testing.T) {
+	zipReader := createZipReader(t, map[string]string{
+		"users.json": `[
+			{"id": "U1", "name": "alice", "profile": {"email": "alice@example.com"}},
+			{"id": "U2", "name": "bob", "profile": {"email": "bob@example.com"}},
+			{"id": "U3", "name": "carol", "profile": {"email": "carol@example.com"}}
+		]`,
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1", "U2", "U3"]}]`,
+		// the group message is listed among the private channels without
+		// its members, which are only in mpims.json
+		"groups.json": `[{"id": "G1", "name": "mpdm-alice--bob--carol-1", "is_mpim": true}]`,
+		"dms.json":    `[{"id": "D1", "members": ["U1", "U2"]}]`,
+		"mpims.json":  `[{"id": "G1", "name": "mpdm-alice--bob--carol-1", "members": ["U1", "U2", "U3"]}]`,
+		"D1/2020-01-01.json": `[
+			{"type": "message", "user": "U1", "text": "hi bob", "ts": "1577836800.000000"},
+			{"type": "message", "user": "U2", "text": "hi alice", "ts": "1577836801.000000"}
+		]`,
+		// the group message folder is named after its id
+		"G1/2020-01-01.json": `[{"type": "message", "user": "U3", "text": "hi all", "ts": "1577836802.000000"}]`,
+	})
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackExport, err := slackTransformer.ParseSlackExportFile(zipReader, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"U1", "U2", "U3"}, slackExport.PrivateChannels[0].Members)
+	require.Len(t, slackExport.Posts["mpdm-alice--bob--carol-1"], 1)
+	require.NotContains(t, slackExport.Posts, "G1")
+
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	require.Len(t, slackTransformer.Intermediate.DirectChannels, 1)
+	require.Equal(t, []string{"U1", "U2"}, slackTransformer.Intermediate.DirectChannels[0].Members)
+	require.Len(t, slackTransformer.Intermediate.GroupChannels, 1)
+	require.Equal(t, []string{"U1", "U2", "U3"}, slackTransformer.Intermediate.GroupChannels[0].Members)
+
+	members := map[string][]string{}
+	for _, post := range slackTransformer.Intermediate.Posts {
+		require.True(t, post.IsDirect)
+		members[post.Message] = post.ChannelMembers
+	}
+	require.Equal(t, map[string][]string{
+		"hi bob":   {"alice", "bob"},
+		"hi alice": {"alice", "bob"},
+		"hi all":   {"alice", "bob", "carol"},
+	}, members)
+}
@@ -0,0 +1,218 @@
+package slack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Types of the lines of the intermediate JSONL format.
+const (
+	IntermediateLineUser           = "user"
+	IntermediateLinePublicChannel  = "public_channel"
+	IntermediateLinePrivateChannel = "private_channel"
+	IntermediateLineGroupChannel   = "group_channel"
+	IntermediateLineDirectChannel  = "direct_channel"
+	IntermediateLinePost           = "post"
+)
+
+// IntermediateLine is a line of the intermediate JSONL format that
+// transform hooks read and write. User lines have the user field set,
+// channel lines of every kind the channel field and post lines, which
+// include the replies of the post, the post field.
+type IntermediateLine struct {
+	Type    string               `json:"type"`
+	User    *IntermediateUser    `json:"user,omitempty"`
+	Channel *IntermediateChannel `json:"channel,omitempty"`
+	Post    *IntermediatePost    `json:"post,omitempty"`
+}
+
+// WriteIntermediate writes the intermediate as JSONL: the users sorted by
+// id, then the public, private, group and direct channels and then the
+// posts, one per line.
+func WriteIntermediate(w io.Writer, intermediate *Intermediate) error {
+	encoder := json.NewEncoder(w)
+
+	userIds := make([]string, 0, len(intermediate.UsersById))
+	for userId := range intermediate.UsersById {
+		userIds = append(userIds, userId)
+	}
+	sort.Strings(userIds)
+	for _, userId := range userIds {
+		if err := encoder.Encode(IntermediateLine{Type: IntermediateLineUser, User: intermediate.UsersById[userId]}); err != nil {
+			return err
+		}
+	}
+
+	for _, group := range []struct {
+		lineType string
+		channels []*IntermediateChannel
+	}{
+		{IntermediateLinePublicChannel, intermediate.PublicChannels},
+		{IntermediateLinePrivateChannel, intermediate.PrivateChannels},
+		{IntermediateLineGroupChannel, intermediate.GroupChannels},
+		{IntermediateLineDirectChannel, intermediate.DirectChannels},
+	} {
+		for _, channel := range group.channels {
+			if err := encoder.Encode(IntermediateLine{Type: group.lineType, Channel: channel}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, post := range intermediate.Posts {
+		if err := encoder.Encode(IntermediateLine{Type: IntermediateLinePost, Post: post}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadIntermediate reads an intermediate written as JSONL by
+// WriteIntermediate. Empty lines are ignored, and lines of an unknown
+// type or without their entity are an error.
+func ReadIntermediate(r io.Reader) (*Intermediate, error) {
+	intermediate := &Intermediate{
+		PublicChannels:  []*IntermediateChannel{},
+		PrivateChannels: []*IntermediateChannel{},
+		GroupChannels:   []*IntermediateChannel{},
+		DirectChannels:  []*IntermediateChannel{},
+		UsersById:       map[string]*IntermediateUser{},
+		Posts:           []*IntermediatePost{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var line IntermediateLine
+		if err := json.Unmarshal(data, &line); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse line %d", lineNumber)
+		}
+
+		switch line.Type {
+		case IntermediateLineUser:
+			if line.User == nil {
+				return nil, errors.Errorf("line %d is a user line without a user", lineNumber)
+			}
+			if _, ok := intermediate.UsersById[line.User.Id]; ok {
+				return nil, errors.Errorf("line %d repeats the user %s", lineNumber, line.User.Id)
+			}
+			intermediate.UsersById[line.User.Id] = line.User
+		case IntermediateLinePublicChannel, IntermediateLinePrivateChannel, IntermediateLineGroupChannel, IntermediateLineDirectChannel:
+			if line.Channel == nil {
+				return nil, errors.Errorf("line %d is a channel line without a channel", lineNumber)
+			}
+			switch line.Type {
+			case IntermediateLinePublicChannel:
+				intermediate.PublicChannels = append(intermediate.PublicChannels, line.Channel)
+			case IntermediateLinePrivateChannel:
+				intermediate.PrivateChannels = append(intermediate.PrivateChannels, line.Channel)
+			case IntermediateLineGroupChannel:
+				intermediate.GroupChannels = append(intermediate.GroupChannels, line.Channel)
+			default:
+				intermediate.DirectChannels = append(intermediate.DirectChannels, line.Channel)
+			}
+		case IntermediateLinePost:
+			if line.Post == nil {
+				return nil, errors.Errorf("line %d is a post line without a post", lineNumber)
+			}
+			intermediate.Posts = append(intermediate.Posts, line.Post)
+		default:
+			return nil, errors.Errorf("line %d has the unknown type %q", lineNumber, line.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read the intermediate")
+	}
+
+	return intermediate, nil
+}
+
+// ValidateIntermediate checks that the users have a username, that the
+// public and private channels have a unique name, and that the posts and
+// their replies reference users that exist and, unless they are direct
+// posts, a public or private channel.
+func ValidateIntermediate(intermediate *Intermediate) error {
+	usernames := map[string]bool{}
+	for _, user := range intermediate.UsersById {
+		if user.Username == "" {
+			return fmt.Errorf("the user %s has no username", user.Id)
+		}
+		usernames[user.Username] = true
+	}
+
+	channelNames := map[string]bool{}
+	for _, channel := range append(slices.Clone(intermediate.PublicChannels), intermediate.PrivateChannels...) {
+		if channel.Name == "" {
+			return fmt.Errorf("the channel %s has no name", channel.OriginalName)
+		}
+		if channelNames[channel.Name] {
+			return fmt.Errorf("the channel name %s is used more than once", channel.Name)
+		}
+		channelNames[channel.Name] = true
+	}
+
+	for _, post := range intermediate.Posts {
+		if !post.IsDirect && !channelNames[post.Channel] {
+			return fmt.Errorf("the post by %s at %d is in the unknown channel %s", post.User, post.CreateAt, post.Channel)
+		}
+		for _, p := range append([]*IntermediatePost{post}, post.Replies...) {
+			if !usernames[p.User] {
+				return fmt.Errorf("the post at %d in channel %s is by the unknown user %s", p.CreateAt, post.Channel, p.User)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RunTransformHook pipes the intermediate, written as JSONL by
+// WriteIntermediate, through the standard input of command, run with
+// sh -c, and replaces it with the JSONL the command writes to its
+// standard output once it has been validated. The standard error of the
+// command is passed through. The command fails the transformation if it
+// exits with an error.
+func (t *Transformer) RunTransformHook(command string) error {
+	t.Logger.Infof("Running the transform hook %q", command)
+
+	input := &bytes.Buffer{}
+	if err := WriteIntermediate(input, t.Intermediate); err != nil {
+		return err
+	}
+
+	output := &bytes.Buffer{}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = input
+	cmd.Stdout = output
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrap(err, "the transform hook failed")
+	}
+
+	intermediate, err := ReadIntermediate(output)
+	if err != nil {
+		return errors.Wrap(err, "invalid output of the transform hook")
+	}
+	if err := ValidateIntermediate(intermediate); err != nil {
+		return errors.Wrap(err, "invalid output of the transform hook")
+	}
+
+	t.Intermediate = intermediate
+	return nil
+}
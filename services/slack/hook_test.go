@@ -0,0 +1,103 @@
+package slack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunTransformHook(t *testing.T) {
+	newTransformer := func(t *testing.T) *Transformer {
+		slackTransformer := NewTransformer("test", log.New())
+		slackExport := &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+				{Id: "U2", Username: "bob", Profile: SlackProfile{Email: "bob@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+			},
+			DirectChannels: []SlackChannel{
+				{Id: "D1", Members: []string{"U1", "U2"}, Type: model.ChannelTypeDirect},
+			},
+			Posts: map[string][]SlackPost{
+				"general": {
+					{User: "U1", Text: "hello world", TimeStamp: "1695219800.000000", Type: "message", ThreadTS: "1695219800.000000"},
+					{User: "U2", Text: "hello back", TimeStamp: "1695219810.000000", Type: "message", ThreadTS: "1695219800.000000"},
+				},
+				"D1": {{User: "U2", Text: "direct hello", TimeStamp: "1695219820.000000", Type: "message"}},
+			},
+		}
+		require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+		return slackTransformer
+	}
+
+	t.Run("the intermediate round trips", func(t *testing.T) {
+		slackTransformer := newTransformer(t)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, WriteIntermediate(buf, slackTransformer.Intermediate))
+		intermediate, err := ReadIntermediate(buf)
+		require.NoError(t, err)
+		assert.Equal(t, slackTransformer.Intermediate, intermediate)
+	})
+
+	t.Run("the modifications of the hook are kept", func(t *testing.T) {
+		slackTransformer := newTransformer(t)
+		require.NoError(t, slackTransformer.RunTransformHook(`sed 's/hello/goodbye/g'`))
+
+		messages := map[string][]string{}
+		for _, post := range slackTransformer.Intermediate.Posts {
+			for _, p := range append([]*IntermediatePost{post}, post.Replies...) {
+				messages[post.Channel] = append(messages[post.Channel], p.Message)
+			}
+		}
+		assert.Equal(t, map[string][]string{
+			"general": {"goodbye world", "goodbye back"},
+			"d1":      {"direct goodbye"},
+		}, messages)
+		assert.Len(t, slackTransformer.Intermediate.UsersById, 2)
+		assert.Len(t, slackTransformer.Intermediate.DirectChannels, 1)
+	})
+
+	t.Run("the hook can drop lines", func(t *testing.T) {
+		slackTransformer := newTransformer(t)
+		require.NoError(t, slackTransformer.RunTransformHook(`grep -v '"direct hello"'`))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+	})
+
+	for name, tc := range map[string]struct {
+		hook          string
+		expectedError string
+	}{
+		"a failing hook": {
+			hook:          "exit 3",
+			expectedError: "the transform hook failed: exit status 3",
+		},
+		"an unknown line type": {
+			hook:          `sed 's/"type":"post"/"type":"message"/'`,
+			expectedError: `invalid output of the transform hook: line 5 has the unknown type "message"`,
+		},
+		"a post by an unknown user": {
+			hook:          `sed 's/"user":"alice"/"user":"carol"/'`,
+			expectedError: "invalid output of the transform hook: the post at 1695219800000 in channel general is by the unknown user carol",
+		},
+		"a post in an unknown channel": {
+			hook:          `sed 's/"channel":"general"/"channel":"random"/'`,
+			expectedError: "invalid output of the transform hook: the post by alice at 1695219800000 is in the unknown channel random",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			slackTransformer := newTransformer(t)
+			original := slackTransformer.Intermediate
+
+			err := slackTransformer.RunTransformHook(tc.hook)
+			require.EqualError(t, err, tc.expectedError)
+			assert.Same(t, original, slackTransformer.Intermediate)
+		})
+	}
+}
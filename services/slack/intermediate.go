@@ -2,13 +2,23 @@ package slack
 
 import (
 	"archive/zip"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unicode/utf8"
 
 	"github.com/mattermost/mattermost/server/public/model"
@@ -19,6 +29,10 @@ import (
 
 const attachmentsInternal = "bulk-export-attachments"
 
+// appUserID identifies the user created for the app messages that have no
+// author.
+const appUserID = "USLACKAPP"
+
 var exitFunc func(code int) = os.Exit
 
 type IntermediateChannel struct {
@@ -32,16 +46,30 @@ type IntermediateChannel struct {
 	Header           string            `json:"header"`
 	Topic            string            `json:"topic"`
 	Type             model.ChannelType `json:"type"`
+	Creator          string            `json:"creator"`
+	// CreateAt is the creation time of the channel in Slack, in
+	// milliseconds, or zero if it's unknown.
+	CreateAt int64 `json:"create_at"`
+	// Team is the team the channel is imported into when it isn't the
+	// team of the transformation.
+	Team string `json:"team"`
+	// SharedTeamIds are the Slack workspaces the channel is shared with,
+	// when there are several.
+	SharedTeamIds []string `json:"shared_team_ids"`
 }
 
-func (c *IntermediateChannel) Sanitise(logger log.FieldLogger) {
+// Sanitise makes the channel valid in Mattermost, truncating and renaming
+// its fields as needed, and returns the changes made.
+func (c *IntermediateChannel) Sanitise(logger log.FieldLogger) []SanitizeChange {
 	if c.Type == model.ChannelTypeDirect {
-		return
+		return nil
 	}
+	logger = withChannel(logger, c.Name)
+	original := *c
 
 	c.Name = strings.Trim(c.Name, "_-")
 	if len(c.Name) > model.ChannelNameMaxLength {
-		logger.Warnf("Channel %s handle exceeds the maximum length. It will be truncated when imported.", c.DisplayName)
+		withCategory(logger, WarningCategoryTruncation).Warnf("Channel %s handle exceeds the maximum length. It will be truncated when imported.", c.DisplayName)
 		c.Name = c.Name[0:model.ChannelNameMaxLength]
 	}
 	if len(c.Name) == 1 {
@@ -53,7 +81,7 @@ func (c *IntermediateChannel) Sanitise(logger log.FieldLogger) {
 
 	c.DisplayName = strings.Trim(c.DisplayName, "_-")
 	if utf8.RuneCountInString(c.DisplayName) > model.ChannelDisplayNameMaxRunes {
-		logger.Warnf("Channel %s display name exceeds the maximum length. It will be truncated when imported.", c.DisplayName)
+		withCategory(logger, WarningCategoryTruncation).Warnf("Channel %s display name exceeds the maximum length. It will be truncated when imported.", c.DisplayName)
 		c.DisplayName = truncateRunes(c.DisplayName, model.ChannelDisplayNameMaxRunes)
 	}
 	if len(c.DisplayName) == 1 {
@@ -64,40 +92,55 @@ func (c *IntermediateChannel) Sanitise(logger log.FieldLogger) {
 	}
 
 	if utf8.RuneCountInString(c.Purpose) > model.ChannelPurposeMaxRunes {
-		logger.Warnf("Channel %s purpose exceeds the maximum length. It will be truncated when imported.", c.DisplayName)
+		withCategory(logger, WarningCategoryTruncation).Warnf("Channel %s purpose exceeds the maximum length. It will be truncated when imported.", c.DisplayName)
 		c.Purpose = truncateRunes(c.Purpose, model.ChannelPurposeMaxRunes)
 	}
 
 	if utf8.RuneCountInString(c.Header) > model.ChannelHeaderMaxRunes {
-		logger.Warnf("Channel %s header exceeds the maximum length. It will be truncated when imported.", c.DisplayName)
+		withCategory(logger, WarningCategoryTruncation).Warnf("Channel %s header exceeds the maximum length. It will be truncated when imported.", c.DisplayName)
 		c.Header = truncateRunes(c.Header, model.ChannelHeaderMaxRunes)
 	}
+
+	return sanitizeChanges(SanitizeEntityChannel, c.OriginalName,
+		[3]string{"name", original.Name, c.Name},
+		[3]string{"display_name", original.DisplayName, c.DisplayName},
+		[3]string{"purpose", original.Purpose, c.Purpose},
+		[3]string{"header", original.Header, c.Header},
+	)
 }
 
 type IntermediateUser struct {
-	Id          string   `json:"id"`
-	Username    string   `json:"username"`
-	FirstName   string   `json:"first_name"`
-	LastName    string   `json:"last_name"`
-	Position    string   `json:"position"`
-	Email       string   `json:"email"`
-	Password    string   `json:"password"`
-	Memberships []string `json:"memberships"`
-	DeleteAt    int64    `json:"delete_at"`
-}
-
-func (u *IntermediateUser) Sanitise(logger log.FieldLogger, defaultEmailDomain string, skipEmptyEmails bool) {
+	Id               string   `json:"id"`
+	Username         string   `json:"username"`
+	FirstName        string   `json:"first_name"`
+	LastName         string   `json:"last_name"`
+	Position         string   `json:"position"`
+	Email            string   `json:"email"`
+	Password         string   `json:"password"`
+	Memberships      []string `json:"memberships"`
+	AdminMemberships []string `json:"admin_memberships"`
+	Favorites        []string `json:"favorites"`
+	DeleteAt         int64    `json:"delete_at"`
+	AuthService      string   `json:"auth_service"`
+	AuthData         string   `json:"auth_data"`
+}
+
+// Sanitise makes the user valid in Mattermost, filling in its email and
+// truncating its fields as needed, and returns the truncations made.
+func (u *IntermediateUser) Sanitise(logger log.FieldLogger, defaultEmailDomain string, skipEmptyEmails bool) []SanitizeChange {
 	logger.Debugf("TransformUsers: Sanitise: IntermediateUser receiver: %+v", u)
+	logger = withUser(logger, u.Id)
+	original := *u
 
 	if u.Email == "" {
 		if skipEmptyEmails {
 			logger.Warnf("User %s does not have an email address in the Slack export. Using blank email address due to --skip-empty-emails flag.", u.Username)
-			return
+			return nil
 		}
 
 		if defaultEmailDomain != "" {
 			u.Email = u.Username + "@" + defaultEmailDomain
-			logger.Warnf("User %s does not have an email address in the Slack export. Used %s as a placeholder. The user should update their email address once logged in to the system.", u.Username, u.Email)
+			withCategory(logger, WarningCategoryPlaceholder).Warnf("User %s does not have an email address in the Slack export. Used %s as a placeholder. The user should update their email address once logged in to the system.", u.Username, u.Email)
 		} else {
 			msg := fmt.Sprintf("User %s does not have an email address in the Slack export. Please provide an email domain through the --default-email-domain flag, to assign this user's email address. Alternatively, use the --skip-empty-emails flag to set the user's email to an empty string.", u.Username)
 			logger.Error(msg)
@@ -107,32 +150,47 @@ func (u *IntermediateUser) Sanitise(logger log.FieldLogger, defaultEmailDomain s
 	}
 
 	if utf8.RuneCountInString(u.FirstName) > model.UserFirstNameMaxRunes {
-		logger.Warnf("User %s first name exceeds the maximum length. It will be truncated when imported.", u.Username)
+		withCategory(logger, WarningCategoryTruncation).Warnf("User %s first name exceeds the maximum length. It will be truncated when imported.", u.Username)
 		u.FirstName = truncateRunes(u.FirstName, model.UserFirstNameMaxRunes)
 	}
 
 	if utf8.RuneCountInString(u.LastName) > model.UserLastNameMaxRunes {
-		logger.Warnf("User %s last name exceeds the maximum length. It will be truncated when imported.", u.Username)
+		withCategory(logger, WarningCategoryTruncation).Warnf("User %s last name exceeds the maximum length. It will be truncated when imported.", u.Username)
 		u.LastName = truncateRunes(u.LastName, model.UserLastNameMaxRunes)
 	}
 
 	if utf8.RuneCountInString(u.Position) > model.UserPositionMaxRunes {
-		logger.Warnf("User %s position exceeds the maximum length. It will be truncated when imported.", u.Username)
+		withCategory(logger, WarningCategoryTruncation).Warnf("User %s position exceeds the maximum length. It will be truncated when imported.", u.Username)
 		u.Position = truncateRunes(u.Position, model.UserPositionMaxRunes)
 	}
+
+	return sanitizeChanges(SanitizeEntityUser, u.Id,
+		[3]string{"first_name", original.FirstName, u.FirstName},
+		[3]string{"last_name", original.LastName, u.LastName},
+		[3]string{"position", original.Position, u.Position},
+	)
+}
+
+type IntermediateReaction struct {
+	User      string `json:"user"`
+	EmojiName string `json:"emoji_name"`
+	CreateAt  int64  `json:"create_at"`
 }
 
 type IntermediatePost struct {
-	User           string                `json:"user"`
-	Channel        string                `json:"channel"`
-	Message        string                `json:"message"`
-	Props          model.StringInterface `json:"props"`
-	CreateAt       int64                 `json:"create_at"`
-	Type           string                `json:"type"`
-	Attachments    []string              `json:"attachments"`
-	Replies        []*IntermediatePost   `json:"replies"`
-	IsDirect       bool                  `json:"is_direct"`
-	ChannelMembers []string              `json:"channel_members"`
+	User           string                  `json:"user"`
+	Channel        string                  `json:"channel"`
+	Message        string                  `json:"message"`
+	Props          model.StringInterface   `json:"props"`
+	CreateAt       int64                   `json:"create_at"`
+	Type           string                  `json:"type"`
+	Attachments    []string                `json:"attachments"`
+	Replies        []*IntermediatePost     `json:"replies"`
+	IsDirect       bool                    `json:"is_direct"`
+	ChannelMembers []string                `json:"channel_members"`
+	Reactions      []*IntermediateReaction `json:"reactions"`
+	IsPinned       bool                    `json:"is_pinned"`
+	OriginalTS     string                  `json:"original_ts"`
 }
 
 type Intermediate struct {
@@ -150,7 +208,27 @@ func (t *Transformer) TransformUsers(users []SlackUser, skipEmptyEmails bool, de
 	t.Logger.Debugf("TransformUsers: Input SlackUser structs: %+v", users)
 
 	resultUsers := map[string]*IntermediateUser{}
+	t.renamedUsernames = map[string]string{}
+	t.inactiveUsers = map[string]bool{}
+	t.botUsers = map[string]bool{}
+	// usernames in use, so the ones given to federated users don't clash
+	takenUsernames := map[string]bool{}
+	for _, user := range users {
+		takenUsernames[user.Username] = true
+	}
 	for _, user := range users {
+		if user.IsBot && t.Options.ExcludeBots {
+			t.Logger.Infof("Skipping the bot user %s", user.Username)
+			t.botUsers[user.Id] = true
+			continue
+		}
+
+		if user.Deleted && t.Options.OnlyActiveUsers {
+			t.Logger.Infof("Skipping the deactivated user %s", user.Username)
+			t.inactiveUsers[user.Id] = true
+			continue
+		}
+
 		var deleteAt int64 = 0
 		if user.Deleted {
 			deleteAt = model.GetMillis()
@@ -184,12 +262,223 @@ func (t *Transformer) TransformUsers(users []SlackUser, skipEmptyEmails bool, de
 			newUser.Id = user.Profile.BotID
 		}
 
-		newUser.Sanitise(t.Logger, defaultEmailDomain, skipEmptyEmails)
+		if newUser.Email == "" {
+			if email, ok := t.Options.UserEmails[user.Id]; ok {
+				newUser.Email = email
+			} else if email, ok := t.Options.UserEmails[user.Username]; ok {
+				newUser.Email = email
+			}
+		}
+
+		if user.Username == "" {
+			t.fillFederatedUser(newUser, user, takenUsernames, skipEmptyEmails, defaultEmailDomain)
+		}
+
+		t.setUserAuth(newUser, user)
+
+		if newUsername, ok := t.Options.UserRenames[newUser.Username]; ok {
+			t.Logger.Infof("Renaming user %s to %s", newUser.Username, newUsername)
+			t.renamedUsernames[newUser.Username] = newUsername
+			newUser.Username = newUsername
+		}
+
+		if newUser.Email == "" && !skipEmptyEmails && defaultEmailDomain == "" && t.Options.SkipUsersWithoutEmail {
+			withUser(withCategory(t.Logger, WarningCategoryOther), newUser.Id).Warnf("Skipping the user %s as they don't have an email address in the Slack export. Their posts will be imported with a placeholder user.", newUser.Username)
+			t.recordSanitizeChanges([]SanitizeChange{{Entity: SanitizeEntityUser, Id: newUser.Id, Field: "user", Original: newUser.Username}})
+			continue
+		}
+
+		t.recordSanitizeChanges(newUser.Sanitise(t.Logger, defaultEmailDomain, skipEmptyEmails))
 		resultUsers[newUser.Id] = newUser
 		t.Logger.Debugf("Slack user with email %s and password %s has been imported.", newUser.Email, newUser.Password)
 	}
 
 	t.Intermediate.UsersById = resultUsers
+
+	if t.Options.NormalizeUsernames {
+		t.NormalizeUsernames()
+	}
+}
+
+// fillFederatedUser completes a user that has no username in the export,
+// such as the users of other organizations in Slack Connect channels,
+// which only carry an id and a display name. The username and first name
+// are taken from the display name, the username falling back to the user
+// id if it's empty or not valid. Unless a default email domain is given or
+// empty emails are allowed, users without an email get a placeholder one,
+// like external users, instead of stopping the transformation.
+func (t *Transformer) fillFederatedUser(newUser *IntermediateUser, user SlackUser, takenUsernames map[string]bool, skipEmptyEmails bool, defaultEmailDomain string) {
+	displayName := strings.TrimSpace(user.Profile.DisplayName)
+	if displayName == "" {
+		displayName = strings.TrimSpace(user.Profile.RealName)
+	}
+
+	username := strings.ToLower(user.Id)
+	if displayName != "" {
+		candidate := normalizeUsername(displayName)
+		if takenUsernames[candidate] {
+			candidate = truncateRunes(candidate+"-"+strings.ToLower(user.Id), model.UserNameMaxLength)
+		}
+		if model.IsValidUsername(candidate) && !takenUsernames[candidate] {
+			username = candidate
+		}
+	}
+	takenUsernames[username] = true
+	newUser.Username = username
+
+	if newUser.FirstName == "" && newUser.LastName == "" {
+		newUser.FirstName = displayName
+	}
+
+	if newUser.Email == "" && !skipEmptyEmails && defaultEmailDomain == "" {
+		newUser.Email = fmt.Sprintf("%s@external", user.Id)
+		withUser(withCategory(t.Logger, WarningCategoryPlaceholder), user.Id).Warnf("User %s has no username or email address in the Slack export, as federated users. Used %s as a placeholder.", username, newUser.Email)
+		return
+	}
+	withUser(t.Logger, user.Id).Infof("User %s has no username in the Slack export, as federated users. Using %s after their display name.", user.Id, username)
+}
+
+// setUserAuth sets the auth service and data of a user from
+// Options.UserAuth, looked up by the Slack id or username of the user,
+// defaulting to Options.AuthService and the email of the user.
+func (t *Transformer) setUserAuth(newUser *IntermediateUser, user SlackUser) {
+	auth, ok := t.Options.UserAuth[user.Id]
+	if !ok {
+		auth, ok = t.Options.UserAuth[user.Username]
+	}
+
+	service := t.Options.AuthService
+	if ok && auth.Service != "" {
+		service = auth.Service
+	}
+	if service == "" {
+		return
+	}
+
+	data := auth.Data
+	if data == "" {
+		data = newUser.Email
+	}
+	if data == "" {
+		withUser(t.Logger, user.Id).Warnf("Unable to set the auth service of the user %s as they have no auth data or email", newUser.Username)
+		return
+	}
+
+	newUser.AuthService = service
+	newUser.AuthData = data
+}
+
+// NormalizeUsernames replaces the usernames that aren't valid in
+// Mattermost with a lowercase version without the invalid characters,
+// truncated to the maximum length. Clashes with other users are resolved
+// by appending a number. The users keep their ids, so their memberships
+// and posts follow them, and the mentions of the old usernames are
+// replaced once the posts are transformed.
+func (t *Transformer) NormalizeUsernames() {
+	if t.renamedUsernames == nil {
+		t.renamedUsernames = map[string]string{}
+	}
+
+	invalidUsers := []*IntermediateUser{}
+	takenUsernames := map[string]bool{}
+	for _, user := range t.Intermediate.UsersById {
+		if model.IsValidUsername(user.Username) {
+			takenUsernames[user.Username] = true
+		} else {
+			invalidUsers = append(invalidUsers, user)
+		}
+	}
+	sort.Slice(invalidUsers, func(i, j int) bool {
+		return invalidUsers[i].Id < invalidUsers[j].Id
+	})
+
+	for _, user := range invalidUsers {
+		base := normalizeUsername(user.Username)
+		username := base
+		for i := 2; takenUsernames[username] || !model.IsValidUsername(username); i++ {
+			suffix := fmt.Sprintf("-%d", i)
+			username = truncateRunes(base, model.UserNameMaxLength-len(suffix)) + suffix
+		}
+		takenUsernames[username] = true
+
+		withUser(t.Logger, user.Id).Infof("Normalizing the username %s to %s", user.Username, username)
+		t.recordSanitizeChanges(sanitizeChanges(SanitizeEntityUser, user.Id, [3]string{"username", user.Username, username}))
+		t.renamedUsernames[user.Username] = username
+		user.Username = username
+	}
+}
+
+// normalizeUsername returns username lowercased, without the characters
+// that aren't valid in a Mattermost username and truncated to the
+// maximum length.
+func normalizeUsername(username string) string {
+	normalized := strings.ToLower(makeAlphaNum(username, '.', '-', '_'))
+	if normalized == "" {
+		normalized = "user"
+	}
+	return truncateRunes(normalized, model.UserNameMaxLength)
+}
+
+// ValidateUserRenames checks that the renamed users end up with valid
+// and unique usernames.
+func (t *Transformer) ValidateUserRenames(users []SlackUser) error {
+	if len(t.Options.UserRenames) == 0 {
+		return nil
+	}
+
+	usernames := map[string]bool{}
+	for _, user := range users {
+		username := user.Username
+		if newUsername, ok := t.Options.UserRenames[username]; ok {
+			username = newUsername
+		}
+		if usernames[username] {
+			return errors.Errorf("renaming users results in the username %s being used by more than one user", username)
+		}
+		usernames[username] = true
+	}
+
+	for oldUsername, newUsername := range t.Options.UserRenames {
+		if !model.IsValidUsername(newUsername) {
+			return errors.Errorf("the username %s to rename %s to is not a valid Mattermost username", newUsername, oldUsername)
+		}
+	}
+
+	return nil
+}
+
+// ValidateChannelRenames checks that the renamed public and private
+// channels don't end up with the name of another channel. Renames of
+// channels that aren't in the export are only logged.
+func (t *Transformer) ValidateChannelRenames(slackExport *SlackExport) error {
+	if len(t.Options.ChannelRenames) == 0 {
+		return nil
+	}
+
+	// original name of the channel using each name in Mattermost
+	names := map[string]string{}
+	found := map[string]bool{}
+	for _, channel := range append(append(slices.Clone(slackExport.PublicChannels), slackExport.PrivateChannels...), slackExport.GroupChannels...) {
+		originalName := getOriginalName(channel)
+		name, renamed := t.Options.ChannelRenames[originalName]
+		if renamed {
+			found[originalName] = true
+		} else {
+			name = SlackConvertChannelName(channel.Name, channel.Id)
+		}
+		if other, ok := names[name]; ok && (renamed || t.Options.ChannelRenames[other] != "") {
+			return errors.Errorf("renaming channels results in the channel name %s being used by both %s and %s", name, other, originalName)
+		}
+		names[name] = originalName
+	}
+
+	for original := range t.Options.ChannelRenames {
+		if !found[original] {
+			t.Logger.Warnf("The channel %s to rename is not in the export", original)
+		}
+	}
+
+	return nil
 }
 
 func filterValidMembers(members []string, users map[string]*IntermediateUser) []string {
@@ -211,47 +500,263 @@ func getOriginalName(channel SlackChannel) string {
 	}
 }
 
+// channelPrefixTeam returns the team of the longest prefix of
+// ChannelPrefixTeams that the Slack name of a channel starts with, or an
+// empty string if none does.
+func (t *Transformer) channelPrefixTeam(name string) string {
+	matched := ""
+	for prefix := range t.Options.ChannelPrefixTeams {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+		}
+	}
+	if matched == "" {
+		return ""
+	}
+	return t.Options.ChannelPrefixTeams[matched]
+}
+
+// maxDerivedChannelNameLength keeps the names derived from the purpose or
+// topic of nameless channels short enough to be readable.
+const maxDerivedChannelNameLength = 40
+
+// deriveChannelName builds a readable channel name from the first words
+// of the purpose or, if it has none, the topic of a channel without a
+// name. It returns an empty string if neither has enough usable words.
+func deriveChannelName(channel SlackChannel, form string) string {
+	description := channel.Purpose.Value
+	if strings.TrimSpace(description) == "" {
+		description = channel.Topic.Value
+	}
+
+	name := ""
+	// makeAlphaNum replaces the punctuation with underscores
+	words := strings.FieldsFunc(strings.ToLower(makeAlphaNumForm(description, normalizationForm(form, norm.NFKD))), func(r rune) bool { return r == '_' })
+	for _, word := range words {
+		candidate := word
+		if name != "" {
+			candidate = name + "-" + word
+		}
+		if len(candidate) > maxDerivedChannelNameLength {
+			break
+		}
+		name = candidate
+	}
+
+	if !IsValidChannelName(name) {
+		return ""
+	}
+	return name
+}
+
 func (t *Transformer) TransformChannels(channels []SlackChannel) []*IntermediateChannel {
+	// names already in use, so a derived name doesn't merge two channels
+	takenNames := map[string]bool{}
+	for _, channel := range channels {
+		takenNames[channel.Name] = true
+	}
+	for _, channel := range append(slices.Clone(t.Intermediate.PublicChannels), t.Intermediate.PrivateChannels...) {
+		takenNames[channel.Name] = true
+	}
+
 	resultChannels := []*IntermediateChannel{}
 	for _, channel := range channels {
 		validMembers := filterValidMembers(channel.Members, t.Intermediate.UsersById)
+
+		// shared DMs reference the external party, which is not part of users.json
+		if channel.Type == model.ChannelTypeDirect && len(channel.Members) == 2 && len(validMembers) == 1 {
+			for _, member := range channel.Members {
+				if _, ok := t.Intermediate.UsersById[member]; !ok {
+					t.CreateExternalIntermediateUser(member)
+				}
+			}
+			validMembers = filterValidMembers(channel.Members, t.Intermediate.UsersById)
+		}
+
 		if (channel.Type == model.ChannelTypeDirect || channel.Type == model.ChannelTypeGroup) && len(validMembers) <= 1 {
 			t.Logger.Warnf("Bulk export for direct channels containing a single member is not supported. Not importing channel %s", channel.Name)
 			continue
 		}
 
+		if (channel.Type == model.ChannelTypeDirect || channel.Type == model.ChannelTypeGroup) && len(validMembers) < t.Options.MinMembers {
+			t.Logger.Infof("Skipping channel %s as it has %d valid members, fewer than the minimum of %d", channel.Name, len(validMembers), t.Options.MinMembers)
+			continue
+		}
+
 		if channel.Type == model.ChannelTypeGroup && len(validMembers) > model.ChannelGroupMaxUsers {
 			channel.Name = channel.Purpose.Value
 			channel.Type = model.ChannelTypePrivate
 		}
 
-		name := SlackConvertChannelName(channel.Name, channel.Id)
+		originalName := getOriginalName(channel)
+		if channel.Name == "" && (channel.Type == model.ChannelTypeOpen || channel.Type == model.ChannelTypePrivate) {
+			if derived := deriveChannelName(channel, t.Options.UTF8Normalization); derived != "" {
+				if takenNames[derived] {
+					derived = derived + "-" + strings.ToLower(channel.Id)
+				}
+				t.Logger.Infof("Channel %s has no name, naming it %s after its purpose or topic", channel.Id, derived)
+				channel.Name = derived
+				takenNames[derived] = true
+			}
+		}
+
+		channelName := channel.Name
+		if t.Options.UTF8Normalization != "" {
+			channelName = normalizationForm(t.Options.UTF8Normalization, norm.NFC).String(channelName)
+		}
+		name := SlackConvertChannelName(channelName, channel.Id)
 		newChannel := &IntermediateChannel{
-			OriginalName: getOriginalName(channel),
+			Id:           channel.Id,
+			OriginalName: originalName,
 			Name:         name,
 			DisplayName:  name,
 			Members:      validMembers,
 			Purpose:      channel.Purpose.Value,
 			Header:       channel.Topic.Value,
 			Type:         channel.Type,
+			CreateAt:     channel.Created * 1000,
+		}
+
+		if len(channel.SharedTeamIds) > 1 {
+			newChannel.SharedTeamIds = slices.Clone(channel.SharedTeamIds)
+			sort.Strings(newChannel.SharedTeamIds)
 		}
 
-		newChannel.Sanitise(t.Logger)
+		if newChannel.Type == model.ChannelTypeOpen || newChannel.Type == model.ChannelTypePrivate {
+			newChannel.Purpose = t.decoratePurpose(newChannel.Purpose, newChannel.Name, newChannel.SharedTeamIds)
+		}
+
+		t.recordSanitizeChanges(newChannel.Sanitise(t.Logger))
+		if newChannel.Type == model.ChannelTypeOpen || newChannel.Type == model.ChannelTypePrivate {
+			newChannel.Name = addChannelNamePrefix(newChannel.Name, t.Options.ChannelNamePrefix)
+
+			if newName, ok := t.Options.ChannelRenames[newChannel.OriginalName]; ok {
+				t.Logger.Infof("Renaming channel %s to %s", newChannel.OriginalName, newName)
+				newChannel.Name = newName
+				newChannel.DisplayName = newName
+			}
+
+			// the purpose is already truncated, and it is shorter than
+			// the maximum header length
+			if t.Options.ChannelHeaderFromPurpose && newChannel.Header == "" && newChannel.Purpose != "" {
+				t.Logger.Debugf("Using the purpose of channel %s as its header", newChannel.OriginalName)
+				newChannel.Header = newChannel.Purpose
+			}
+
+			if channelType, ok := t.Options.ChannelTypes[newChannel.OriginalName]; ok && channelType != newChannel.Type {
+				t.Logger.Infof("Changing the type of channel %s from %s to %s", newChannel.OriginalName, newChannel.Type, channelType)
+				newChannel.Type = channelType
+			}
+
+			if team, ok := t.Options.SlackTeamTeams[t.channelSlackTeams[newChannel.OriginalName]]; ok {
+				t.Logger.Debugf("Importing channel %s into team %s of its Slack workspace", newChannel.OriginalName, team)
+				newChannel.Team = team
+			}
+
+			if team := t.channelPrefixTeam(newChannel.OriginalName); team != "" {
+				t.Logger.Debugf("Importing channel %s into team %s", newChannel.OriginalName, team)
+				newChannel.Team = team
+			}
+
+			// the creator may have left the channel, so it is looked up
+			// among all the users instead of the channel members
+			if channel.Creator != "" && !t.isDroppedUser(channel.Creator) {
+				newChannel.Creator = t.getOrCreateIntermediateUser(channel.Creator).Id
+			}
+		}
 		resultChannels = append(resultChannels, newChannel)
 	}
 
 	return resultChannels
 }
 
+// decoratePurpose adds the purpose prefix and suffix to the purpose of a
+// channel, separated by spaces, followed by a note listing the Slack
+// workspaces the channel is shared with, if any. The purpose itself is
+// truncated if needed so the result fits in the maximum length and the
+// prefix, suffix and note are kept whole.
+func (t *Transformer) decoratePurpose(purpose, channelName string, sharedTeamIds []string) string {
+	prefix, suffix := t.Options.ChannelPurposePrefix, t.Options.ChannelPurposeSuffix
+	sharedNote := ""
+	if len(sharedTeamIds) > 0 {
+		sharedNote = fmt.Sprintf("(Shared across the Slack workspaces %s)", strings.Join(sharedTeamIds, ", "))
+	}
+	if prefix == "" && suffix == "" && sharedNote == "" {
+		return purpose
+	}
+
+	join := func(purpose string) string {
+		parts := []string{}
+		for _, part := range []string{prefix, purpose, suffix, sharedNote} {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+
+	if excess := utf8.RuneCountInString(join(purpose)) - model.ChannelPurposeMaxRunes; excess > 0 {
+		withChannel(withCategory(t.Logger, WarningCategoryTruncation), channelName).Warnf("Channel %s purpose exceeds the maximum length with its prefix, suffix and shared workspaces. It will be truncated when imported.", channelName)
+		purpose = strings.TrimSpace(truncateRunes(purpose, max(utf8.RuneCountInString(purpose)-excess, 0)))
+	}
+	return join(purpose)
+}
+
+// addChannelNamePrefix prepends the prefix to a sanitised channel name,
+// truncating the result to the maximum channel name length.
+func addChannelNamePrefix(name, prefix string) string {
+	if prefix == "" {
+		return name
+	}
+
+	name = prefix + name
+	if len(name) > model.ChannelNameMaxLength {
+		name = name[0:model.ChannelNameMaxLength]
+	}
+	return name
+}
+
+// AddPostersToChannels adds the users that posted in a public or private
+// channel to its members, for exports whose member lists are incomplete.
+// Join and leave messages don't count, so users that only left a channel
+// aren't added back.
+func (t *Transformer) AddPostersToChannels(posts map[string][]SlackPost) {
+	channelsByOriginalName := map[string]*IntermediateChannel{}
+	for _, channel := range append(slices.Clone(t.Intermediate.PublicChannels), t.Intermediate.PrivateChannels...) {
+		channelsByOriginalName[channel.OriginalName] = channel
+	}
+
+	for originalName, channelPosts := range posts {
+		channel, ok := channelsByOriginalName[originalName]
+		if !ok {
+			continue
+		}
+		for _, post := range channelPosts {
+			if post.User == "" || post.IsJoinLeaveMessage() || t.isDroppedUser(post.User) {
+				continue
+			}
+			if _, ok := t.Intermediate.UsersById[post.User]; !ok || slices.Contains(channel.Members, post.User) {
+				continue
+			}
+			t.Logger.Debugf("Adding user %s to channel %s as they posted in it", post.User, channel.Name)
+			channel.Members = append(channel.Members, post.User)
+		}
+	}
+}
+
 func (t *Transformer) PopulateUserMemberships() {
 	t.Logger.Info("Populating user memberships")
 
 	for userId, user := range t.Intermediate.UsersById {
 		memberships := []string{}
+		adminMemberships := []string{}
 		for _, channel := range t.Intermediate.PublicChannels {
 			for _, memberId := range channel.Members {
 				if userId == memberId {
 					memberships = append(memberships, channel.Name)
+					if channel.Creator == userId {
+						adminMemberships = append(adminMemberships, channel.Name)
+					}
 					break
 				}
 			}
@@ -260,11 +765,15 @@ func (t *Transformer) PopulateUserMemberships() {
 			for _, memberId := range channel.Members {
 				if userId == memberId {
 					memberships = append(memberships, channel.Name)
+					if channel.Creator == userId {
+						adminMemberships = append(adminMemberships, channel.Name)
+					}
 					break
 				}
 			}
 		}
 		user.Memberships = memberships
+		user.AdminMemberships = adminMemberships
 	}
 }
 
@@ -279,6 +788,7 @@ func (t *Transformer) PopulateChannelMemberships() {
 			}
 		}
 
+		sort.Strings(members)
 		channel.MembersUsernames = members
 	}
 	for _, channel := range t.Intermediate.DirectChannels {
@@ -289,6 +799,7 @@ func (t *Transformer) PopulateChannelMemberships() {
 			}
 		}
 
+		sort.Strings(members)
 		channel.MembersUsernames = members
 	}
 }
@@ -296,6 +807,20 @@ func (t *Transformer) PopulateChannelMemberships() {
 func (t *Transformer) TransformAllChannels(slackExport *SlackExport) error {
 	t.Logger.Info("Transforming channels")
 
+	ClassifyGroupChannels(slackExport)
+
+	if len(t.Options.ChannelOnlyById) > 0 {
+		t.DropChannelsNotInIds(slackExport, t.Options.ChannelOnlyById)
+	}
+
+	if len(t.Options.SlackTeamTeams) > 0 {
+		t.channelSlackTeams = t.GetChannelTeams(slackExport.Posts)
+	}
+
+	if t.Options.LinkCanvases {
+		LinkCanvases(slackExport)
+	}
+
 	// transform public
 	t.Intermediate.PublicChannels = t.TransformChannels(slackExport.PublicChannels)
 
@@ -309,96 +834,406 @@ func (t *Transformer) TransformAllChannels(slackExport *SlackExport) error {
 
 	t.Intermediate.GroupChannels = t.TransformChannels(regularGroupChannels)
 
-	// transform direct
-	t.Intermediate.DirectChannels = t.TransformChannels(slackExport.DirectChannels)
-
-	return nil
-}
-
-func AddPostToThreads(original SlackPost, post *IntermediatePost, threads map[string]*IntermediatePost, channel *IntermediateChannel, timestamps map[int64]bool) {
-	// direct and group posts need the channel members in the import line
-	if channel.Type == model.ChannelTypeDirect || channel.Type == model.ChannelTypeGroup {
-		post.IsDirect = true
-		post.ChannelMembers = channel.MembersUsernames
-	} else {
-		post.IsDirect = false
-	}
+	// channels whose type was overridden change list
+	if len(t.Options.ChannelTypes) > 0 {
+		channels := append(t.Intermediate.PublicChannels, t.Intermediate.PrivateChannels...)
+		t.Intermediate.PublicChannels, t.Intermediate.PrivateChannels = splitChannelsByType(channels)
 
-	// avoid timestamp duplications
-	for {
-		// if the timestamp hasn't been used already, break and use
-		if _, ok := timestamps[post.CreateAt]; !ok {
-			break
+		for name := range t.Options.ChannelTypes {
+			if !slices.ContainsFunc(channels, func(channel *IntermediateChannel) bool { return channel.OriginalName == name }) {
+				t.Logger.Warnf("Not able to change the type of channel %s as it isn't a public or private channel of the export", name)
+			}
 		}
-		post.CreateAt++
 	}
-	timestamps[post.CreateAt] = true
 
-	// if post is part of a thread
-	if original.ThreadTS != "" && original.ThreadTS != original.TimeStamp {
-		rootPost, ok := threads[original.ThreadTS]
-		if !ok {
-			log.Printf("ERROR processing post in thread, couldn't find rootPost: %+v\n", original)
-			return
-		}
-		rootPost.Replies = append(rootPost.Replies, post)
-		return
-	}
+	// transform direct
+	t.Intermediate.DirectChannels = t.TransformChannels(slackExport.DirectChannels)
 
-	// if post is the root of a thread
-	if original.TimeStamp == original.ThreadTS {
-		if threads[original.ThreadTS] != nil {
-			log.Println("WARNING: overwriting root post for thread " + original.ThreadTS)
+	if t.Options.ArchiveDeadDMs != "" {
+		if err := t.ArchiveDeadDirectChannels(slackExport, t.Options.ArchiveDeadDMs, t.Options.ArchiveDeadDMsAdmin); err != nil {
+			return err
 		}
-		threads[original.ThreadTS] = post
-		return
 	}
 
-	if threads[original.TimeStamp] != nil {
-		log.Println("WARNING: overwriting root post for thread " + original.TimeStamp)
+	switch {
+	case t.Options.SkipDirectChannels:
+		t.DropDirectChannels(slackExport)
+	case t.Options.ArchiveDirectChannels:
+		t.ConvertDirectChannelsToPrivate()
 	}
 
-	threads[original.TimeStamp] = post
+	return nil
 }
 
-func buildChannelsByOriginalNameMap(intermediate *Intermediate) map[string]*IntermediateChannel {
-	channelsByName := map[string]*IntermediateChannel{}
-	for _, channel := range intermediate.PublicChannels {
-		channelsByName[channel.OriginalName] = channel
-	}
-	for _, channel := range intermediate.PrivateChannels {
-		channelsByName[channel.OriginalName] = channel
-	}
-	for _, channel := range intermediate.GroupChannels {
-		channelsByName[channel.OriginalName] = channel
+// DropChannelsNotInIds leaves the channels whose Slack id isn't one of ids
+// and their posts out of the export, warning about the ids that aren't in
+// it.
+func (t *Transformer) DropChannelsNotInIds(slackExport *SlackExport, ids []string) {
+	found := map[string]bool{}
+	keep := func(channels []SlackChannel) []SlackChannel {
+		kept := []SlackChannel{}
+		for _, channel := range channels {
+			if slices.Contains(ids, channel.Id) {
+				found[channel.Id] = true
+				kept = append(kept, channel)
+				continue
+			}
+			t.Logger.Debugf("Skipping the channel %s and its posts as its id %s isn't one of the channels to import", getOriginalName(channel), channel.Id)
+			delete(slackExport.Posts, getOriginalName(channel))
+		}
+		return kept
 	}
-	for _, channel := range intermediate.DirectChannels {
-		channelsByName[channel.OriginalName] = channel
+
+	slackExport.PublicChannels = keep(slackExport.PublicChannels)
+	slackExport.PrivateChannels = keep(slackExport.PrivateChannels)
+	slackExport.GroupChannels = keep(slackExport.GroupChannels)
+	slackExport.DirectChannels = keep(slackExport.DirectChannels)
+
+	for _, id := range ids {
+		if !found[id] {
+			t.Logger.Warnf("Not able to import the channel with id %s as it isn't in the export", id)
+		}
 	}
-	return channelsByName
 }
 
-func getNormalisedFilePath(file *SlackFile, attachmentsDir string) string {
-	n := makeAlphaNum(file.Name, '.', '-', '_')
-	p := path.Join(attachmentsDir, fmt.Sprintf("%s_%s", file.Id, n))
-	return norm.NFC.String(p)
+// DropDirectChannels leaves the direct and group channels and their posts
+// out of the import.
+func (t *Transformer) DropDirectChannels(slackExport *SlackExport) {
+	for _, channel := range append(slices.Clone(t.Intermediate.GroupChannels), t.Intermediate.DirectChannels...) {
+		t.Logger.Infof("Skipping the direct channel %s and its posts", channel.OriginalName)
+		delete(slackExport.Posts, channel.OriginalName)
+	}
+	t.Intermediate.GroupChannels = []*IntermediateChannel{}
+	t.Intermediate.DirectChannels = []*IntermediateChannel{}
 }
 
-func addFileToPost(file *SlackFile, uploads map[string]*zip.File, post *IntermediatePost, attachmentsDir string, allowDownload bool) error {
-	if _, ok := uploads[file.Id]; ok || !allowDownload {
-		return addZipFileToPost(file, uploads, post, attachmentsDir)
+// ConvertDirectChannelsToPrivate replaces each direct and group channel
+// with a private channel of the same members, for the servers that don't
+// allow importing direct messages. The header of the channel names the
+// members of the conversation.
+func (t *Transformer) ConvertDirectChannelsToPrivate() {
+	takenNames := map[string]bool{}
+	for _, channel := range append(slices.Clone(t.Intermediate.PublicChannels), t.Intermediate.PrivateChannels...) {
+		takenNames[channel.Name] = true
 	}
 
-	return addDownloadToPost(file, post, attachmentsDir)
-}
+	for _, channel := range append(slices.Clone(t.Intermediate.GroupChannels), t.Intermediate.DirectChannels...) {
+		usernames := []string{}
+		for _, member := range channel.Members {
+			if user, ok := t.Intermediate.UsersById[member]; ok {
+				usernames = append(usernames, user.Username)
+			}
+		}
+		sort.Strings(usernames)
 
-func addDownloadToPost(file *SlackFile, post *IntermediatePost, attachmentsDir string) error {
-	destFilePath := getNormalisedFilePath(file, attachmentsInternal)
-	fullFilePath := path.Join(attachmentsDir, destFilePath)
+		name := "dm-" + strings.ReplaceAll(strings.Join(usernames, "-"), ".", "-")
+		if !IsValidChannelName(name) || takenNames[name] {
+			name = "dm-" + strings.ToLower(channel.Id)
+		}
+		takenNames[name] = true
 
-	log.Printf("Downloading %q into %q...\n", file.DownloadURL, destFilePath)
+		mentions := []string{}
+		for _, username := range usernames {
+			mentions = append(mentions, "@"+username)
+		}
+		kind := "Direct"
+		if channel.Type == model.ChannelTypeGroup {
+			kind = "Group"
+		}
+		header := kind + " messages between " + strings.Join(mentions, ", ")
+		if len(mentions) > 1 {
+			header = kind + " messages between " + strings.Join(mentions[:len(mentions)-1], ", ") + " and " + mentions[len(mentions)-1]
+		}
 
-	err := downloadInto(fullFilePath, file.DownloadURL, file.Size)
+		privateChannel := &IntermediateChannel{
+			Id:           channel.Id,
+			OriginalName: channel.OriginalName,
+			Name:         name,
+			DisplayName:  truncateRunes("DM: "+strings.Join(usernames, ", "), model.ChannelDisplayNameMaxRunes),
+			Members:      channel.Members,
+			Header:       header,
+			Type:         model.ChannelTypePrivate,
+			CreateAt:     channel.CreateAt,
+		}
+		t.Logger.Infof("Importing the direct channel %s as the private channel %s", channel.OriginalName, name)
+		t.Intermediate.PrivateChannels = append(t.Intermediate.PrivateChannels, privateChannel)
+	}
+	t.Intermediate.GroupChannels = []*IntermediateChannel{}
+	t.Intermediate.DirectChannels = []*IntermediateChannel{}
+}
+
+// splitChannelsByType returns the public and the private channels of a
+// list, keeping their order.
+func splitChannelsByType(channels []*IntermediateChannel) ([]*IntermediateChannel, []*IntermediateChannel) {
+	publicChannels := []*IntermediateChannel{}
+	privateChannels := []*IntermediateChannel{}
+	for _, channel := range channels {
+		if channel.Type == model.ChannelTypePrivate {
+			privateChannels = append(privateChannels, channel)
+		} else {
+			publicChannels = append(publicChannels, channel)
+		}
+	}
+	return publicChannels, privateChannels
+}
+
+// ClassifyGroupChannels moves the group messages listed among the public
+// or private channels of the export, flagged with is_mpim, to its group
+// channels.
+func ClassifyGroupChannels(slackExport *SlackExport) {
+	groupChannelIds := map[string]bool{}
+	for _, channel := range slackExport.GroupChannels {
+		groupChannelIds[channel.Id] = true
+	}
+
+	extractGroupChannels := func(channels []SlackChannel) []SlackChannel {
+		result := []SlackChannel{}
+		for _, channel := range channels {
+			if !channel.IsMpim {
+				result = append(result, channel)
+				continue
+			}
+			if !groupChannelIds[channel.Id] {
+				channel.Type = model.ChannelTypeGroup
+				slackExport.GroupChannels = append(slackExport.GroupChannels, channel)
+				groupChannelIds[channel.Id] = true
+			}
+		}
+		return result
+	}
+
+	slackExport.PublicChannels = extractGroupChannels(slackExport.PublicChannels)
+	slackExport.PrivateChannels = extractGroupChannels(slackExport.PrivateChannels)
+}
+
+// LinkCanvases adds a note to the header of the channels with a canvas,
+// or with canvases or lists in their tabs, that links to them in Slack.
+// The link needs the workspace metadata; the file ids are noted otherwise.
+func LinkCanvases(slackExport *SlackExport) {
+	for _, channels := range [][]SlackChannel{slackExport.PublicChannels, slackExport.PrivateChannels, slackExport.GroupChannels, slackExport.DirectChannels} {
+		for i := range channels {
+			notes := canvasNotes(channels[i], slackExport.Workspace)
+			if len(notes) == 0 {
+				continue
+			}
+			header := channels[i].Topic.Value
+			if header != "" {
+				header += " | "
+			}
+			channels[i].Topic.Value = header + strings.Join(notes, " | ")
+		}
+	}
+}
+
+func canvasNotes(channel SlackChannel, workspace *SlackWorkspace) []string {
+	if channel.Properties == nil {
+		return nil
+	}
+
+	note := func(kind, label, fileId string) string {
+		if workspace != nil && workspace.Domain != "" && workspace.Id != "" {
+			return fmt.Sprintf("Slack %s: [%s](https://%s.slack.com/docs/%s/%s)", kind, label, workspace.Domain, workspace.Id, fileId)
+		}
+		return fmt.Sprintf("Slack %s: %s (%s)", kind, label, fileId)
+	}
+
+	notes := []string{}
+	seen := map[string]bool{}
+	if canvas := channel.Properties.Canvas; canvas != nil && canvas.FileId != "" && !canvas.IsEmpty {
+		notes = append(notes, note("canvas", "Channel canvas", canvas.FileId))
+		seen[canvas.FileId] = true
+	}
+	for _, tab := range channel.Properties.Tabs {
+		if (tab.Type != "canvas" && tab.Type != "list") || tab.Data.FileId == "" || seen[tab.Data.FileId] {
+			continue
+		}
+		label := tab.Label
+		if label == "" {
+			label = tab.Data.FileId
+		}
+		notes = append(notes, note(tab.Type, label, tab.Data.FileId))
+		seen[tab.Data.FileId] = true
+	}
+	return notes
+}
+
+// ArchiveDeadDirectChannels replaces the direct channels whose members are
+// all deleted users with a private channel that receives their posts, as
+// the import can't create direct channels with deactivated users. The
+// archive channel is owned by the active user with adminUsername, its only
+// member, so the history can be read and shared after the import.
+func (t *Transformer) ArchiveDeadDirectChannels(slackExport *SlackExport, archiveChannelName, adminUsername string) error {
+	if adminUsername == "" {
+		return errors.Errorf("the archive channel %s needs an admin", archiveChannelName)
+	}
+	var admin *IntermediateUser
+	for _, user := range t.Intermediate.UsersById {
+		if user.Username == adminUsername {
+			admin = user
+			break
+		}
+	}
+	if admin == nil || admin.DeleteAt != 0 {
+		return errors.Errorf("the admin of the archive channel %s must be an active user of the export, %s isn't", archiveChannelName, adminUsername)
+	}
+
+	for _, channels := range [][]*IntermediateChannel{t.Intermediate.PublicChannels, t.Intermediate.PrivateChannels} {
+		for _, channel := range channels {
+			if channel.Name == archiveChannelName || channel.OriginalName == archiveChannelName {
+				return errors.Errorf("the archive channel %s already exists in the export", archiveChannelName)
+			}
+		}
+	}
+
+	isDead := func(channel *IntermediateChannel) bool {
+		if len(channel.Members) == 0 {
+			return false
+		}
+		for _, member := range channel.Members {
+			user, ok := t.Intermediate.UsersById[member]
+			if !ok || user.DeleteAt == 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	directChannels := []*IntermediateChannel{}
+	archivedPosts := []SlackPost{}
+	for _, channel := range t.Intermediate.DirectChannels {
+		if !isDead(channel) {
+			directChannels = append(directChannels, channel)
+			continue
+		}
+
+		t.Logger.Infof("Moving the posts of the direct channel %s to the archive channel %s as all its members are deleted", channel.OriginalName, archiveChannelName)
+		archivedPosts = append(archivedPosts, slackExport.Posts[channel.OriginalName]...)
+		delete(slackExport.Posts, channel.OriginalName)
+	}
+
+	if len(directChannels) == len(t.Intermediate.DirectChannels) {
+		return nil
+	}
+
+	archiveChannel := &IntermediateChannel{
+		OriginalName: archiveChannelName,
+		Name:         archiveChannelName,
+		DisplayName:  archiveChannelName,
+		Members:      []string{admin.Id},
+		Creator:      admin.Id,
+		Purpose:      "Direct messages between deleted users",
+		Type:         model.ChannelTypePrivate,
+	}
+	t.recordSanitizeChanges(archiveChannel.Sanitise(t.Logger))
+
+	t.Intermediate.DirectChannels = directChannels
+	t.Intermediate.PrivateChannels = append(t.Intermediate.PrivateChannels, archiveChannel)
+	slackExport.Posts[archiveChannelName] = append(slackExport.Posts[archiveChannelName], archivedPosts...)
+
+	return nil
+}
+
+func AddPostToThreads(original SlackPost, post *IntermediatePost, threads map[string]*IntermediatePost, channel *IntermediateChannel, timestamps map[int64]bool) {
+	// direct and group posts need the channel members in the import line
+	if channel.Type == model.ChannelTypeDirect || channel.Type == model.ChannelTypeGroup {
+		post.IsDirect = true
+		post.ChannelMembers = channel.MembersUsernames
+	} else {
+		post.IsDirect = false
+	}
+
+	// avoid timestamp duplications
+	for {
+		// if the timestamp hasn't been used already, break and use
+		if _, ok := timestamps[post.CreateAt]; !ok {
+			break
+		}
+		post.CreateAt++
+	}
+	timestamps[post.CreateAt] = true
+	post.OriginalTS = original.TimeStamp
+
+	// if post is part of a thread
+	if original.ThreadTS != "" && original.ThreadTS != original.TimeStamp {
+		rootPost, ok := threads[original.ThreadTS]
+		if !ok {
+			log.Printf("ERROR processing post in thread, couldn't find rootPost: %+v\n", original)
+			return
+		}
+		rootPost.Replies = append(rootPost.Replies, post)
+		return
+	}
+
+	// if post is the root of a thread
+	if original.TimeStamp == original.ThreadTS {
+		if threads[original.ThreadTS] != nil {
+			log.Println("WARNING: overwriting root post for thread " + original.ThreadTS)
+		}
+		threads[original.ThreadTS] = post
+		return
+	}
+
+	if threads[original.TimeStamp] != nil {
+		log.Println("WARNING: overwriting root post for thread " + original.TimeStamp)
+	}
+
+	threads[original.TimeStamp] = post
+}
+
+func buildChannelsByOriginalNameMap(intermediate *Intermediate) map[string]*IntermediateChannel {
+	channelsByName := map[string]*IntermediateChannel{}
+	for _, channel := range intermediate.PublicChannels {
+		channelsByName[channel.OriginalName] = channel
+	}
+	for _, channel := range intermediate.PrivateChannels {
+		channelsByName[channel.OriginalName] = channel
+	}
+	for _, channel := range intermediate.GroupChannels {
+		channelsByName[channel.OriginalName] = channel
+	}
+	for _, channel := range intermediate.DirectChannels {
+		channelsByName[channel.OriginalName] = channel
+	}
+	return channelsByName
+}
+
+// getNormalisedFilePath returns the path of a file in the attachments
+// directory, after its id and its name without the characters that
+// aren't ASCII letters, digits or separators. The name is decomposed with
+// NFKD and the path composed with NFC, unless form overrides both.
+func getNormalisedFilePath(file *SlackFile, attachmentsDir, form string) string {
+	n := makeAlphaNumForm(file.Name, normalizationForm(form, norm.NFKD), '.', '-', '_')
+	p := path.Join(attachmentsDir, fmt.Sprintf("%s_%s", file.Id, n))
+	return normalizationForm(form, norm.NFC).String(p)
+}
+
+// addFileToPost copies a file from the export into the attachments
+// directory, or downloads it if it isn't in the export and downloads are
+// allowed. The token, if any, authorizes the download.
+func addFileToPost(file *SlackFile, uploads map[string]*zip.File, post *IntermediatePost, attachmentsDir, destFilePath string, allowDownload bool, token string) error {
+	if _, ok := uploads[file.Id]; ok || !allowDownload {
+		return addZipFileToPost(file, uploads, post, attachmentsDir, destFilePath)
+	}
+
+	return addDownloadToPost(file, post, attachmentsDir, destFilePath, token)
+}
+
+// expandAttachmentURLTemplate builds the download URL of a file from a
+// template, replacing {id} with the file id and {name} with its escaped
+// name.
+func expandAttachmentURLTemplate(template string, file *SlackFile) string {
+	return strings.NewReplacer(
+		"{id}", url.PathEscape(file.Id),
+		"{name}", url.PathEscape(file.Name),
+	).Replace(template)
+}
+
+func addDownloadToPost(file *SlackFile, post *IntermediatePost, attachmentsDir, destFilePath, token string) error {
+	fullFilePath := path.Join(attachmentsDir, destFilePath)
+
+	log.Printf("Downloading %q into %q...\n", file.DownloadURL, destFilePath)
+
+	err := downloadInto(fullFilePath, file.DownloadURL, file.Size, token)
 	if err != nil {
 		return err
 	}
@@ -428,375 +1263,2162 @@ func humanSize(size int64) string {
 		limit *= 1024
 	}
 
-	return fmt.Sprintf("%.2f %s", float64(size)/float64(limit/1024), sizes[len(sizes)-1])
+	return fmt.Sprintf("%.2f %s", float64(size)/float64(limit/1024), sizes[len(sizes)-1])
+}
+
+func addZipFileToPost(file *SlackFile, uploads map[string]*zip.File, post *IntermediatePost, attachmentsDir, destFilePath string) error {
+	zipFile, ok := uploads[file.Id]
+	if !ok {
+		return errors.Errorf("failed to retrieve file with id %s", file.Id)
+	}
+
+	zipFileReader, err := zipFile.Open()
+	if err != nil {
+		return errors.Wrapf(err, "failed to open attachment from zipfile for id %s", file.Id)
+	}
+	defer zipFileReader.Close()
+
+	destFile, err := os.Create(path.Join(attachmentsDir, destFilePath))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create file %s in the attachments directory", file.Id)
+	}
+	defer destFile.Close()
+
+	_, err = io.Copy(destFile, zipFileReader)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create file %s in the attachments directory", file.Id)
+	}
+
+	log.Printf("SUCCESS COPYING FILE %s TO DEST %s", file.Id, destFilePath)
+
+	post.Attachments = append(post.Attachments, destFilePath)
+
+	return nil
+}
+
+// placeholderPassword returns a random password for a placeholder user,
+// or one derived from the user id and Options.PlaceholderSeed if it's
+// set, so the placeholders are identical across runs.
+func (t *Transformer) placeholderPassword(userID string) string {
+	if t.Options.PlaceholderSeed == "" {
+		return model.NewId()
+	}
+
+	hash := sha256.Sum256([]byte(t.Options.PlaceholderSeed + ":" + userID))
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(hash[:]))[:26]
+}
+
+func (t *Transformer) CreateIntermediateUser(userID string) {
+	newUser := &IntermediateUser{
+		Id:        userID,
+		Username:  strings.ToLower(userID),
+		FirstName: "Deleted",
+		LastName:  "User",
+		Email:     fmt.Sprintf("%s@local", userID),
+		Password:  t.placeholderPassword(userID),
+	}
+	t.Intermediate.UsersById[userID] = newUser
+	t.recordPlaceholderUser(userID, PlaceholderKindMissing)
+	withUser(withCategory(t.Logger, WarningCategoryPlaceholder), userID).Warnf("Created a new user because the original user was missing from the import files. user=%s", userID)
+}
+
+// CreateExternalIntermediateUser creates a placeholder for a user that
+// belongs to another workspace, such as the external party of a shared DM.
+func (t *Transformer) CreateExternalIntermediateUser(userID string) {
+	newUser := &IntermediateUser{
+		Id:        userID,
+		Username:  strings.ToLower(userID),
+		FirstName: "External",
+		LastName:  "User",
+		Email:     fmt.Sprintf("%s@external", userID),
+		Password:  t.placeholderPassword(userID),
+	}
+	t.Intermediate.UsersById[userID] = newUser
+	t.recordPlaceholderUser(userID, PlaceholderKindExternal)
+	withUser(withCategory(t.Logger, WarningCategoryPlaceholder), userID).Warnf("Created a new user because the original user is external to the workspace. user=%s", userID)
+}
+
+// intermediateUser returns the user with the given id, or nil if it
+// doesn't exist. It is safe to call while several channels are being
+// transformed.
+func (t *Transformer) intermediateUser(userID string) *IntermediateUser {
+	t.usersMutex.RLock()
+	defer t.usersMutex.RUnlock()
+	return t.Intermediate.UsersById[userID]
+}
+
+// isDroppedUser reports whether the content of the user is dropped, as
+// they are a deactivated user left out of the import.
+func (t *Transformer) isDroppedUser(userID string) bool {
+	return t.Options.DropInactiveUserPosts && t.inactiveUsers[userID]
+}
+
+// getOrCreateIntermediateUser returns the user with the given id,
+// creating a placeholder user if it doesn't exist. It is safe to call
+// while several channels are being transformed.
+func (t *Transformer) getOrCreateIntermediateUser(userID string) *IntermediateUser {
+	if user := t.intermediateUser(userID); user != nil {
+		return user
+	}
+
+	t.usersMutex.Lock()
+	defer t.usersMutex.Unlock()
+	if user := t.Intermediate.UsersById[userID]; user != nil {
+		return user
+	}
+	t.CreateIntermediateUser(userID)
+	return t.Intermediate.UsersById[userID]
+}
+
+// integrationNames returns the names of the apps and integrations of the
+// integration logs, by their bot, app and service ids.
+func integrationNames(integrationLogs []SlackIntegrationLog) map[string]string {
+	names := map[string]string{}
+	for _, integrationLog := range integrationLogs {
+		name := integrationLog.Name()
+		if name == "" {
+			continue
+		}
+		for _, id := range []string{integrationLog.BotId, integrationLog.AppId, integrationLog.ServiceId} {
+			if _, ok := names[id]; id != "" && !ok {
+				names[id] = name
+			}
+		}
+	}
+	return names
+}
+
+// emojiAliases returns the custom emoji that are aliases of standard
+// emoji, following aliases of aliases, by name. Custom emoji aren't
+// imported, so reactions with these aliases are imported with the
+// standard emoji instead.
+func emojiAliases(customEmoji map[string]string) map[string]string {
+	aliases := map[string]string{}
+	for name := range customEmoji {
+		target := name
+		// the number of hops is bounded in case of alias loops
+		for i := 0; i <= len(customEmoji); i++ {
+			value, ok := customEmoji[target]
+			if !ok || !strings.HasPrefix(value, "alias:") {
+				break
+			}
+			target = strings.TrimPrefix(value, "alias:")
+		}
+		if _, custom := customEmoji[target]; !custom {
+			aliases[name] = target
+		}
+	}
+	return aliases
+}
+
+// systemEmojiNames returns the name of each standard emoji by its
+// codepoints, without variation selectors. When an emoji has several
+// names the shortest one is used, so 👍 is +1 rather than thumbsup.
+var systemEmojiNames = sync.OnceValue(func() map[string]string {
+	names := map[string]string{}
+	for name, codepoints := range model.SystemEmojis {
+		codepoints = strings.ReplaceAll(codepoints, "-fe0f", "")
+		if other, ok := names[codepoints]; ok && (len(other) < len(name) || len(other) == len(name) && other < name) {
+			continue
+		}
+		names[codepoints] = name
+	}
+	return names
+})
+
+// unicodeEmojiName returns the name of the standard emoji that a
+// reaction stored as the emoji itself, rather than its name, stands for.
+// It returns false if the reaction is a name or an unknown emoji.
+func unicodeEmojiName(reaction string) (string, bool) {
+	codepoints := []string{}
+	ascii := true
+	for _, r := range reaction {
+		if r >= utf8.RuneSelf {
+			ascii = false
+		}
+		if r == 0xfe0f {
+			continue
+		}
+		codepoints = append(codepoints, fmt.Sprintf("%x", r))
+	}
+	if ascii {
+		return "", false
+	}
+	name, ok := systemEmojiNames()[strings.Join(codepoints, "-")]
+	return name, ok
+}
+
+// getOrCreateBotIntermediateUser returns the user with the given bot id,
+// creating it if it doesn't exist. The user is named after the app or
+// integration of the bot if the integration logs have it, and is a
+// regular placeholder otherwise.
+func (t *Transformer) getOrCreateBotIntermediateUser(botID, appID string) *IntermediateUser {
+	if user := t.intermediateUser(botID); user != nil {
+		return user
+	}
+
+	name := t.integrationNames[botID]
+	if name == "" {
+		name = t.integrationNames[appID]
+	}
+	if name == "" {
+		return t.getOrCreateIntermediateUser(botID)
+	}
+
+	t.usersMutex.Lock()
+	defer t.usersMutex.Unlock()
+	if user := t.Intermediate.UsersById[botID]; user != nil {
+		return user
+	}
+
+	// the name of the integration is used as the username unless another
+	// user has it already
+	username := normalizeUsername(name)
+	for _, user := range t.Intermediate.UsersById {
+		if user.Username == username {
+			username = strings.ToLower(botID)
+			break
+		}
+	}
+	if !model.IsValidUsername(username) {
+		username = strings.ToLower(botID)
+	}
+
+	t.Intermediate.UsersById[botID] = &IntermediateUser{
+		Id:        botID,
+		Username:  username,
+		FirstName: name,
+		Email:     fmt.Sprintf("%s@local", botID),
+		Password:  t.placeholderPassword(botID),
+	}
+	withUser(withCategory(t.Logger, WarningCategoryPlaceholder), botID).Warnf("Created a new user for the bot of the integration %s. user=%s", name, botID)
+	return t.Intermediate.UsersById[botID]
+}
+
+// getOrCreateAppIntermediateUser returns the user that the app messages
+// without an author are attributed to, creating it if it doesn't exist.
+func (t *Transformer) getOrCreateAppIntermediateUser() *IntermediateUser {
+	if user := t.intermediateUser(appUserID); user != nil {
+		return user
+	}
+
+	t.usersMutex.Lock()
+	defer t.usersMutex.Unlock()
+	if user := t.Intermediate.UsersById[appUserID]; user != nil {
+		return user
+	}
+	t.Intermediate.UsersById[appUserID] = &IntermediateUser{
+		Id:        appUserID,
+		Username:  strings.ToLower(appUserID),
+		FirstName: "Slack",
+		LastName:  "App",
+		Email:     fmt.Sprintf("%s@local", appUserID),
+		Password:  t.placeholderPassword(appUserID),
+	}
+	withUser(withCategory(t.Logger, WarningCategoryPlaceholder), appUserID).Warn("Created a new user for the app messages that have no author.")
+	return t.Intermediate.UsersById[appUserID]
+}
+
+func (t *Transformer) CreateAndAddPostToThreads(post SlackPost, threads map[string]*IntermediatePost, timestamps map[int64]bool, channel *IntermediateChannel) {
+	author := t.getOrCreateIntermediateUser(post.User)
+
+	newPost := &IntermediatePost{
+		User:     author.Username,
+		Channel:  channel.Name,
+		Message:  post.Text,
+		CreateAt: SlackConvertTimeStamp(post.TimeStamp),
+		IsPinned: post.IsPinned(),
+	}
+
+	AddPostToThreads(post, newPost, threads, channel, timestamps)
+}
+
+// AddReminderSummaryPost adds a single post to a channel that lists the
+// reminders set up in it, with their owner and the time they were set up.
+// It is attributed to the app user and posted along with the last of the
+// reminders.
+func (t *Transformer) AddReminderSummaryPost(reminders []SlackPost, threads map[string]*IntermediatePost, timestamps map[int64]bool, channel *IntermediateChannel) {
+	location := t.Options.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	lines := []string{"**Reminders set up in this channel in Slack:**"}
+	for _, reminder := range reminders {
+		owner := t.getOrCreateIntermediateUser(reminder.User)
+		setUpAt := time.UnixMilli(SlackConvertTimeStamp(reminder.TimeStamp)).In(location).Format("2006-01-02 15:04 MST")
+		lines = append(lines, fmt.Sprintf("- @%s %s (%s)", owner.Username, reminder.Text, setUpAt))
+	}
+
+	last := reminders[len(reminders)-1]
+	newPost := &IntermediatePost{
+		User:     t.getOrCreateAppIntermediateUser().Username,
+		Channel:  channel.Name,
+		Message:  strings.Join(lines, "\n"),
+		CreateAt: SlackConvertTimeStamp(last.TimeStamp),
+	}
+
+	AddPostToThreads(SlackPost{TimeStamp: last.TimeStamp}, newPost, threads, channel, timestamps)
+	t.Logger.Debugf("Summarized %d reminders of channel %s in a single post", len(reminders), channel.Name)
+}
+
+// AddChannelHistorySummaryPost adds a single post to a channel that lists
+// the changes of its topic, purpose and name in order, with their time.
+// It is posted along with the last of the changes and attributed to the
+// app user, or to the author of the last change in the direct and group
+// channels, where the app user isn't a member.
+func (t *Transformer) AddChannelHistorySummaryPost(changes []SlackPost, threads map[string]*IntermediatePost, timestamps map[int64]bool, channel *IntermediateChannel) {
+	location := t.Options.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	lines := []string{"**History of this channel in Slack:**"}
+	for _, change := range changes {
+		author := t.getOrCreateIntermediateUser(change.User)
+		message := channelHistoryMessage(&change, author.Username)
+		if message == "" {
+			message = change.Text
+		}
+		changedAt := time.UnixMilli(SlackConvertTimeStamp(change.TimeStamp)).In(location).Format("2006-01-02 15:04 MST")
+		lines = append(lines, fmt.Sprintf("- %s: %s", changedAt, message))
+	}
+
+	last := changes[len(changes)-1]
+	user := t.getOrCreateIntermediateUser(last.User)
+	if channel.Type == model.ChannelTypeOpen || channel.Type == model.ChannelTypePrivate {
+		user = t.getOrCreateAppIntermediateUser()
+	}
+
+	newPost := &IntermediatePost{
+		User:     user.Username,
+		Channel:  channel.Name,
+		Message:  strings.Join(lines, "\n"),
+		CreateAt: SlackConvertTimeStamp(last.TimeStamp),
+	}
+
+	// the post is kept apart from the last change, which has the same
+	// Slack timestamp
+	summary := map[string]*IntermediatePost{}
+	AddPostToThreads(SlackPost{TimeStamp: last.TimeStamp}, newPost, summary, channel, timestamps)
+	threads["channel-history:"+last.TimeStamp] = newPost
+	t.Logger.Debugf("Summarized %d changes of channel %s in a single post", len(changes), channel.Name)
+}
+
+// CreateChannelHistoryPost adds a post for a change of the channel topic,
+// purpose or name, worded like the Mattermost system messages and keeping
+// the author and time of the change.
+func (t *Transformer) CreateChannelHistoryPost(post SlackPost, threads map[string]*IntermediatePost, timestamps map[int64]bool, channel *IntermediateChannel) {
+	author := t.getOrCreateIntermediateUser(post.User)
+	if message := channelHistoryMessage(&post, author.Username); message != "" {
+		post.Text = message
+	}
+
+	t.CreateAndAddPostToThreads(post, threads, timestamps, channel)
+}
+
+// channelHistoryMessage describes the channel change of a post, or returns
+// an empty string if the post doesn't carry the details of the change.
+// Slack topics are imported as channel headers.
+func channelHistoryMessage(post *SlackPost, username string) string {
+	switch {
+	case post.IsChannelTopicMessage() && post.Topic != nil:
+		if *post.Topic == "" {
+			return fmt.Sprintf("@%s removed the channel header", username)
+		}
+		return fmt.Sprintf("@%s updated the channel header to: %s", username, *post.Topic)
+	case post.IsChannelPurposeMessage() && post.Purpose != nil:
+		if *post.Purpose == "" {
+			return fmt.Sprintf("@%s removed the channel purpose", username)
+		}
+		return fmt.Sprintf("@%s updated the channel purpose to: %s", username, *post.Purpose)
+	case post.IsChannelNameMessage() && post.Name != "":
+		if post.OldName == "" {
+			return fmt.Sprintf("@%s updated the channel display name to: %s", username, post.Name)
+		}
+		return fmt.Sprintf("@%s updated the channel display name from: %s to: %s", username, post.OldName, post.Name)
+	}
+	return ""
+}
+
+func (t *Transformer) AddFilesToPost(post *SlackPost, skipAttachments bool, slackExport *SlackExport, attachmentsDir string, newPost *IntermediatePost, allowDownload bool) {
+	if post.File == nil && post.Files == nil {
+		return
+	}
+	logger := withChannel(withCategory(t.Logger, WarningCategoryFile), newPost.Channel)
+	if skipAttachments {
+		for _, file := range append([]*SlackFile{post.File}, post.Files...) {
+			if file == nil {
+				continue
+			}
+			if file.IsExternal() {
+				t.AddExternalFileLinkToPost(file, newPost)
+				continue
+			}
+			t.AddFileLinkToPost(file, newPost)
+		}
+		return
+	}
+	addFile := func(file *SlackFile) {
+		if file.IsExternal() {
+			t.AddExternalFileLinkToPost(file, newPost)
+			return
+		}
+
+		size := int64(-1)
+		if t.Options.AttachmentsSizeLimit > 0 {
+			size = attachmentSize(file, slackExport.Uploads)
+			if !t.reserveAttachmentSize(file.Id, size) {
+				logger.Warnf("Skipping the file %s as it would exceed the attachments size limit", file.Id)
+				t.recordSkippedAttachment(SkippedAttachment{
+					FileId:   file.Id,
+					Name:     file.Name,
+					Size:     size,
+					Channel:  newPost.Channel,
+					CreateAt: newPost.CreateAt,
+				})
+				t.AddFileLinkToPost(file, newPost)
+				return
+			}
+		}
+
+		if err := t.addFileToPostLocked(file, slackExport.Uploads, newPost, attachmentsDir, allowDownload); err != nil {
+			logger.WithError(err).Error("Failed to add file to post")
+			if t.Options.AttachmentsSizeLimit > 0 {
+				t.releaseAttachmentSize(file.Id)
+			}
+			t.AddFileLinkToPost(file, newPost)
+			return
+		}
+
+		// files of unknown size are counted once they are written
+		if t.Options.AttachmentsSizeLimit > 0 && size < 0 && len(newPost.Attachments) > 0 {
+			if info, err := os.Stat(path.Join(attachmentsDir, newPost.Attachments[len(newPost.Attachments)-1])); err == nil {
+				t.addAttachmentSize(file.Id, info.Size())
+			}
+		}
+		t.AddFileTitleToPost(file, newPost)
+	}
+
+	if post.File != nil {
+		addFile(post.File)
+	} else if post.Files != nil {
+		for _, file := range post.Files {
+			if file.Name == "" {
+				logger.Warnf("Not able to access the file %s as file access is denied so skipping", file.Id)
+				continue
+			}
+			addFile(file)
+		}
+	}
+}
+
+// addFileToPostLocked adds a file to a post while holding a lock on the
+// file id, as a file shared in several channels would otherwise be
+// written concurrently when channels are transformed in parallel.
+func (t *Transformer) addFileToPostLocked(file *SlackFile, uploads map[string]*zip.File, post *IntermediatePost, attachmentsDir string, allowDownload bool) error {
+	originalId, variant := file.Id, FileVariantOriginal
+	if _, ok := uploads[file.Id]; !ok && allowDownload && t.Options.PreferThumbnails {
+		if thumbnailURL := file.ThumbnailURL(); thumbnailURL != "" {
+			t.Logger.Infof("Downloading the thumbnail of the file %s instead of the original", file.Id)
+			variant = FileVariantThumbnail
+			file = &SlackFile{
+				Id:          file.Id + "-thumb",
+				Name:        file.Name,
+				Size:        -1,
+				DownloadURL: thumbnailURL,
+			}
+		}
+	}
+
+	token := ""
+	if _, ok := uploads[file.Id]; !ok && allowDownload && file.DownloadURL == "" && t.Options.AttachmentURLTemplate != "" {
+		downloadURL := expandAttachmentURLTemplate(t.Options.AttachmentURLTemplate, file)
+		t.Logger.Debugf("Downloading the file %s without a download URL from %s", file.Id, downloadURL)
+		reconstructed := *file
+		reconstructed.DownloadURL = downloadURL
+		file = &reconstructed
+		token = t.Options.SlackToken
+	}
+
+	value, _ := t.fileLocks.LoadOrStore(file.Id, &sync.Mutex{})
+	mutex := value.(*sync.Mutex)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	destDir := attachmentsInternal
+	if t.Options.AttachmentsByDate {
+		destDir = path.Join(attachmentsInternal, dayBucket(post.CreateAt, t.Options.Location))
+		if err := os.MkdirAll(path.Join(attachmentsDir, destDir), 0755); err != nil {
+			return errors.Wrapf(err, "failed to create the attachments directory %s", destDir)
+		}
+	}
+
+	destFilePath := getNormalisedFilePath(file, destDir, t.Options.UTF8Normalization)
+	_, inExport := uploads[file.Id]
+	download := !inExport && allowDownload
+	recordDownload := func() {
+		if download && t.Options.PreferThumbnails {
+			t.recordDownloadedFile(DownloadedFile{
+				FileId:  originalId,
+				Name:    file.Name,
+				Variant: variant,
+				URL:     file.DownloadURL,
+				Path:    destFilePath,
+			})
+		}
+	}
+
+	if download && t.Options.Checkpoint != nil && t.Options.Checkpoint.hasFile(file.Id) {
+		if _, err := os.Stat(path.Join(attachmentsDir, destFilePath)); err == nil {
+			t.Logger.Debugf("Skipping the download of the file %s as it is in the checkpoint", file.Id)
+			post.Attachments = append(post.Attachments, destFilePath)
+			recordDownload()
+			return nil
+		}
+	}
+
+	if err := addFileToPost(file, uploads, post, attachmentsDir, destFilePath, allowDownload, token); err != nil {
+		return err
+	}
+	recordDownload()
+
+	if download && t.Options.Checkpoint != nil {
+		return t.Options.Checkpoint.addFile(file.Id)
+	}
+	return nil
+}
+
+// dayBucket returns the day of a timestamp in the given location, or UTC
+// if it's nil. Slack names the files of the posts of a channel after
+// their day in the workspace timezone, so using that timezone puts the
+// attachments in the same day as the file of their post.
+func dayBucket(createAt int64, location *time.Location) string {
+	if location == nil {
+		location = time.UTC
+	}
+	return time.UnixMilli(createAt).In(location).Format("2006-01-02")
+}
+
+// AddFileLinkToPost references a file that couldn't be imported by
+// appending a markdown link to it to the message, if IncludeFileURLs is
+// set. Messages that become too long are split later on.
+func (t *Transformer) AddFileLinkToPost(file *SlackFile, newPost *IntermediatePost) {
+	if !t.Options.IncludeFileURLs || file.Name == "" {
+		return
+	}
+
+	url := file.Permalink
+	if url == "" {
+		url = file.DownloadURL
+	}
+	if url == "" {
+		withCategory(t.Logger, WarningCategoryFile).Warnf("Unable to link the file %s as it has no URL", file.Id)
+		return
+	}
+
+	title := file.Title
+	if title == "" {
+		title = file.Name
+	}
+
+	appendLinkToMessage(newPost, title, url)
+}
+
+// AddExternalFileLinkToPost appends a markdown link to a file hosted by
+// another service, such as Google Drive, to the message, as there is
+// nothing to download.
+func (t *Transformer) AddExternalFileLinkToPost(file *SlackFile, newPost *IntermediatePost) {
+	url := file.ExternalURL
+	if url == "" {
+		url = file.URLPrivate
+	}
+	if url == "" {
+		url = file.Permalink
+	}
+	if url == "" {
+		withCategory(t.Logger, WarningCategoryFile).Warnf("Unable to link the external file %s as it has no URL", file.Id)
+		return
+	}
+
+	title := file.Title
+	if title == "" {
+		title = file.Name
+	}
+	if title == "" {
+		title = url
+	}
+
+	t.Logger.Debugf("Linking the external file %s of type %s instead of importing it", file.Id, file.ExternalType)
+	appendLinkToMessage(newPost, title, url)
+}
+
+// AddFileTitleToPost appends the title of an imported file to the
+// message, as the import has no display name for attachments. Titles that
+// are just the file name, which Slack uses by default, are left out.
+func (t *Transformer) AddFileTitleToPost(file *SlackFile, newPost *IntermediatePost) {
+	title := strings.TrimSpace(file.Title)
+	if title == "" || title == file.Name || title == strings.TrimSuffix(file.Name, path.Ext(file.Name)) {
+		return
+	}
+	// the caption of a file share may already be the title
+	if slices.Contains(strings.Split(newPost.Message, "\n"), title) {
+		return
+	}
+
+	appendLineToMessage(newPost, fmt.Sprintf("*%s*", title))
+}
+
+// fileCaption returns the caption of a file share without a message,
+// following Options.FileCaption, with a line for the name or the title of
+// each of its files, or an empty string if there's no caption. Files
+// without a title are captioned with their name.
+func (t *Transformer) fileCaption(post *SlackPost) string {
+	if t.Options.FileCaption == "" || t.Options.FileCaption == FileCaptionNone {
+		return ""
+	}
+
+	lines := []string{}
+	for _, file := range append([]*SlackFile{post.File}, post.Files...) {
+		if file == nil || file.Name == "" {
+			continue
+		}
+		caption := file.Name
+		if title := strings.TrimSpace(file.Title); t.Options.FileCaption == FileCaptionTitle && title != "" {
+			caption = title
+		}
+		lines = append(lines, caption)
+	}
+
+	return truncateRunes(strings.Join(lines, "\n"), t.maxMessageLength())
+}
+
+// appendLinkToMessage adds a markdown link in a new line of the message.
+func appendLinkToMessage(newPost *IntermediatePost, title, url string) {
+	appendLineToMessage(newPost, fmt.Sprintf("[%s](%s)", title, url))
+}
+
+func appendLineToMessage(newPost *IntermediatePost, line string) {
+	if newPost.Message == "" {
+		newPost.Message = line
+	} else {
+		newPost.Message += "\n" + line
+	}
+}
+
+// AddBlockImagesToPost imports the images of the block-kit image blocks
+// of a post, which aren't part of its files. They are downloaded when
+// downloads are allowed, and linked from the message otherwise.
+func (t *Transformer) AddBlockImagesToPost(post *SlackPost, newPost *IntermediatePost, attachmentsDir string, skipAttachments, allowDownload bool) {
+	for _, block := range post.Blocks {
+		if block.Type != "image" || block.ImageURL == "" {
+			continue
+		}
+
+		file := blockImageFile(block)
+		if !skipAttachments && allowDownload {
+			err := t.addFileToPostLocked(file, nil, newPost, attachmentsDir, true)
+			if err == nil {
+				continue
+			}
+			withCategory(t.Logger, WarningCategoryFile).WithError(err).Warnf("Failed to download the image %s, linking it instead", block.ImageURL)
+		}
+
+		appendLinkToMessage(newPost, file.Title, block.ImageURL)
+	}
+}
+
+// blockImageFile describes the image of an image block as a file, with an
+// id derived from its URL so the same image is only downloaded once.
+func blockImageFile(block *SlackBlock) *SlackFile {
+	hash := sha256.Sum256([]byte(block.ImageURL))
+
+	name := "image"
+	if imageURL, err := url.Parse(block.ImageURL); err == nil {
+		if base := path.Base(imageURL.Path); base != "." && base != "/" {
+			name = base
+		}
+	}
+
+	title := block.AltText
+	if block.Title != nil && block.Title.Text != "" {
+		title = block.Title.Text
+	}
+	if title == "" {
+		title = name
+	}
+
+	return &SlackFile{
+		Id:          hex.EncodeToString(hash[:6]),
+		Name:        name,
+		Title:       title,
+		Size:        -1,
+		DownloadURL: block.ImageURL,
+	}
+}
+
+// AddReactionsToPost converts the Slack reactions of a post. Slack
+// doesn't record when a reaction was added, so reactions share the
+// post's timestamp unless SpreadReactionTimestamps is set, in which case
+// each one is placed a millisecond after the previous one.
+//
+// The importer rejects a user reacting twice with the same emoji, so
+// duplicated reactions in the export are only added once.
+//
+// If ReactionUsersLimit is set, only that many users are added for each
+// emoji and a line with the Slack count of the capped emojis is added to
+// the message.
+func (t *Transformer) AddReactionsToPost(post *SlackPost, newPost *IntermediatePost) {
+	type reactionKey struct {
+		user  string
+		emoji string
+	}
+	seen := map[reactionKey]bool{}
+
+	var capped []string
+	offset := int64(0)
+	for _, reaction := range post.Reactions {
+		emojiName := reaction.Name
+		if name, ok := unicodeEmojiName(emojiName); ok {
+			t.Logger.Debugf("Importing the reaction %s as the emoji %s", emojiName, name)
+			emojiName = name
+		}
+		if target, ok := t.emojiAliases[emojiName]; ok {
+			t.Logger.Debugf("Importing the reaction %s as its standard emoji %s", emojiName, target)
+			emojiName = target
+		}
+
+		added := 0
+		for _, userId := range reaction.Users {
+			if t.Options.ReactionUsersLimit > 0 && added == t.Options.ReactionUsersLimit {
+				break
+			}
+
+			user := t.intermediateUser(userId)
+			if user == nil {
+				t.Logger.Warnf("Unable to import the reaction %s as its user is missing. user=%s", reaction.Name, userId)
+				continue
+			}
+
+			key := reactionKey{user: user.Username, emoji: emojiName}
+			if seen[key] {
+				t.Logger.Debugf("Skipping duplicated reaction %s by user %s", emojiName, user.Username)
+				continue
+			}
+			seen[key] = true
+
+			createAt := newPost.CreateAt
+			if t.Options.SpreadReactionTimestamps {
+				offset++
+				createAt += offset
+			}
+
+			newPost.Reactions = append(newPost.Reactions, &IntermediateReaction{
+				User:      user.Username,
+				EmojiName: emojiName,
+				CreateAt:  createAt,
+			})
+			added++
+		}
+
+		// Slack only lists some of the users of very popular reactions
+		total := max(reaction.Count, len(reaction.Users))
+		if t.Options.ReactionUsersLimit > 0 && added == t.Options.ReactionUsersLimit && total > added {
+			t.Logger.Debugf("Capping the reaction %s to %d of its %d users", reaction.Name, added, total)
+			capped = append(capped, fmt.Sprintf(":%s: %d", emojiName, total))
+		}
+	}
+
+	if len(capped) > 0 {
+		note := fmt.Sprintf("_Reactions in Slack: %s. Only the first %d users of each were imported._", strings.Join(capped, ", "), t.Options.ReactionUsersLimit)
+		if newPost.Message != "" {
+			note = "\n\n" + note
+		}
+		newPost.Message += note
+	}
+}
+
+func (t *Transformer) AddAttachmentsToPost(post *SlackPost, newPost *IntermediatePost) (model.StringInterface, []byte) {
+	props := model.StringInterface{"attachments": post.Attachments}
+	propsByteArray, _ := json.Marshal(props)
+	return props, propsByteArray
+}
+
+// splitMessage splits a message in chunks of at most maxRunes runes,
+// breaking at the last newline or space of each chunk when possible.
+func splitMessage(message string, maxRunes int) []string {
+	runes := []rune(message)
+	if len(runes) <= maxRunes {
+		return []string{message}
+	}
+
+	chunks := []string{}
+	for len(runes) > maxRunes {
+		cut := maxRunes
+		next := maxRunes
+		for i := maxRunes; i > maxRunes/2; i-- {
+			if runes[i] == '\n' || runes[i] == ' ' {
+				cut = i
+				next = i + 1
+				break
+			}
+		}
+		chunks = append(chunks, string(runes[:cut]))
+		runes = runes[next:]
+	}
+	if len(runes) > 0 {
+		chunks = append(chunks, string(runes))
+	}
+
+	return chunks
+}
+
+func nextFreeTimestamp(createAt int64, timestamps map[int64]bool) int64 {
+	for timestamps[createAt] {
+		createAt++
+	}
+	timestamps[createAt] = true
+	return createAt
+}
+
+// SplitLongPost splits the messages of a thread root and its replies that
+// exceed the maximum message length. The continuation chunks are added
+// as replies right after the post they belong to, while attachments,
+// props and reactions stay on the first chunk, which for a root is the
+// root itself.
+func (t *Transformer) SplitLongPost(post *IntermediatePost, timestamps map[int64]bool) {
+	maxLength := t.maxMessageLength()
+
+	continuations := func(original *IntermediatePost, chunks []string) []*IntermediatePost {
+		replies := []*IntermediatePost{}
+		createAt := original.CreateAt
+		for _, chunk := range chunks {
+			createAt = nextFreeTimestamp(createAt+1, timestamps)
+			replies = append(replies, &IntermediatePost{
+				User:           original.User,
+				Channel:        original.Channel,
+				Message:        chunk,
+				CreateAt:       createAt,
+				IsDirect:       original.IsDirect,
+				ChannelMembers: original.ChannelMembers,
+				OriginalTS:     original.OriginalTS,
+			})
+		}
+		return replies
+	}
+
+	replies := []*IntermediatePost{}
+	if chunks := splitMessage(post.Message, maxLength); len(chunks) > 1 {
+		t.Logger.Debugf("Splitting a post of user %s in channel %s in %d posts as it exceeds the maximum message length", post.User, post.Channel, len(chunks))
+		post.Message = chunks[0]
+		replies = append(replies, continuations(post, chunks[1:])...)
+	}
+
+	for _, reply := range post.Replies {
+		replies = append(replies, reply)
+		if chunks := splitMessage(reply.Message, maxLength); len(chunks) > 1 {
+			t.Logger.Debugf("Splitting a reply of user %s in channel %s in %d posts as it exceeds the maximum message length", reply.User, reply.Channel, len(chunks))
+			reply.Message = chunks[0]
+			replies = append(replies, continuations(reply, chunks[1:])...)
+		}
+	}
+
+	if len(replies) > 0 {
+		post.Replies = replies
+
+		// the continuations can take the time of the replies that follow
+		// them, so those are moved after them, along with their reactions
+		previous := post.CreateAt
+		for _, reply := range post.Replies {
+			if reply.CreateAt <= previous {
+				shift := nextFreeTimestamp(previous+1, timestamps) - reply.CreateAt
+				reply.CreateAt += shift
+				for _, reaction := range reply.Reactions {
+					reaction.CreateAt += shift
+				}
+			}
+			previous = reply.CreateAt
+		}
+	}
+}
+
+// OrderThreadReplies sorts the replies of a thread by their creation time
+// and makes sure that every reply is created after the previous one, so
+// the server derives the last activity of the thread and its channel from
+// the latest reply.
+func OrderThreadReplies(post *IntermediatePost, timestamps map[int64]bool) {
+	sort.SliceStable(post.Replies, func(i, j int) bool {
+		return post.Replies[i].CreateAt < post.Replies[j].CreateAt
+	})
+
+	previous := post.CreateAt
+	for _, reply := range post.Replies {
+		if reply.CreateAt <= previous {
+			reply.CreateAt = nextFreeTimestamp(previous+1, timestamps)
+		}
+		previous = reply.CreateAt
+	}
+}
+
+// LimitThreadReplies keeps the earliest Options.ThreadReplyLimit replies
+// of a thread, which must be sorted, and adds a last reply noting how many
+// were left out. The note is attributed to the app user in public and
+// private channels, and to the author of the root post in direct and group
+// channels, where the app user isn't a member.
+func (t *Transformer) LimitThreadReplies(channel *IntermediateChannel, post *IntermediatePost, timestamps map[int64]bool) {
+	limit := t.Options.ThreadReplyLimit
+	if limit <= 0 || len(post.Replies) <= limit {
+		return
+	}
+
+	omitted := len(post.Replies) - limit
+	withChannel(withCategory(t.Logger, WarningCategoryTruncation), channel.Name).Warnf("Only the first %d of the %d replies of the thread at %d were imported.", limit, len(post.Replies), post.CreateAt)
+
+	post.Replies = post.Replies[:limit]
+
+	user := post.User
+	if channel.Type == model.ChannelTypeOpen || channel.Type == model.ChannelTypePrivate {
+		user = t.getOrCreateAppIntermediateUser().Username
+	}
+	previous := post.Replies[limit-1].CreateAt
+	noun := "replies"
+	if omitted == 1 {
+		noun = "reply"
+	}
+	post.Replies = append(post.Replies, &IntermediatePost{
+		User:           user,
+		Channel:        post.Channel,
+		Message:        fmt.Sprintf("_...and %d more %s in Slack that were not imported._", omitted, noun),
+		CreateAt:       nextFreeTimestamp(previous+1, timestamps),
+		IsDirect:       post.IsDirect,
+		ChannelMembers: post.ChannelMembers,
+	})
+}
+
+// flattenNestedReplies moves the replies to a reply into the thread of
+// their parent, as threads can only be one level deep. The posts must be
+// sorted by timestamp.
+func flattenNestedReplies(posts []SlackPost) {
+	// root of the thread of each reply, by the reply timestamp
+	replyRoots := map[string]string{}
+	for i := range posts {
+		post := &posts[i]
+		if post.ThreadTS == "" || post.ThreadTS == post.TimeStamp {
+			continue
+		}
+
+		if root, ok := replyRoots[post.ThreadTS]; ok {
+			post.ThreadTS = root
+		}
+		replyRoots[post.TimeStamp] = post.ThreadTS
+	}
+}
+
+// addFileThreads records the thread of a post for each of the files that
+// it shares, so the comments on those files can be added to the thread.
+func addFileThreads(post *SlackPost, fileThreads map[string]string) {
+	threadTS := post.TimeStamp
+	if post.ThreadTS != "" {
+		threadTS = post.ThreadTS
+	}
+
+	if post.File != nil {
+		fileThreads[post.File.Id] = threadTS
+	}
+	for _, file := range post.Files {
+		fileThreads[file.Id] = threadTS
+	}
+}
+
+const slackReplyCountProp = "slack_reply_count"
+
+// AddThreadMetadataToPost records the number of replies that Slack
+// reports for a thread root, so truncated threads can be detected after
+// the import.
+func AddThreadMetadataToPost(post *SlackPost, newPost *IntermediatePost) {
+	if post.ReplyCount == 0 {
+		return
+	}
+
+	if newPost.Props == nil {
+		newPost.Props = model.StringInterface{}
+	}
+	newPost.Props[slackReplyCountProp] = post.ReplyCount
+}
+
+// DropEmptyThreads removes the roots of the threads of a channel that
+// have no replies left and are either system messages or have no message,
+// attachments or props of their own. threadRoots holds the timestamps of
+// the posts that were thread roots in Slack and whether they are system
+// messages.
+func (t *Transformer) DropEmptyThreads(channel *IntermediateChannel, threads map[string]*IntermediatePost, threadRoots map[string]bool) {
+	dropped := 0
+	for threadTS, isSystem := range threadRoots {
+		post, ok := threads[threadTS]
+		if !ok || len(post.Replies) > 0 {
+			continue
+		}
+		if !isSystem && !isEmptyPost(post) {
+			continue
+		}
+		t.Logger.Debugf("Dropping the root of thread %s in channel %s as none of its replies are left", threadTS, channel.Name)
+		delete(threads, threadTS)
+		dropped++
+	}
+	if dropped > 0 {
+		t.Logger.Infof("Dropped %d threads without replies left in channel %s", dropped, channel.Name)
+	}
+}
+
+// isEmptyPost reports whether a post has no message, attachments or
+// props other than its Slack reply count.
+func isEmptyPost(post *IntermediatePost) bool {
+	if strings.TrimSpace(post.Message) != "" || len(post.Attachments) > 0 {
+		return false
+	}
+	for key := range post.Props {
+		if key != slackReplyCountProp {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckThreadReplyCounts warns about the threads of a channel that have
+// fewer replies than Slack reported, which happens with partial exports.
+func (t *Transformer) CheckThreadReplyCounts(channel *IntermediateChannel, threads map[string]*IntermediatePost) {
+	for threadTS, post := range threads {
+		replyCount, ok := post.Props[slackReplyCountProp].(int)
+		if !ok || replyCount <= len(post.Replies) {
+			continue
+		}
+		t.Logger.Warnf("Thread %s in channel %s has %d replies in Slack but only %d were imported. The export might be partial.", threadTS, channel.Name, replyCount, len(post.Replies))
+	}
+}
+
+func buildMessagePropsFromHuddle(post *SlackPost) model.StringInterface {
+	type Attachment struct {
+		ID       int    `json:"id"`
+		Text     string `json:"text"`
+		Fallback string `json:"fallback"`
+	}
+
+	type MessageProps struct {
+		Title       string       `json:"title"`
+		EndAt       int64        `json:"end_at"`
+		StartAt     int64        `json:"start_at"`
+		Attachments []Attachment `json:"attachments"`
+		FromPlugin  bool         `json:"from_plugin"`
+	}
+
+	props := MessageProps{
+		Title: "",
+		Attachments: []Attachment{{
+			ID:       0,
+			Text:     "Call ended",
+			Fallback: "Call ended",
+		}},
+		FromPlugin: true,
+		EndAt:      0,
+		StartAt:    0,
+	}
+
+	if post.Room != nil {
+		props.EndAt = int64(post.Room.DateEnd) * 1000
+		props.StartAt = int64(post.Room.DateStart) * 1000
+	}
+
+	// the calls plugin can't show a call without times, so the time of the
+	// post stands in for the missing ones
+	if props.StartAt == 0 {
+		props.StartAt = SlackConvertTimeStamp(post.TimeStamp)
+	}
+	if props.EndAt == 0 {
+		props.EndAt = props.StartAt
+	}
+
+	propsMap := make(map[string]interface{})
+	bytes, _ := json.Marshal(props)
+	_ = json.Unmarshal(bytes, &propsMap)
+
+	return propsMap
+}
+
+func (t *Transformer) TransformPosts(slackExport *SlackExport, attachmentsDir string, skipAttachments, discardInvalidProps, allowDownload bool) error {
+	t.Logger.Info("Transforming posts")
+
+	t.integrationNames = integrationNames(slackExport.IntegrationLogs)
+	t.emojiAliases = emojiAliases(slackExport.Emoji)
+	if t.Options.SeedContextPost {
+		t.channelContexts = map[string]SlackChannel{}
+		for _, channel := range append(slices.Clone(slackExport.PublicChannels), slackExport.PrivateChannels...) {
+			t.channelContexts[channel.Id] = channel
+		}
+	}
+
+	newGroupChannels := []*IntermediateChannel{}
+	newDirectChannels := []*IntermediateChannel{}
+	channelsByOriginalName := buildChannelsByOriginalNameMap(t.Intermediate)
+
+	originalChannelNames := make([]string, 0, len(slackExport.Posts))
+	for originalChannelName := range slackExport.Posts {
+		if _, ok := channelsByOriginalName[originalChannelName]; !ok {
+			t.Logger.Warnf("--- Couldn't find channel %s referenced by posts", originalChannelName)
+			continue
+		}
+		originalChannelNames = append(originalChannelNames, originalChannelName)
+	}
+	sort.Strings(originalChannelNames)
+
+	concurrentChannels := t.Options.ConcurrentChannels
+	if concurrentChannels < 1 {
+		concurrentChannels = 1
+	}
+
+	// channels are transformed concurrently and their posts merged in
+	// the order of the channel names, so the result doesn't depend on
+	// the number of workers
+	checkpoint := t.Options.Checkpoint
+	if checkpoint != nil {
+		t.restoreCheckpoint(checkpoint)
+	}
+
+	channelResults := make([][]*IntermediatePost, len(originalChannelNames))
+	channelErrors := make([]error, len(originalChannelNames))
+	var completedChannels atomic.Int64
+	t.reportProgress(ProgressPhasePosts, 0, len(originalChannelNames))
+	semaphore := make(chan struct{}, concurrentChannels)
+	var wg sync.WaitGroup
+	// number of posts of the completed channels, to stop transforming
+	// channels once the post limit is reached
+	var postCount atomic.Int64
+	for i, originalChannelName := range originalChannelNames {
+		if t.Options.PostLimit > 0 && postCount.Load() >= int64(t.Options.PostLimit) {
+			t.Logger.Infof("Skipping the posts of the remaining channels as the post limit of %d is reached", t.Options.PostLimit)
+			break
+		}
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, originalChannelName string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			defer func() {
+				t.reportProgress(ProgressPhasePosts, int(completedChannels.Add(1)), len(originalChannelNames))
+			}()
+
+			channel := channelsByOriginalName[originalChannelName]
+			if checkpoint != nil {
+				if posts, ok := checkpoint.channelPosts(channel.Name); ok {
+					t.Logger.Infof("Skipping the posts of channel %s as they are in the checkpoint", channel.Name)
+					channelResults[i] = posts
+					postCount.Add(int64(countPosts(posts)))
+					return
+				}
+			}
+
+			channelResults[i] = t.transformChannelPosts(channel, slackExport.Posts[originalChannelName], slackExport, attachmentsDir, skipAttachments, discardInvalidProps, allowDownload)
+			postCount.Add(int64(countPosts(channelResults[i])))
+
+			if checkpoint != nil {
+				channelErrors[i] = t.completeCheckpointChannel(checkpoint, channel.Name, channelResults[i])
+			}
+		}(i, originalChannelName)
+	}
+	wg.Wait()
+
+	for _, err := range channelErrors {
+		if err != nil {
+			return err
+		}
+	}
+
+	resultPosts := []*IntermediatePost{}
+	resultCount := 0
+merge:
+	for _, channelPosts := range channelResults {
+		for _, post := range channelPosts {
+			// threads are kept whole, so the last one that doesn't fit
+			// is left out along with the rest
+			threadCount := countPosts([]*IntermediatePost{post})
+			if t.Options.PostLimit > 0 && resultCount+threadCount > t.Options.PostLimit {
+				t.Logger.Infof("Stopping at %d posts as the post limit is %d", resultCount, t.Options.PostLimit)
+				break merge
+			}
+			resultPosts = append(resultPosts, post)
+			resultCount += threadCount
+		}
+	}
+
+	t.Intermediate.Posts = resultPosts
+	t.Intermediate.GroupChannels = append(t.Intermediate.GroupChannels, newGroupChannels...)
+	t.Intermediate.DirectChannels = append(t.Intermediate.DirectChannels, newDirectChannels...)
+
+	return nil
+}
+
+// countPosts returns the number of posts of a list, including replies.
+func countPosts(posts []*IntermediatePost) int {
+	count := 0
+	for _, post := range posts {
+		count += 1 + len(post.Replies)
+	}
+	return count
+}
+
+// transformChannelPosts transforms the posts of a channel, returning its
+// root posts sorted by their creation time.
+func (t *Transformer) transformChannelPosts(channel *IntermediateChannel, channelPosts []SlackPost, slackExport *SlackExport, attachmentsDir string, skipAttachments, discardInvalidProps, allowDownload bool) []*IntermediatePost {
+	timestamps := make(map[int64]bool)
+	// posts within the same millisecond are ordered by their original
+	// timestamp, so a thread root is always processed before its
+	// replies, including file shares sent right after the root
+	sort.Slice(channelPosts, func(i, j int) bool {
+		createAtI := SlackConvertTimeStamp(channelPosts[i].TimeStamp)
+		createAtJ := SlackConvertTimeStamp(channelPosts[j].TimeStamp)
+		if createAtI == createAtJ {
+			return channelPosts[i].TimeStamp < channelPosts[j].TimeStamp
+		}
+		return createAtI < createAtJ
+	})
+	flattenNestedReplies(channelPosts)
+	threads := map[string]*IntermediatePost{}
+	// thread of the post that shared each file, by file id
+	fileThreads := map[string]string{}
+	// threads whose root was dropped, by timestamp
+	droppedThreads := map[string]bool{}
+	// threads whose bot root was excluded, by timestamp, with the
+	// timestamp of the reply that replaces the root
+	botThreads := map[string]string{}
+	// reminders set up in the channel, summarized in a single post
+	reminders := []SlackPost{}
+	// changes of the topic, purpose and name, summarized in a single post
+	channelChanges := []SlackPost{}
+	// roots of the threads in Slack, by timestamp, and whether they are
+	// system messages
+	threadRoots := map[string]bool{}
+
+	for _, post := range channelPosts {
+		if t.isDroppedUser(post.User) || droppedThreads[post.ThreadTS] {
+			t.Logger.Debugf("Dropping the post %s as it belongs to a deactivated user or to one of their threads", post.TimeStamp)
+			droppedThreads[post.TimeStamp] = true
+			continue
+		}
+
+		if t.Options.ExcludeBots && (post.IsBotAuthored() || t.botUsers[post.User]) {
+			t.Logger.Debugf("Dropping the post %s as it belongs to a bot", post.TimeStamp)
+			if t.Options.DropBotThreadReplies {
+				droppedThreads[post.TimeStamp] = true
+			} else if _, ok := botThreads[post.TimeStamp]; !ok {
+				botThreads[post.TimeStamp] = ""
+			}
+			continue
+		}
+
+		// the first human reply to an excluded bot root starts a new
+		// thread that receives the rest of the replies
+		if newRootTS, ok := botThreads[post.ThreadTS]; ok && post.ThreadTS != post.TimeStamp {
+			if newRootTS == "" {
+				botThreads[post.ThreadTS] = post.TimeStamp
+				post.ThreadTS = ""
+			} else {
+				post.ThreadTS = newRootTS
+			}
+		}
+
+		// replies whose root is missing from the export, or wasn't
+		// imported, would be dropped when added to their thread
+		if t.Options.PromoteOrphanReplies && post.ThreadTS != "" && post.ThreadTS != post.TimeStamp {
+			if _, ok := threads[post.ThreadTS]; !ok {
+				withChannel(t.Logger, channel.Name).Warnf("The root of the thread %s of the reply %s is missing. The reply will be imported as a standalone post.", post.ThreadTS, post.TimeStamp)
+				post.ThreadTS = ""
+			}
+		}
+
+		if t.Options.DropEmptyThreads && post.ThreadTS != "" && post.ThreadTS == post.TimeStamp {
+			threadRoots[post.TimeStamp] = post.IsSystemMessage()
+		}
+
+		switch {
+		// plain message that can have files attached
+		case post.IsPlainMessage():
+			// messages posted by apps carry the bot id instead of a user
+			if post.User == "" && post.BotId == "" {
+				t.Logger.Warn("Unable to import the message as the user field is missing.")
+				continue
+			}
+			var author *IntermediateUser
+			if post.User != "" {
+				author = t.getOrCreateIntermediateUser(post.User)
+			} else {
+				author = t.getOrCreateBotIntermediateUser(post.BotId, post.AppId)
+			}
+			newPost := &IntermediatePost{
+				User:     author.Username,
+				Channel:  channel.Name,
+				Message:  post.Text,
+				CreateAt: SlackConvertTimeStamp(post.TimeStamp),
+				IsPinned: post.IsPinned(),
+			}
+			if newPost.Message == "" {
+				newPost.Message = t.fileCaption(&post)
+			}
+			t.AddFilesToPost(&post, skipAttachments, slackExport, attachmentsDir, newPost, allowDownload)
+			t.AddBlockImagesToPost(&post, newPost, attachmentsDir, skipAttachments, allowDownload)
+
+			if len(post.Attachments) > 0 {
+				props, propsB := t.AddAttachmentsToPost(&post, newPost)
+				if utf8.RuneCount(propsB) <= model.PostPropsMaxRunes {
+					newPost.Props = props
+				} else {
+					if discardInvalidProps {
+						t.Logger.Warn("Unable import post as props exceed the maximum character count. Skipping as --discard-invalid-props is enabled.")
+						continue
+					} else {
+						t.Logger.Warn("Unable to add props to post as they exceed the maximum character count.")
+					}
+				}
+			}
+
+			AddPostToThreads(post, newPost, threads, channel, timestamps)
+
+			// reactions are added once the post has its final timestamp
+			t.AddReactionsToPost(&post, newPost)
+			AddThreadMetadataToPost(&post, newPost)
+			addFileThreads(&post, fileThreads)
+
+		// file comment
+		case post.IsFileComment():
+			if post.Comment == nil {
+				t.Logger.Warn("Unable to import the message as it has no comments.")
+				continue
+			}
+			if post.Comment.User == "" {
+				t.Logger.Warn("Unable to import the message as the user field is missing.")
+				continue
+			}
+			author := t.intermediateUser(post.Comment.User)
+			if author == nil {
+				author = t.getOrCreateIntermediateUser(post.User)
+			}
+			newPost := &IntermediatePost{
+				User:     author.Username,
+				Channel:  channel.Name,
+				Message:  post.Comment.Comment,
+				CreateAt: SlackConvertTimeStamp(post.TimeStamp),
+			}
+
+			// the comment is a reply to the post that shared the file
+			if post.File != nil {
+				if threadTS, ok := fileThreads[post.File.Id]; ok {
+					post.ThreadTS = threadTS
+				}
+			}
+
+			AddPostToThreads(post, newPost, threads, channel, timestamps)
+
+		// bot message
+		case post.IsBotMessage():
+			var author *IntermediateUser
+			switch {
+			case post.BotId != "":
+				author = t.getOrCreateBotIntermediateUser(post.BotId, post.AppId)
+			case post.User != "":
+				author = t.getOrCreateIntermediateUser(post.User)
+			default:
+				// some app messages, such as the ones pinned by
+				// integrations, have no author at all
+				author = t.getOrCreateAppIntermediateUser()
+			}
+
+			newPost := &IntermediatePost{
+				User:     author.Username,
+				Channel:  channel.Name,
+				Message:  post.Text,
+				CreateAt: SlackConvertTimeStamp(post.TimeStamp),
+				IsPinned: post.IsPinned(),
+			}
+
+			t.AddFilesToPost(&post, skipAttachments, slackExport, attachmentsDir, newPost, allowDownload)
+			t.AddBlockImagesToPost(&post, newPost, attachmentsDir, skipAttachments, allowDownload)
+
+			if len(post.Attachments) > 0 {
+				props, propsB := t.AddAttachmentsToPost(&post, newPost)
+				if utf8.RuneCount(propsB) <= model.PostPropsMaxRunes {
+					newPost.Props = props
+				} else {
+					if discardInvalidProps {
+						t.Logger.Warn("Unable to import the post as props exceed the maximum character count. Skipping as --discard-invalid-props is enabled.")
+						continue
+					} else {
+						t.Logger.Warn("Unable to add the props to post as they exceed the maximum character count.")
+					}
+				}
+			}
+
+			AddPostToThreads(post, newPost, threads, channel, timestamps)
+
+			// reactions are added once the post has its final timestamp
+			t.AddReactionsToPost(&post, newPost)
+			AddThreadMetadataToPost(&post, newPost)
+
+		// channel join/leave messages
+		case post.IsJoinLeaveMessage():
+			if post.User == "" {
+				t.Logger.Warn("Unable to import the message as the user field is missing.")
+				continue
+			}
+
+			t.CreateAndAddPostToThreads(post, threads, timestamps, channel)
+
+		// me message
+		case post.IsMeMessage():
+			if post.User == "" {
+				t.Logger.Warn("Unable to import the message as the user field is missing.")
+				continue
+			}
+			t.CreateAndAddPostToThreads(post, threads, timestamps, channel)
+
+		// change topic message
+		case post.IsChannelTopicMessage():
+			if post.User == "" {
+				t.Logger.Warn("Unable to import the message as the user field is missing.")
+				continue
+			}
+			t.CreateChannelHistoryPost(post, threads, timestamps, channel)
+			if t.Options.ChannelTopicHistory {
+				channelChanges = append(channelChanges, post)
+			}
+
+		// change channel purpose message
+		case post.IsChannelPurposeMessage():
+			if post.User == "" {
+				t.Logger.Warn("Unable to import the message as the user field is missing.")
+				continue
+			}
+			t.CreateChannelHistoryPost(post, threads, timestamps, channel)
+			if t.Options.ChannelTopicHistory {
+				channelChanges = append(channelChanges, post)
+			}
+
+		// change channel name message
+		case post.IsChannelNameMessage():
+			if post.User == "" {
+				t.Logger.Warn("Slack Import: Unable to import the message as the user field is missing.")
+				continue
+			}
+			t.CreateChannelHistoryPost(post, threads, timestamps, channel)
+			if t.Options.ChannelTopicHistory {
+				channelChanges = append(channelChanges, post)
+			}
+
+		// Huddle thread
+		case post.isHuddleThread():
+			post.Text = "Call ended"
+			if post.Room == nil && t.Options.HuddleWithoutRoom == HuddleWithoutRoomSkip {
+				withChannel(t.Logger, channel.Name).Warnf("Skipping the huddle %s as its room data is missing.", post.TimeStamp)
+				continue
+			}
+
+			// all huddles are owned by USLACKBOT, but the room has a CreatedBy prop.
+			// this lets us get the actual user who created the huddle and fit with how Mattermost works.
+			poster := post.User
+			if post.Room != nil && len(post.Room.CreatedBy) > 0 {
+				poster = post.Room.CreatedBy
+			}
+			if poster == "" {
+				withChannel(t.Logger, channel.Name).Warnf("The huddle %s has no author, attributing it to Slackbot.", post.TimeStamp)
+				poster = "USLACKBOT"
+			}
+
+			author := t.getOrCreateIntermediateUser(poster)
+
+			huddleProps := buildMessagePropsFromHuddle(&post)
+
+			newPost := &IntermediatePost{
+				User:     author.Username,
+				Channel:  channel.Name,
+				Message:  post.Text,
+				CreateAt: SlackConvertTimeStamp(post.TimeStamp),
+				Props:    huddleProps,
+				Type:     "custom_calls",
+			}
+
+			AddPostToThreads(post, newPost, threads, channel, timestamps)
+			AddThreadMetadataToPost(&post, newPost)
+
+		// reminders are summarized once all of them are known
+		case post.IsReminderMessage() && t.Options.SummarizeReminders:
+			if post.User == "" {
+				t.Logger.Warn("Unable to summarize the reminder as the user field is missing.")
+				continue
+			}
+			reminders = append(reminders, post)
+		default:
+			withChannel(withCategory(t.Logger, WarningCategoryUnsupported), channel.Name).Warnf("Unable to import the message as its type is not supported. post_type=%s, post_subtype=%s", post.Type, post.SubType)
+		}
+	}
+
+	if len(reminders) > 0 {
+		t.AddReminderSummaryPost(reminders, threads, timestamps, channel)
+	}
+
+	if len(channelChanges) > 0 {
+		t.AddChannelHistorySummaryPost(channelChanges, threads, timestamps, channel)
+	}
+
+	if t.Options.DropEmptyThreads {
+		t.DropEmptyThreads(channel, threads, threadRoots)
+	}
+
+	t.CheckThreadReplyCounts(channel, threads)
+
+	for _, post := range threads {
+		if t.Options.MessagePrefixTemplate != "" {
+			t.PrefixMessages(channel, post)
+		}
+		OrderThreadReplies(post, timestamps)
+		t.LimitThreadReplies(channel, post, timestamps)
+	}
+
+	result := make([]*IntermediatePost, 0, len(threads))
+	for _, post := range threads {
+		result = append(result, post)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreateAt < result[j].CreateAt
+	})
+
+	if t.Options.MergeConsecutiveMessages > 0 {
+		result = t.MergeConsecutivePosts(result)
+		for _, post := range result {
+			post.Replies = t.MergeConsecutivePosts(post.Replies)
+		}
+	}
+
+	for _, post := range result {
+		t.SplitLongPost(post, timestamps)
+	}
+
+	if t.Options.PreserveTimestampPrecision {
+		PreserveOriginalOrder(result)
+	}
+
+	if t.Options.TruncationNote && len(result) > 0 && (channel.Type == model.ChannelTypeOpen || channel.Type == model.ChannelTypePrivate) {
+		result = append([]*IntermediatePost{t.truncationNotePost(channel, result[0].CreateAt)}, result...)
+	}
+
+	if t.Options.SeedContextPost && len(result) > 0 && (channel.Type == model.ChannelTypeOpen || channel.Type == model.ChannelTypePrivate) {
+		if post := t.contextPost(channel, result[0].CreateAt); post != nil {
+			result = append([]*IntermediatePost{post}, result...)
+		}
+	}
+
+	if t.Options.PostCreateAtOffset != 0 {
+		ShiftPostTimestamps(result, t.Options.PostCreateAtOffset.Milliseconds())
+		if len(result) > 0 && result[0].CreateAt <= 0 {
+			withChannel(t.Logger, channel.Name).Warnf("The posts of the channel start before 1970 once shifted and will fail to import. oldest=%d", result[0].CreateAt)
+		}
+	}
+
+	return result
+}
+
+// PrefixMessages prepends Options.MessagePrefixTemplate to the message
+// of a thread root and its replies. Calls are left alone, as their
+// message is rendered by the calls plugin. It runs before long messages are split, so the prefixed messages
+// still fit the maximum message length.
+func (t *Transformer) PrefixMessages(channel *IntermediateChannel, post *IntermediatePost) {
+	location := t.Options.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	prefix := func(post *IntermediatePost) {
+		if post.Type != "" {
+			return
+		}
+		createAt := time.UnixMilli(post.CreateAt).In(location)
+		replacer := strings.NewReplacer(
+			"{user}", post.User,
+			"{date}", createAt.Format("2006-01-02"),
+			"{time}", createAt.Format("15:04"),
+			"{channel}", channel.Name,
+		)
+		rendered := replacer.Replace(t.Options.MessagePrefixTemplate)
+		if post.Message == "" {
+			post.Message = strings.TrimRight(rendered, " ")
+		} else {
+			post.Message = rendered + post.Message
+		}
+	}
+
+	prefix(post)
+	for _, reply := range post.Replies {
+		prefix(reply)
+	}
 }
 
-func addZipFileToPost(file *SlackFile, uploads map[string]*zip.File, post *IntermediatePost, attachmentsDir string) error {
-	zipFile, ok := uploads[file.Id]
-	if !ok {
-		return errors.Errorf("failed to retrieve file with id %s", file.Id)
+// ShiftPostTimestamps adds offset milliseconds to the creation time of a
+// list of posts, their replies and reactions, and the start and end of
+// their calls. Every time is shifted by the same amount, so the order of
+// the posts and the timestamps already made unique are kept.
+func ShiftPostTimestamps(posts []*IntermediatePost, offset int64) {
+	for _, post := range posts {
+		post.CreateAt += offset
+		for _, reaction := range post.Reactions {
+			reaction.CreateAt += offset
+		}
+		for _, key := range []string{"start_at", "end_at"} {
+			// call props are decoded from JSON, so they hold float64
+			if value, ok := post.Props[key].(float64); ok && value != 0 {
+				post.Props[key] = value + float64(offset)
+			}
+		}
+		ShiftPostTimestamps(post.Replies, offset)
 	}
+}
 
-	zipFileReader, err := zipFile.Open()
-	if err != nil {
-		return errors.Wrapf(err, "failed to open attachment from zipfile for id %s", file.Id)
+// contextPost returns a post, right before the oldest post of a channel,
+// with the topic and purpose of the channel in Slack, or nil if it has
+// neither. It is attributed to the creator of the channel, or to the app
+// user if the creator isn't imported.
+func (t *Transformer) contextPost(channel *IntermediateChannel, oldestCreateAt int64) *IntermediatePost {
+	slackChannel := t.channelContexts[channel.Id]
+	topic := strings.TrimSpace(slackChannel.Topic.Value)
+	purpose := strings.TrimSpace(slackChannel.Purpose.Value)
+	if topic == "" && purpose == "" {
+		return nil
 	}
-	defer zipFileReader.Close()
 
-	destFilePath := getNormalisedFilePath(file, attachmentsInternal)
-	destFile, err := os.Create(path.Join(attachmentsDir, destFilePath))
-	if err != nil {
-		return errors.Wrapf(err, "failed to create file %s in the attachments directory", file.Id)
+	lines := []string{"_Channel context imported from Slack_"}
+	if topic != "" {
+		lines = append(lines, "**Topic:** "+topic)
 	}
-	defer destFile.Close()
-
-	_, err = io.Copy(destFile, zipFileReader)
-	if err != nil {
-		return errors.Wrapf(err, "failed to create file %s in the attachments directory", file.Id)
+	if purpose != "" {
+		lines = append(lines, "**Purpose:** "+purpose)
 	}
 
-	log.Printf("SUCCESS COPYING FILE %s TO DEST %s", file.Id, destFilePath)
-
-	post.Attachments = append(post.Attachments, destFilePath)
-
-	return nil
-}
+	user := t.getOrCreateAppIntermediateUser()
+	if channel.Creator != "" {
+		if creator := t.intermediateUser(channel.Creator); creator != nil {
+			user = creator
+		}
+	}
 
-func (t *Transformer) CreateIntermediateUser(userID string) {
-	newUser := &IntermediateUser{
-		Id:        userID,
-		Username:  strings.ToLower(userID),
-		FirstName: "Deleted",
-		LastName:  "User",
-		Email:     fmt.Sprintf("%s@local", userID),
-		Password:  model.NewId(),
+	return &IntermediatePost{
+		User:     user.Username,
+		Channel:  channel.Name,
+		Message:  strings.Join(lines, "\n"),
+		CreateAt: oldestCreateAt - 1,
 	}
-	t.Intermediate.UsersById[userID] = newUser
-	t.Logger.Warnf("Created a new user because the original user was missing from the import files. user=%s", userID)
 }
 
-func (t *Transformer) CreateAndAddPostToThreads(post SlackPost, threads map[string]*IntermediatePost, timestamps map[int64]bool, channel *IntermediateChannel) {
-	author := t.Intermediate.UsersById[post.User]
-	if author == nil {
-		t.CreateIntermediateUser(post.User)
-		author = t.Intermediate.UsersById[post.User]
+// truncationNotePost returns a post, right before the oldest post of a
+// channel, noting the date of that post, as free workspaces export a
+// limited history and the older messages are missing. The direct and
+// group channels don't get the note, as it is attributed to the app user,
+// who isn't one of their members.
+func (t *Transformer) truncationNotePost(channel *IntermediateChannel, oldestCreateAt int64) *IntermediatePost {
+	location := t.Options.Location
+	if location == nil {
+		location = time.UTC
 	}
+	oldest := time.UnixMilli(oldestCreateAt).In(location).Format("January 2, 2006")
 
-	newPost := &IntermediatePost{
-		User:     author.Username,
+	return &IntermediatePost{
+		User:     t.getOrCreateAppIntermediateUser().Username,
 		Channel:  channel.Name,
-		Message:  post.Text,
-		CreateAt: SlackConvertTimeStamp(post.TimeStamp),
+		Message:  fmt.Sprintf("_The history of this channel was imported from Slack starting on %s, the date of its oldest message in the export. Older messages may not have been included in the export._", oldest),
+		CreateAt: oldestCreateAt - 1,
 	}
-
-	AddPostToThreads(post, newPost, threads, channel, timestamps)
 }
 
-func (t *Transformer) AddFilesToPost(post *SlackPost, skipAttachments bool, slackExport *SlackExport, attachmentsDir string, newPost *IntermediatePost, allowDownload bool) {
-	if skipAttachments || (post.File == nil && post.Files == nil) {
-		return
+// PreserveOriginalOrder reassigns the timestamps of the posts of a
+// channel, sorted by creation time, so they strictly increase in the
+// order of the original Slack timestamps, which have sub-millisecond
+// precision. Resolving collisions one post at a time can push a post,
+// such as the continuation of a split message, past the time of a later
+// one. The chunks of a split message keep their order right after it,
+// and replies are always kept after their root. Reactions are shifted
+// along with their post.
+func PreserveOriginalOrder(posts []*IntermediatePost) {
+	type entry struct {
+		post *IntermediatePost
+		// time and timestamp of the original message, and position
+		// among the chunks of the same message
+		base int64
+		ts   string
+		seq  int64
 	}
-	if post.File != nil {
-		if err := addFileToPost(post.File, slackExport.Uploads, newPost, attachmentsDir, allowDownload); err != nil {
-			t.Logger.WithError(err).Error("Failed to add file to post")
+	key := func(post *IntermediatePost) entry {
+		if post.OriginalTS == "" {
+			return entry{post: post, base: post.CreateAt, seq: post.CreateAt}
 		}
-	} else if post.Files != nil {
-		for _, file := range post.Files {
-			if file.Name == "" {
-				t.Logger.Warnf("Not able to access the file %s as file access is denied so skipping", file.Id)
-				continue
+		return entry{post: post, base: SlackConvertTimeStamp(post.OriginalTS), ts: post.OriginalTS, seq: post.CreateAt}
+	}
+	less := func(a, b entry) bool {
+		if a.base != b.base {
+			return a.base < b.base
+		}
+		if a.ts != b.ts {
+			return a.ts < b.ts
+		}
+		return a.seq < b.seq
+	}
+
+	entries := []entry{}
+	for _, post := range posts {
+		root := key(post)
+		entries = append(entries, root)
+		for _, reply := range post.Replies {
+			replyEntry := key(reply)
+			if less(replyEntry, root) {
+				replyEntry.base, replyEntry.ts = root.base, root.ts
 			}
-			if err := addFileToPost(file, slackExport.Uploads, newPost, attachmentsDir, allowDownload); err != nil {
-				t.Logger.WithError(err).Error("Failed to add file to post")
+			entries = append(entries, replyEntry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return less(entries[i], entries[j]) })
+
+	var previous int64
+	for i, e := range entries {
+		createAt := e.base
+		if i > 0 && createAt <= previous {
+			createAt = previous + 1
+		}
+		if delta := createAt - e.post.CreateAt; delta != 0 {
+			e.post.CreateAt = createAt
+			for _, reaction := range e.post.Reactions {
+				reaction.CreateAt += delta
 			}
 		}
+		previous = createAt
 	}
-}
 
-func (t *Transformer) AddAttachmentsToPost(post *SlackPost, newPost *IntermediatePost) (model.StringInterface, []byte) {
-	props := model.StringInterface{"attachments": post.Attachments}
-	propsByteArray, _ := json.Marshal(props)
-	return props, propsByteArray
+	for _, post := range posts {
+		sort.SliceStable(post.Replies, func(i, j int) bool {
+			return post.Replies[i].CreateAt < post.Replies[j].CreateAt
+		})
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].CreateAt < posts[j].CreateAt
+	})
 }
 
-func buildMessagePropsFromHuddle(post *SlackPost) model.StringInterface {
-	type Attachment struct {
-		ID       int    `json:"id"`
-		Text     string `json:"text"`
-		Fallback string `json:"fallback"`
+// MergeConsecutivePosts merges the posts of a list, sorted by creation
+// time, that follow a post of the same author within
+// Options.MergeConsecutiveMessages of it. The merged post keeps the
+// earliest timestamp and the attachments and reactions of all of them.
+// Thread roots with replies, system messages and posts with props are
+// never merged, and neither are posts that would exceed the maximum
+// message length or number of attachments.
+func (t *Transformer) MergeConsecutivePosts(posts []*IntermediatePost) []*IntermediatePost {
+	window := t.Options.MergeConsecutiveMessages.Milliseconds()
+	maxLength := t.maxMessageLength()
+
+	mergeable := func(post *IntermediatePost) bool {
+		return len(post.Replies) == 0 && post.Type == "" && len(post.Props) == 0 && !post.IsPinned
 	}
 
-	type MessageProps struct {
-		Title       string       `json:"title"`
-		EndAt       int64        `json:"end_at"`
-		StartAt     int64        `json:"start_at"`
-		Attachments []Attachment `json:"attachments"`
-		FromPlugin  bool         `json:"from_plugin"`
+	result := []*IntermediatePost{}
+	// creation time of the last post merged into the last result
+	var lastCreateAt int64
+	for _, post := range posts {
+		if len(result) > 0 {
+			previous := result[len(result)-1]
+			if previous.User == post.User &&
+				mergeable(previous) && mergeable(post) &&
+				post.CreateAt-lastCreateAt <= window &&
+				utf8.RuneCountInString(previous.Message)+1+utf8.RuneCountInString(post.Message) <= maxLength &&
+				len(previous.Attachments)+len(post.Attachments) <= POST_MAX_ATTACHMENTS {
+				mergePosts(previous, post)
+				lastCreateAt = post.CreateAt
+				continue
+			}
+		}
+		result = append(result, post)
+		lastCreateAt = post.CreateAt
 	}
 
-	props := MessageProps{
-		Title: "",
-		Attachments: []Attachment{{
-			ID:       0,
-			Text:     "Call ended",
-			Fallback: "Call ended",
-		}},
-		FromPlugin: true,
-		EndAt:      0,
-		StartAt:    0,
+	if merged := len(posts) - len(result); merged > 0 {
+		t.Logger.Debugf("Merged %d consecutive messages into the previous message of their author", merged)
 	}
+	return result
+}
 
-	if post.Room != nil {
-		props.EndAt = int64(post.Room.DateEnd) * 1000
-		props.StartAt = int64(post.Room.DateStart) * 1000
+// mergePosts appends the message, attachments and reactions of post to
+// target, skipping the reactions that target already has.
+func mergePosts(target, post *IntermediatePost) {
+	switch {
+	case post.Message == "":
+	case target.Message == "":
+		target.Message = post.Message
+	default:
+		target.Message += "\n" + post.Message
 	}
 
-	propsMap := make(map[string]interface{})
-	bytes, _ := json.Marshal(props)
-	_ = json.Unmarshal(bytes, &propsMap)
+	target.Attachments = append(target.Attachments, post.Attachments...)
 
-	return propsMap
+	for _, reaction := range post.Reactions {
+		duplicated := slices.ContainsFunc(target.Reactions, func(existing *IntermediateReaction) bool {
+			return existing.User == reaction.User && existing.EmojiName == reaction.EmojiName
+		})
+		if !duplicated {
+			target.Reactions = append(target.Reactions, reaction)
+		}
+	}
 }
 
-func (t *Transformer) TransformPosts(slackExport *SlackExport, attachmentsDir string, skipAttachments, discardInvalidProps, allowDownload bool) error {
-	t.Logger.Info("Transforming posts")
+func (t *Transformer) Transform(slackExport *SlackExport, attachmentsDir string, skipAttachments, discardInvalidProps, allowDownload, skipEmptyEmails bool, defaultEmailDomain string) error {
+	if err := t.ValidateUserRenames(slackExport.Users); err != nil {
+		return err
+	}
 
-	newGroupChannels := []*IntermediateChannel{}
-	newDirectChannels := []*IntermediateChannel{}
-	channelsByOriginalName := buildChannelsByOriginalNameMap(t.Intermediate)
+	if err := t.ValidateChannelRenames(slackExport); err != nil {
+		return err
+	}
 
-	resultPosts := []*IntermediatePost{}
-	for originalChannelName, channelPosts := range slackExport.Posts {
-		channel, ok := channelsByOriginalName[originalChannelName]
-		if !ok {
-			t.Logger.Warnf("--- Couldn't find channel %s referenced by posts", originalChannelName)
-			continue
-		}
+	t.reportProgress(ProgressPhaseUsers, 0, len(slackExport.Users))
+	t.TransformUsers(slackExport.Users, skipEmptyEmails, defaultEmailDomain)
+	t.reportProgress(ProgressPhaseUsers, len(slackExport.Users), len(slackExport.Users))
 
-		timestamps := make(map[int64]bool)
-		sort.Slice(channelPosts, func(i, j int) bool {
-			return SlackConvertTimeStamp(channelPosts[i].TimeStamp) < SlackConvertTimeStamp(channelPosts[j].TimeStamp)
-		})
-		threads := map[string]*IntermediatePost{}
+	channelCount := len(slackExport.PublicChannels) + len(slackExport.PrivateChannels) + len(slackExport.GroupChannels) + len(slackExport.DirectChannels)
+	t.reportProgress(ProgressPhaseChannels, 0, channelCount)
+	if err := t.TransformAllChannels(slackExport); err != nil {
+		return err
+	}
+	t.reportProgress(ProgressPhaseChannels, channelCount, channelCount)
 
-		for _, post := range channelPosts {
-			switch {
-			// plain message that can have files attached
-			case post.IsPlainMessage():
-				if post.User == "" {
-					t.Logger.Warn("Unable to import the message as the user field is missing.")
-					continue
-				}
-				author := t.Intermediate.UsersById[post.User]
-				if author == nil {
-					t.CreateIntermediateUser(post.User)
-					author = t.Intermediate.UsersById[post.User]
-				}
-				newPost := &IntermediatePost{
-					User:     author.Username,
-					Channel:  channel.Name,
-					Message:  post.Text,
-					CreateAt: SlackConvertTimeStamp(post.TimeStamp),
-				}
-				t.AddFilesToPost(&post, skipAttachments, slackExport, attachmentsDir, newPost, allowDownload)
+	if t.Options.ChannelMembersFromPosts {
+		t.AddPostersToChannels(slackExport.Posts)
+	}
 
-				if len(post.Attachments) > 0 {
-					props, propsB := t.AddAttachmentsToPost(&post, newPost)
-					if utf8.RuneCount(propsB) <= model.PostPropsMaxRunes {
-						newPost.Props = props
-					} else {
-						if discardInvalidProps {
-							t.Logger.Warn("Unable import post as props exceed the maximum character count. Skipping as --discard-invalid-props is enabled.")
-							continue
-						} else {
-							t.Logger.Warn("Unable to add props to post as they exceed the maximum character count.")
-						}
-					}
-				}
+	t.PopulateUserMemberships()
+	t.PopulateChannelMemberships()
 
-				AddPostToThreads(post, newPost, threads, channel, timestamps)
+	if t.Options.ImportCategories {
+		t.PopulateUserFavorites(slackExport.Sections)
+	}
 
-			// file comment
-			case post.IsFileComment():
-				if post.Comment == nil {
-					t.Logger.Warn("Unable to import the message as it has no comments.")
-					continue
-				}
-				if post.Comment.User == "" {
-					t.Logger.Warn("Unable to import the message as the user field is missing.")
-					continue
-				}
-				author := t.Intermediate.UsersById[post.Comment.User]
-				if author == nil {
-					t.CreateIntermediateUser(post.User)
-					author = t.Intermediate.UsersById[post.User]
-				}
-				newPost := &IntermediatePost{
-					User:     author.Username,
-					Channel:  channel.Name,
-					Message:  post.Comment.Comment,
-					CreateAt: SlackConvertTimeStamp(post.TimeStamp),
-				}
+	if err := t.TransformPosts(slackExport, attachmentsDir, skipAttachments, discardInvalidProps, allowDownload); err != nil {
+		return err
+	}
 
-				AddPostToThreads(post, newPost, threads, channel, timestamps)
+	if !t.Options.SkipChannelsWithoutPostsSince.IsZero() {
+		t.RemoveStaleChannels(t.Options.SkipChannelsWithoutPostsSince)
+	}
 
-			// bot message
-			case post.IsBotMessage():
-				if post.BotId == "" {
-					if post.User == "" {
-						t.Logger.Warn("Unable to import the message as the user field is missing.")
-						continue
-					}
-					post.BotId = post.User
-				}
+	if t.Options.DiscardEmptyChannels {
+		t.RemoveEmptyChannels()
+	}
 
-				author := t.Intermediate.UsersById[post.BotId]
-				if author == nil {
-					t.CreateIntermediateUser(post.BotId)
-					author = t.Intermediate.UsersById[post.BotId]
-				}
+	if t.Options.AttachmentBaseURL != "" {
+		t.LinkAttachmentsToBaseURL(t.Options.AttachmentBaseURL)
+	}
 
-				newPost := &IntermediatePost{
-					User:     author.Username,
-					Channel:  channel.Name,
-					Message:  post.Text,
-					CreateAt: SlackConvertTimeStamp(post.TimeStamp),
-				}
+	// the authors, members and reactions already carry the new
+	// usernames, only the mentions converted when parsing don't
+	if len(t.renamedUsernames) > 0 {
+		t.replaceMentionedUsernames(t.renamedUsernames)
+	}
 
-				t.AddFilesToPost(&post, skipAttachments, slackExport, attachmentsDir, newPost, allowDownload)
+	if t.Options.HashUsernames {
+		t.HashUsernames(t.Options.HashSalt, t.Options.HashEmails)
+	}
 
-				if len(post.Attachments) > 0 {
-					props, propsB := t.AddAttachmentsToPost(&post, newPost)
-					if utf8.RuneCount(propsB) <= model.PostPropsMaxRunes {
-						newPost.Props = props
-					} else {
-						if discardInvalidProps {
-							t.Logger.Warn("Unable to import the post as props exceed the maximum character count. Skipping as --discard-invalid-props is enabled.")
-							continue
-						} else {
-							t.Logger.Warn("Unable to add the props to post as they exceed the maximum character count.")
-						}
-					}
-				}
+	return nil
+}
 
-				AddPostToThreads(post, newPost, threads, channel, timestamps)
+// PopulateUserFavorites marks the channels in the starred sidebar section
+// of each user as favorites. The import format has no custom categories,
+// so the channels of other sections are imported without them.
+func (t *Transformer) PopulateUserFavorites(sections []SlackSection) {
+	t.Logger.Info("Populating user favorites")
 
-			// channel join/leave messages
-			case post.IsJoinLeaveMessage():
-				if post.User == "" {
-					t.Logger.Warn("Unable to import the message as the user field is missing.")
-					continue
-				}
+	channelNames := map[string]string{}
+	for _, channel := range t.Intermediate.PublicChannels {
+		channelNames[channel.Id] = channel.Name
+	}
+	for _, channel := range t.Intermediate.PrivateChannels {
+		channelNames[channel.Id] = channel.Name
+	}
 
-				t.CreateAndAddPostToThreads(post, threads, timestamps, channel)
+	for _, section := range sections {
+		user, ok := t.Intermediate.UsersById[section.User]
+		if !ok {
+			continue
+		}
 
-			// me message
-			case post.IsMeMessage():
-				if post.User == "" {
-					t.Logger.Warn("Unable to import the message as the user field is missing.")
-					continue
-				}
-				t.CreateAndAddPostToThreads(post, threads, timestamps, channel)
+		if section.Type != "stars" {
+			if len(section.ChannelIds) > 0 {
+				withUser(withCategory(t.Logger, WarningCategoryUnsupported), user.Id).Warnf("Unable to import the sidebar section %s of the user %s as only favorites are supported. Its channels will be imported without it", section.Name, user.Username)
+			}
+			continue
+		}
 
-			// change topic message
-			case post.IsChannelTopicMessage():
-				if post.User == "" {
-					t.Logger.Warn("Unable to import the message as the user field is missing.")
-					continue
-				}
-				t.CreateAndAddPostToThreads(post, threads, timestamps, channel)
+		for _, channelId := range section.ChannelIds {
+			name, ok := channelNames[channelId]
+			if !ok || !slices.Contains(user.Memberships, name) || slices.Contains(user.Favorites, name) {
+				continue
+			}
+			user.Favorites = append(user.Favorites, name)
+		}
+	}
+}
 
-			// change channel purpose message
-			case post.IsChannelPurposeMessage():
-				if post.User == "" {
-					t.Logger.Warn("Unable to import the message as the user field is missing.")
-					continue
-				}
-				t.CreateAndAddPostToThreads(post, threads, timestamps, channel)
+// RemoveStaleChannels removes the public and private channels whose most
+// recent post, including thread replies, is older than since, along with
+// their posts and memberships. Channels without posts are removed too.
+func (t *Transformer) RemoveStaleChannels(since time.Time) {
+	cutoff := since.UnixMilli()
+
+	lastPostAt := map[string]int64{}
+	for _, post := range t.Intermediate.Posts {
+		createAt := post.CreateAt
+		for _, reply := range post.Replies {
+			createAt = max(createAt, reply.CreateAt)
+		}
+		lastPostAt[post.Channel] = max(lastPostAt[post.Channel], createAt)
+	}
 
-			// change channel name message
-			case post.IsChannelNameMessage():
-				if post.User == "" {
-					t.Logger.Warn("Slack Import: Unable to import the message as the user field is missing.")
-					continue
-				}
-				t.CreateAndAddPostToThreads(post, threads, timestamps, channel)
-
-			// Huddle thread
-			case post.isHuddleThread():
-				post.Text = "Call ended"
-				if post.User == "" {
-					t.Logger.Warn("Slack Import: Unable to import the message as the user field is missing.")
-					continue
-				}
+	staleChannels := map[string]bool{}
+	removeStale := func(channels []*IntermediateChannel) []*IntermediateChannel {
+		result := []*IntermediateChannel{}
+		for _, channel := range channels {
+			if lastPostAt[channel.Name] < cutoff {
+				t.Logger.Infof("Skipping channel %s as it has no posts since %s", channel.Name, since.Format(time.RFC3339))
+				staleChannels[channel.Name] = true
+				continue
+			}
+			result = append(result, channel)
+		}
+		return result
+	}
 
-				// all huddles are owned by USLACKBOT, but the room has a CreatedBy prop.
-				// this lets us get the actual user who created the huddle and fit with how Mattermost works.
-				poster := post.User
-				if len(post.Room.CreatedBy) > 0 {
-					poster = post.Room.CreatedBy
-				}
+	t.Intermediate.PublicChannels = removeStale(t.Intermediate.PublicChannels)
+	t.Intermediate.PrivateChannels = removeStale(t.Intermediate.PrivateChannels)
+	if len(staleChannels) == 0 {
+		return
+	}
 
-				author := t.Intermediate.UsersById[poster]
-				if author == nil {
-					t.CreateIntermediateUser(poster)
-					author = t.Intermediate.UsersById[poster]
-				}
+	posts := []*IntermediatePost{}
+	for _, post := range t.Intermediate.Posts {
+		if !post.IsDirect && staleChannels[post.Channel] {
+			continue
+		}
+		posts = append(posts, post)
+	}
+	t.Intermediate.Posts = posts
 
-				huddleProps := buildMessagePropsFromHuddle(&post)
+	removeMemberships := func(memberships []string) []string {
+		result := []string{}
+		for _, channelName := range memberships {
+			if !staleChannels[channelName] {
+				result = append(result, channelName)
+			}
+		}
+		return result
+	}
+	for _, user := range t.Intermediate.UsersById {
+		user.Memberships = removeMemberships(user.Memberships)
+		user.AdminMemberships = removeMemberships(user.AdminMemberships)
+	}
+}
 
-				newPost := &IntermediatePost{
-					User:     author.Username,
-					Channel:  channel.Name,
-					Message:  post.Text,
-					CreateAt: SlackConvertTimeStamp(post.TimeStamp),
-					Props:    huddleProps,
-					Type:     "custom_calls",
-				}
+// RemoveEmptyChannels removes the public and private channels that have
+// neither posts nor members. Direct and group channels without members
+// are never imported.
+func (t *Transformer) RemoveEmptyChannels() {
+	channelsWithPosts := map[string]bool{}
+	for _, post := range t.Intermediate.Posts {
+		channelsWithPosts[post.Channel] = true
+	}
 
-				AddPostToThreads(post, newPost, threads, channel, timestamps)
-			default:
-				t.Logger.Warnf("Unable to import the message as its type is not supported. post_type=%s, post_subtype=%s", post.Type, post.SubType)
+	removeEmpty := func(channels []*IntermediateChannel) []*IntermediateChannel {
+		result := []*IntermediateChannel{}
+		for _, channel := range channels {
+			if len(channel.Members) == 0 && !channelsWithPosts[channel.Name] {
+				t.Logger.Infof("Discarding channel %s as it has no posts and no members", channel.Name)
+				continue
 			}
+			result = append(result, channel)
+		}
+		return result
+	}
+
+	t.Intermediate.PublicChannels = removeEmpty(t.Intermediate.PublicChannels)
+	t.Intermediate.PrivateChannels = removeEmpty(t.Intermediate.PrivateChannels)
+}
+
+// ExternalAttachment is an attachment that is linked from its post instead
+// of being imported, and has to be uploaded to URL separately.
+type ExternalAttachment struct {
+	Path string
+	URL  string
+}
+
+// LinkAttachmentsToBaseURL replaces the attachments of the posts with
+// links to them under baseURL, keeping the same relative path they have in
+// the attachments directory. The attachments to upload are recorded in the
+// attachment manifest. The posts that the links make too long are split
+// again.
+func (t *Transformer) LinkAttachmentsToBaseURL(baseURL string) {
+	t.Logger.Info("Linking attachments to the base URL")
+
+	baseURL = strings.TrimRight(baseURL, "/")
+	var linkAttachments func(post *IntermediatePost)
+	linkAttachments = func(post *IntermediatePost) {
+		for _, attachmentPath := range post.Attachments {
+			attachmentURL := baseURL + "/" + attachmentPath
+			appendLinkToMessage(post, path.Base(attachmentPath), attachmentURL)
+			t.externalAttachments = append(t.externalAttachments, ExternalAttachment{Path: attachmentPath, URL: attachmentURL})
 		}
+		post.Attachments = nil
 
-		channelPosts := []*IntermediatePost{}
-		for _, post := range threads {
-			channelPosts = append(channelPosts, post)
+		for _, reply := range post.Replies {
+			linkAttachments(reply)
 		}
-		resultPosts = append(resultPosts, channelPosts...)
 	}
 
-	t.Intermediate.Posts = resultPosts
-	t.Intermediate.GroupChannels = append(t.Intermediate.GroupChannels, newGroupChannels...)
-	t.Intermediate.DirectChannels = append(t.Intermediate.DirectChannels, newDirectChannels...)
+	// the continuations of the split posts take the free timestamps of
+	// their channel
+	timestamps := map[string]map[int64]bool{}
+	for _, post := range t.Intermediate.Posts {
+		if timestamps[post.Channel] == nil {
+			timestamps[post.Channel] = map[int64]bool{}
+		}
+		timestamps[post.Channel][post.CreateAt] = true
+		for _, reply := range post.Replies {
+			timestamps[post.Channel][reply.CreateAt] = true
+		}
+	}
 
-	return nil
+	for _, post := range t.Intermediate.Posts {
+		linkAttachments(post)
+		t.SplitLongPost(post, timestamps[post.Channel])
+	}
 }
 
-func (t *Transformer) Transform(slackExport *SlackExport, attachmentsDir string, skipAttachments, discardInvalidProps, allowDownload, skipEmptyEmails bool, defaultEmailDomain string) error {
-	t.TransformUsers(slackExport.Users, skipEmptyEmails, defaultEmailDomain)
+// AttachmentManifest returns the attachments linked by
+// LinkAttachmentsToBaseURL, in the order of their posts.
+func (t *Transformer) AttachmentManifest() []ExternalAttachment {
+	return t.externalAttachments
+}
 
-	if err := t.TransformAllChannels(slackExport); err != nil {
+// WriteAttachmentManifest writes the attachment manifest as a CSV file
+// with the path of each attachment in the attachments directory and the
+// URL it has to be uploaded to.
+func (t *Transformer) WriteAttachmentManifest(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"path", "url"}); err != nil {
 		return err
 	}
+	for _, attachment := range t.externalAttachments {
+		if err := writer.Write([]string{attachment.Path, attachment.URL}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
 
-	t.PopulateUserMemberships()
-	t.PopulateChannelMemberships()
+// hashValue returns a stable hash of value, salted with salt, that is a
+// valid Mattermost username.
+func hashValue(salt, value string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + value))
+	return "u" + hex.EncodeToString(sum[:])[:20]
+}
 
-	if err := t.TransformPosts(slackExport, attachmentsDir, skipAttachments, discardInvalidProps, allowDownload); err != nil {
-		return err
+// HashUsernames replaces every username with a salted hash of it, in the
+// users, the direct channel members, the authors and reactions of the
+// posts and the mentions in their messages. If hashEmails is set, the
+// local part of the emails is replaced with a hash of the email too.
+func (t *Transformer) HashUsernames(salt string, hashEmails bool) {
+	t.Logger.Info("Hashing usernames")
+
+	hashes := map[string]string{}
+	for _, user := range t.Intermediate.UsersById {
+		hash := hashValue(salt, user.Username)
+		hashes[user.Username] = hash
+		user.Username = hash
+
+		if hashEmails && user.Email != "" {
+			domain := ""
+			if i := strings.LastIndex(user.Email, "@"); i >= 0 {
+				domain = user.Email[i:]
+			}
+			user.Email = hashValue(salt, user.Email) + domain
+		}
 	}
 
-	return nil
+	hashUsernames := func(usernames []string) {
+		for i, username := range usernames {
+			if hash, ok := hashes[username]; ok {
+				usernames[i] = hash
+			}
+		}
+	}
+
+	for _, channels := range [][]*IntermediateChannel{t.Intermediate.GroupChannels, t.Intermediate.DirectChannels} {
+		for _, channel := range channels {
+			hashUsernames(channel.MembersUsernames)
+		}
+	}
+
+	var hashPost func(post *IntermediatePost)
+	hashPost = func(post *IntermediatePost) {
+		if hash, ok := hashes[post.User]; ok {
+			post.User = hash
+		}
+		hashUsernames(post.ChannelMembers)
+		for _, reaction := range post.Reactions {
+			if hash, ok := hashes[reaction.User]; ok {
+				reaction.User = hash
+			}
+		}
+		post.Message = replaceMentions(post.Message, hashes)
+		for _, reply := range post.Replies {
+			hashPost(reply)
+		}
+	}
+	for _, post := range t.Intermediate.Posts {
+		hashPost(post)
+	}
+}
+
+// NormalizationForms are the Unicode normalization forms that can be set
+// in Options.UTF8Normalization, by name.
+var NormalizationForms = map[string]norm.Form{
+	"nfc":  norm.NFC,
+	"nfd":  norm.NFD,
+	"nfkc": norm.NFKC,
+	"nfkd": norm.NFKD,
+}
+
+// normalizationForm returns the normalization form named name, or
+// fallback if it is empty or unknown.
+func normalizationForm(name string, fallback norm.Form) norm.Form {
+	if form, ok := NormalizationForms[name]; ok {
+		return form
+	}
+	return fallback
 }
 
 func makeAlphaNum(str string, allowAdditional ...rune) string {
+	return makeAlphaNumForm(str, norm.NFKD, allowAdditional...)
+}
+
+// makeAlphaNumForm replaces the characters of str that aren't ASCII
+// letters or digits, nor one of allowAdditional, with underscores, after
+// normalizing it with form. Non-ASCII characters are removed, so the
+// decomposed forms keep the base letter of accented characters.
+func makeAlphaNumForm(str string, form norm.Form, allowAdditional ...rune) string {
 	for match, replace := range specialReplacements {
 		str = strings.ReplaceAll(str, match, replace)
 	}
 
-	str = norm.NFKD.String(str)
+	str = form.String(str)
 	str = strings.Map(func(r rune) rune {
 		for _, allowed := range allowAdditional {
 			if r == allowed {
@@ -825,6 +3447,38 @@ func makeAlphaNum(str string, allowAdditional ...rune) string {
 	return str
 }
 
+// usernameMentionRegexp matches the mentions of usernames, including the
+// ones that aren't valid in Mattermost, so they can be normalized.
+var usernameMentionRegexp = regexp.MustCompile(`@([\p{L}\p{N}.\-_]+)`)
+
+// replaceMentionedUsernames replaces the mentions in the messages of the
+// posts and their replies, following replacements.
+func (t *Transformer) replaceMentionedUsernames(replacements map[string]string) {
+	for _, post := range t.Intermediate.Posts {
+		post.Message = replaceMentions(post.Message, replacements)
+		for _, reply := range post.Replies {
+			reply.Message = replaceMentions(reply.Message, replacements)
+		}
+	}
+}
+
+// replaceMentions replaces the mentions of the usernames of a message
+// that are in replacements, in a single pass so swapped usernames are
+// replaced correctly.
+func replaceMentions(message string, replacements map[string]string) string {
+	return usernameMentionRegexp.ReplaceAllStringFunc(message, func(mention string) string {
+		if replacement, ok := replacements[mention[1:]]; ok {
+			return "@" + replacement
+		}
+		// the mention may be followed by punctuation
+		username := strings.TrimRight(mention[1:], ".-_")
+		if replacement, ok := replacements[username]; ok {
+			return "@" + replacement + mention[1+len(username):]
+		}
+		return mention
+	})
+}
+
 var specialReplacements = map[string]string{
 	"ß": "ss",
 }
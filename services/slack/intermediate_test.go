@@ -1,17 +1,27 @@
 package slack
 
 import (
+	"archive/zip"
 	"bytes"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/v8/channels/app/imports"
 )
 
 func TestIntermediateChannelSanitise(t *testing.T) {
@@ -367,6 +377,317 @@ func TestTransformRegularGroupChannels(t *testing.T) {
 	}
 }
 
+func TestTransformMpimChannels(t *testing.T) {
+	zipReader := createZipReader(t, map[string]string{
+		"users.json": `[
+			{"id": "U1", "name": "alice", "profile": {"email": "alice@example.com"}},
+			{"id": "U2", "name": "bob", "profile": {"email": "bob@example.com"}},
+			{"id": "U3", "name": "carol", "profile": {"email": "carol@example.com"}}
+		]`,
+		"channels.json": `[
+			{"id": "C1", "name": "general", "members": ["U1", "U2", "U3"]},
+			{"id": "G1", "name": "mpdm-alice--bob--carol-1", "is_mpim": true, "members": ["U1", "U2", "U3"]}
+		]`,
+		"mpdm-alice--bob--carol-1/2020-01-01.json": `[{"user": "U1", "text": "hi both", "ts": "1577836800.000000", "type": "message"}]`,
+	})
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackExport, err := slackTransformer.ParseSlackExportFile(zipReader, true)
+	require.NoError(t, err)
+	require.Len(t, slackExport.PublicChannels, 2)
+	assert.Equal(t, model.ChannelTypeGroup, slackExport.PublicChannels[1].Type)
+
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	require.Len(t, slackTransformer.Intermediate.PublicChannels, 1)
+	assert.Equal(t, "general", slackTransformer.Intermediate.PublicChannels[0].Name)
+	require.Len(t, slackTransformer.Intermediate.GroupChannels, 1)
+	groupChannel := slackTransformer.Intermediate.GroupChannels[0]
+	assert.Equal(t, model.ChannelTypeGroup, groupChannel.Type)
+	assert.ElementsMatch(t, []string{"alice", "bob", "carol"}, groupChannel.MembersUsernames)
+
+	require.Len(t, slackTransformer.Intermediate.Posts, 1)
+	post := slackTransformer.Intermediate.Posts[0]
+	assert.True(t, post.IsDirect)
+	assert.ElementsMatch(t, []string{"alice", "bob", "carol"}, post.ChannelMembers)
+}
+
+func TestTransformLinkCanvases(t *testing.T) {
+	slackExport := func(workspace *SlackWorkspace) *SlackExport {
+		return &SlackExport{
+			Workspace: workspace,
+			Users: []SlackUser{
+				{Id: "U1", Username: "user1", Profile: SlackProfile{Email: "user1@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{
+					Id: "C1", Name: "general", Members: []string{"U1"}, Type: model.ChannelTypeOpen,
+					Topic: SlackChannelSub{Value: "Work matters"},
+					Properties: &SlackChannelProperties{
+						Canvas: &SlackChannelCanvas{FileId: "F1"},
+						Tabs: []SlackChannelTab{
+							{Type: "canvas", Label: "Channel canvas", Data: SlackChannelTabData{FileId: "F1"}},
+							{Type: "list", Label: "Tasks", Data: SlackChannelTabData{FileId: "F2"}},
+							{Type: "files"},
+						},
+					},
+				},
+				{
+					Id: "C2", Name: "random", Members: []string{"U1"}, Type: model.ChannelTypeOpen,
+					Properties: &SlackChannelProperties{Canvas: &SlackChannelCanvas{FileId: "F3", IsEmpty: true}},
+				},
+			},
+		}
+	}
+
+	headers := func(t *testing.T, workspace *SlackWorkspace, linkCanvases bool) []string {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.LinkCanvases = linkCanvases
+		require.NoError(t, slackTransformer.Transform(slackExport(workspace), "", true, false, false, false, ""))
+
+		result := []string{}
+		for _, channel := range slackTransformer.Intermediate.PublicChannels {
+			result = append(result, channel.Header)
+		}
+		return result
+	}
+
+	t.Run("canvases aren't linked by default", func(t *testing.T) {
+		assert.Equal(t, []string{"Work matters", ""}, headers(t, nil, false))
+	})
+
+	t.Run("canvases and lists are linked from the header", func(t *testing.T) {
+		workspace := &SlackWorkspace{Id: "T1", Name: "Acme", Domain: "acme"}
+		assert.Equal(t, []string{
+			"Work matters | Slack canvas: [Channel canvas](https://acme.slack.com/docs/T1/F1) | Slack list: [Tasks](https://acme.slack.com/docs/T1/F2)",
+			"",
+		}, headers(t, workspace, true))
+	})
+
+	t.Run("the file ids are noted without the workspace", func(t *testing.T) {
+		assert.Equal(t, []string{
+			"Work matters | Slack canvas: Channel canvas (F1) | Slack list: Tasks (F2)",
+			"",
+		}, headers(t, nil, true))
+	})
+}
+
+func TestTransformChannelsMinMembers(t *testing.T) {
+	channels := []SlackChannel{
+		{Id: "G1", Name: "two-members", Members: []string{"m1", "m2"}, Type: model.ChannelTypeGroup},
+		{Id: "G2", Name: "three-members", Members: []string{"m1", "m2", "m3"}, Type: model.ChannelTypeGroup},
+		{Id: "G3", Name: "one-valid-member", Members: []string{"m1", "missing", "other"}, Type: model.ChannelTypeGroup},
+		{Id: "C1", Name: "public", Members: []string{"m1"}, Type: model.ChannelTypeOpen},
+	}
+
+	for name, tc := range map[string]struct {
+		minMembers    int
+		expectedNames []string
+	}{
+		"channels with a single member are skipped by default": {
+			expectedNames: []string{"two-members", "three-members", "public"},
+		},
+		"small group channels are skipped": {
+			minMembers:    3,
+			expectedNames: []string{"three-members", "public"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {}, "m2": {}, "m3": {}}
+			slackTransformer.Options.MinMembers = tc.minMembers
+
+			names := []string{}
+			for _, channel := range slackTransformer.TransformChannels(channels) {
+				names = append(names, channel.Name)
+			}
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+}
+
+func TestTransformChannelTypes(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"m1": {Id: "m1", Username: "user1"},
+		"m2": {Id: "m2", Username: "user2"},
+	}
+	slackTransformer.Options.ChannelTypes = map[string]model.ChannelType{
+		"secret":  model.ChannelTypePrivate,
+		"open":    model.ChannelTypeOpen,
+		"general": model.ChannelTypeOpen,
+		"missing": model.ChannelTypePrivate,
+	}
+
+	slackExport := &SlackExport{
+		PublicChannels: []SlackChannel{
+			{Id: "C1", Name: "general", Members: []string{"m1", "m2"}, Type: model.ChannelTypeOpen},
+			{Id: "C2", Name: "secret", Members: []string{"m1"}, Type: model.ChannelTypeOpen},
+		},
+		PrivateChannels: []SlackChannel{
+			{Id: "P1", Name: "open", Members: []string{"m2"}, Type: model.ChannelTypePrivate},
+			{Id: "P2", Name: "private", Members: []string{"m1", "m2"}, Type: model.ChannelTypePrivate},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformAllChannels(slackExport))
+
+	names := func(channels []*IntermediateChannel) []string {
+		result := []string{}
+		for _, channel := range channels {
+			result = append(result, channel.Name)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"general", "open"}, names(slackTransformer.Intermediate.PublicChannels))
+	assert.Equal(t, []string{"secret", "private"}, names(slackTransformer.Intermediate.PrivateChannels))
+	for _, channel := range slackTransformer.Intermediate.PrivateChannels {
+		assert.Equal(t, model.ChannelTypePrivate, channel.Type)
+	}
+
+	slackTransformer.PopulateUserMemberships()
+	assert.Equal(t, []string{"general", "secret", "private"}, slackTransformer.Intermediate.UsersById["m1"].Memberships)
+	assert.Equal(t, []string{"general", "open", "private"}, slackTransformer.Intermediate.UsersById["m2"].Memberships)
+}
+
+func TestTransformChannelsWithoutName(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	channels := slackTransformer.TransformChannels([]SlackChannel{
+		{Id: "C1", Purpose: SlackChannelSub{Value: "Planning the Q3 product launch & marketing campaign for Europe"}, Type: model.ChannelTypeOpen},
+		{Id: "C2", Topic: SlackChannelSub{Value: "Café talk"}, Type: model.ChannelTypePrivate},
+		{Id: "C3", Name: "cafe-talk", Type: model.ChannelTypeOpen},
+		{Id: "C4", Purpose: SlackChannelSub{Value: "!!!"}, Type: model.ChannelTypeOpen},
+	})
+
+	require.Len(t, channels, 4)
+	assert.Equal(t, "planning-the-q3-product-launch-marketing", channels[0].Name)
+	assert.Equal(t, "planning-the-q3-product-launch-marketing", channels[0].DisplayName)
+	assert.Equal(t, "C1", channels[0].OriginalName)
+	// the name of another channel is not reused
+	assert.Equal(t, "cafe-talk-c2", channels[1].Name)
+	assert.Equal(t, "C2", channels[1].OriginalName)
+	assert.Equal(t, "cafe-talk", channels[2].Name)
+	// the id is used when the purpose has no usable words
+	assert.Equal(t, "c4", channels[3].Name)
+}
+
+func TestTransformChannelPurposePrefixSuffix(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.ChannelPurposePrefix = "[Imported from Slack]"
+	slackTransformer.Options.ChannelPurposeSuffix = "(archived)"
+
+	channels := slackTransformer.TransformChannels([]SlackChannel{
+		{Id: "C1", Name: "general", Purpose: SlackChannelSub{Value: "Company wide news"}, Type: model.ChannelTypeOpen},
+		{Id: "C2", Name: "empty", Type: model.ChannelTypePrivate},
+		{Id: "C3", Name: "long", Purpose: SlackChannelSub{Value: strings.Repeat("á", 300)}, Type: model.ChannelTypeOpen},
+	})
+
+	require.Len(t, channels, 3)
+	assert.Equal(t, "[Imported from Slack] Company wide news (archived)", channels[0].Purpose)
+	assert.Equal(t, "[Imported from Slack] (archived)", channels[1].Purpose)
+
+	// the purpose is truncated, keeping the prefix and suffix whole
+	purpose := channels[2].Purpose
+	assert.Equal(t, model.ChannelPurposeMaxRunes, utf8.RuneCountInString(purpose))
+	assert.True(t, strings.HasPrefix(purpose, "[Imported from Slack] ááá"))
+	assert.True(t, strings.HasSuffix(purpose, "ááá (archived)"))
+	assert.Equal(t, 1, slackTransformer.WarningCount(WarningCategoryTruncation))
+}
+
+func TestTransformChannelSharedTeamIds(t *testing.T) {
+	zipReader := createZipReader(t, map[string]string{
+		"channels.json": `[
+			{"id": "C1", "name": "shared", "purpose": {"value": "Cross-team news"}, "shared_team_ids": ["T2", "T1"]},
+			{"id": "C2", "name": "local", "purpose": {"value": "Just us"}, "shared_team_ids": ["T1"]}
+		]`,
+		"users.json": `[]`,
+	})
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackExport, err := slackTransformer.ParseSlackExportFile(zipReader, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"T2", "T1"}, slackExport.PublicChannels[0].SharedTeamIds)
+
+	channels := slackTransformer.TransformChannels(slackExport.PublicChannels)
+	require.Len(t, channels, 2)
+	assert.Equal(t, []string{"T1", "T2"}, channels[0].SharedTeamIds)
+	assert.Equal(t, "Cross-team news (Shared across the Slack workspaces T1, T2)", channels[0].Purpose)
+
+	// channels of a single workspace aren't tagged
+	assert.Nil(t, channels[1].SharedTeamIds)
+	assert.Equal(t, "Just us", channels[1].Purpose)
+}
+
+func TestTransformUTF8Normalization(t *testing.T) {
+	// a decomposed accented letter, a ligature and fullwidth letters
+	decomposed := &SlackFile{Id: "F1", Name: "cafe\u0301.txt"}
+	ligature := &SlackFile{Id: "F2", Name: "\ufb01le.txt"}
+	channels := []SlackChannel{
+		{Id: "C1", Name: "\uff47\uff45\uff4e\uff45\uff52\uff41\uff4c", Type: model.ChannelTypeOpen},
+		{Id: "C2", Purpose: SlackChannelSub{Value: "Caf\u00e9 \ufb01nance"}, Type: model.ChannelTypeOpen},
+	}
+
+	testCases := []struct {
+		form             string
+		expectedFiles    []string
+		expectedChannels []string
+	}{
+		{"", []string{"F1_cafe.txt", "F2_file.txt"}, []string{"c1", "cafe-finance"}},
+		{"nfc", []string{"F1_caf.txt", "F2_le.txt"}, []string{"c1", "caf-nance"}},
+		{"nfd", []string{"F1_cafe.txt", "F2_le.txt"}, []string{"c1", "cafe-nance"}},
+		{"nfkc", []string{"F1_caf.txt", "F2_file.txt"}, []string{"general", "caf-finance"}},
+		{"nfkd", []string{"F1_cafe.txt", "F2_file.txt"}, []string{"general", "cafe-finance"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run("form "+tc.form, func(t *testing.T) {
+			assert.Equal(t, tc.expectedFiles, []string{
+				getNormalisedFilePath(decomposed, "", tc.form),
+				getNormalisedFilePath(ligature, "", tc.form),
+			})
+
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.UTF8Normalization = tc.form
+			result := slackTransformer.TransformChannels(channels)
+			require.Len(t, result, 2)
+			assert.Equal(t, tc.expectedChannels, []string{result[0].Name, result[1].Name})
+		})
+	}
+}
+
+func TestTransformChannelHeaderFromPurpose(t *testing.T) {
+	channels := []SlackChannel{
+		{Id: "C1", Name: "no-topic", Purpose: SlackChannelSub{Value: "What this channel is about"}, Type: model.ChannelTypeOpen},
+		{Id: "C2", Name: "with-topic", Purpose: SlackChannelSub{Value: "The purpose"}, Topic: SlackChannelSub{Value: "The topic"}, Type: model.ChannelTypePrivate},
+		{Id: "C3", Name: "long-purpose", Purpose: SlackChannelSub{Value: strings.Repeat("a", 300)}, Type: model.ChannelTypeOpen},
+		{Id: "C4", Name: "empty", Type: model.ChannelTypeOpen},
+	}
+
+	for name, tc := range map[string]struct {
+		headerFromPurpose bool
+		expected          []string
+	}{
+		"the headers are the topics by default": {
+			expected: []string{"", "The topic", "", ""},
+		},
+		"the empty headers are filled from the purposes": {
+			headerFromPurpose: true,
+			expected:          []string{"What this channel is about", "The topic", strings.Repeat("a", model.ChannelPurposeMaxRunes), ""},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.ChannelHeaderFromPurpose = tc.headerFromPurpose
+
+			headers := []string{}
+			for _, channel := range slackTransformer.TransformChannels(channels) {
+				headers = append(headers, channel.Header)
+			}
+			assert.Equal(t, tc.expected, headers)
+		})
+	}
+}
+
 func TestTransformDirectChannels(t *testing.T) {
 	slackTransformer := NewTransformer("test", log.New())
 	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {}, "m2": {}, "m3": {}}
@@ -668,6 +989,170 @@ func TestDeleteAt(t *testing.T) {
 	require.NotZero(t, slackTransformer.Intermediate.UsersById[inactiveUsers[1].Id].DeleteAt)
 }
 
+func TestTransformUsersEmailsFile(t *testing.T) {
+	exitCode := -1
+	exitFunc = func(code int) {
+		exitCode = code
+	}
+	defer func() {
+		exitFunc = os.Exit
+	}()
+
+	users := []SlackUser{
+		{Id: "U1", Username: "by-id"},
+		{Id: "U2", Username: "by-username"},
+		{Id: "U3", Username: "with-email", Profile: SlackProfile{Email: "original@example.com"}},
+	}
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.UserEmails = map[string]string{
+		"U1":          "id@example.com",
+		"by-username": "username@example.com",
+		"with-email":  "ignored@example.com",
+	}
+	slackTransformer.TransformUsers(users, false, "")
+
+	require.Equal(t, -1, exitCode)
+	assert.Equal(t, "id@example.com", slackTransformer.Intermediate.UsersById["U1"].Email)
+	assert.Equal(t, "username@example.com", slackTransformer.Intermediate.UsersById["U2"].Email)
+	assert.Equal(t, "original@example.com", slackTransformer.Intermediate.UsersById["U3"].Email)
+}
+
+func TestTransformFederatedUsers(t *testing.T) {
+	exitCode := -1
+	exitFunc = func(code int) {
+		exitCode = code
+	}
+	defer func() {
+		exitFunc = os.Exit
+	}()
+
+	users := []SlackUser{
+		{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+		{Id: "W2", TeamId: "T9", Profile: SlackProfile{DisplayName: "Bob Partner"}},
+		// the display name of the federated user matches an existing user
+		{Id: "W3", TeamId: "T9", Profile: SlackProfile{DisplayName: "Alice"}},
+		{Id: "W4", TeamId: "T9"},
+	}
+
+	for name, tc := range map[string]struct {
+		defaultEmailDomain string
+		expectedEmails     map[string]string
+	}{
+		"without a default email domain": {
+			expectedEmails: map[string]string{"W2": "W2@external", "W3": "W3@external", "W4": "W4@external"},
+		},
+		"with a default email domain": {
+			defaultEmailDomain: "partner.example.com",
+			expectedEmails:     map[string]string{"W2": "bob_partner@partner.example.com", "W3": "alice-w3@partner.example.com", "W4": "w4@partner.example.com"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.TransformUsers(users, false, tc.defaultEmailDomain)
+			require.Equal(t, -1, exitCode)
+
+			usersById := slackTransformer.Intermediate.UsersById
+			require.Len(t, usersById, 4)
+			assert.Equal(t, "bob_partner", usersById["W2"].Username)
+			assert.Equal(t, "Bob Partner", usersById["W2"].FirstName)
+			assert.Equal(t, "alice-w3", usersById["W3"].Username)
+			assert.Equal(t, "w4", usersById["W4"].Username)
+
+			for id, email := range tc.expectedEmails {
+				assert.Equal(t, email, usersById[id].Email)
+				line := GetImportLineFromUser(usersById[id], "test")
+				assert.Nil(t, imports.ValidateUserImportData(line.User), id)
+			}
+		})
+	}
+}
+
+func TestTransformSkipUsersWithoutEmail(t *testing.T) {
+	exitCode := -1
+	exitFunc = func(code int) {
+		exitCode = code
+	}
+	defer func() {
+		exitFunc = os.Exit
+	}()
+
+	slackExport := &SlackExport{
+		Users: []SlackUser{
+			{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+			{Id: "U2", Username: "bob"},
+			{Id: "U3", Username: "carol", Profile: SlackProfile{Email: "carol@example.com"}},
+		},
+		PublicChannels: []SlackChannel{
+			{Id: "C1", Name: "general", Members: []string{"U1", "U2", "U3"}, Type: model.ChannelTypeOpen},
+		},
+		Posts: map[string][]SlackPost{
+			"general": {
+				{User: "U1", Text: "hello", TimeStamp: "1695219800.000000", Type: "message"},
+				{User: "U2", Text: "hi", TimeStamp: "1695219810.000000", Type: "message"},
+			},
+		},
+	}
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.SkipUsersWithoutEmail = true
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	require.Equal(t, -1, exitCode)
+	require.Contains(t, slackTransformer.Intermediate.UsersById, "U1")
+	require.Contains(t, slackTransformer.Intermediate.UsersById, "U3")
+	assert.Equal(t, []string{"U1", "U3"}, slackTransformer.Intermediate.PublicChannels[0].Members)
+
+	// the posts of the skipped user are kept with a placeholder
+	require.Len(t, slackTransformer.Intermediate.Posts, 2)
+	assert.Equal(t, "u2", slackTransformer.Intermediate.Posts[1].User)
+	assert.Equal(t, "U2@local", slackTransformer.Intermediate.UsersById["U2"].Email)
+
+	assert.Contains(t, slackTransformer.SanitizeChanges(), SanitizeChange{Entity: SanitizeEntityUser, Id: "U2", Field: "user", Original: "bob"})
+}
+
+func TestTransformChannelOnlyById(t *testing.T) {
+	slackExport := &SlackExport{
+		Users: []SlackUser{
+			{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+			{Id: "U2", Username: "bob", Profile: SlackProfile{Email: "bob@example.com"}},
+		},
+		PublicChannels: []SlackChannel{
+			{Id: "C1", Name: "general", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+			{Id: "C2", Name: "random", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+		},
+		PrivateChannels: []SlackChannel{
+			{Id: "G1", Name: "secret", Members: []string{"U1", "U2"}, Type: model.ChannelTypePrivate},
+		},
+		DirectChannels: []SlackChannel{
+			{Id: "D1", Members: []string{"U1", "U2"}, Type: model.ChannelTypeDirect},
+		},
+		Posts: map[string][]SlackPost{
+			"general": {{User: "U1", Text: "in general", TimeStamp: "1695219800.000000", Type: "message"}},
+			"random":  {{User: "U2", Text: "in random", TimeStamp: "1695219810.000000", Type: "message"}},
+			"secret":  {{User: "U1", Text: "in secret", TimeStamp: "1695219820.000000", Type: "message"}},
+			"D1":      {{User: "U2", Text: "in a DM", TimeStamp: "1695219830.000000", Type: "message"}},
+		},
+	}
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.ChannelOnlyById = []string{"C2", "D1", "C404"}
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	require.Len(t, slackTransformer.Intermediate.PublicChannels, 1)
+	assert.Equal(t, "C2", slackTransformer.Intermediate.PublicChannels[0].Id)
+	assert.Empty(t, slackTransformer.Intermediate.PrivateChannels)
+	require.Len(t, slackTransformer.Intermediate.DirectChannels, 1)
+	assert.Equal(t, "D1", slackTransformer.Intermediate.DirectChannels[0].Id)
+
+	messages := []string{}
+	for _, post := range slackTransformer.Intermediate.Posts {
+		messages = append(messages, post.Message)
+	}
+	assert.ElementsMatch(t, []string{"in random", "in a DM"}, messages)
+	assert.Equal(t, []string{"random"}, slackTransformer.Intermediate.UsersById["U1"].Memberships)
+}
+
 func TestPopulateUserMemberships(t *testing.T) {
 	slackTransformer := NewTransformer("test", log.New())
 
@@ -698,6 +1183,66 @@ func TestPopulateUserMemberships(t *testing.T) {
 	assert.Equal(t, []string{"c1", "c3"}, slackTransformer.Intermediate.UsersById["id3"].Memberships)
 }
 
+func TestTransformChannelMembersFromPosts(t *testing.T) {
+	slackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+				{Id: "U2", Username: "bob", Profile: SlackProfile{Email: "bob@example.com"}},
+				{Id: "U3", Username: "carol", Profile: SlackProfile{Email: "carol@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			},
+			PrivateChannels: []SlackChannel{
+				{Id: "G1", Name: "secret", Members: []string{"U1"}, Type: model.ChannelTypePrivate},
+			},
+			Posts: map[string][]SlackPost{
+				"general": {
+					{User: "U1", Text: "hello", TimeStamp: "1695219800.000000", Type: "message"},
+					{User: "U2", Text: "hi", TimeStamp: "1695219810.000000", Type: "message"},
+					{User: "U2", Text: "again", TimeStamp: "1695219815.000000", Type: "message"},
+					// users that only left the channel aren't added back
+					{User: "U3", Text: "<@U3> has left the channel", TimeStamp: "1695219820.000000", Type: "message", SubType: "channel_leave"},
+					// unknown users aren't members
+					{User: "U4", Text: "who am I", TimeStamp: "1695219830.000000", Type: "message"},
+				},
+				"secret": {
+					{User: "U3", Text: "psst", TimeStamp: "1695219840.000000", Type: "message", ThreadTS: "1695219840.000000"},
+				},
+			},
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		membersFromPosts   bool
+		expectedGeneral    []string
+		expectedSecret     []string
+		expectedBobChannel []string
+	}{
+		"without the flag the member lists are kept": {
+			expectedGeneral: []string{"U1"},
+			expectedSecret:  []string{"U1"},
+		},
+		"with the flag the posters become members": {
+			membersFromPosts:   true,
+			expectedGeneral:    []string{"U1", "U2"},
+			expectedSecret:     []string{"U1", "U3"},
+			expectedBobChannel: []string{"general"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.ChannelMembersFromPosts = tc.membersFromPosts
+			require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+			assert.Equal(t, tc.expectedGeneral, slackTransformer.Intermediate.PublicChannels[0].Members)
+			assert.Equal(t, tc.expectedSecret, slackTransformer.Intermediate.PrivateChannels[0].Members)
+			assert.ElementsMatch(t, tc.expectedBobChannel, slackTransformer.Intermediate.UsersById["U2"].Memberships)
+		})
+	}
+}
+
 func TestPopulateChannelMemberships(t *testing.T) {
 	slackTransformer := NewTransformer("test", log.New())
 
@@ -729,6 +1274,36 @@ func TestPopulateChannelMemberships(t *testing.T) {
 	assert.Equal(t, []string{"u1", "u3"}, c1.MembersUsernames)
 	assert.Equal(t, []string{"u1", "u2"}, c2.MembersUsernames)
 	assert.Equal(t, []string{"u3"}, c3.MembersUsernames)
+
+	t.Run("Usernames should be sorted regardless of the members order", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+
+		group := IntermediateChannel{
+			Name:    "group",
+			Members: []string{"id3", "id1", "id2"},
+		}
+		direct := IntermediateChannel{
+			Name:    "direct",
+			Members: []string{"id2", "id1"},
+		}
+
+		slackTransformer.Intermediate = &Intermediate{
+			UsersById: map[string]*IntermediateUser{
+				"id1": {Username: "charlie"},
+				"id2": {Username: "alice"},
+				"id3": {Username: "bob"},
+			},
+			GroupChannels:  []*IntermediateChannel{&group},
+			DirectChannels: []*IntermediateChannel{&direct},
+		}
+
+		for i := 0; i < 3; i++ {
+			slackTransformer.PopulateChannelMemberships()
+
+			assert.Equal(t, []string{"alice", "bob", "charlie"}, group.MembersUsernames)
+			assert.Equal(t, []string{"alice", "charlie"}, direct.MembersUsernames)
+		}
+	})
 }
 
 func TestAddPostToThreads(t *testing.T) {
@@ -843,4 +1418,3207 @@ func TestTransformPosts(t *testing.T) {
 		}
 
 	})
+
+	roomlessHuddleExport := func(user string) *SlackExport {
+		return &SlackExport{
+			Posts: map[string][]SlackPost{
+				"channel1": {
+					{
+						User:      user,
+						TimeStamp: "1695219818.000100",
+						SubType:   "huddle_thread",
+						Type:      "message",
+					},
+				},
+			},
+		}
+	}
+
+	newHuddleTransformer := func() *Transformer {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}}
+		slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+		return slackTransformer
+	}
+
+	t.Run("huddle threads without room are imported at the time of the post", func(t *testing.T) {
+		slackTransformer := newHuddleTransformer()
+		require.NoError(t, slackTransformer.TransformPosts(roomlessHuddleExport("m1"), "", false, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+		post := slackTransformer.Intermediate.Posts[0]
+		require.Equal(t, "m1", post.User)
+		require.Equal(t, "custom_calls", post.Type)
+		require.EqualValues(t, 1695219818000, post.Props["start_at"])
+		require.EqualValues(t, 1695219818000, post.Props["end_at"])
+	})
+
+	t.Run("huddle threads without room nor user are attributed to Slackbot", func(t *testing.T) {
+		slackTransformer := newHuddleTransformer()
+		require.NoError(t, slackTransformer.TransformPosts(roomlessHuddleExport(""), "", false, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+		post := slackTransformer.Intermediate.Posts[0]
+		require.Equal(t, slackTransformer.Intermediate.UsersById["USLACKBOT"].Username, post.User)
+		require.NotEqual(t, "m1", post.User)
+		require.EqualValues(t, 1695219818000, post.Props["start_at"])
+	})
+
+	t.Run("huddle threads without room are skipped if configured", func(t *testing.T) {
+		slackTransformer := newHuddleTransformer()
+		slackTransformer.Options.HuddleWithoutRoom = HuddleWithoutRoomSkip
+		require.NoError(t, slackTransformer.TransformPosts(roomlessHuddleExport("m1"), "", false, false, false))
+		require.Empty(t, slackTransformer.Intermediate.Posts)
+	})
+
+	reactionsExport := func() *SlackExport {
+		return &SlackExport{
+			Posts: map[string][]SlackPost{
+				"channel1": {
+					{
+						User:      "m1",
+						Text:      "reacted message",
+						TimeStamp: "1695219818.000100",
+						Type:      "message",
+						Reactions: []*SlackReaction{
+							{Name: "+1", Users: []string{"m1", "m2"}, Count: 2},
+							{Name: "tada", Users: []string{"m2"}, Count: 1},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	newReactionsTransformer := func() *Transformer {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}, "m2": {Username: "m2"}}
+		slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+			{
+				Name:         "channel1",
+				OriginalName: "channel1",
+			},
+		}
+		return slackTransformer
+	}
+
+	t.Run("reactions share the post timestamp by default", func(t *testing.T) {
+		slackTransformer := newReactionsTransformer()
+
+		require.NoError(t, slackTransformer.TransformPosts(reactionsExport(), "", false, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+		post := slackTransformer.Intermediate.Posts[0]
+		require.Len(t, post.Reactions, 3)
+		assert.Equal(t, &IntermediateReaction{User: "m1", EmojiName: "+1", CreateAt: 1695219818000}, post.Reactions[0])
+		assert.Equal(t, &IntermediateReaction{User: "m2", EmojiName: "+1", CreateAt: 1695219818000}, post.Reactions[1])
+		assert.Equal(t, &IntermediateReaction{User: "m2", EmojiName: "tada", CreateAt: 1695219818000}, post.Reactions[2])
+	})
+
+	t.Run("duplicated reactions are only added once", func(t *testing.T) {
+		slackTransformer := newReactionsTransformer()
+
+		slackExport := reactionsExport()
+		slackExport.Posts["channel1"][0].Reactions = []*SlackReaction{
+			{Name: "+1", Users: []string{"m1", "m1"}, Count: 2},
+			{Name: "+1", Users: []string{"m1", "m2"}, Count: 2},
+			{Name: "tada", Users: []string{"m1"}, Count: 1},
+		}
+
+		require.NoError(t, slackTransformer.TransformPosts(slackExport, "", false, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+		reactions := []string{}
+		for _, reaction := range slackTransformer.Intermediate.Posts[0].Reactions {
+			reactions = append(reactions, reaction.User+":"+reaction.EmojiName)
+		}
+		assert.Equal(t, []string{"m1:+1", "m2:+1", "m1:tada"}, reactions)
+	})
+
+	t.Run("reactions get unique timestamps after the post when spread", func(t *testing.T) {
+		slackTransformer := newReactionsTransformer()
+		slackTransformer.Options.SpreadReactionTimestamps = true
+
+		require.NoError(t, slackTransformer.TransformPosts(reactionsExport(), "", false, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+		post := slackTransformer.Intermediate.Posts[0]
+		require.Len(t, post.Reactions, 3)
+		seen := map[int64]bool{}
+		for _, reaction := range post.Reactions {
+			assert.Greater(t, reaction.CreateAt, post.CreateAt)
+			assert.False(t, seen[reaction.CreateAt], "duplicated reaction timestamp %d", reaction.CreateAt)
+			seen[reaction.CreateAt] = true
+		}
+	})
+}
+
+func TestTransformSharedDirectChannel(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Id: "m1", Username: "m1"}}
+
+	directChannels := []SlackChannel{
+		{
+			Id:      "id1",
+			Members: []string{"m1", "EXT1"},
+			Type:    model.ChannelTypeDirect,
+		},
+	}
+
+	result := slackTransformer.TransformChannels(directChannels)
+	require.Len(t, result, 1)
+	assert.Equal(t, []string{"m1", "EXT1"}, result[0].Members)
+
+	external, ok := slackTransformer.Intermediate.UsersById["EXT1"]
+	require.True(t, ok)
+	assert.Equal(t, "ext1", external.Username)
+	assert.Equal(t, "EXT1@external", external.Email)
+}
+
+func TestTransformPostsFileShareReplies(t *testing.T) {
+	zipReader := createZipReader(t, map[string]string{"__uploads/F1/report.txt": "file contents"})
+
+	attachmentsDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(attachmentsDir, attachmentsInternal), 0755))
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}, "m2": {Username: "m2"}}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+		{
+			Name:         "channel1",
+			OriginalName: "channel1",
+		},
+	}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				// the reply is listed first and shares the root's millisecond
+				{
+					User:      "m2",
+					Text:      "here is the report",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219818.000200",
+					Type:      "message",
+					SubType:   "file_share",
+					Files:     []*SlackFile{{Id: "F1", Name: "report.txt"}},
+				},
+				{
+					User:      "m1",
+					Text:      "can someone share the report?",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219818.000100",
+					Type:      "message",
+				},
+			},
+		},
+		Uploads: map[string]*zip.File{"F1": zipReader.File[0]},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, attachmentsDir, false, false, false))
+	require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+	root := slackTransformer.Intermediate.Posts[0]
+	assert.Equal(t, "can someone share the report?", root.Message)
+	assert.Empty(t, root.Attachments)
+	require.Len(t, root.Replies, 1)
+	assert.Equal(t, "here is the report", root.Replies[0].Message)
+	assert.Equal(t, []string{"bulk-export-attachments/F1_report.txt"}, root.Replies[0].Attachments)
+}
+
+func TestTransformPostsFileTitles(t *testing.T) {
+	zipReader := createZipReader(t, map[string]string{
+		"__uploads/F1/q3-report.pdf": "report",
+		"__uploads/F2/photo.png":     "photo",
+	})
+	uploads := map[string]*zip.File{}
+	for _, file := range zipReader.File {
+		uploads[strings.Split(file.Name, "/")[1]] = file
+	}
+
+	attachmentsDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(attachmentsDir, attachmentsInternal), 0755))
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{User: "m1", Text: "the report", TimeStamp: "1695219818.000100", Type: "message", SubType: "file_share",
+					Files: []*SlackFile{{Id: "F1", Name: "q3-report.pdf", Title: "Q3 financial report"}}},
+				// the default title is the file name without the extension
+				{User: "m1", TimeStamp: "1695219819.000100", Type: "message", SubType: "file_share",
+					Files: []*SlackFile{{Id: "F2", Name: "photo.png", Title: "photo"}}},
+			},
+		},
+		Uploads: uploads,
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, attachmentsDir, false, false, false))
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 2)
+	assert.Equal(t, "the report\n*Q3 financial report*", posts[0].Message)
+	assert.Equal(t, []string{"bulk-export-attachments/F1_q3-report.pdf"}, posts[0].Attachments)
+	assert.Empty(t, posts[1].Message)
+	assert.Equal(t, []string{"bulk-export-attachments/F2_photo.png"}, posts[1].Attachments)
+}
+
+func TestTransformPostsFileCaption(t *testing.T) {
+	testCases := []struct {
+		caption  string
+		expected []string
+	}{
+		{caption: FileCaptionNone, expected: []string{"*Q3 financial report*", "", "the report\n*Q3 financial report*"}},
+		{caption: FileCaptionFilename, expected: []string{"q3-report.pdf\n*Q3 financial report*", "photo.png\nnotes.txt", "the report\n*Q3 financial report*"}},
+		{caption: FileCaptionTitle, expected: []string{"Q3 financial report", "photo\nnotes.txt", "the report\n*Q3 financial report*"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caption, func(t *testing.T) {
+			zipReader := createZipReader(t, map[string]string{
+				"__uploads/F1/q3-report.pdf": "report",
+				"__uploads/F2/photo.png":     "photo",
+				"__uploads/F3/notes.txt":     "notes",
+			})
+			uploads := map[string]*zip.File{}
+			for _, file := range zipReader.File {
+				uploads[strings.Split(file.Name, "/")[1]] = file
+			}
+
+			attachmentsDir := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(attachmentsDir, attachmentsInternal), 0755))
+
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.FileCaption = tc.caption
+			slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}}
+			slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+			report := &SlackFile{Id: "F1", Name: "q3-report.pdf", Title: "Q3 financial report"}
+			slackExport := &SlackExport{
+				Posts: map[string][]SlackPost{
+					"channel1": {
+						{User: "m1", TimeStamp: "1695219818.000100", Type: "message", SubType: "file_share", Files: []*SlackFile{report}},
+						// a caption line for each file, using the name of the files without a title
+						{User: "m1", TimeStamp: "1695219819.000100", Type: "message", SubType: "file_share",
+							Files: []*SlackFile{{Id: "F2", Name: "photo.png", Title: "photo"}, {Id: "F3", Name: "notes.txt"}}},
+						// file shares with a message don't get a caption
+						{User: "m1", Text: "the report", TimeStamp: "1695219820.000100", Type: "message", SubType: "file_share", Files: []*SlackFile{report}},
+					},
+				},
+				Uploads: uploads,
+			}
+
+			require.NoError(t, slackTransformer.TransformPosts(slackExport, attachmentsDir, false, false, false))
+
+			messages := []string{}
+			for _, post := range slackTransformer.Intermediate.Posts {
+				messages = append(messages, post.Message)
+				assert.NotEmpty(t, post.Attachments)
+			}
+			assert.Equal(t, tc.expected, messages)
+		})
+	}
+
+	// captions are cut to the maximum message length
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.FileCaption = FileCaptionTitle
+	slackTransformer.Options.MaxMessageLength = MinMessageLength
+	caption := slackTransformer.fileCaption(&SlackPost{File: &SlackFile{Id: "F1", Name: "long.txt", Title: strings.Repeat("t", 300)}})
+	assert.Equal(t, MinMessageLength, utf8.RuneCountInString(caption))
+}
+
+func TestTransformEmptyChannels(t *testing.T) {
+	slackExport := &SlackExport{
+		Users: []SlackUser{
+			{Id: "U1", Username: "user1", Profile: SlackProfile{Email: "user1@example.com"}},
+		},
+		PublicChannels: []SlackChannel{
+			{Id: "C1", Name: "empty", Type: model.ChannelTypeOpen},
+			{Id: "C2", Name: "quiet", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			{Id: "C3", Name: "abandoned", Members: []string{"UMISSING"}, Type: model.ChannelTypeOpen},
+		},
+		PrivateChannels: []SlackChannel{
+			{Id: "G1", Name: "private-empty", Type: model.ChannelTypePrivate},
+		},
+		Posts: map[string][]SlackPost{
+			"abandoned": {
+				{User: "U1", Text: "anyone here?", TimeStamp: "1695219818.000100", Type: "message"},
+			},
+		},
+	}
+
+	channelNames := func(channels []*IntermediateChannel) []string {
+		names := []string{}
+		for _, channel := range channels {
+			names = append(names, channel.Name)
+		}
+		return names
+	}
+
+	t.Run("empty channels are kept by default", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+		assert.ElementsMatch(t, []string{"empty", "quiet", "abandoned"}, channelNames(slackTransformer.Intermediate.PublicChannels))
+		assert.ElementsMatch(t, []string{"private-empty"}, channelNames(slackTransformer.Intermediate.PrivateChannels))
+	})
+
+	t.Run("empty channels are discarded", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.DiscardEmptyChannels = true
+		require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+		assert.ElementsMatch(t, []string{"quiet", "abandoned"}, channelNames(slackTransformer.Intermediate.PublicChannels))
+		assert.Empty(t, slackTransformer.Intermediate.PrivateChannels)
+	})
+}
+
+func TestTransformSkipStaleChannels(t *testing.T) {
+	slackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "user1", Profile: SlackProfile{Email: "user1@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "stale", Creator: "U1", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+				{Id: "C2", Name: "recent", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+				{Id: "C3", Name: "recent-thread", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			},
+			Posts: map[string][]SlackPost{
+				// 2020-01-01
+				"stale": {{User: "U1", Text: "old news", TimeStamp: "1577836800.000000", Type: "message"}},
+				// 2023-06-01
+				"recent": {{User: "U1", Text: "fresh", TimeStamp: "1685577600.000000", Type: "message"}},
+				// a 2020 thread with a 2023 reply
+				"recent-thread": {
+					{User: "U1", Text: "old root", TimeStamp: "1577836800.000000", ThreadTS: "1577836800.000000", Type: "message"},
+					{User: "U1", Text: "new reply", TimeStamp: "1685577600.000000", ThreadTS: "1577836800.000000", Type: "message"},
+				},
+			},
+		}
+	}
+
+	channelNames := func(channels []*IntermediateChannel) []string {
+		names := []string{}
+		for _, channel := range channels {
+			names = append(names, channel.Name)
+		}
+		return names
+	}
+
+	t.Run("every channel is imported by default", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		assert.ElementsMatch(t, []string{"stale", "recent", "recent-thread"}, channelNames(slackTransformer.Intermediate.PublicChannels))
+		assert.Len(t, slackTransformer.Intermediate.Posts, 3)
+	})
+
+	t.Run("channels without posts since the cutoff are skipped", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.SkipChannelsWithoutPostsSince = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		assert.ElementsMatch(t, []string{"recent", "recent-thread"}, channelNames(slackTransformer.Intermediate.PublicChannels))
+		require.Len(t, slackTransformer.Intermediate.Posts, 2)
+		for _, post := range slackTransformer.Intermediate.Posts {
+			assert.NotEqual(t, "stale", post.Channel)
+		}
+
+		user := slackTransformer.Intermediate.UsersById["U1"]
+		assert.ElementsMatch(t, []string{"recent", "recent-thread"}, user.Memberships)
+		assert.Empty(t, user.AdminMemberships)
+	})
+}
+
+func TestTransformArchiveDeadDMs(t *testing.T) {
+	buildExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "user1", Deleted: true, Profile: SlackProfile{Email: "user1@example.com"}},
+				{Id: "U2", Username: "user2", Deleted: true, Profile: SlackProfile{Email: "user2@example.com"}},
+				{Id: "U3", Username: "user3", Profile: SlackProfile{Email: "user3@example.com"}},
+			},
+			DirectChannels: []SlackChannel{
+				{Id: "D1", Members: []string{"U1", "U2"}, Type: model.ChannelTypeDirect},
+				{Id: "D2", Members: []string{"U1", "U3"}, Type: model.ChannelTypeDirect},
+			},
+			Posts: map[string][]SlackPost{
+				"D1": {
+					{User: "U1", Text: "hello", TimeStamp: "1695219818.000100", Type: "message"},
+					{User: "U2", Text: "bye", TimeStamp: "1695219819.000100", Type: "message"},
+				},
+				"D2": {
+					{User: "U3", Text: "still here", TimeStamp: "1695219820.000100", Type: "message"},
+				},
+			},
+		}
+	}
+
+	t.Run("direct channels between deleted users are kept by default", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		require.NoError(t, slackTransformer.Transform(buildExport(), "", true, false, false, false, ""))
+
+		require.Len(t, slackTransformer.Intermediate.DirectChannels, 2)
+		assert.Empty(t, slackTransformer.Intermediate.PrivateChannels)
+	})
+
+	t.Run("direct channels between deleted users are moved to the archive channel", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.ArchiveDeadDMs = "dm-archive"
+		slackTransformer.Options.ArchiveDeadDMsAdmin = "user3"
+		require.NoError(t, slackTransformer.Transform(buildExport(), "", true, false, false, false, ""))
+
+		require.Len(t, slackTransformer.Intermediate.DirectChannels, 1)
+		assert.Equal(t, "D2", slackTransformer.Intermediate.DirectChannels[0].OriginalName)
+
+		require.Len(t, slackTransformer.Intermediate.PrivateChannels, 1)
+		archiveChannel := slackTransformer.Intermediate.PrivateChannels[0]
+		assert.Equal(t, "dm-archive", archiveChannel.Name)
+		assert.Equal(t, model.ChannelTypePrivate, archiveChannel.Type)
+		assert.Equal(t, []string{"U3"}, archiveChannel.Members)
+		assert.Equal(t, []string{"dm-archive"}, slackTransformer.Intermediate.UsersById["U3"].AdminMemberships)
+
+		messagesByChannel := map[string][]string{}
+		for _, post := range slackTransformer.Intermediate.Posts {
+			messagesByChannel[post.Channel] = append(messagesByChannel[post.Channel], post.Message)
+			assert.Equal(t, post.Channel != "dm-archive", post.IsDirect)
+		}
+		assert.Equal(t, []string{"hello", "bye"}, messagesByChannel["dm-archive"])
+		assert.Len(t, messagesByChannel, 2)
+	})
+
+	t.Run("the archive channel can't clash with an existing channel", func(t *testing.T) {
+		slackExport := buildExport()
+		slackExport.PublicChannels = []SlackChannel{{Id: "C1", Name: "dm-archive", Type: model.ChannelTypeOpen}}
+
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.ArchiveDeadDMs = "dm-archive"
+		slackTransformer.Options.ArchiveDeadDMsAdmin = "user3"
+		require.EqualError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""), "the archive channel dm-archive already exists in the export")
+	})
+
+	t.Run("direct channels without members aren't archived", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"U3": {Id: "U3", Username: "user3"}}
+		slackTransformer.Intermediate.DirectChannels = []*IntermediateChannel{{OriginalName: "D1", Name: "d1", Members: []string{}}}
+		slackExport := &SlackExport{Posts: map[string][]SlackPost{"D1": {{User: "U1", Text: "hello"}}}}
+
+		require.NoError(t, slackTransformer.ArchiveDeadDirectChannels(slackExport, "dm-archive", "user3"))
+		require.Len(t, slackTransformer.Intermediate.DirectChannels, 1)
+		assert.Empty(t, slackTransformer.Intermediate.PrivateChannels)
+		assert.Len(t, slackExport.Posts["D1"], 1)
+	})
+
+	t.Run("the archive channel needs an active admin", func(t *testing.T) {
+		for adminUsername, expectedError := range map[string]string{
+			"":      "the archive channel dm-archive needs an admin",
+			"user1": "the admin of the archive channel dm-archive must be an active user of the export, user1 isn't",
+			"user9": "the admin of the archive channel dm-archive must be an active user of the export, user9 isn't",
+		} {
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.ArchiveDeadDMs = "dm-archive"
+			slackTransformer.Options.ArchiveDeadDMsAdmin = adminUsername
+			require.EqualError(t, slackTransformer.Transform(buildExport(), "", true, false, false, false, ""), expectedError)
+		}
+	})
+}
+
+func TestTransformChannelCreator(t *testing.T) {
+	slackExport := &SlackExport{
+		Users: []SlackUser{
+			{Id: "U1", Username: "user1", Profile: SlackProfile{Email: "user1@example.com"}},
+			{Id: "U2", Username: "user2", Profile: SlackProfile{Email: "user2@example.com"}},
+		},
+		PublicChannels: []SlackChannel{
+			{Id: "C1", Name: "member-creator", Creator: "U1", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+			{Id: "C2", Name: "left-creator", Creator: "U1", Members: []string{"U2"}, Type: model.ChannelTypeOpen},
+			{Id: "C3", Name: "missing-creator", Creator: "UMISSING", Members: []string{"U2"}, Type: model.ChannelTypeOpen},
+		},
+	}
+
+	slackTransformer := NewTransformer("test", log.New())
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	creators := map[string]string{}
+	for _, channel := range slackTransformer.Intermediate.PublicChannels {
+		creators[channel.Name] = channel.Creator
+	}
+	assert.Equal(t, map[string]string{"member-creator": "U1", "left-creator": "U1", "missing-creator": "UMISSING"}, creators)
+
+	placeholder, ok := slackTransformer.Intermediate.UsersById["UMISSING"]
+	require.True(t, ok)
+	assert.Equal(t, "umissing", placeholder.Username)
+	assert.Empty(t, placeholder.Memberships)
+
+	user1 := slackTransformer.Intermediate.UsersById["U1"]
+	assert.Equal(t, []string{"member-creator"}, user1.Memberships)
+	assert.Equal(t, []string{"member-creator"}, user1.AdminMemberships)
+	user2 := slackTransformer.Intermediate.UsersById["U2"]
+	assert.Empty(t, user2.AdminMemberships)
+
+	line := GetImportLineFromUser(user1, "test")
+	channels := *(*line.User.Teams)[0].Channels
+	require.Len(t, channels, 1)
+	assert.Equal(t, "channel_user channel_admin", *channels[0].Roles)
+}
+
+func TestTransformImportCategories(t *testing.T) {
+	slackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "user1", Profile: SlackProfile{Email: "user1@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+				{Id: "C2", Name: "random", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+				{Id: "C3", Name: "dev", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			},
+			Sections: []SlackSection{
+				{Id: "S1", Name: "Starred", Type: "stars", User: "U1", ChannelIds: []string{"C1", "C2"}},
+				{Id: "S2", Name: "Projects", Type: "custom", User: "U1", ChannelIds: []string{"C3"}},
+			},
+		}
+	}
+
+	favorites := func(user *IntermediateUser) map[string]bool {
+		result := map[string]bool{}
+		for _, channel := range *(*GetImportLineFromUser(user, "team").User.Teams)[0].Channels {
+			result[*channel.Name] = channel.Favorite != nil && *channel.Favorite
+		}
+		return result
+	}
+
+	t.Run("sections are ignored by default", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		user := slackTransformer.Intermediate.UsersById["U1"]
+		assert.Empty(t, user.Favorites)
+		assert.Equal(t, map[string]bool{"general": false, "random": false, "dev": false}, favorites(user))
+	})
+
+	t.Run("the starred section is imported as favorites", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.ImportCategories = true
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		user := slackTransformer.Intermediate.UsersById["U1"]
+		assert.ElementsMatch(t, []string{"general", "random"}, user.Favorites)
+		assert.Equal(t, map[string]bool{"general": true, "random": true, "dev": false}, favorites(user))
+		assert.Equal(t, 1, slackTransformer.WarningCount(WarningCategoryUnsupported))
+	})
+}
+
+func TestTransformOnlyActiveUsers(t *testing.T) {
+	slackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "active", Profile: SlackProfile{Email: "active@example.com"}},
+				{Id: "U2", Username: "gone", Deleted: true, Profile: SlackProfile{Email: "gone@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Creator: "U2", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+			},
+			Posts: map[string][]SlackPost{
+				"general": {
+					{User: "U1", Text: "hello", TimeStamp: "1577836800.000000", Type: "message"},
+					{User: "U2", Text: "bye", TimeStamp: "1577836801.000000", ThreadTS: "1577836801.000000", Type: "message"},
+					{User: "U1", Text: "see you", TimeStamp: "1577836802.000000", ThreadTS: "1577836801.000000", Type: "message"},
+				},
+			},
+		}
+	}
+
+	t.Run("deactivated users are imported by default", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		require.Contains(t, slackTransformer.Intermediate.UsersById, "U2")
+		assert.NotZero(t, slackTransformer.Intermediate.UsersById["U2"].DeleteAt)
+		require.Len(t, slackTransformer.Intermediate.Posts, 2)
+		assert.Equal(t, "gone", slackTransformer.Intermediate.Posts[1].User)
+	})
+
+	t.Run("posts of deactivated users are kept as placeholders", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.OnlyActiveUsers = true
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		placeholder := slackTransformer.Intermediate.UsersById["U2"]
+		require.NotNil(t, placeholder)
+		assert.Equal(t, "u2", placeholder.Username)
+		assert.Equal(t, "Deleted", placeholder.FirstName)
+		assert.Equal(t, []string{"U1"}, slackTransformer.Intermediate.PublicChannels[0].Members)
+
+		posts := slackTransformer.Intermediate.Posts
+		require.Len(t, posts, 2)
+		assert.Equal(t, "u2", posts[1].User)
+		require.Len(t, posts[1].Replies, 1)
+		assert.Equal(t, "active", posts[1].Replies[0].User)
+	})
+
+	t.Run("posts of deactivated users are dropped", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.OnlyActiveUsers = true
+		slackTransformer.Options.DropInactiveUserPosts = true
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		assert.NotContains(t, slackTransformer.Intermediate.UsersById, "U2")
+		assert.Empty(t, slackTransformer.Intermediate.PublicChannels[0].Creator)
+
+		posts := slackTransformer.Intermediate.Posts
+		require.Len(t, posts, 1)
+		assert.Equal(t, "hello", posts[0].Message)
+	})
+}
+
+func TestTransformDropEmptyThreads(t *testing.T) {
+	slackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "active", Profile: SlackProfile{Email: "active@example.com"}},
+				{Id: "U2", Username: "gone", Deleted: true, Profile: SlackProfile{Email: "gone@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+			},
+			Posts: map[string][]SlackPost{
+				"general": {
+					// a join whose only reply is by a dropped user
+					{User: "U1", Text: "<@U1> has joined the channel", TimeStamp: "1577836800.000000", ThreadTS: "1577836800.000000", ReplyCount: 1, Type: "message", SubType: "channel_join"},
+					{User: "U2", Text: "welcome", TimeStamp: "1577836801.000000", ThreadTS: "1577836800.000000", Type: "message"},
+					// an empty root whose only reply is by a dropped user
+					{User: "U1", TimeStamp: "1577836802.000000", ThreadTS: "1577836802.000000", ReplyCount: 1, Type: "message"},
+					{User: "U2", Text: "what?", TimeStamp: "1577836803.000000", ThreadTS: "1577836802.000000", Type: "message"},
+					// a root with content of its own
+					{User: "U1", Text: "question", TimeStamp: "1577836804.000000", ThreadTS: "1577836804.000000", ReplyCount: 1, Type: "message"},
+					{User: "U2", Text: "answer", TimeStamp: "1577836805.000000", ThreadTS: "1577836804.000000", Type: "message"},
+					// a system root with replies left
+					{User: "U1", Text: "<@U1> set the channel topic: news", TimeStamp: "1577836806.000000", ThreadTS: "1577836806.000000", ReplyCount: 1, Type: "message", SubType: "channel_topic"},
+					{User: "U1", Text: "nice topic", TimeStamp: "1577836807.000000", ThreadTS: "1577836806.000000", Type: "message"},
+					// a join that was never a thread
+					{User: "U1", Text: "<@U1> has joined the channel", TimeStamp: "1577836808.000000", Type: "message", SubType: "channel_join"},
+				},
+			},
+		}
+	}
+
+	messages := func(posts []*IntermediatePost) []string {
+		result := []string{}
+		for _, post := range posts {
+			result = append(result, post.Message)
+		}
+		return result
+	}
+
+	t.Run("stubs are kept by default", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.OnlyActiveUsers = true
+		slackTransformer.Options.DropInactiveUserPosts = true
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+		assert.Len(t, slackTransformer.Intermediate.Posts, 5)
+	})
+
+	t.Run("stubs are dropped", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.OnlyActiveUsers = true
+		slackTransformer.Options.DropInactiveUserPosts = true
+		slackTransformer.Options.DropEmptyThreads = true
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		posts := slackTransformer.Intermediate.Posts
+		assert.Equal(t, []string{"question", "<@U1> set the channel topic: news", "<@U1> has joined the channel"}, messages(posts))
+		require.Len(t, posts[1].Replies, 1)
+	})
+}
+
+func TestTransformChannelRenames(t *testing.T) {
+	slackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+				{Id: "C2", Name: "random", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+				{Id: "C3", Name: "news", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			},
+			PrivateChannels: []SlackChannel{
+				{Id: "G1", Name: "secret", Members: []string{"U1"}, Type: model.ChannelTypePrivate},
+			},
+			Posts: map[string][]SlackPost{
+				"general": {{User: "U1", Text: "in general", TimeStamp: "1577836800.000000", Type: "message"}},
+				"random":  {{User: "U1", Text: "in random", TimeStamp: "1577836801.000000", Type: "message"}},
+				"news":    {{User: "U1", Text: "in news", TimeStamp: "1577836802.000000", Type: "message"}},
+				"secret":  {{User: "U1", Text: "in secret", TimeStamp: "1577836803.000000", Type: "message"}},
+			},
+		}
+	}
+
+	t.Run("channels are renamed and their posts follow", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.ChannelNamePrefix = "slack-"
+		slackTransformer.Options.ChannelRenames = map[string]string{
+			"general": "town-square",
+			"random":  "off-topic",
+			"secret":  "private-plans",
+			"missing": "unused",
+		}
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		names := []string{}
+		for _, channel := range append(slices.Clone(slackTransformer.Intermediate.PublicChannels), slackTransformer.Intermediate.PrivateChannels...) {
+			names = append(names, channel.Name)
+		}
+		assert.Equal(t, []string{"town-square", "off-topic", "slack-news", "private-plans"}, names)
+		assert.Equal(t, "town-square", slackTransformer.Intermediate.PublicChannels[0].DisplayName)
+
+		postChannels := map[string]string{}
+		for _, post := range slackTransformer.Intermediate.Posts {
+			postChannels[post.Message] = post.Channel
+		}
+		assert.Equal(t, map[string]string{
+			"in general": "town-square",
+			"in random":  "off-topic",
+			"in news":    "slack-news",
+			"in secret":  "private-plans",
+		}, postChannels)
+	})
+
+	t.Run("renames can't collide with other channels", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.ChannelRenames = map[string]string{"general": "news"}
+		err := slackTransformer.Transform(slackExport(), "", true, false, false, false, "")
+		require.EqualError(t, err, "renaming channels results in the channel name news being used by both general and news")
+	})
+
+	t.Run("renames can't collide with each other", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.ChannelRenames = map[string]string{"general": "town-square", "secret": "town-square"}
+		err := slackTransformer.Transform(slackExport(), "", true, false, false, false, "")
+		require.EqualError(t, err, "renaming channels results in the channel name town-square being used by both general and secret")
+	})
+}
+
+func TestTransformExcludeBots(t *testing.T) {
+	slackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+				{Id: "U2", Username: "bob", Profile: SlackProfile{Email: "bob@example.com"}},
+				{Id: "U3", Username: "deploybot", IsBot: true, Profile: SlackProfile{BotID: "B1", Email: "deploybot@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Members: []string{"U1", "U2", "U3"}, Type: model.ChannelTypeOpen},
+			},
+			Posts: map[string][]SlackPost{
+				"general": {
+					{User: "U1", Text: "hello", TimeStamp: "1577836800.000000", Type: "message"},
+					{BotId: "B1", Text: "deployed", TimeStamp: "1577836801.000000", ThreadTS: "1577836801.000000", Type: "message", SubType: "bot_message"},
+					{User: "U1", Text: "thanks", TimeStamp: "1577836802.000000", ThreadTS: "1577836801.000000", Type: "message"},
+					{User: "U2", Text: "great", TimeStamp: "1577836803.000000", ThreadTS: "1577836801.000000", Type: "message"},
+					{User: "U3", BotId: "B1", Text: "app message", TimeStamp: "1577836804.000000", Type: "message"},
+					{Text: "unknown app", TimeStamp: "1577836805.000000", Type: "message", SubType: "bot_message"},
+				},
+			},
+		}
+	}
+
+	t.Run("bot posts are imported by default", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		require.Len(t, slackTransformer.Intermediate.Posts, 4)
+		assert.Len(t, slackTransformer.Intermediate.Posts[1].Replies, 2)
+	})
+
+	t.Run("human replies to bot threads are reparented", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.ExcludeBots = true
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		assert.NotContains(t, slackTransformer.Intermediate.UsersById, "B1")
+		assert.NotContains(t, slackTransformer.Intermediate.UsersById, appUserID)
+		assert.Equal(t, []string{"U1", "U2"}, slackTransformer.Intermediate.PublicChannels[0].Members)
+
+		posts := slackTransformer.Intermediate.Posts
+		require.Len(t, posts, 2)
+		assert.Equal(t, "hello", posts[0].Message)
+		assert.Equal(t, "thanks", posts[1].Message)
+		require.Len(t, posts[1].Replies, 1)
+		assert.Equal(t, "great", posts[1].Replies[0].Message)
+	})
+
+	t.Run("human replies to bot threads are dropped", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.ExcludeBots = true
+		slackTransformer.Options.DropBotThreadReplies = true
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		posts := slackTransformer.Intermediate.Posts
+		require.Len(t, posts, 1)
+		assert.Equal(t, "hello", posts[0].Message)
+	})
+}
+
+func TestTransformHashUsernames(t *testing.T) {
+	slackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+				{Id: "U2", Username: "bob", Profile: SlackProfile{Email: "bob@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+			},
+			DirectChannels: []SlackChannel{
+				{Id: "D1", Name: "D1", Members: []string{"U1", "U2"}, Type: model.ChannelTypeDirect},
+			},
+			Posts: map[string][]SlackPost{
+				"general": {
+					{User: "U1", Text: "hi @bob.", TimeStamp: "1577836800.000000", ThreadTS: "1577836800.000000", Type: "message", Reactions: []*SlackReaction{{Name: "+1", Users: []string{"U2"}}}},
+					{User: "U2", Text: "hello @alice and @carol", TimeStamp: "1577836801.000000", ThreadTS: "1577836800.000000", Type: "message"},
+				},
+				"D1": {
+					{User: "U2", Text: "psst", TimeStamp: "1577836802.000000", Type: "message"},
+				},
+			},
+		}
+	}
+
+	transform := func(t *testing.T, salt string, hashEmails bool) *Intermediate {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.HashUsernames = true
+		slackTransformer.Options.HashSalt = salt
+		slackTransformer.Options.HashEmails = hashEmails
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+		return slackTransformer.Intermediate
+	}
+
+	t.Run("references are hashed consistently", func(t *testing.T) {
+		intermediate := transform(t, "salt", false)
+
+		alice := intermediate.UsersById["U1"].Username
+		bob := intermediate.UsersById["U2"].Username
+		assert.Equal(t, hashValue("salt", "alice"), alice)
+		assert.Equal(t, hashValue("salt", "bob"), bob)
+		assert.True(t, model.IsValidUsername(alice))
+		assert.Equal(t, "alice@example.com", intermediate.UsersById["U1"].Email)
+
+		assert.ElementsMatch(t, []string{alice, bob}, intermediate.DirectChannels[0].MembersUsernames)
+
+		// channels are merged by name, so the direct post comes first
+		require.Len(t, intermediate.Posts, 2)
+		root := intermediate.Posts[1]
+		assert.Equal(t, alice, root.User)
+		assert.Equal(t, "hi @"+bob+".", root.Message)
+		require.Len(t, root.Reactions, 1)
+		assert.Equal(t, bob, root.Reactions[0].User)
+		require.Len(t, root.Replies, 1)
+		assert.Equal(t, bob, root.Replies[0].User)
+		assert.Equal(t, "hello @"+alice+" and @carol", root.Replies[0].Message)
+
+		direct := intermediate.Posts[0]
+		assert.Equal(t, bob, direct.User)
+		assert.ElementsMatch(t, []string{alice, bob}, direct.ChannelMembers)
+	})
+
+	t.Run("hashes are stable for the same salt", func(t *testing.T) {
+		assert.Equal(t, transform(t, "salt", false).UsersById["U1"].Username, transform(t, "salt", false).UsersById["U1"].Username)
+		assert.NotEqual(t, transform(t, "salt", false).UsersById["U1"].Username, transform(t, "pepper", false).UsersById["U1"].Username)
+	})
+
+	t.Run("emails can be hashed too", func(t *testing.T) {
+		intermediate := transform(t, "salt", true)
+
+		assert.Equal(t, hashValue("salt", "alice@example.com")+"@example.com", intermediate.UsersById["U1"].Email)
+		assert.NotEqual(t, intermediate.UsersById["U1"].Email, intermediate.UsersById["U2"].Email)
+	})
+}
+
+func TestPlaceholderSeed(t *testing.T) {
+	createPlaceholders := func(seed string) (*IntermediateUser, *IntermediateUser) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.PlaceholderSeed = seed
+		slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{}
+		slackTransformer.CreateIntermediateUser("U1")
+		slackTransformer.CreateExternalIntermediateUser("U2")
+		return slackTransformer.Intermediate.UsersById["U1"], slackTransformer.Intermediate.UsersById["U2"]
+	}
+
+	t.Run("placeholders are identical across runs with the same seed", func(t *testing.T) {
+		missing1, external1 := createPlaceholders("seed")
+		missing2, external2 := createPlaceholders("seed")
+
+		assert.Equal(t, missing1, missing2)
+		assert.Equal(t, external1, external2)
+		assert.NotEqual(t, missing1.Password, external1.Password)
+		assert.Len(t, missing1.Password, 26)
+	})
+
+	t.Run("different seeds produce different passwords", func(t *testing.T) {
+		missing1, _ := createPlaceholders("seed")
+		missing2, _ := createPlaceholders("another seed")
+
+		assert.Equal(t, missing1.Email, missing2.Email)
+		assert.NotEqual(t, missing1.Password, missing2.Password)
+	})
+
+	t.Run("passwords are random without a seed", func(t *testing.T) {
+		missing1, _ := createPlaceholders("")
+		missing2, _ := createPlaceholders("")
+
+		assert.Equal(t, missing1.Email, missing2.Email)
+		assert.NotEqual(t, missing1.Password, missing2.Password)
+	})
+}
+
+func TestTransformChannelNamePrefix(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.ChannelNamePrefix = "slack-"
+
+	slackExport := &SlackExport{
+		Users: []SlackUser{
+			{Id: "m1", Username: "m1", Profile: SlackProfile{Email: "m1@example.com"}},
+			{Id: "m2", Username: "m2", Profile: SlackProfile{Email: "m2@example.com"}},
+		},
+		PublicChannels: []SlackChannel{
+			{Id: "C1", Name: "general", Members: []string{"m1", "m2"}, Type: model.ChannelTypeOpen},
+			{Id: "C2", Name: strings.Repeat("a", model.ChannelNameMaxLength), Members: []string{"m1"}, Type: model.ChannelTypeOpen},
+		},
+		PrivateChannels: []SlackChannel{
+			{Id: "G1", Name: "secret", Members: []string{"m2"}, Type: model.ChannelTypePrivate},
+		},
+		DirectChannels: []SlackChannel{
+			{Id: "D1", Members: []string{"m1", "m2"}, Type: model.ChannelTypeDirect},
+		},
+		Posts: map[string][]SlackPost{
+			"general": {{User: "m1", Text: "hello", TimeStamp: "1695219818.000100", Type: "message"}},
+			"secret":  {{User: "m2", Text: "psst", TimeStamp: "1695219819.000100", Type: "message"}},
+			"D1":      {{User: "m2", Text: "hi", TimeStamp: "1695219820.000100", Type: "message"}},
+		},
+	}
+
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	intermediate := slackTransformer.Intermediate
+	require.Len(t, intermediate.PublicChannels, 2)
+	assert.Equal(t, "slack-general", intermediate.PublicChannels[0].Name)
+	assert.Equal(t, "general", intermediate.PublicChannels[0].DisplayName)
+	assert.Len(t, intermediate.PublicChannels[1].Name, model.ChannelNameMaxLength)
+	assert.True(t, strings.HasPrefix(intermediate.PublicChannels[1].Name, "slack-aaa"))
+	require.Len(t, intermediate.PrivateChannels, 1)
+	assert.Equal(t, "slack-secret", intermediate.PrivateChannels[0].Name)
+	require.Len(t, intermediate.DirectChannels, 1)
+	assert.Equal(t, "d1", intermediate.DirectChannels[0].Name)
+
+	assert.Equal(t, []string{"slack-general", intermediate.PublicChannels[1].Name}, intermediate.UsersById["m1"].Memberships)
+	assert.Equal(t, []string{"slack-general", "slack-secret"}, intermediate.UsersById["m2"].Memberships)
+
+	postChannels := []string{}
+	for _, post := range intermediate.Posts {
+		if !post.IsDirect {
+			postChannels = append(postChannels, post.Channel)
+		}
+	}
+	assert.ElementsMatch(t, []string{"slack-general", "slack-secret"}, postChannels)
+}
+
+func TestTransformPostsFileComments(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}, "m2": {Username: "m2"}}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+		{
+			Name:         "channel1",
+			OriginalName: "channel1",
+		},
+	}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{
+					User:      "m1",
+					Text:      "sharing a file",
+					TimeStamp: "1695219818.000100",
+					Type:      "message",
+					SubType:   "file_share",
+					Files:     []*SlackFile{{Id: "F1", Name: "report.txt"}},
+				},
+				{
+					User:      "m2",
+					TimeStamp: "1695219819.000100",
+					Type:      "message",
+					SubType:   "file_comment",
+					File:      &SlackFile{Id: "F1"},
+					Comment:   &SlackComment{User: "m2", Comment: "nice report"},
+				},
+				{
+					User:      "m2",
+					TimeStamp: "1695219820.000100",
+					Type:      "message",
+					SubType:   "file_comment",
+					File:      &SlackFile{Id: "F2"},
+					Comment:   &SlackComment{User: "m2", Comment: "a comment on an unknown file"},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+	require.Len(t, slackTransformer.Intermediate.Posts, 2)
+
+	messages := map[string]*IntermediatePost{}
+	for _, post := range slackTransformer.Intermediate.Posts {
+		messages[post.Message] = post
+	}
+
+	fileShare := messages["sharing a file"]
+	require.NotNil(t, fileShare)
+	require.Len(t, fileShare.Replies, 1)
+	assert.Equal(t, "nice report", fileShare.Replies[0].Message)
+	assert.Equal(t, "m2", fileShare.Replies[0].User)
+
+	orphan := messages["a comment on an unknown file"]
+	require.NotNil(t, orphan)
+	assert.Empty(t, orphan.Replies)
+}
+
+func TestDayBucket(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// 2020-01-02T04:59:59.999Z and 2020-01-02T05:00:00Z are on each side
+	// of midnight in New York
+	assert.Equal(t, "2020-01-02", dayBucket(1577941199999, nil))
+	assert.Equal(t, "2020-01-01", dayBucket(1577941199999, newYork))
+	assert.Equal(t, "2020-01-02", dayBucket(1577941200000, newYork))
+}
+
+func TestTransformAttachmentsByDate(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// the post was sent on the evening of 2020-01-01 in New York, which is
+	// already 2020-01-02 in UTC
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json":    `[{"id": "U1", "name": "user1", "profile": {"email": "user1@example.com"}}]`,
+		"general/2020-01-01.json": `[{"user": "U1", "text": "a file", "ts": "1577930400.000000", "type": "message", "subtype": "file_share",
+			"files": [{"id": "F1", "name": "report.txt"}]}]`,
+		"__uploads/F1/report.txt": "file contents",
+	}
+
+	for name, tc := range map[string]struct {
+		location       *time.Location
+		expectedBucket string
+		expectedPath   string
+	}{
+		"attachments are bucketed by the day of their post in the timezone": {
+			location:       newYork,
+			expectedBucket: "2020-01-01",
+			expectedPath:   "bulk-export-attachments/2020-01-01/F1_report.txt",
+		},
+		"attachments are bucketed in UTC without a timezone": {
+			expectedBucket: "2020-01-02",
+			expectedPath:   "bulk-export-attachments/2020-01-02/F1_report.txt",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.AttachmentsByDate = true
+			slackTransformer.Options.Location = tc.location
+
+			slackExport, err := slackTransformer.ParseSlackExportFile(createZipReader(t, files), false)
+			require.NoError(t, err)
+
+			attachmentsDir := t.TempDir()
+			require.NoError(t, slackTransformer.Transform(slackExport, attachmentsDir, false, false, false, false, ""))
+			require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+			post := slackTransformer.Intermediate.Posts[0]
+			require.Equal(t, []string{tc.expectedPath}, post.Attachments)
+			contents, err := os.ReadFile(filepath.Join(attachmentsDir, tc.expectedPath))
+			require.NoError(t, err)
+			assert.Equal(t, "file contents", string(contents))
+			assert.Equal(t, tc.expectedBucket, dayBucket(post.CreateAt, tc.location))
+		})
+	}
+}
+
+func TestTransformAttachmentBaseURL(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json":    `[{"id": "U1", "name": "user1", "profile": {"email": "user1@example.com"}}]`,
+		"general/2020-01-01.json": `[
+			{"user": "U1", "text": "a file", "ts": "1577836800.000000", "thread_ts": "1577836800.000000", "type": "message", "subtype": "file_share",
+				"files": [{"id": "F1", "name": "report.txt"}]},
+			{"user": "U1", "text": "", "ts": "1577836801.000000", "thread_ts": "1577836800.000000", "type": "message", "subtype": "file_share",
+				"files": [{"id": "F2", "name": "photo.png"}]}
+		]`,
+		"__uploads/F1/report.txt": "report",
+		"__uploads/F2/photo.png":  "photo",
+	}
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.AttachmentBaseURL = "https://cdn.example.com/media/"
+
+	slackExport, err := slackTransformer.ParseSlackExportFile(createZipReader(t, files), false)
+	require.NoError(t, err)
+
+	attachmentsDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(attachmentsDir, "bulk-export-attachments"), 0755))
+	require.NoError(t, slackTransformer.Transform(slackExport, attachmentsDir, false, false, false, false, ""))
+
+	require.Len(t, slackTransformer.Intermediate.Posts, 1)
+	post := slackTransformer.Intermediate.Posts[0]
+	assert.Empty(t, post.Attachments)
+	assert.Equal(t, "a file\n[F1_report.txt](https://cdn.example.com/media/bulk-export-attachments/F1_report.txt)", post.Message)
+	require.Len(t, post.Replies, 1)
+	assert.Empty(t, post.Replies[0].Attachments)
+	assert.Equal(t, "[F2_photo.png](https://cdn.example.com/media/bulk-export-attachments/F2_photo.png)", post.Replies[0].Message)
+
+	// the files are still written to be uploaded separately
+	contents, err := os.ReadFile(filepath.Join(attachmentsDir, "bulk-export-attachments", "F1_report.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "report", string(contents))
+
+	require.Equal(t, []ExternalAttachment{
+		{Path: "bulk-export-attachments/F1_report.txt", URL: "https://cdn.example.com/media/bulk-export-attachments/F1_report.txt"},
+		{Path: "bulk-export-attachments/F2_photo.png", URL: "https://cdn.example.com/media/bulk-export-attachments/F2_photo.png"},
+	}, slackTransformer.AttachmentManifest())
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, slackTransformer.WriteAttachmentManifest(buf))
+	assert.Equal(t, `path,url
+bulk-export-attachments/F1_report.txt,https://cdn.example.com/media/bulk-export-attachments/F1_report.txt
+bulk-export-attachments/F2_photo.png,https://cdn.example.com/media/bulk-export-attachments/F2_photo.png
+`, buf.String())
+}
+
+func TestLinkAttachmentsToBaseURLLongMessage(t *testing.T) {
+	message := strings.Repeat("a", model.PostMessageMaxRunesV2-10)
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.Posts = []*IntermediatePost{
+		{
+			User:        "user1",
+			Channel:     "general",
+			Message:     message,
+			CreateAt:    1000,
+			Attachments: []string{"bulk-export-attachments/F1_report.txt"},
+			Replies: []*IntermediatePost{
+				{User: "user1", Channel: "general", Message: "a reply", CreateAt: 1010},
+			},
+		},
+	}
+
+	slackTransformer.LinkAttachmentsToBaseURL("https://cdn.example.com/media")
+
+	require.Len(t, slackTransformer.Intermediate.Posts, 1)
+	post := slackTransformer.Intermediate.Posts[0]
+	assert.Equal(t, message, post.Message)
+	assert.Empty(t, post.Attachments)
+
+	// the link is moved to a continuation that comes before the reply
+	require.Len(t, post.Replies, 2)
+	assert.Equal(t, "[F1_report.txt](https://cdn.example.com/media/bulk-export-attachments/F1_report.txt)", post.Replies[0].Message)
+	assert.Equal(t, int64(1001), post.Replies[0].CreateAt)
+	assert.Equal(t, "a reply", post.Replies[1].Message)
+	assert.Equal(t, int64(1010), post.Replies[1].CreateAt)
+}
+
+func TestTransformPostsBlockImages(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/images/chart.png", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("image contents"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	newExport := func(imageURL string) *SlackExport {
+		return &SlackExport{
+			Posts: map[string][]SlackPost{
+				"channel1": {
+					{
+						User:      "m1",
+						Text:      "the results",
+						TimeStamp: "1695219818.000100",
+						Type:      "message",
+						Blocks: []*SlackBlock{
+							{Type: "rich_text"},
+							{Type: "image", ImageURL: imageURL, AltText: "a chart", Title: &SlackBlockText{Text: "Quarterly chart"}},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	newTransformer := func() *Transformer {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}}
+		slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+		return slackTransformer
+	}
+
+	t.Run("images are downloaded as attachments when downloads are allowed", func(t *testing.T) {
+		attachmentsDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(attachmentsDir, attachmentsInternal), 0755))
+
+		slackTransformer := newTransformer()
+		require.NoError(t, slackTransformer.TransformPosts(newExport(server.URL+"/images/chart.png"), attachmentsDir, false, false, true))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+		post := slackTransformer.Intermediate.Posts[0]
+		assert.Equal(t, "the results", post.Message)
+		require.Len(t, post.Attachments, 1)
+		assert.True(t, strings.HasSuffix(post.Attachments[0], "_chart.png"))
+
+		contents, err := os.ReadFile(filepath.Join(attachmentsDir, post.Attachments[0]))
+		require.NoError(t, err)
+		assert.Equal(t, "image contents", string(contents))
+	})
+
+	t.Run("images are linked when downloads aren't allowed", func(t *testing.T) {
+		imageURL := server.URL + "/images/chart.png"
+		slackTransformer := newTransformer()
+		require.NoError(t, slackTransformer.TransformPosts(newExport(imageURL), "", true, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+		post := slackTransformer.Intermediate.Posts[0]
+		assert.Equal(t, "the results\n[Quarterly chart]("+imageURL+")", post.Message)
+		assert.Empty(t, post.Attachments)
+	})
+
+	t.Run("images that fail to download are linked", func(t *testing.T) {
+		attachmentsDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(attachmentsDir, attachmentsInternal), 0755))
+
+		imageURL := server.URL + "/images/missing.png"
+		slackTransformer := newTransformer()
+		require.NoError(t, slackTransformer.TransformPosts(newExport(imageURL), attachmentsDir, false, false, true))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+		post := slackTransformer.Intermediate.Posts[0]
+		assert.Equal(t, "the results\n[Quarterly chart]("+imageURL+")", post.Message)
+		assert.Empty(t, post.Attachments)
+		assert.Equal(t, 1, slackTransformer.WarningCount(WarningCategoryFile))
+	})
+}
+
+func TestTransformPostsPreferThumbnails(t *testing.T) {
+	requested := []string{}
+	mux := http.NewServeMux()
+	for _, name := range []string{"/photo.png", "/photo_1024.png", "/report.pdf"} {
+		mux.HandleFunc(name, func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, r.URL.Path)
+			_, _ = w.Write([]byte(r.URL.Path))
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{
+					User:      "m1",
+					TimeStamp: "1695219818.000100",
+					Type:      "message",
+					SubType:   "file_share",
+					Files: []*SlackFile{
+						{
+							Id:          "F1",
+							Name:        "photo.png",
+							Mimetype:    "image/png",
+							Size:        int64(len("/photo.png")),
+							DownloadURL: server.URL + "/photo.png",
+							Thumb1024:   server.URL + "/photo_1024.png",
+						},
+						{
+							Id:          "F2",
+							Name:        "report.pdf",
+							Mimetype:    "application/pdf",
+							Size:        int64(len("/report.pdf")),
+							DownloadURL: server.URL + "/report.pdf",
+							Thumb1024:   server.URL + "/report_1024.png",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		preferThumbnails bool
+		expected         []string
+	}{
+		"the originals are downloaded by default": {
+			expected: []string{"/photo.png", "/report.pdf"},
+		},
+		"the thumbnails of the images are downloaded with prefer thumbnails": {
+			preferThumbnails: true,
+			expected:         []string{"/photo_1024.png", "/report.pdf"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			requested = []string{}
+			attachmentsDir := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(attachmentsDir, attachmentsInternal), 0755))
+
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.PreferThumbnails = tc.preferThumbnails
+			slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}}
+			slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+			require.NoError(t, slackTransformer.TransformPosts(slackExport, attachmentsDir, false, false, true))
+			assert.Equal(t, tc.expected, requested)
+
+			require.Len(t, slackTransformer.Intermediate.Posts, 1)
+			attachments := slackTransformer.Intermediate.Posts[0].Attachments
+			require.Len(t, attachments, 2)
+			contents, err := os.ReadFile(filepath.Join(attachmentsDir, attachments[0]))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected[0], string(contents))
+
+			if !tc.preferThumbnails {
+				assert.Empty(t, slackTransformer.DownloadedFiles())
+				return
+			}
+			assert.Equal(t, []DownloadedFile{
+				{FileId: "F1", Name: "photo.png", Variant: FileVariantThumbnail, URL: server.URL + "/photo_1024.png", Path: attachments[0]},
+				{FileId: "F2", Name: "report.pdf", Variant: FileVariantOriginal, URL: server.URL + "/report.pdf", Path: attachments[1]},
+			}, slackTransformer.DownloadedFiles())
+		})
+	}
+}
+
+func TestWriteDownloadedFilesReport(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteDownloadedFilesReport(buf, []DownloadedFile{
+		{FileId: "F1", Name: "photo.png", Variant: FileVariantThumbnail, URL: "https://files.slack.com/photo_1024.png", Path: "bulk-export-attachments/F1-thumb_photo.png"},
+	}))
+	assert.Equal(t, `file_id,name,variant,url,path
+F1,photo.png,thumbnail,https://files.slack.com/photo_1024.png,bulk-export-attachments/F1-thumb_photo.png
+`, buf.String())
+}
+
+func TestTransformPostsChannelHistory(t *testing.T) {
+	topic := "Release planning"
+	emptyPurpose := ""
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"U1": {Id: "U1", Username: "alice"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "general", OriginalName: "general", Type: model.ChannelTypeOpen}}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"general": {
+				{User: "U1", Type: "message", SubType: "channel_topic", TimeStamp: "1577836800.000000", Text: "<@U1> set the channel topic: Release planning", Topic: &topic},
+				{User: "U1", Type: "message", SubType: "channel_purpose", TimeStamp: "1577836801.000000", Text: "<@U1> cleared channel purpose", Purpose: &emptyPurpose},
+				{User: "U1", Type: "message", SubType: "channel_name", TimeStamp: "1577836802.000000", Text: "<@U1> renamed the channel", Name: "general", OldName: "lobby"},
+				{User: "U1", Type: "message", SubType: "channel_topic", TimeStamp: "1577836803.000000", Text: "set the channel topic"},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 4)
+	for _, post := range posts {
+		assert.Equal(t, "alice", post.User)
+	}
+	assert.Equal(t, "@alice updated the channel header to: Release planning", posts[0].Message)
+	assert.Equal(t, SlackConvertTimeStamp("1577836800.000000"), posts[0].CreateAt)
+	assert.Equal(t, "@alice removed the channel purpose", posts[1].Message)
+	assert.Equal(t, "@alice updated the channel display name from: lobby to: general", posts[2].Message)
+	// older exports don't carry the new topic, so the original text is kept
+	assert.Equal(t, "set the channel topic", posts[3].Message)
+}
+
+func TestTransformPostsChannelTopicHistory(t *testing.T) {
+	topic := "Release planning"
+	newTopic := "Release on Friday"
+	purpose := "Planning the releases"
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.ChannelTopicHistory = true
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"U1": {Id: "U1", Username: "alice"},
+		"U2": {Id: "U2", Username: "bob"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+		{Name: "general", OriginalName: "general", Type: model.ChannelTypeOpen},
+		{Name: "quiet", OriginalName: "quiet", Type: model.ChannelTypeOpen},
+	}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"general": {
+				{User: "U1", Type: "message", SubType: "channel_topic", TimeStamp: "1577836800.000000", Text: "<@U1> set the channel topic: Release planning", Topic: &topic},
+				{User: "U2", Type: "message", TimeStamp: "1577840400.000000", Text: "hello"},
+				{User: "U2", Type: "message", SubType: "channel_name", TimeStamp: "1577923200.000000", Text: "<@U2> renamed the channel", Name: "general", OldName: "lobby"},
+				{User: "U1", Type: "message", SubType: "channel_topic", TimeStamp: "1578009600.000000", Text: "<@U1> set the channel topic: Release on Friday", Topic: &newTopic},
+				{User: "U2", Type: "message", SubType: "channel_purpose", TimeStamp: "1577880000.000000", Text: "<@U2> set the channel purpose", Purpose: &purpose},
+			},
+			// channels without changes get no summary
+			"quiet": {{User: "U1", Type: "message", TimeStamp: "1577836900.000000", Text: "hi"}},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	messages := map[string][]string{}
+	var summary *IntermediatePost
+	for _, post := range slackTransformer.Intermediate.Posts {
+		messages[post.Channel] = append(messages[post.Channel], post.Message)
+		if strings.HasPrefix(post.Message, "**History of this channel in Slack:**") {
+			require.Nil(t, summary)
+			summary = post
+		}
+	}
+
+	// the posts of each change are kept, and the summary follows the last one
+	require.Len(t, messages["general"], 6)
+	assert.Equal(t, "@alice updated the channel header to: Release on Friday", messages["general"][4])
+	require.NotNil(t, summary)
+	assert.Equal(t, "general", summary.Channel)
+	assert.Equal(t, strings.ToLower(appUserID), summary.User)
+	assert.Equal(t, SlackConvertTimeStamp("1578009600.000000")+1, summary.CreateAt)
+	assert.Equal(t, "**History of this channel in Slack:**\n"+
+		"- 2020-01-01 00:00 UTC: @alice updated the channel header to: Release planning\n"+
+		"- 2020-01-01 12:00 UTC: @bob updated the channel purpose to: Planning the releases\n"+
+		"- 2020-01-02 00:00 UTC: @bob updated the channel display name from: lobby to: general\n"+
+		"- 2020-01-03 00:00 UTC: @alice updated the channel header to: Release on Friday", summary.Message)
+	assert.Equal(t, summary.Message, messages["general"][5])
+
+	assert.Equal(t, []string{"hi"}, messages["quiet"])
+}
+
+func TestTransformPostsPinnedAppMessages(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"U1": {Id: "U1", Username: "alice"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "general", OriginalName: "general", Type: model.ChannelTypeOpen}}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"general": {
+				{User: "U1", Type: "message", TimeStamp: "1577836800.000000", Text: "pinned by a user", PinnedTo: []string{"C1"}},
+				{Type: "message", SubType: "bot_message", TimeStamp: "1577836801.000000", Text: "pinned by an app", PinnedTo: []string{"C1"}},
+				{BotId: "B1", Type: "message", TimeStamp: "1577836802.000000", Text: "posted by an app"},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 3)
+	assert.Equal(t, "alice", posts[0].User)
+	assert.True(t, posts[0].IsPinned)
+
+	// the app message without an author is attributed to the app user
+	require.Contains(t, slackTransformer.Intermediate.UsersById, appUserID)
+	assert.Equal(t, slackTransformer.Intermediate.UsersById[appUserID].Username, posts[1].User)
+	assert.True(t, posts[1].IsPinned)
+	line := GetImportLineFromPost(posts[1], "test")
+	require.NotNil(t, line.Post.IsPinned)
+	assert.True(t, *line.Post.IsPinned)
+
+	assert.Equal(t, "b1", posts[2].User)
+	assert.False(t, posts[2].IsPinned)
+	assert.Nil(t, GetImportLineFromPost(posts[2], "test").Post.IsPinned)
+}
+
+func TestTransformPostsIntegrationBotUsers(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"U1": {Id: "U1", Username: "alice"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "general", OriginalName: "general", Type: model.ChannelTypeOpen}}
+
+	slackExport := &SlackExport{
+		IntegrationLogs: []SlackIntegrationLog{
+			{ServiceId: "B1", ServiceType: "Jenkins CI", ChangeType: "added"},
+			{AppId: "A1", AppType: "Deploy Bot", ChangeType: "added"},
+			{AppId: "A2", AppType: "alice", ChangeType: "added"},
+		},
+		Posts: map[string][]SlackPost{
+			"general": {
+				{BotId: "B1", Type: "message", SubType: "bot_message", TimeStamp: "1577836800.000000", Text: "build passed"},
+				{BotId: "B2", AppId: "A1", Type: "message", TimeStamp: "1577836801.000000", Text: "deployed"},
+				// the name of the app is taken by another user
+				{BotId: "B3", AppId: "A2", Type: "message", SubType: "bot_message", TimeStamp: "1577836802.000000", Text: "hi"},
+				{BotId: "B4", Type: "message", SubType: "bot_message", TimeStamp: "1577836803.000000", Text: "unknown"},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	users := slackTransformer.Intermediate.UsersById
+	require.Contains(t, users, "B1")
+	assert.Equal(t, "jenkins_ci", users["B1"].Username)
+	assert.Equal(t, "Jenkins CI", users["B1"].FirstName)
+	require.Contains(t, users, "B2")
+	assert.Equal(t, "deploy_bot", users["B2"].Username)
+	assert.Equal(t, "Deploy Bot", users["B2"].FirstName)
+	require.Contains(t, users, "B3")
+	assert.Equal(t, "b3", users["B3"].Username)
+	require.Contains(t, users, "B4")
+	assert.Equal(t, "b4", users["B4"].Username)
+	assert.Equal(t, "Deleted", users["B4"].FirstName)
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 4)
+	assert.Equal(t, "jenkins_ci", posts[0].User)
+	assert.Equal(t, "deploy_bot", posts[1].User)
+}
+
+func TestTransformPostsReplyCount(t *testing.T) {
+	logger := log.New()
+	buf := &bytes.Buffer{}
+	logger.SetOutput(buf)
+
+	slackTransformer := NewTransformer("test", logger)
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}, "m2": {Username: "m2"}}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+		{
+			Name:         "channel1",
+			OriginalName: "channel1",
+		},
+	}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{
+					User:       "m1",
+					Text:       "root",
+					ThreadTS:   "1695219818.000100",
+					TimeStamp:  "1695219818.000100",
+					Type:       "message",
+					ReplyCount: 3,
+					ReplyUsers: []string{"m2"},
+				},
+				{
+					User:      "m2",
+					Text:      "the only exported reply",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219819.000100",
+					Type:      "message",
+				},
+				{
+					User:      "m1",
+					Text:      "not a thread",
+					TimeStamp: "1695219820.000100",
+					Type:      "message",
+				},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+	require.Len(t, slackTransformer.Intermediate.Posts, 2)
+
+	for _, post := range slackTransformer.Intermediate.Posts {
+		if post.Message == "root" {
+			assert.Equal(t, 3, post.Props[slackReplyCountProp])
+			require.Len(t, post.Replies, 1)
+			assert.Nil(t, post.Replies[0].Props)
+		} else {
+			assert.Nil(t, post.Props)
+		}
+	}
+
+	assert.Contains(t, buf.String(), "Thread 1695219818.000100 in channel channel1 has 3 replies in Slack but only 1 were imported")
+}
+
+func TestTransformPostsLatestReply(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}, "m2": {Username: "m2"}}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+		{
+			Name:         "channel1",
+			OriginalName: "channel1",
+		},
+	}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{
+					User:      "m1",
+					Text:      "root",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219818.000100",
+					Type:      "message",
+				},
+				{
+					User:      "m1",
+					Text:      "a later post",
+					TimeStamp: "1695219820.000100",
+					Type:      "message",
+				},
+				{
+					User:      "m2",
+					Text:      "the latest reply",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219830.000100",
+					Type:      "message",
+				},
+				{
+					User:      "m2",
+					Text:      "the first reply",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219819.000100",
+					Type:      "message",
+				},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+	require.Len(t, slackTransformer.Intermediate.Posts, 2)
+
+	var root *IntermediatePost
+	for _, post := range slackTransformer.Intermediate.Posts {
+		if post.Message == "root" {
+			root = post
+		}
+	}
+	require.NotNil(t, root)
+	require.Len(t, root.Replies, 2)
+
+	assert.Equal(t, "the first reply", root.Replies[0].Message)
+	assert.Equal(t, "the latest reply", root.Replies[1].Message)
+	assert.Equal(t, int64(1695219830000), root.Replies[1].CreateAt)
+	assert.Greater(t, root.Replies[1].CreateAt, root.CreateAt)
+}
+
+func TestOrderThreadReplies(t *testing.T) {
+	post := &IntermediatePost{
+		Message:  "root",
+		CreateAt: 1000,
+		Replies: []*IntermediatePost{
+			{Message: "third", CreateAt: 3000},
+			{Message: "first", CreateAt: 1000},
+			{Message: "second", CreateAt: 1000},
+		},
+	}
+	timestamps := map[int64]bool{1000: true, 1001: true, 3000: true}
+
+	OrderThreadReplies(post, timestamps)
+
+	require.Len(t, post.Replies, 3)
+	assert.Equal(t, "first", post.Replies[0].Message)
+	assert.Equal(t, int64(1002), post.Replies[0].CreateAt)
+	assert.Equal(t, "second", post.Replies[1].Message)
+	assert.Equal(t, int64(1003), post.Replies[1].CreateAt)
+	assert.Equal(t, "third", post.Replies[2].Message)
+	assert.Equal(t, int64(3000), post.Replies[2].CreateAt)
+}
+
+func TestTransformPostsExternalFiles(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"U1": {Id: "U1", Username: "user1"}}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{
+					User:      "U1",
+					Text:      "the plan",
+					TimeStamp: "1695219800.000000",
+					Type:      "message",
+					Files: []*SlackFile{{
+						Id:           "F1",
+						Name:         "Roadmap",
+						Title:        "Roadmap 2024",
+						External:     true,
+						ExternalType: "gdrive",
+						ExternalURL:  "https://docs.google.com/document/d/abc/edit",
+						URLPrivate:   "https://docs.google.com/document/d/abc/edit",
+						DownloadURL:  server.URL + "/F1",
+					}},
+				},
+			},
+		},
+		Uploads: map[string]*zip.File{},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, t.TempDir(), false, false, true))
+
+	require.Len(t, slackTransformer.Intermediate.Posts, 1)
+	post := slackTransformer.Intermediate.Posts[0]
+	assert.Equal(t, "the plan\n[Roadmap 2024](https://docs.google.com/document/d/abc/edit)", post.Message)
+	assert.Empty(t, post.Attachments)
+	assert.Zero(t, requests)
+	assert.Zero(t, slackTransformer.WarningCount(WarningCategoryFile))
+}
+
+func TestTransformPostsIncludeFileURLs(t *testing.T) {
+	newTransformer := func(includeFileURLs bool) *Transformer {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.IncludeFileURLs = includeFileURLs
+		slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}}
+		slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+			{
+				Name:         "channel1",
+				OriginalName: "channel1",
+			},
+		}
+		return slackTransformer
+	}
+
+	newExport := func(text string) *SlackExport {
+		return &SlackExport{
+			Posts: map[string][]SlackPost{
+				"channel1": {
+					{
+						User:      "m1",
+						Text:      text,
+						TimeStamp: "1695219818.000100",
+						Type:      "message",
+						SubType:   "file_share",
+						Files: []*SlackFile{
+							{Id: "F1", Name: "report.pdf", Title: "Quarterly report", Permalink: "https://example.slack.com/files/U1/F1/report.pdf"},
+							{Id: "F2", Name: "notes.txt", DownloadURL: "https://files.slack.com/files-pri/T1-F2/download/notes.txt"},
+						},
+					},
+				},
+			},
+			Uploads: map[string]*zip.File{},
+		}
+	}
+
+	t.Run("files are dropped by default when they can't be imported", func(t *testing.T) {
+		slackTransformer := newTransformer(false)
+		require.NoError(t, slackTransformer.TransformPosts(newExport("see attached"), "", false, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+		assert.Equal(t, "see attached", slackTransformer.Intermediate.Posts[0].Message)
+	})
+
+	t.Run("links to the files are added to the message", func(t *testing.T) {
+		slackTransformer := newTransformer(true)
+		require.NoError(t, slackTransformer.TransformPosts(newExport("see attached"), "", false, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+		post := slackTransformer.Intermediate.Posts[0]
+		assert.Equal(t, "see attached\n[Quarterly report](https://example.slack.com/files/U1/F1/report.pdf)\n[notes.txt](https://files.slack.com/files-pri/T1-F2/download/notes.txt)", post.Message)
+		assert.Empty(t, post.Attachments)
+	})
+
+	t.Run("links are added when attachments are skipped", func(t *testing.T) {
+		slackTransformer := newTransformer(true)
+		require.NoError(t, slackTransformer.TransformPosts(newExport(""), "", true, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+		assert.True(t, strings.HasPrefix(slackTransformer.Intermediate.Posts[0].Message, "[Quarterly report]"))
+	})
+
+	t.Run("messages that become too long are split", func(t *testing.T) {
+		slackTransformer := newTransformer(true)
+		slackTransformer.Options.MaxMessageLength = 20
+		require.NoError(t, slackTransformer.TransformPosts(newExport("see attached"), "", false, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+		post := slackTransformer.Intermediate.Posts[0]
+		assert.Equal(t, "see attached", post.Message)
+		require.NotEmpty(t, post.Replies)
+		for _, reply := range post.Replies {
+			assert.LessOrEqual(t, utf8.RuneCountInString(reply.Message), 20)
+			assert.Greater(t, reply.CreateAt, post.CreateAt)
+		}
+	})
+
+	t.Run("messages are split at the server limit by default", func(t *testing.T) {
+		for name, text := range map[string]string{
+			"pushed over by the links": strings.Repeat("a", model.PostMessageMaxRunesV2-10),
+			"already too long":         strings.Repeat("a", model.PostMessageMaxRunesV2+10),
+		} {
+			slackTransformer := newTransformer(true)
+			require.NoError(t, slackTransformer.TransformPosts(newExport(text), "", false, false, false), name)
+			require.Len(t, slackTransformer.Intermediate.Posts, 1, name)
+
+			post := slackTransformer.Intermediate.Posts[0]
+			assert.LessOrEqual(t, utf8.RuneCountInString(post.Message), model.PostMessageMaxRunesV2, name)
+			require.NotEmpty(t, post.Replies, name)
+			for _, reply := range post.Replies {
+				assert.LessOrEqual(t, utf8.RuneCountInString(reply.Message), model.PostMessageMaxRunesV2, name)
+			}
+		}
+	})
+}
+
+func TestSplitMessage(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Message  string
+		MaxRunes int
+		Expected []string
+	}{
+		{
+			Name:     "short messages are not split",
+			Message:  "hello world",
+			MaxRunes: 20,
+			Expected: []string{"hello world"},
+		},
+		{
+			Name:     "messages are split at the last space",
+			Message:  "hello wonderful world",
+			MaxRunes: 16,
+			Expected: []string{"hello wonderful", "world"},
+		},
+		{
+			Name:     "messages are split at the last newline",
+			Message:  "first line\nsecond line",
+			MaxRunes: 15,
+			Expected: []string{"first line", "second line"},
+		},
+		{
+			Name:     "messages without spaces are split at the limit",
+			Message:  "abcdefghij",
+			MaxRunes: 4,
+			Expected: []string{"abcd", "efgh", "ij"},
+		},
+		{
+			Name:     "runes are counted instead of bytes",
+			Message:  "ñññññ",
+			MaxRunes: 3,
+			Expected: []string{"ñññ", "ññ"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expected, splitMessage(tc.Message, tc.MaxRunes))
+		})
+	}
+}
+
+func TestSplitLongPost(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.MaxMessageLength = 10
+
+	reply := &IntermediatePost{User: "u2", Message: "short", CreateAt: 100}
+	post := &IntermediatePost{
+		User:        "u1",
+		Message:     "first part second part",
+		CreateAt:    10,
+		Attachments: []string{"file"},
+		Reactions:   []*IntermediateReaction{{User: "u2", EmojiName: "+1", CreateAt: 10}},
+		Replies:     []*IntermediatePost{reply},
+	}
+	timestamps := map[int64]bool{10: true, 11: true, 100: true}
+
+	slackTransformer.SplitLongPost(post, timestamps)
+
+	assert.Equal(t, "first part", post.Message)
+	assert.Equal(t, []string{"file"}, post.Attachments)
+	assert.Len(t, post.Reactions, 1)
+	require.Len(t, post.Replies, 3)
+	assert.Equal(t, "second", post.Replies[0].Message)
+	assert.Equal(t, int64(12), post.Replies[0].CreateAt)
+	assert.Equal(t, "part", post.Replies[1].Message)
+	assert.Equal(t, int64(13), post.Replies[1].CreateAt)
+	assert.Equal(t, reply, post.Replies[2])
+	for _, continuation := range post.Replies[:2] {
+		assert.Equal(t, "u1", continuation.User)
+		assert.Empty(t, continuation.Attachments)
+		assert.Empty(t, continuation.Reactions)
+	}
+}
+
+func TestTransformPostsSplitNestedReply(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.MaxMessageLength = 10
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}, "m2": {Username: "m2"}}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+		{
+			Name:         "channel1",
+			OriginalName: "channel1",
+		},
+	}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{
+					User:      "m1",
+					Text:      "root",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219818.000100",
+					Type:      "message",
+				},
+				{
+					User:      "m2",
+					Text:      "first part second part",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219819.000100",
+					Type:      "message",
+					Reactions: []*SlackReaction{{Name: "+1", Users: []string{"m1"}, Count: 1}},
+				},
+				{
+					User:      "m1",
+					Text:      "sub-reply",
+					ThreadTS:  "1695219819.000100",
+					TimeStamp: "1695219820.000100",
+					Type:      "message",
+					Reactions: []*SlackReaction{{Name: "smile", Users: []string{"m2"}, Count: 1}},
+				},
+				{
+					User:      "m2",
+					Text:      "nested",
+					ThreadTS:  "1695219820.000100",
+					TimeStamp: "1695219821.000100",
+					Type:      "message",
+				},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+	require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+	root := slackTransformer.Intermediate.Posts[0]
+	assert.Equal(t, "root", root.Message)
+
+	messages := []string{}
+	for _, reply := range root.Replies {
+		messages = append(messages, reply.Message)
+	}
+	assert.Equal(t, []string{"first part", "second", "part", "sub-reply", "nested"}, messages)
+
+	for i := 1; i < len(root.Replies); i++ {
+		assert.Less(t, root.Replies[i-1].CreateAt, root.Replies[i].CreateAt)
+	}
+
+	require.Len(t, root.Replies[0].Reactions, 1)
+	assert.Equal(t, "+1", root.Replies[0].Reactions[0].EmojiName)
+	assert.Empty(t, root.Replies[1].Reactions)
+	assert.Empty(t, root.Replies[2].Reactions)
+	require.Len(t, root.Replies[3].Reactions, 1)
+	assert.Equal(t, "smile", root.Replies[3].Reactions[0].EmojiName)
+	assert.Empty(t, root.Replies[4].Reactions)
+}
+
+func TestTransformPostsSplitRootReactions(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.MaxMessageLength = 10
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}, "m2": {Username: "m2"}}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{
+					User:      "m1",
+					Text:      "first part second part",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219818.000100",
+					Type:      "message",
+					Reactions: []*SlackReaction{{Name: "+1", Users: []string{"m2"}, Count: 1}, {Name: "eyes", Users: []string{"m1"}, Count: 1}},
+				},
+				// the replies follow the root within the milliseconds the
+				// continuations of the root would take
+				{
+					User:      "m2",
+					Text:      "reply",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219818.001100",
+					Type:      "message",
+					Reactions: []*SlackReaction{{Name: "smile", Users: []string{"m1"}, Count: 1}},
+				},
+				{
+					User:      "m1",
+					Text:      "another",
+					ThreadTS:  "1695219818.000100",
+					TimeStamp: "1695219818.002100",
+					Type:      "message",
+				},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+	require.Len(t, slackTransformer.Intermediate.Posts, 1)
+
+	root := slackTransformer.Intermediate.Posts[0]
+	assert.Equal(t, "first part", root.Message)
+	emojis := []string{}
+	for _, reaction := range root.Reactions {
+		emojis = append(emojis, reaction.EmojiName)
+		assert.Equal(t, root.CreateAt, reaction.CreateAt)
+	}
+	assert.Equal(t, []string{"+1", "eyes"}, emojis)
+
+	messages := []string{}
+	for _, reply := range root.Replies {
+		messages = append(messages, reply.Message)
+	}
+	assert.Equal(t, []string{"second", "part", "reply", "another"}, messages)
+
+	previous := root.CreateAt
+	for _, reply := range root.Replies {
+		assert.Less(t, previous, reply.CreateAt, reply.Message)
+		previous = reply.CreateAt
+	}
+
+	assert.Empty(t, root.Replies[0].Reactions)
+	assert.Empty(t, root.Replies[1].Reactions)
+	require.Len(t, root.Replies[2].Reactions, 1)
+	assert.Equal(t, "smile", root.Replies[2].Reactions[0].EmojiName)
+	assert.Equal(t, root.Replies[2].CreateAt, root.Replies[2].Reactions[0].CreateAt)
+}
+
+func TestTransformPostsMergeConsecutiveMessages(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.MergeConsecutiveMessages = time.Minute
+	slackTransformer.Options.MaxMessageLength = 100
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"m1": {Id: "m1", Username: "user1"},
+		"m2": {Id: "m2", Username: "user2"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{User: "m1", Text: "one", TimeStamp: "1695219800.000000", Type: "message",
+					Reactions: []*SlackReaction{{Name: "+1", Users: []string{"m2"}}}},
+				{User: "m1", Text: "two", TimeStamp: "1695219810.000000", Type: "message",
+					Reactions: []*SlackReaction{{Name: "+1", Users: []string{"m2"}}, {Name: "heart", Users: []string{"m2"}}}},
+				// more than a minute after the previous message
+				{User: "m1", Text: "three", TimeStamp: "1695219880.000000", Type: "message"},
+				{User: "m2", Text: "other", TimeStamp: "1695219890.000000", Type: "message"},
+				{User: "m1", Text: "four", TimeStamp: "1695219895.000000", Type: "message"},
+				{User: "m1", Text: "question", TimeStamp: "1695220000.000000", ThreadTS: "1695220000.000000", Type: "message"},
+				{User: "m2", Text: "a", TimeStamp: "1695220001.000000", ThreadTS: "1695220000.000000", Type: "message"},
+				{User: "m2", Text: "b", TimeStamp: "1695220002.000000", ThreadTS: "1695220000.000000", Type: "message"},
+				{User: "m1", Text: "c", TimeStamp: "1695220003.000000", ThreadTS: "1695220000.000000", Type: "message"},
+				// the previous root has replies
+				{User: "m1", Text: "after the thread", TimeStamp: "1695220004.000000", Type: "message"},
+				// merging would exceed the maximum message length
+				{User: "m2", Text: strings.Repeat("x", 60), TimeStamp: "1695220100.000000", Type: "message"},
+				{User: "m2", Text: strings.Repeat("y", 60), TimeStamp: "1695220101.000000", Type: "message"},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	messages := []string{}
+	for _, post := range slackTransformer.Intermediate.Posts {
+		messages = append(messages, post.Message)
+	}
+	assert.Equal(t, []string{"one\ntwo", "three", "other", "four", "question", "after the thread", strings.Repeat("x", 60), strings.Repeat("y", 60)}, messages)
+
+	merged := slackTransformer.Intermediate.Posts[0]
+	assert.Equal(t, SlackConvertTimeStamp("1695219800.000000"), merged.CreateAt)
+	require.Len(t, merged.Reactions, 2)
+	assert.Equal(t, "+1", merged.Reactions[0].EmojiName)
+	assert.Equal(t, "heart", merged.Reactions[1].EmojiName)
+
+	thread := slackTransformer.Intermediate.Posts[4]
+	require.Len(t, thread.Replies, 2)
+	assert.Equal(t, "a\nb", thread.Replies[0].Message)
+	assert.Equal(t, "c", thread.Replies[1].Message)
+}
+
+func TestTransformRenameUsers(t *testing.T) {
+	newSlackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "admin", Profile: SlackProfile{Email: "admin@example.com"}},
+				{Id: "U2", Username: "user2", Profile: SlackProfile{Email: "user2@example.com"}},
+				{Id: "U3", Username: "user3", Profile: SlackProfile{Email: "user3@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+			},
+			GroupChannels: []SlackChannel{
+				{Id: "G1", Name: "mpdm-admin--user2--user3-1", Members: []string{"U1", "U2", "U3"}, Type: model.ChannelTypeGroup},
+			},
+			Posts: map[string][]SlackPost{
+				"general":                    {{User: "U1", Text: "hello @admin, @user2 and @user3.", TimeStamp: "1695219818.000100", Type: "message"}},
+				"mpdm-admin--user2--user3-1": {{User: "U1", Text: "hi", TimeStamp: "1695219819.000100", Type: "message"}},
+			},
+		}
+	}
+
+	// the posts of the channels aren't sorted, so the one of general is
+	// looked up by its channel
+	generalMessage := func(posts []*IntermediatePost) string {
+		for _, post := range posts {
+			if post.Channel == "general" {
+				return post.Message
+			}
+		}
+		return ""
+	}
+
+	t.Run("renames propagate to posts and channel members", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.UserRenames = map[string]string{"admin": "slack-admin"}
+
+		require.NoError(t, slackTransformer.Transform(newSlackExport(), "", true, false, false, false, ""))
+
+		assert.Equal(t, "slack-admin", slackTransformer.Intermediate.UsersById["U1"].Username)
+		assert.Equal(t, []string{"general"}, slackTransformer.Intermediate.UsersById["U1"].Memberships)
+		require.Len(t, slackTransformer.Intermediate.GroupChannels, 1)
+		assert.Equal(t, []string{"slack-admin", "user2", "user3"}, slackTransformer.Intermediate.GroupChannels[0].MembersUsernames)
+
+		require.Len(t, slackTransformer.Intermediate.Posts, 2)
+		for _, post := range slackTransformer.Intermediate.Posts {
+			assert.Equal(t, "slack-admin", post.User)
+			if post.IsDirect {
+				assert.Equal(t, []string{"slack-admin", "user2", "user3"}, post.ChannelMembers)
+			}
+		}
+
+		// the mentions converted when parsing follow the rename
+		assert.Equal(t, "hello @slack-admin, @user2 and @user3.", generalMessage(slackTransformer.Intermediate.Posts))
+	})
+
+	t.Run("renames can't produce duplicated usernames", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.UserRenames = map[string]string{"admin": "user2"}
+
+		err := slackTransformer.Transform(newSlackExport(), "", true, false, false, false, "")
+		require.EqualError(t, err, "renaming users results in the username user2 being used by more than one user")
+	})
+
+	t.Run("swapping usernames is allowed", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.UserRenames = map[string]string{"user2": "user3", "user3": "user2"}
+
+		require.NoError(t, slackTransformer.Transform(newSlackExport(), "", true, false, false, false, ""))
+		assert.Equal(t, "user3", slackTransformer.Intermediate.UsersById["U2"].Username)
+		assert.Equal(t, "user2", slackTransformer.Intermediate.UsersById["U3"].Username)
+
+		assert.Equal(t, "hello @admin, @user3 and @user2.", generalMessage(slackTransformer.Intermediate.Posts))
+		require.Len(t, slackTransformer.Intermediate.GroupChannels, 1)
+		assert.Equal(t, []string{"admin", "user2", "user3"}, slackTransformer.Intermediate.GroupChannels[0].MembersUsernames)
+	})
+
+	t.Run("renames must produce valid usernames", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.UserRenames = map[string]string{"admin": "Not Valid!"}
+
+		err := slackTransformer.Transform(newSlackExport(), "", true, false, false, false, "")
+		require.EqualError(t, err, "the username Not Valid! to rename admin to is not a valid Mattermost username")
+	})
+}
+
+// buildConcurrentChannelsExport builds an export with many channels whose
+// posts reference both known users and users missing from the export.
+func buildConcurrentChannelsExport(numChannels, numPosts int) (*SlackExport, []*IntermediateChannel) {
+	slackExport := &SlackExport{Posts: map[string][]SlackPost{}}
+	channels := []*IntermediateChannel{}
+	for i := 0; i < numChannels; i++ {
+		name := fmt.Sprintf("channel%d", i)
+		channels = append(channels, &IntermediateChannel{Name: name, OriginalName: name})
+
+		posts := []SlackPost{}
+		for j := 0; j < numPosts; j++ {
+			ts := fmt.Sprintf("%d.%06d", 1695219818+j, i)
+			post := SlackPost{
+				User:      fmt.Sprintf("u%d", j%5),
+				Text:      fmt.Sprintf("message %d in %s", j, name),
+				TimeStamp: ts,
+				Type:      "message",
+			}
+			if j%3 == 1 {
+				post.ThreadTS = fmt.Sprintf("%d.%06d", 1695219818+j-1, i)
+			}
+			if j%7 == 0 {
+				post.User = fmt.Sprintf("missing%d", j%4)
+			}
+			posts = append(posts, post)
+		}
+		slackExport.Posts[name] = posts
+	}
+	return slackExport, channels
+}
+
+func transformConcurrentChannels(tb testing.TB, concurrentChannels, numChannels, numPosts int) *Transformer {
+	slackExport, channels := buildConcurrentChannelsExport(numChannels, numPosts)
+
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	slackTransformer := NewTransformer("test", logger)
+	slackTransformer.Options.ConcurrentChannels = concurrentChannels
+	slackTransformer.Intermediate.PublicChannels = channels
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{}
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("u%d", i)
+		slackTransformer.Intermediate.UsersById[id] = &IntermediateUser{Id: id, Username: id}
+	}
+
+	require.NoError(tb, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+	return slackTransformer
+}
+
+func TestTransformNormalizeUsernames(t *testing.T) {
+	slackExport := &SlackExport{
+		Users: []SlackUser{
+			{Id: "U1", Username: "Admin.User", Profile: SlackProfile{Email: "admin@example.com"}},
+			{Id: "U2", Username: "señor", Profile: SlackProfile{Email: "senor2@example.com"}},
+			{Id: "U3", Username: "senor", Profile: SlackProfile{Email: "senor@example.com"}},
+			{Id: "U4", Username: "all", Profile: SlackProfile{Email: "all@example.com"}},
+			{Id: "U5", Username: strings.Repeat("A", 70), Profile: SlackProfile{Email: "long@example.com"}},
+		},
+		PublicChannels: []SlackChannel{
+			{Id: "C1", Name: "general", Members: []string{"U1", "U2"}, Type: model.ChannelTypeOpen},
+		},
+		GroupChannels: []SlackChannel{
+			{Id: "G1", Name: "mpdm-admin--senor--senor-1", Members: []string{"U1", "U2", "U3"}, Type: model.ChannelTypeGroup},
+		},
+		Posts: map[string][]SlackPost{
+			"general":                    {{User: "U1", Text: "welcome @señor and @Admin.User.", TimeStamp: "1695219818.000100", Type: "message"}},
+			"mpdm-admin--senor--senor-1": {{User: "U2", Text: "hi", TimeStamp: "1695219819.000100", Type: "message"}},
+		},
+	}
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.NormalizeUsernames = true
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	users := slackTransformer.Intermediate.UsersById
+	assert.Equal(t, "admin.user", users["U1"].Username)
+	// the user with a valid username keeps it
+	assert.Equal(t, "senor", users["U3"].Username)
+	assert.Equal(t, "senor-2", users["U2"].Username)
+	assert.Equal(t, "all-2", users["U4"].Username)
+	assert.Equal(t, strings.Repeat("a", model.UserNameMaxLength), users["U5"].Username)
+	for _, user := range users {
+		assert.True(t, model.IsValidUsername(user.Username), user.Username)
+	}
+
+	assert.Equal(t, []string{"general"}, users["U2"].Memberships)
+	require.Len(t, slackTransformer.Intermediate.GroupChannels, 1)
+	assert.ElementsMatch(t, []string{"admin.user", "senor-2", "senor"}, slackTransformer.Intermediate.GroupChannels[0].MembersUsernames)
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 2)
+	assert.Equal(t, "admin.user", posts[0].User)
+	assert.Equal(t, "welcome @senor-2 and @admin.user.", posts[0].Message)
+	assert.Equal(t, "senor-2", posts[1].User)
+	assert.ElementsMatch(t, []string{"admin.user", "senor-2", "senor"}, posts[1].ChannelMembers)
+}
+
+func TestTransformPostsConcurrentChannels(t *testing.T) {
+	sequential := transformConcurrentChannels(t, 1, 20, 50)
+	concurrent := transformConcurrentChannels(t, 8, 20, 50)
+
+	require.NotEmpty(t, sequential.Intermediate.Posts)
+	assert.Equal(t, sequential.Intermediate.Posts, concurrent.Intermediate.Posts)
+
+	sequentialUsers := []string{}
+	for id := range sequential.Intermediate.UsersById {
+		sequentialUsers = append(sequentialUsers, id)
+	}
+	concurrentUsers := []string{}
+	for id := range concurrent.Intermediate.UsersById {
+		concurrentUsers = append(concurrentUsers, id)
+	}
+	assert.ElementsMatch(t, sequentialUsers, concurrentUsers)
+	assert.Len(t, concurrentUsers, 9)
+
+	// posts are sorted by channel and then by their creation time
+	for i := 1; i < len(concurrent.Intermediate.Posts); i++ {
+		previous, current := concurrent.Intermediate.Posts[i-1], concurrent.Intermediate.Posts[i]
+		if previous.Channel == current.Channel {
+			assert.Less(t, previous.CreateAt, current.CreateAt)
+		} else {
+			assert.Less(t, previous.Channel, current.Channel)
+		}
+	}
+}
+
+func BenchmarkTransformPostsConcurrentChannels(b *testing.B) {
+	for _, concurrentChannels := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrent-channels=%d", concurrentChannels), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				transformConcurrentChannels(b, concurrentChannels, 50, 200)
+			}
+		})
+	}
+}
+
+func TestTransformPostsPostLimit(t *testing.T) {
+	newTransformer := func(postLimit int) *Transformer {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.PostLimit = postLimit
+		slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+			"m1": {Id: "m1", Username: "user1"},
+		}
+		slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+			{Name: "channel1", OriginalName: "channel1"},
+			{Name: "channel2", OriginalName: "channel2"},
+		}
+		return slackTransformer
+	}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{User: "m1", Text: "one", TimeStamp: "1695219800.000000", Type: "message"},
+				{User: "m1", Text: "thread", TimeStamp: "1695219810.000000", ThreadTS: "1695219810.000000", Type: "message"},
+				{User: "m1", Text: "reply 1", TimeStamp: "1695219811.000000", ThreadTS: "1695219810.000000", Type: "message"},
+				{User: "m1", Text: "reply 2", TimeStamp: "1695219812.000000", ThreadTS: "1695219810.000000", Type: "message"},
+			},
+			"channel2": {
+				{User: "m1", Text: "two", TimeStamp: "1695219900.000000", Type: "message"},
+				{User: "m1", Text: "three", TimeStamp: "1695219910.000000", Type: "message"},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		postLimit int
+		expected  []string
+	}{
+		{name: "no limit", postLimit: 0, expected: []string{"one", "thread", "two", "three"}},
+		{name: "limit at a thread boundary", postLimit: 5, expected: []string{"one", "thread", "two"}},
+		{name: "limit inside a thread", postLimit: 3, expected: []string{"one"}},
+		{name: "limit of a single post", postLimit: 1, expected: []string{"one"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			slackTransformer := newTransformer(tc.postLimit)
+			require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+			messages := []string{}
+			for _, post := range slackTransformer.Intermediate.Posts {
+				messages = append(messages, post.Message)
+			}
+			assert.Equal(t, tc.expected, messages)
+			if tc.postLimit > 0 {
+				assert.LessOrEqual(t, countPosts(slackTransformer.Intermediate.Posts), tc.postLimit)
+			}
+		})
+	}
+
+	t.Run("thread replies are kept whole", func(t *testing.T) {
+		slackTransformer := newTransformer(5)
+		require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+		require.Len(t, slackTransformer.Intermediate.Posts, 3)
+		require.Len(t, slackTransformer.Intermediate.Posts[1].Replies, 2)
+		assert.Equal(t, 5, countPosts(slackTransformer.Intermediate.Posts))
+	})
+}
+
+func TestTransformPostsAttachmentURLTemplate(t *testing.T) {
+	requested := []string{}
+	authorizations := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.EscapedPath())
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte("contents"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{
+					User:      "m1",
+					TimeStamp: "1695219818.000100",
+					Type:      "message",
+					SubType:   "file_share",
+					Files: []*SlackFile{
+						{Id: "F1", Name: "my report.pdf", Size: int64(len("contents"))},
+						{Id: "F2", Name: "other.pdf", Size: int64(len("contents")), DownloadURL: server.URL + "/files/direct"},
+					},
+				},
+			},
+		},
+	}
+
+	attachmentsDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(attachmentsDir, attachmentsInternal), 0755))
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.AttachmentURLTemplate = server.URL + "/files/T1-{id}/download/{name}"
+	slackTransformer.Options.SlackToken = "xoxp-token"
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{"m1": {Username: "m1"}}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, attachmentsDir, false, false, true))
+
+	// the template is only used for the file without a download URL, and
+	// the token is only sent to it
+	assert.Equal(t, []string{"/files/T1-F1/download/my%20report.pdf", "/files/direct"}, requested)
+	assert.Equal(t, []string{"Bearer xoxp-token", ""}, authorizations)
+
+	require.Len(t, slackTransformer.Intermediate.Posts, 1)
+	require.Len(t, slackTransformer.Intermediate.Posts[0].Attachments, 2)
+	contents, err := os.ReadFile(filepath.Join(attachmentsDir, slackTransformer.Intermediate.Posts[0].Attachments[0]))
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(contents))
+}
+
+func TestTransformPostsOrphanReplies(t *testing.T) {
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{User: "m1", Text: "root", TimeStamp: "1695219800.000000", ThreadTS: "1695219800.000000", Type: "message"},
+				{User: "m2", Text: "reply", TimeStamp: "1695219801.000000", ThreadTS: "1695219800.000000", Type: "message"},
+				// the root of this thread isn't in the export
+				{User: "m2", Text: "orphan 1", TimeStamp: "1695219810.000000", ThreadTS: "1695219700.000000", Type: "message"},
+				{User: "m1", Text: "orphan 2", TimeStamp: "1695219820.000000", ThreadTS: "1695219700.000000", Type: "message"},
+			},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		promote  bool
+		expected []string
+	}{
+		"orphan replies are dropped by default": {
+			expected: []string{"root"},
+		},
+		"orphan replies are promoted to standalone posts": {
+			promote:  true,
+			expected: []string{"root", "orphan 1", "orphan 2"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.PromoteOrphanReplies = tc.promote
+			slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+				"m1": {Id: "m1", Username: "user1"},
+				"m2": {Id: "m2", Username: "user2"},
+			}
+			slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+			require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+			messages := []string{}
+			for _, post := range slackTransformer.Intermediate.Posts {
+				messages = append(messages, post.Message)
+			}
+			assert.Equal(t, tc.expected, messages)
+
+			posts := slackTransformer.Intermediate.Posts
+			require.Len(t, posts[0].Replies, 1)
+			assert.Equal(t, "reply", posts[0].Replies[0].Message)
+			if tc.promote {
+				assert.Equal(t, "user2", posts[1].User)
+				assert.Equal(t, SlackConvertTimeStamp("1695219810.000000"), posts[1].CreateAt)
+				assert.Empty(t, posts[1].Replies)
+				assert.Equal(t, "user1", posts[2].User)
+				assert.Equal(t, SlackConvertTimeStamp("1695219820.000000"), posts[2].CreateAt)
+			}
+		})
+	}
+}
+
+func TestTransformPostsSummarizeReminders(t *testing.T) {
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{User: "m1", Text: "hello", TimeStamp: "1695219800.000000", Type: "message"},
+				{User: "m1", Text: "set up a reminder “Submit the report” in this channel at 9AM every Monday, UTC.", TimeStamp: "1695219900.000000", Type: "message", SubType: "reminder_add"},
+				{User: "m2", Text: "set up a reminder “Standup” in this channel at 10AM every weekday, UTC.", TimeStamp: "1695220000.000000", Type: "message", SubType: "reminder_add"},
+				{User: "m2", Text: "bye", TimeStamp: "1695220100.000000", Type: "message"},
+			},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		summarize bool
+		expected  []string
+	}{
+		"reminders are dropped by default": {
+			expected: []string{"hello", "bye"},
+		},
+		"reminders are summarized in a single post": {
+			summarize: true,
+			expected: []string{
+				"hello",
+				"**Reminders set up in this channel in Slack:**\n" +
+					"- @user1 set up a reminder “Submit the report” in this channel at 9AM every Monday, UTC. (2023-09-20 14:25 UTC)\n" +
+					"- @user2 set up a reminder “Standup” in this channel at 10AM every weekday, UTC. (2023-09-20 14:26 UTC)",
+				"bye",
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.SummarizeReminders = tc.summarize
+			slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+				"m1": {Id: "m1", Username: "user1"},
+				"m2": {Id: "m2", Username: "user2"},
+			}
+			slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+			require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+			messages := []string{}
+			for _, post := range slackTransformer.Intermediate.Posts {
+				messages = append(messages, post.Message)
+			}
+			assert.Equal(t, tc.expected, messages)
+
+			if tc.summarize {
+				summary := slackTransformer.Intermediate.Posts[1]
+				assert.Equal(t, strings.ToLower(appUserID), summary.User)
+				assert.Equal(t, SlackConvertTimeStamp("1695220000.000000"), summary.CreateAt)
+			}
+		})
+	}
+}
+
+func TestTransformPostsPreserveTimestampPrecision(t *testing.T) {
+	// the three first messages share a millisecond, and the first one is
+	// split in two posts
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{User: "m2", Text: "third", TimeStamp: "1695219800.000300", Type: "message"},
+				{User: "m1", Text: strings.Repeat("a", 100) + " " + strings.Repeat("b", 100), TimeStamp: "1695219800.000100", Type: "message"},
+				{User: "m2", Text: "second", TimeStamp: "1695219800.000200", Type: "message"},
+				{User: "m1", Text: "fourth", TimeStamp: "1695219800.002000", Type: "message"},
+			},
+		},
+	}
+
+	// the posts of the channel, including replies, by creation time
+	chronological := func(posts []*IntermediatePost) []string {
+		all := []*IntermediatePost{}
+		for _, post := range posts {
+			all = append(all, post)
+			all = append(all, post.Replies...)
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].CreateAt < all[j].CreateAt })
+		messages := []string{}
+		for _, post := range all {
+			messages = append(messages, post.Message[:1])
+		}
+		return messages
+	}
+
+	for name, tc := range map[string]struct {
+		preserve bool
+		expected []string
+	}{
+		"the continuation is bumped past the later messages by default": {
+			expected: []string{"a", "s", "t", "f", "b"},
+		},
+		"the original order is preserved": {
+			preserve: true,
+			expected: []string{"a", "b", "s", "t", "f"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			slackTransformer := NewTransformer("test", log.New())
+			slackTransformer.Options.MaxMessageLength = 100
+			slackTransformer.Options.PreserveTimestampPrecision = tc.preserve
+			slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+				"m1": {Id: "m1", Username: "user1"},
+				"m2": {Id: "m2", Username: "user2"},
+			}
+			slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+			require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+			posts := slackTransformer.Intermediate.Posts
+			assert.Equal(t, tc.expected, chronological(posts))
+
+			if tc.preserve {
+				base := SlackConvertTimeStamp("1695219800.000100")
+				require.Len(t, posts, 4)
+				assert.Equal(t, base, posts[0].CreateAt)
+				assert.Equal(t, base+1, posts[0].Replies[0].CreateAt)
+				assert.Equal(t, base+2, posts[1].CreateAt)
+				assert.Equal(t, base+3, posts[2].CreateAt)
+				assert.Equal(t, base+4, posts[3].CreateAt)
+			}
+		})
+	}
+}
+
+func TestTransformPostsTruncationNote(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.TruncationNote = true
+	slackTransformer.Options.Location = time.FixedZone("UTC-5", -5*60*60)
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"m1": {Id: "m1", Username: "user1"},
+		"m2": {Id: "m2", Username: "user2"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+		{Name: "channel1", OriginalName: "channel1", Type: model.ChannelTypeOpen},
+		{Name: "empty", OriginalName: "empty", Type: model.ChannelTypeOpen},
+	}
+	slackTransformer.Intermediate.DirectChannels = []*IntermediateChannel{
+		{Name: "dm", OriginalName: "dm", Type: model.ChannelTypeDirect, Members: []string{"m1", "m2"}, MembersUsernames: []string{"user1", "user2"}},
+	}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{User: "m1", Text: "later", TimeStamp: "1695300000.000000", Type: "message"},
+				// 2023-09-20 02:23 UTC, which is still September 19 in UTC-5
+				{User: "m2", Text: "oldest", TimeStamp: "1695176600.000000", Type: "message"},
+			},
+			"dm": {
+				{User: "m1", Text: "private", TimeStamp: "1695176600.000000", Type: "message"},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 4)
+	note := posts[0]
+	assert.Equal(t, "channel1", note.Channel)
+	assert.Equal(t, strings.ToLower(appUserID), note.User)
+	assert.Equal(t, "_The history of this channel was imported from Slack starting on September 19, 2023, the date of its oldest message in the export. Older messages may not have been included in the export._", note.Message)
+	assert.Equal(t, SlackConvertTimeStamp("1695176600.000000")-1, note.CreateAt)
+	assert.Equal(t, "oldest", posts[1].Message)
+	assert.Equal(t, "later", posts[2].Message)
+	// direct channels don't get the note
+	assert.Equal(t, "private", posts[3].Message)
+}
+
+func TestTransformPostsSeedContextPost(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.SeedContextPost = true
+	slackTransformer.Options.TruncationNote = true
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"U1": {Id: "U1", Username: "user1"},
+		"U2": {Id: "U2", Username: "user2"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+		{Id: "C1", Name: "channel1", OriginalName: "channel1", Type: model.ChannelTypeOpen, Creator: "U2"},
+		{Id: "C2", Name: "no-context", OriginalName: "no-context", Type: model.ChannelTypeOpen, Creator: "U2"},
+	}
+	slackTransformer.Intermediate.PrivateChannels = []*IntermediateChannel{
+		{Id: "G1", Name: "private1", OriginalName: "private1", Type: model.ChannelTypePrivate},
+	}
+
+	slackExport := &SlackExport{
+		PublicChannels: []SlackChannel{
+			{Id: "C1", Name: "channel1", Topic: SlackChannelSub{Value: "Release on Friday"}, Purpose: SlackChannelSub{Value: "Planning the releases"}},
+			{Id: "C2", Name: "no-context"},
+		},
+		PrivateChannels: []SlackChannel{
+			{Id: "G1", Name: "private1", Purpose: SlackChannelSub{Value: "Secret plans"}},
+		},
+		Posts: map[string][]SlackPost{
+			"channel1":   {{User: "U1", Text: "hello", TimeStamp: "1695176600.000000", Type: "message"}},
+			"no-context": {{User: "U1", Text: "quiet", TimeStamp: "1695176700.000000", Type: "message"}},
+			"private1":   {{User: "U1", Text: "psst", TimeStamp: "1695176800.000000", Type: "message"}},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	posts := map[string][]*IntermediatePost{}
+	for _, post := range slackTransformer.Intermediate.Posts {
+		posts[post.Channel] = append(posts[post.Channel], post)
+	}
+
+	// the context post comes first, even before the truncation note
+	require.Len(t, posts["channel1"], 3)
+	context := posts["channel1"][0]
+	assert.Equal(t, "user2", context.User)
+	assert.Equal(t, "_Channel context imported from Slack_\n**Topic:** Release on Friday\n**Purpose:** Planning the releases", context.Message)
+	assert.Less(t, context.CreateAt, posts["channel1"][1].CreateAt)
+	assert.Equal(t, "hello", posts["channel1"][2].Message)
+
+	// channels without a topic or purpose don't get one
+	require.Len(t, posts["no-context"], 2)
+	assert.Equal(t, "quiet", posts["no-context"][1].Message)
+
+	// channels without a creator get the post from the app user
+	require.Len(t, posts["private1"], 3)
+	assert.Equal(t, strings.ToLower(appUserID), posts["private1"][0].User)
+	assert.Equal(t, "_Channel context imported from Slack_\n**Purpose:** Secret plans", posts["private1"][0].Message)
+}
+
+func TestTransformPostsMessagePrefixTemplate(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.MessagePrefixTemplate = "[{date} {time}] {user} in ~{channel}: "
+	slackTransformer.Options.Location = location
+	slackTransformer.Options.MaxMessageLength = MinMessageLength
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"U1": {Id: "U1", Username: "alice"},
+		"U2": {Id: "U2", Username: "bob"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{User: "U1", Text: "hello", TimeStamp: "1695219800.000000", Type: "message", ThreadTS: "1695219800.000000"},
+				{User: "U2", Text: "hello back", TimeStamp: "1695219810.000000", Type: "message", ThreadTS: "1695219800.000000"},
+				{User: "U2", Text: strings.Repeat("a", 90), TimeStamp: "1695223400.000000", Type: "message"},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+	require.Len(t, slackTransformer.Intermediate.Posts, 2)
+
+	thread := slackTransformer.Intermediate.Posts[0]
+	assert.Equal(t, "[2023-09-20 10:23] alice in ~channel1: hello", thread.Message)
+	require.Len(t, thread.Replies, 1)
+	assert.Equal(t, "[2023-09-20 10:23] bob in ~channel1: hello back", thread.Replies[0].Message)
+
+	// the prefix counts towards the maximum message length
+	long := slackTransformer.Intermediate.Posts[1]
+	require.Len(t, long.Replies, 1)
+	prefix := "[2023-09-20 11:23] bob in ~channel1: "
+	assert.Equal(t, prefix+strings.Repeat("a", 90), long.Message+long.Replies[0].Message)
+	assert.LessOrEqual(t, utf8.RuneCountInString(long.Message), MinMessageLength)
+
+	require.NoError(t, ValidateMessagePrefixTemplate("{user} ({date}): "))
+	require.EqualError(t, ValidateMessagePrefixTemplate("{author}: "), "unknown placeholder {author} in the message prefix template, it should be one of {user}, {date}, {time}, {channel}")
+}
+
+func TestTransformPostsBotMessageReactions(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"U1": {Id: "U1", Username: "alice"},
+		"U2": {Id: "U2", Username: "bob"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+	reactions := []*SlackReaction{
+		{Name: "+1", Users: []string{"U1", "U2"}, Count: 2},
+		{Name: "eyes", Users: []string{"U2"}, Count: 1},
+	}
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				// the bot has no user, so a synthetic user is created for it
+				{BotId: "B1", Text: "build passed", TimeStamp: "1695219800.000000", Type: "message", SubType: "bot_message", Reactions: reactions},
+				// app messages without the bot subtype
+				{BotId: "B1", Text: "deployed", TimeStamp: "1695219810.000000", Type: "message", Reactions: reactions},
+				// app messages without any author
+				{Text: "pinned by an app", TimeStamp: "1695219820.000000", Type: "message", SubType: "bot_message", Reactions: reactions},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 3)
+	assert.Equal(t, "b1", posts[0].User)
+	assert.Equal(t, strings.ToLower(appUserID), posts[2].User)
+	for _, post := range posts {
+		assert.Equal(t, []*IntermediateReaction{
+			{User: "alice", EmojiName: "+1", CreateAt: post.CreateAt},
+			{User: "bob", EmojiName: "+1", CreateAt: post.CreateAt},
+			{User: "bob", EmojiName: "eyes", CreateAt: post.CreateAt},
+		}, post.Reactions, post.Message)
+	}
+}
+
+func TestTransformPostsUnicodeEmojiReactions(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"U1": {Id: "U1", Username: "alice"},
+		"U2": {Id: "U2", Username: "bob"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {{User: "U1", Text: "shipped", TimeStamp: "1695219800.000000", Type: "message", Reactions: []*SlackReaction{
+				{Name: "\U0001F44D", Users: []string{"U1"}, Count: 1},
+				// the same emoji by name isn't imported twice for the same user
+				{Name: "+1", Users: []string{"U1", "U2"}, Count: 2},
+				// variation selectors and skin tones
+				{Name: "\u2764\uFE0F", Users: []string{"U2"}, Count: 1},
+				{Name: "\U0001F44D\U0001F3FD", Users: []string{"U2"}, Count: 1},
+				// unknown emoji are kept as they are
+				{Name: "\u2603x", Users: []string{"U2"}, Count: 1},
+			}}},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	require.Len(t, slackTransformer.Intermediate.Posts, 1)
+	post := slackTransformer.Intermediate.Posts[0]
+	assert.Equal(t, []*IntermediateReaction{
+		{User: "alice", EmojiName: "+1", CreateAt: post.CreateAt},
+		{User: "bob", EmojiName: "+1", CreateAt: post.CreateAt},
+		{User: "bob", EmojiName: "heart", CreateAt: post.CreateAt},
+		{User: "bob", EmojiName: "+1_medium_skin_tone", CreateAt: post.CreateAt},
+		{User: "bob", EmojiName: "\u2603x", CreateAt: post.CreateAt},
+	}, post.Reactions)
+}
+
+func TestTransformPostsCreateAtOffset(t *testing.T) {
+	transform := func(offset time.Duration) []*IntermediatePost {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.PostCreateAtOffset = offset
+		slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+			"U1": {Id: "U1", Username: "alice"},
+			"U2": {Id: "U2", Username: "bob"},
+		}
+		slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+		slackExport := &SlackExport{
+			Posts: map[string][]SlackPost{
+				"channel1": {
+					{User: "U1", Text: "root", TimeStamp: "1577836800.000000", Type: "message", ThreadTS: "1577836800.000000", Reactions: []*SlackReaction{{Name: "eyes", Users: []string{"U2"}, Count: 1}}},
+					{User: "U2", Text: "reply", TimeStamp: "1577836801.000000", Type: "message", ThreadTS: "1577836800.000000"},
+					// both posts have the same millisecond, so one of them is moved
+					{User: "U1", Text: "first", TimeStamp: "1577836900.000100", Type: "message"},
+					{User: "U2", Text: "second", TimeStamp: "1577836900.000200", Type: "message"},
+				},
+			},
+		}
+		require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+		return slackTransformer.Intermediate.Posts
+	}
+
+	original := transform(0)
+	offset := 3 * 365 * 24 * time.Hour
+	shifted := transform(offset)
+
+	require.Len(t, shifted, len(original))
+	for i, post := range shifted {
+		assert.Equal(t, original[i].Message, post.Message)
+		assert.Equal(t, original[i].CreateAt+offset.Milliseconds(), post.CreateAt)
+		require.Len(t, post.Replies, len(original[i].Replies))
+		for j, reply := range post.Replies {
+			assert.Equal(t, original[i].Replies[j].Message, reply.Message)
+			assert.Equal(t, original[i].Replies[j].CreateAt+offset.Milliseconds(), reply.CreateAt)
+		}
+		require.Len(t, post.Reactions, len(original[i].Reactions))
+		for j, reaction := range post.Reactions {
+			assert.Equal(t, original[i].Reactions[j].CreateAt+offset.Milliseconds(), reaction.CreateAt)
+		}
+	}
+	assert.Equal(t, []string{"root", "first", "second"}, []string{shifted[0].Message, shifted[1].Message, shifted[2].Message})
+	assert.Less(t, shifted[1].CreateAt, shifted[2].CreateAt)
+
+	// a negative offset moves the history earlier
+	earlier := transform(-24 * time.Hour)
+	assert.Equal(t, original[0].CreateAt-(24*time.Hour).Milliseconds(), earlier[0].CreateAt)
+
+	// call times move along with the posts
+	calls := []*IntermediatePost{{CreateAt: 1000, Props: model.StringInterface{"start_at": float64(1000), "end_at": float64(2000)}}}
+	ShiftPostTimestamps(calls, 500)
+	assert.Equal(t, int64(1500), calls[0].CreateAt)
+	assert.Equal(t, model.StringInterface{"start_at": float64(1500), "end_at": float64(2500)}, calls[0].Props)
+}
+
+func TestTransformDirectChannelsMode(t *testing.T) {
+	slackExport := func() *SlackExport {
+		return &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+				{Id: "U2", Username: "bob.smith", Profile: SlackProfile{Email: "bob@example.com"}},
+				{Id: "U3", Username: "carol", Profile: SlackProfile{Email: "carol@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Members: []string{"U1", "U2", "U3"}, Type: model.ChannelTypeOpen},
+			},
+			GroupChannels: []SlackChannel{
+				{Id: "G1", Name: "mpdm-alice--bob.smith--carol-1", Members: []string{"U1", "U2", "U3"}, Type: model.ChannelTypeGroup},
+			},
+			DirectChannels: []SlackChannel{
+				{Id: "D1", Members: []string{"U2", "U1"}, Type: model.ChannelTypeDirect},
+				{Id: "D2", Members: []string{"U1", "U3"}, Type: model.ChannelTypeDirect},
+			},
+			Posts: map[string][]SlackPost{
+				"general":                        {{User: "U1", Text: "public", TimeStamp: "1695219800.000000", Type: "message"}},
+				"mpdm-alice--bob.smith--carol-1": {{User: "U3", Text: "group", TimeStamp: "1695219810.000000", Type: "message"}},
+				"D1":                             {{User: "U2", Text: "direct", TimeStamp: "1695219820.000000", Type: "message"}},
+			},
+		}
+	}
+
+	t.Run("archive", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.ArchiveDirectChannels = true
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		assert.Empty(t, slackTransformer.Intermediate.GroupChannels)
+		assert.Empty(t, slackTransformer.Intermediate.DirectChannels)
+		require.Len(t, slackTransformer.Intermediate.PrivateChannels, 3)
+
+		group := slackTransformer.Intermediate.PrivateChannels[0]
+		assert.Equal(t, "dm-alice-bob-smith-carol", group.Name)
+		assert.Equal(t, "DM: alice, bob.smith, carol", group.DisplayName)
+		assert.Equal(t, "Group messages between @alice, @bob.smith and @carol", group.Header)
+		assert.Equal(t, model.ChannelTypePrivate, group.Type)
+
+		direct := slackTransformer.Intermediate.PrivateChannels[1]
+		assert.Equal(t, "dm-alice-bob-smith", direct.Name)
+		assert.Equal(t, "Direct messages between @alice and @bob.smith", direct.Header)
+		assert.Equal(t, "dm-alice-carol", slackTransformer.Intermediate.PrivateChannels[2].Name)
+
+		// only the members of the conversation can see the channel
+		assert.Equal(t, []string{"general", "dm-alice-bob-smith-carol", "dm-alice-bob-smith", "dm-alice-carol"}, slackTransformer.Intermediate.UsersById["U1"].Memberships)
+		assert.Equal(t, []string{"general", "dm-alice-bob-smith-carol", "dm-alice-carol"}, slackTransformer.Intermediate.UsersById["U3"].Memberships)
+
+		channels := map[string]string{}
+		for _, post := range slackTransformer.Intermediate.Posts {
+			assert.False(t, post.IsDirect)
+			channels[post.Message] = post.Channel
+		}
+		assert.Equal(t, map[string]string{"public": "general", "group": "dm-alice-bob-smith-carol", "direct": "dm-alice-bob-smith"}, channels)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+		slackTransformer.Options.SkipDirectChannels = true
+		require.NoError(t, slackTransformer.Transform(slackExport(), "", true, false, false, false, ""))
+
+		assert.Empty(t, slackTransformer.Intermediate.GroupChannels)
+		assert.Empty(t, slackTransformer.Intermediate.DirectChannels)
+		assert.Empty(t, slackTransformer.Intermediate.PrivateChannels)
+		require.Len(t, slackTransformer.Intermediate.Posts, 1)
+		assert.Equal(t, "public", slackTransformer.Intermediate.Posts[0].Message)
+	})
+}
+
+func TestTransformPostsReactionUsersLimit(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.ReactionUsersLimit = 3
+	users := []string{}
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{}
+	for i := 1; i <= 10; i++ {
+		id := fmt.Sprintf("U%d", i)
+		users = append(users, id)
+		slackTransformer.Intermediate.UsersById[id] = &IntermediateUser{Id: id, Username: fmt.Sprintf("user%d", i)}
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1"}}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"channel1": {
+				{User: "U1", Text: "popular", TimeStamp: "1695219800.000000", Type: "message", Reactions: []*SlackReaction{
+					{Name: "tada", Users: users, Count: 10},
+					// Slack lists only some of the users of popular reactions
+					{Name: "+1", Users: users[:5], Count: 250},
+					{Name: "eyes", Users: users[:3], Count: 3},
+				}},
+				{User: "U1", Text: "quiet", TimeStamp: "1695219810.000000", Type: "message", Reactions: []*SlackReaction{
+					{Name: "eyes", Users: users[:2], Count: 2},
+				}},
+			},
+		},
+	}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 2)
+
+	emojis := map[string]int{}
+	for _, reaction := range posts[0].Reactions {
+		emojis[reaction.EmojiName]++
+	}
+	assert.Equal(t, map[string]int{"tada": 3, "+1": 3, "eyes": 3}, emojis)
+	assert.Equal(t, "popular\n\n_Reactions in Slack: :tada: 10, :+1: 250. Only the first 3 users of each were imported._", posts[0].Message)
+
+	assert.Len(t, posts[1].Reactions, 2)
+	assert.Equal(t, "quiet", posts[1].Message)
+}
+
+func TestTransformPostsThreadReplyLimit(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.ThreadReplyLimit = 3
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"U1": {Id: "U1", Username: "user1"},
+		"U2": {Id: "U2", Username: "user2"},
+	}
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{{Name: "channel1", OriginalName: "channel1", Type: model.ChannelTypeOpen}}
+
+	posts := []SlackPost{
+		{User: "U1", Text: "megathread", TimeStamp: "1695219800.000000", ThreadTS: "1695219800.000000", Type: "message"},
+		{User: "U1", Text: "small thread", TimeStamp: "1695219900.000000", ThreadTS: "1695219900.000000", Type: "message"},
+		{User: "U2", Text: "only reply", TimeStamp: "1695219910.000000", ThreadTS: "1695219900.000000", Type: "message"},
+	}
+	// the replies are listed out of order, and the earliest are kept
+	for i := 10; i >= 1; i-- {
+		posts = append(posts, SlackPost{User: "U2", Text: fmt.Sprintf("reply %d", i), TimeStamp: fmt.Sprintf("16952198%02d.000000", i), ThreadTS: "1695219800.000000", Type: "message"})
+	}
+	slackExport := &SlackExport{Posts: map[string][]SlackPost{"channel1": posts}}
+
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	result := slackTransformer.Intermediate.Posts
+	require.Len(t, result, 2)
+
+	replies := result[0].Replies
+	require.Len(t, replies, 4)
+	for i, reply := range replies[:3] {
+		assert.Equal(t, fmt.Sprintf("reply %d", i+1), reply.Message)
+	}
+	note := replies[3]
+	assert.Equal(t, "_...and 7 more replies in Slack that were not imported._", note.Message)
+	assert.Equal(t, strings.ToLower(appUserID), note.User)
+	assert.Equal(t, "channel1", note.Channel)
+	assert.Greater(t, note.CreateAt, replies[2].CreateAt)
+
+	require.Len(t, result[1].Replies, 1)
+	assert.Equal(t, "only reply", result[1].Replies[0].Message)
+}
+
+func TestTransformBotMessageBlocks(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json":    `[{"id": "U1", "name": "user1", "profile": {"email": "user1@example.com"}}]`,
+		"general/2020-01-01.json": `[
+			{"bot_id": "B1", "text": "", "ts": "1577836800.000000", "type": "message", "subtype": "bot_message",
+				"blocks": [
+					{"type": "header", "text": {"type": "plain_text", "text": "Deploy finished"}},
+					{"type": "section", "text": {"type": "mrkdwn", "text": "Deployed by <@U1>, see <https://ci.example.com/1|the logs>"},
+						"fields": [{"type": "mrkdwn", "text": "*Env:* prod"}]},
+					{"type": "divider"},
+					{"type": "context", "elements": [{"type": "mrkdwn", "text": "took 3m"}, {"type": "image", "image_url": "https://example.com/i.png", "alt_text": "icon"}]},
+					{"type": "rich_text", "elements": [
+						{"type": "rich_text_section", "elements": [{"type": "text", "text": "Changes "}, {"type": "emoji", "name": "rocket"}]},
+						{"type": "rich_text_list", "elements": [
+							{"type": "rich_text_section", "elements": [{"type": "text", "text": "first"}]},
+							{"type": "rich_text_section", "elements": [{"type": "link", "url": "https://example.com/2", "text": "second"}]}
+						]}
+					]}
+				],
+				"attachments": [{"fallback": "build 1", "color": "good", "text": "build 1"}]},
+			{"bot_id": "B1", "text": "fallback text", "ts": "1577836801.000000", "type": "message", "subtype": "bot_message",
+				"blocks": [{"type": "section", "text": {"type": "mrkdwn", "text": "block text"}}]}
+		]`,
+	}
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackExport, err := slackTransformer.ParseSlackExportFile(createZipReader(t, files), false)
+	require.NoError(t, err)
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 2)
+	assert.Equal(t, "**Deploy finished**\n"+
+		"Deployed by @user1, see [the logs](https://ci.example.com/1)\n**Env:** prod\n"+
+		"took 3m\n"+
+		"Changes :rocket:\n- first\n- [second](https://example.com/2)", posts[0].Message)
+	require.NotNil(t, posts[0].Props)
+	attachments, ok := posts[0].Props["attachments"].([]*model.SlackAttachment)
+	require.True(t, ok)
+	require.Len(t, attachments, 1)
+	assert.Equal(t, "build 1", attachments[0].Fallback)
+
+	// the text of the message takes precedence over its blocks
+	assert.Equal(t, "fallback text", posts[1].Message)
+}
+
+func TestTransformPostsEmojiAliasReactions(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1", "U2"]}]`,
+		"users.json": `[
+			{"id": "U1", "name": "alice", "profile": {"email": "alice@example.com"}},
+			{"id": "U2", "name": "bob", "profile": {"email": "bob@example.com"}}
+		]`,
+		"emoji.json": `{"ok": true, "emoji": {
+			"yay": "alias:tada",
+			"woohoo": "alias:yay",
+			"partyparrot": "https://emoji.slack-edge.com/T1/partyparrot/1.gif",
+			"parrot": "alias:partyparrot"
+		}}`,
+		"general/2020-01-01.json": `[{"user": "U1", "text": "shipped", "ts": "1577836800.000000", "type": "message", "reactions": [
+			{"name": "yay", "users": ["U1"], "count": 1},
+			{"name": "woohoo", "users": ["U2"], "count": 1},
+			{"name": "tada", "users": ["U1"], "count": 1},
+			{"name": "parrot", "users": ["U2"], "count": 1}
+		]}]`,
+	}
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackExport, err := slackTransformer.ParseSlackExportFile(createZipReader(t, files), false)
+	require.NoError(t, err)
+	require.Len(t, slackExport.Emoji, 4)
+	require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+	require.Len(t, slackTransformer.Intermediate.Posts, 1)
+	post := slackTransformer.Intermediate.Posts[0]
+	assert.Equal(t, []*IntermediateReaction{
+		{User: "alice", EmojiName: "tada", CreateAt: post.CreateAt},
+		{User: "bob", EmojiName: "tada", CreateAt: post.CreateAt},
+		// aliases of other custom emoji are kept as they are
+		{User: "bob", EmojiName: "parrot", CreateAt: post.CreateAt},
+	}, post.Reactions)
+}
+
+func TestTransformAttachmentsSizeLimit(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json":    `[{"id": "U1", "name": "user1", "profile": {"email": "user1@example.com"}}]`,
+		"general/2020-01-01.json": `[
+			{"user": "U1", "text": "first", "ts": "1577836800.000000", "type": "message", "subtype": "file_share",
+				"files": [{"id": "F1", "name": "one.txt", "permalink": "https://example.slack.com/files/F1"}]},
+			{"user": "U1", "text": "second", "ts": "1577836801.000000", "type": "message", "subtype": "file_share",
+				"files": [{"id": "F2", "name": "two.txt", "permalink": "https://example.slack.com/files/F2"}]},
+			{"user": "U1", "text": "third", "ts": "1577836802.000000", "type": "message", "subtype": "file_share",
+				"files": [{"id": "F3", "name": "three.txt", "permalink": "https://example.slack.com/files/F3"}]},
+			{"user": "U1", "text": "shared again", "ts": "1577836803.000000", "type": "message", "subtype": "file_share",
+				"files": [{"id": "F1", "name": "one.txt", "permalink": "https://example.slack.com/files/F1"}]}
+		]`,
+		"__uploads/F1/one.txt":   strings.Repeat("1", 10),
+		"__uploads/F2/two.txt":   strings.Repeat("2", 10),
+		"__uploads/F3/three.txt": strings.Repeat("3", 10),
+	}
+
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.AttachmentsSizeLimit = 25
+	slackTransformer.Options.IncludeFileURLs = true
+
+	slackExport, err := slackTransformer.ParseSlackExportFile(createZipReader(t, files), false)
+	require.NoError(t, err)
+
+	attachmentsDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(attachmentsDir, "bulk-export-attachments"), 0755))
+	require.NoError(t, slackTransformer.Transform(slackExport, attachmentsDir, false, false, false, false, ""))
+
+	posts := slackTransformer.Intermediate.Posts
+	require.Len(t, posts, 4)
+	assert.Equal(t, []string{"bulk-export-attachments/F1_one.txt"}, posts[0].Attachments)
+	assert.Equal(t, []string{"bulk-export-attachments/F2_two.txt"}, posts[1].Attachments)
+	// the third file doesn't fit and is linked instead
+	assert.Empty(t, posts[2].Attachments)
+	assert.Equal(t, "third\n[three.txt](https://example.slack.com/files/F3)", posts[2].Message)
+	// files shared again are only counted once
+	assert.Equal(t, []string{"bulk-export-attachments/F1_one.txt"}, posts[3].Attachments)
+
+	skipped := slackTransformer.SkippedAttachments()
+	require.Equal(t, []SkippedAttachment{
+		{FileId: "F3", Name: "three.txt", Size: 10, Channel: "general", CreateAt: 1577836802000},
+	}, skipped)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteSkippedAttachmentsReport(buf, skipped))
+	assert.Equal(t, "file_id,name,size,channel,create_at\nF3,three.txt,10,general,1577836802000\n", buf.String())
 }
@@ -0,0 +1,211 @@
+package slack
+
+import (
+	"archive/zip"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// MergeSlackExports combines several exports of the same organization,
+// such as the exports of consecutive time periods, into a single one:
+//
+//   - Users are deduplicated by id and by email, keeping the first one,
+//     and every reference to the duplicates, from their posts, replies,
+//     reactions, mentions, calls, channels and user groups, is moved to
+//     the user kept.
+//   - Channels are deduplicated by the folder of their posts, keeping the
+//     first one with the members of all of them.
+//   - The posts of each channel are deduplicated by timestamp and by
+//     client_msg_id, as overlapping periods include the same messages.
+//
+// The other files are concatenated, and the first export wins for the
+// workspace, emoji and uploads that several exports have. The exports are
+// expected to be parsed without converting their posts, which are
+// converted with ConvertSlackExportPosts once merged, as the mentions of
+// the duplicates would otherwise carry their username.
+func (t *Transformer) MergeSlackExports(exports []*SlackExport) *SlackExport {
+	merged := &SlackExport{
+		Posts:   map[string][]SlackPost{},
+		Uploads: map[string]*zip.File{},
+		Emoji:   map[string]string{},
+	}
+	if len(exports) > 0 {
+		merged.TeamName = exports[0].TeamName
+	}
+
+	// id of the user kept for each duplicated user
+	userIds := map[string]string{}
+	usersByEmail := map[string]string{}
+	for _, export := range exports {
+		for _, user := range export.Users {
+			if _, ok := userIds[user.Id]; ok {
+				continue
+			}
+			email := strings.ToLower(strings.TrimSpace(user.Profile.Email))
+			if kept, ok := usersByEmail[email]; ok && email != "" {
+				t.Logger.Infof("Merging the user %s into the user %s as they have the same email %s", user.Id, kept, email)
+				userIds[user.Id] = kept
+				continue
+			}
+			userIds[user.Id] = user.Id
+			if email != "" {
+				usersByEmail[email] = user.Id
+			}
+			merged.Users = append(merged.Users, user)
+		}
+	}
+	userId := func(id string) string {
+		if kept, ok := userIds[id]; ok {
+			return kept
+		}
+		return id
+	}
+	userIdList := func(ids []string) []string {
+		if ids == nil {
+			return nil
+		}
+		result := []string{}
+		for _, id := range ids {
+			if id = userId(id); !slices.Contains(result, id) {
+				result = append(result, id)
+			}
+		}
+		return result
+	}
+
+	mergeChannels := func(lists func(*SlackExport) []SlackChannel) []SlackChannel {
+		result := []SlackChannel{}
+		byName := map[string]int{}
+		for _, export := range exports {
+			for _, channel := range lists(export) {
+				channel.Creator = userId(channel.Creator)
+				name := getOriginalName(channel)
+				if i, ok := byName[name]; ok {
+					result[i].Members = userIdList(append(slices.Clone(result[i].Members), channel.Members...))
+					continue
+				}
+				channel.Members = userIdList(channel.Members)
+				byName[name] = len(result)
+				result = append(result, channel)
+			}
+		}
+		return result
+	}
+	merged.PublicChannels = mergeChannels(func(e *SlackExport) []SlackChannel { return e.PublicChannels })
+	merged.PrivateChannels = mergeChannels(func(e *SlackExport) []SlackChannel { return e.PrivateChannels })
+	merged.GroupChannels = mergeChannels(func(e *SlackExport) []SlackChannel { return e.GroupChannels })
+	merged.DirectChannels = mergeChannels(func(e *SlackExport) []SlackChannel { return e.DirectChannels })
+	for _, channels := range [][]SlackChannel{merged.PublicChannels, merged.PrivateChannels, merged.GroupChannels, merged.DirectChannels} {
+		merged.Channels = append(merged.Channels, channels...)
+	}
+
+	duplicated := 0
+	for _, export := range exports {
+		for channelName, posts := range export.Posts {
+			seen := map[string]bool{}
+			for _, post := range merged.Posts[channelName] {
+				seen["ts:"+post.TimeStamp] = true
+				if post.ClientMsgId != "" {
+					seen["client_msg_id:"+post.ClientMsgId] = true
+				}
+			}
+			for _, post := range posts {
+				if seen["ts:"+post.TimeStamp] || (post.ClientMsgId != "" && seen["client_msg_id:"+post.ClientMsgId]) {
+					duplicated++
+					continue
+				}
+				seen["ts:"+post.TimeStamp] = true
+				if post.ClientMsgId != "" {
+					seen["client_msg_id:"+post.ClientMsgId] = true
+				}
+
+				merged.Posts[channelName] = append(merged.Posts[channelName], remapPostUsers(post, userId, userIdList))
+			}
+		}
+
+		if merged.Workspace == nil {
+			merged.Workspace = export.Workspace
+		}
+		for _, userGroup := range export.UserGroups {
+			userGroup.Users = userIdList(userGroup.Users)
+			merged.UserGroups = append(merged.UserGroups, userGroup)
+		}
+		merged.Sections = append(merged.Sections, export.Sections...)
+		merged.IntegrationLogs = append(merged.IntegrationLogs, export.IntegrationLogs...)
+		merged.CorruptFiles = append(merged.CorruptFiles, export.CorruptFiles...)
+		for id, file := range export.Uploads {
+			if _, ok := merged.Uploads[id]; !ok {
+				merged.Uploads[id] = file
+			}
+		}
+		for name, value := range export.Emoji {
+			if _, ok := merged.Emoji[name]; !ok {
+				merged.Emoji[name] = value
+			}
+		}
+	}
+	if duplicated > 0 {
+		t.Logger.Infof("Skipped %d posts present in several of the merged exports", duplicated)
+	}
+
+	t.Logger.Infof("Merged %d exports into %d users, %d channels and the posts of %d channels", len(exports), len(merged.Users), len(merged.Channels), len(merged.Posts))
+	return merged
+}
+
+// userMentionIdRegexp matches the mentions of users in posts that weren't
+// converted yet, with the id of the user and the optional label.
+var userMentionIdRegexp = regexp.MustCompile(`<@([A-Z0-9]+)(\|[^>]*)?>`)
+
+// remapPostUsers returns a copy of a post whose user references go
+// through userId, and userIdList for the lists of users. The mentions of
+// remapped users lose their label, which is the username of the
+// duplicate, so they are converted to the username of the user kept.
+func remapPostUsers(post SlackPost, userId func(string) string, userIdList func([]string) []string) SlackPost {
+	post.User = userId(post.User)
+	if post.Comment != nil {
+		comment := *post.Comment
+		comment.User = userId(comment.User)
+		post.Comment = &comment
+	}
+	post.ReplyUsers = userIdList(post.ReplyUsers)
+	post.PinnedTo = userIdList(post.PinnedTo)
+	if post.Room != nil {
+		room := *post.Room
+		room.CreatedBy = userId(room.CreatedBy)
+		room.Participants = userIdList(room.Participants)
+		room.ParticipantHistory = userIdList(room.ParticipantHistory)
+		post.Room = &room
+	}
+
+	reactions := make([]*SlackReaction, 0, len(post.Reactions))
+	for _, reaction := range post.Reactions {
+		reaction := *reaction
+		reaction.Users = userIdList(reaction.Users)
+		reactions = append(reactions, &reaction)
+	}
+	post.Reactions = reactions
+
+	remapMentions := func(text string) string {
+		return userMentionIdRegexp.ReplaceAllStringFunc(text, func(mention string) string {
+			id := userMentionIdRegexp.FindStringSubmatch(mention)[1]
+			if kept := userId(id); kept != id {
+				return "<@" + kept + ">"
+			}
+			return mention
+		})
+	}
+	post.Text = remapMentions(post.Text)
+	if post.Attachments != nil {
+		attachments := make([]*model.SlackAttachment, 0, len(post.Attachments))
+		for _, attachment := range post.Attachments {
+			attachment := *attachment
+			attachment.Fallback = remapMentions(attachment.Fallback)
+			attachments = append(attachments, &attachment)
+		}
+		post.Attachments = attachments
+	}
+	return post
+}
@@ -0,0 +1,129 @@
+package slack
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeSlackExports(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+
+	january, err := slackTransformer.ParseSlackExportFile(createZipReader(t, map[string]string{
+		"users.json": `[
+			{"id": "U1", "name": "alice", "profile": {"email": "alice@example.com"}},
+			{"id": "U2", "name": "bob", "profile": {"email": "bob@example.com"}}
+		]`,
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1", "U2"]}]`,
+		"general/2020-01-31.json": `[
+			{"type": "message", "user": "U1", "text": "end of january", "ts": "1580428800.000000", "client_msg_id": "m1"},
+			{"type": "message", "user": "U2", "text": "overlap", "ts": "1580515200.000000", "client_msg_id": "m2", "reactions": [{"name": "eyes", "users": ["U1"], "count": 1}]}
+		]`,
+	}), true)
+	require.NoError(t, err)
+
+	// the second export overlaps with the first one, and bob has a new id
+	// with the same email, as in an export of another workspace
+	february, err := slackTransformer.ParseSlackExportFile(createZipReader(t, map[string]string{
+		"users.json": `[
+			{"id": "U1", "name": "alice", "profile": {"email": "alice@example.com"}},
+			{"id": "U9", "name": "bob", "profile": {"email": "Bob@example.com"}},
+			{"id": "U3", "name": "carol", "profile": {"email": "carol@example.com"}}
+		]`,
+		"channels.json": `[
+			{"id": "C1", "name": "general", "members": ["U1", "U9", "U3"]},
+			{"id": "C2", "name": "random", "members": ["U3"]}
+		]`,
+		"general/2020-02-01.json": `[
+			{"type": "message", "user": "U9", "text": "overlap", "ts": "1580515200.000000", "client_msg_id": "m2"},
+			{"type": "message", "user": "U9", "text": "edited overlap", "ts": "1580515200.000100", "client_msg_id": "m2"},
+			{"type": "message", "user": "U9", "text": "february", "ts": "1580601600.000000", "client_msg_id": "m3", "reactions": [{"name": "tada", "users": ["U9", "U2"], "count": 2}]}
+		]`,
+		"random/2020-02-02.json": `[{"type": "message", "user": "U3", "text": "hi", "ts": "1580688000.000000"}]`,
+	}), true)
+	require.NoError(t, err)
+
+	merged := slackTransformer.MergeSlackExports([]*SlackExport{january, february})
+
+	userIds := []string{}
+	for _, user := range merged.Users {
+		userIds = append(userIds, user.Id)
+	}
+	assert.Equal(t, []string{"U1", "U2", "U3"}, userIds)
+
+	require.Len(t, merged.PublicChannels, 2)
+	assert.Equal(t, []string{"U1", "U2", "U3"}, merged.PublicChannels[0].Members)
+	assert.Equal(t, "random", merged.PublicChannels[1].Name)
+	assert.Len(t, merged.Channels, 2)
+
+	general := merged.Posts["general"]
+	texts := []string{}
+	for _, post := range general {
+		texts = append(texts, post.Text)
+		assert.Contains(t, []string{"U1", "U2"}, post.User)
+	}
+	assert.Equal(t, []string{"end of january", "overlap", "february"}, texts)
+	assert.Equal(t, []string{"U2"}, general[2].Reactions[0].Users)
+	assert.Len(t, merged.Posts["random"], 1)
+
+	require.NoError(t, slackTransformer.Transform(merged, "", true, false, false, false, ""))
+	assert.Len(t, slackTransformer.Intermediate.UsersById, 3)
+	assert.Len(t, slackTransformer.Intermediate.Posts, 4)
+}
+
+func TestMergeSlackExportsUserReferences(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+
+	january, err := slackTransformer.ParseSlackExportFile(createZipReader(t, map[string]string{
+		"users.json":              `[{"id": "U1", "name": "alice", "profile": {"email": "alice@example.com"}}, {"id": "U2", "name": "bob", "profile": {"email": "bob@example.com"}}]`,
+		"channels.json":           `[{"id": "C1", "name": "general", "members": ["U1", "U2"]}]`,
+		"general/2020-01-31.json": `[{"type": "message", "user": "U1", "text": "hi", "ts": "1580428800.000000"}]`,
+	}), true)
+	require.NoError(t, err)
+
+	// bob has another id and username in the second export
+	february, err := slackTransformer.ParseSlackExportFile(createZipReader(t, map[string]string{
+		"users.json":      `[{"id": "U1", "name": "alice", "profile": {"email": "alice@example.com"}}, {"id": "U9", "name": "bobby", "profile": {"email": "bob@example.com"}}]`,
+		"channels.json":   `[{"id": "C1", "name": "general", "members": ["U1", "U9"]}]`,
+		"usergroups.json": `[{"id": "S1", "name": "Team", "handle": "team", "users": ["U1", "U9"]}]`,
+		"general/2020-02-01.json": `[
+			{"type": "message", "user": "U1", "text": "thanks <@U9|bobby>, cc <@U1>", "ts": "1580515200.000000", "reply_users": ["U9"], "pinned_to": ["C1"],
+				"attachments": [{"fallback": "for <@U9>"}]},
+			{"type": "message", "subtype": "file_comment", "comment": {"user": "U9", "comment": "nice"}, "ts": "1580515300.000000"},
+			{"type": "message", "subtype": "huddle_thread", "user": "USLACKBOT", "ts": "1580515400.000000",
+				"room": {"created_by": "U9", "participants": ["U1", "U9"], "participant_history": ["U9"]}}
+		]`,
+	}), true)
+	require.NoError(t, err)
+
+	merged := slackTransformer.MergeSlackExports([]*SlackExport{january, february})
+	posts := merged.Posts["general"]
+	require.Len(t, posts, 4)
+
+	assert.Equal(t, "thanks <@U2>, cc <@U1>", posts[1].Text)
+	assert.Equal(t, "for <@U2>", posts[1].Attachments[0].Fallback)
+	assert.Equal(t, []string{"U2"}, posts[1].ReplyUsers)
+	assert.Equal(t, []string{"C1"}, posts[1].PinnedTo)
+	assert.Equal(t, "U2", posts[2].Comment.User)
+	assert.Equal(t, "U2", posts[3].Room.CreatedBy)
+	assert.Equal(t, []string{"U1", "U2"}, posts[3].Room.Participants)
+	assert.Equal(t, []string{"U2"}, posts[3].Room.ParticipantHistory)
+	assert.Equal(t, []string{"U1", "U2"}, merged.UserGroups[0].Users)
+
+	// the exports aren't changed by the merge
+	assert.Equal(t, "U9", february.Posts["general"][1].Comment.User)
+	assert.Equal(t, "for <@U9>", february.Posts["general"][0].Attachments[0].Fallback)
+
+	// once converted, the mentions point to the user kept
+	slackTransformer.ConvertSlackExportPosts(merged)
+	assert.Equal(t, "thanks @bob, cc @alice", merged.Posts["general"][1].Text)
+	assert.Equal(t, "for @bob", merged.Posts["general"][1].Attachments[0].Fallback)
+
+	require.NoError(t, slackTransformer.Transform(merged, "", true, false, false, false, ""))
+	assert.Len(t, slackTransformer.Intermediate.UsersById, 2)
+	for _, post := range slackTransformer.Intermediate.Posts {
+		assert.Contains(t, []string{"alice", "bob"}, post.User, post.Message)
+	}
+}
@@ -2,6 +2,7 @@ package slack
 
 import (
 	"archive/zip"
+	"encoding/csv"
 	"encoding/json"
 	"io"
 	"os"
@@ -14,39 +15,175 @@ import (
 )
 
 type SlackChannel struct {
-	Id      string          `json:"id"`
-	Name    string          `json:"name"`
-	Creator string          `json:"creator"`
-	Members []string        `json:"members"`
-	Purpose SlackChannelSub `json:"purpose"`
-	Topic   SlackChannelSub `json:"topic"`
-	Type    model.ChannelType
+	Id         string                  `json:"id"`
+	Name       string                  `json:"name"`
+	Creator    string                  `json:"creator"`
+	Members    []string                `json:"members"`
+	Purpose    SlackChannelSub         `json:"purpose"`
+	Topic      SlackChannelSub         `json:"topic"`
+	IsMpim     bool                    `json:"is_mpim"`
+	Created    int64                   `json:"created"`
+	Properties *SlackChannelProperties `json:"properties"`
+	Type       model.ChannelType
+	// SharedTeamIds are the workspaces of an Enterprise Grid export the
+	// channel is shared with.
+	SharedTeamIds []string `json:"shared_team_ids"`
 }
 
 type SlackChannelSub struct {
 	Value string `json:"value"`
 }
 
+// SlackChannelProperties holds the canvas of a channel and its tabs,
+// which can link to other canvases and lists.
+type SlackChannelProperties struct {
+	Canvas *SlackChannelCanvas `json:"canvas"`
+	Tabs   []SlackChannelTab   `json:"tabs"`
+}
+
+type SlackChannelCanvas struct {
+	FileId  string `json:"file_id"`
+	IsEmpty bool   `json:"is_empty"`
+}
+
+type SlackChannelTab struct {
+	Type  string              `json:"type"`
+	Label string              `json:"label"`
+	Data  SlackChannelTabData `json:"data"`
+}
+
+type SlackChannelTabData struct {
+	FileId string `json:"file_id"`
+}
+
 type SlackProfile struct {
-	BotID    string `json:"bot_id"`
-	RealName string `json:"real_name"`
-	Email    string `json:"email"`
-	Title    string `json:"title"`
+	BotID       string `json:"bot_id"`
+	RealName    string `json:"real_name"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Title       string `json:"title"`
 }
 
 type SlackUser struct {
 	Id       string       `json:"id"`
+	TeamId   string       `json:"team_id"`
 	Username string       `json:"name"`
 	IsBot    bool         `json:"is_bot"`
 	Profile  SlackProfile `json:"profile"`
 	Deleted  bool         `json:"deleted"`
 }
 
+type SlackUserGroup struct {
+	Id     string   `json:"id"`
+	Name   string   `json:"name"`
+	Handle string   `json:"handle"`
+	Users  []string `json:"users"`
+}
+
+// SlackWorkspace is the workspace metadata that some exports include in a
+// team.json or workspace.json file.
+type SlackWorkspace struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+}
+
+// SlackSection is a sidebar section that groups channels for a user.
+// Slack uses the "stars" type for the starred section.
+type SlackSection struct {
+	Id         string   `json:"channel_section_id"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	User       string   `json:"user"`
+	ChannelIds []string `json:"channel_ids"`
+}
+
+// SlackIntegrationLog is an entry of integration_logs.json, which records
+// the apps and integrations installed in the workspace.
+type SlackIntegrationLog struct {
+	BotId       string `json:"bot_id"`
+	AppId       string `json:"app_id"`
+	AppType     string `json:"app_type"`
+	ServiceId   string `json:"service_id"`
+	ServiceType string `json:"service_type"`
+	ChangeType  string `json:"change_type"`
+}
+
+// Name returns the name of the app or integration of the entry.
+func (l *SlackIntegrationLog) Name() string {
+	if l.ServiceType != "" {
+		return l.ServiceType
+	}
+	return l.AppType
+}
+
 type SlackFile struct {
 	Id          string `json:"id"`
 	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Mimetype    string `json:"mimetype"`
 	Size        int64  `json:"size"`
 	DownloadURL string `json:"url_private_download"`
+	Permalink   string `json:"permalink"`
+	Thumb1024   string `json:"thumb_1024"`
+	Thumb720    string `json:"thumb_720"`
+	Thumb480    string `json:"thumb_480"`
+	Thumb360    string `json:"thumb_360"`
+	// external files, such as Google Drive documents, are only linked
+	// from Slack and have no content to download
+	External     bool   `json:"is_external"`
+	ExternalType string `json:"external_type"`
+	ExternalURL  string `json:"external_url"`
+	URLPrivate   string `json:"url_private"`
+}
+
+// IsExternal reports whether a file is hosted by another service, such as
+// Google Drive or Dropbox.
+func (f *SlackFile) IsExternal() bool {
+	return f.External || f.ExternalType != ""
+}
+
+// ThumbnailURL returns the URL of the largest thumbnail of an image file,
+// or an empty string if it has none.
+func (f *SlackFile) ThumbnailURL() string {
+	if !strings.HasPrefix(f.Mimetype, "image/") {
+		return ""
+	}
+
+	for _, thumbnail := range []string{f.Thumb1024, f.Thumb720, f.Thumb480, f.Thumb360} {
+		if thumbnail != "" {
+			return thumbnail
+		}
+	}
+	return ""
+}
+
+// SlackBlock is a block-kit block of a message. Only the fields of the
+// image blocks are parsed.
+type SlackBlock struct {
+	Type     string               `json:"type"`
+	ImageURL string               `json:"image_url"`
+	AltText  string               `json:"alt_text"`
+	Title    *SlackBlockText      `json:"title"`
+	Text     *SlackBlockText      `json:"text"`
+	Fields   []*SlackBlockText    `json:"fields"`
+	Elements []*SlackBlockElement `json:"elements"`
+}
+
+type SlackBlockText struct {
+	Text string `json:"text"`
+}
+
+// SlackBlockElement is an element of a context or rich text block. Rich
+// text sections, lists and quotes contain further elements.
+type SlackBlockElement struct {
+	Type      string               `json:"type"`
+	Text      string               `json:"text"`
+	URL       string               `json:"url"`
+	UserId    string               `json:"user_id"`
+	ChannelId string               `json:"channel_id"`
+	Name      string               `json:"name"`
+	Elements  []*SlackBlockElement `json:"elements"`
 }
 
 type SlackRoom struct {
@@ -66,9 +203,16 @@ type SlackRoom struct {
 	HasEnded           bool     `json:"has_ended"`
 }
 
+type SlackReaction struct {
+	Name  string   `json:"name"`
+	Users []string `json:"users"`
+	Count int      `json:"count"`
+}
+
 type SlackPost struct {
 	User        string                   `json:"user"`
 	BotId       string                   `json:"bot_id"`
+	AppId       string                   `json:"app_id"`
 	BotUsername string                   `json:"username"`
 	Text        string                   `json:"text"`
 	TimeStamp   string                   `json:"ts"`
@@ -81,12 +225,40 @@ type SlackPost struct {
 	Files       []*SlackFile             `json:"files"`
 	Attachments []*model.SlackAttachment `json:"attachments"`
 	Room        *SlackRoom               `json:"room"`
+	Reactions   []*SlackReaction         `json:"reactions"`
+	ReplyCount  int                      `json:"reply_count"`
+	ReplyUsers  []string                 `json:"reply_users"`
+	Team        string                   `json:"team"`
+	Blocks      []*SlackBlock            `json:"blocks"`
+	Topic       *string                  `json:"topic"`
+	Purpose     *string                  `json:"purpose"`
+	Name        string                   `json:"name"`
+	OldName     string                   `json:"old_name"`
+	PinnedTo    []string                 `json:"pinned_to"`
+	UserProfile *SlackPostUserProfile    `json:"user_profile"`
+	ClientMsgId string                   `json:"client_msg_id"`
+}
+
+// SlackPostUserProfile is the profile of the author that Slack includes
+// in their messages.
+type SlackPostUserProfile struct {
+	Name        string `json:"name"`
+	RealName    string `json:"real_name"`
+	DisplayName string `json:"display_name"`
+
+	// timeStamp is the timestamp of the post the profile was taken from
+	timeStamp string
 }
 
 func (p *SlackPost) IsPlainMessage() bool {
 	return p.Type == "message" && (p.SubType == "" || p.SubType == "file_share" || p.SubType == "thread_broadcast")
 }
 
+// IsPinned reports whether the post is pinned to a channel.
+func (p *SlackPost) IsPinned() bool {
+	return len(p.PinnedTo) > 0
+}
+
 func (p *SlackPost) IsFileComment() bool {
 	return p.Type == "message" && p.SubType == "file_comment"
 }
@@ -95,6 +267,12 @@ func (p *SlackPost) IsBotMessage() bool {
 	return p.Type == "message" && (p.SubType == "bot_message" || p.SubType == "tombstone")
 }
 
+// IsBotAuthored reports whether the post was sent by a bot or an app,
+// including the messages of apps that don't have the bot subtype.
+func (p *SlackPost) IsBotAuthored() bool {
+	return p.IsBotMessage() || p.BotId != ""
+}
+
 func (p *SlackPost) IsJoinLeaveMessage() bool {
 	return p.Type == "message" && (p.SubType == "channel_join" || p.SubType == "channel_leave")
 }
@@ -115,6 +293,19 @@ func (p *SlackPost) IsChannelNameMessage() bool {
 	return p.Type == "message" && p.SubType == "channel_name"
 }
 
+// IsSystemMessage reports whether the post records an event rather than
+// a message: a join or leave, a change of the channel topic, purpose or
+// name, or a deleted message.
+func (p *SlackPost) IsSystemMessage() bool {
+	return p.IsJoinLeaveMessage() || p.IsChannelTopicMessage() || p.IsChannelPurposeMessage() || p.IsChannelNameMessage() || (p.Type == "message" && p.SubType == "tombstone")
+}
+
+// IsReminderMessage reports whether the post records a reminder set up
+// in the channel, which Mattermost has no equivalent for.
+func (p *SlackPost) IsReminderMessage() bool {
+	return p.Type == "message" && p.SubType == "reminder_add"
+}
+
 func (p *SlackPost) isHuddleThread() bool {
 	return p.Type == "message" && p.SubType == "huddle_thread"
 }
@@ -126,14 +317,23 @@ type SlackComment struct {
 
 type SlackExport struct {
 	TeamName        string
+	Workspace       *SlackWorkspace
 	Channels        []SlackChannel
 	PublicChannels  []SlackChannel
 	PrivateChannels []SlackChannel
 	GroupChannels   []SlackChannel
 	DirectChannels  []SlackChannel
 	Users           []SlackUser
+	UserGroups      []SlackUserGroup
+	Sections        []SlackSection
+	IntegrationLogs []SlackIntegrationLog
 	Posts           map[string][]SlackPost
-	Uploads         map[string]*zip.File
+	Uploads         map[string]*zip.File `json:"-"`
+	CorruptFiles    []string
+
+	// Emoji holds the custom emoji of the workspace by name, with the URL
+	// of their image or, for aliases, alias: followed by the aliased emoji.
+	Emoji map[string]string
 }
 
 func (t *Transformer) SlackParseUsers(data io.Reader) ([]SlackUser, error) {
@@ -172,6 +372,260 @@ func (t *Transformer) SlackParseUsers(data io.Reader) ([]SlackUser, error) {
 	return users, nil
 }
 
+// ParseUserEmailsFile reads a CSV file with two columns, a Slack user id
+// or username and an email, into a map from the former to the latter. A
+// first row whose second column is "email" is taken as a header.
+func ParseUserEmailsFile(data io.Reader) (map[string]string, error) {
+	reader := csv.NewReader(data)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the users file")
+	}
+
+	if len(records) > 0 && strings.EqualFold(records[0][1], "email") {
+		records = records[1:]
+	}
+
+	emails := map[string]string{}
+	for i, record := range records {
+		user, email := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if user == "" || !strings.Contains(email, "@") {
+			return nil, errors.Errorf("invalid row %d in the users file: %q", i+1, strings.Join(record, ","))
+		}
+		if _, ok := emails[user]; ok {
+			return nil, errors.Errorf("the user %s appears more than once in the users file", user)
+		}
+		emails[user] = email
+	}
+
+	return emails, nil
+}
+
+// ParseChannelNameMapFile reads a CSV file with two columns, the name of a
+// channel in Slack and its name in Mattermost, into a map from the former
+// to the latter. A first row whose second column is "new_name" is taken
+// as a header.
+func ParseChannelNameMapFile(data io.Reader) (map[string]string, error) {
+	reader := csv.NewReader(data)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the channel name map file")
+	}
+
+	if len(records) > 0 && strings.EqualFold(records[0][1], "new_name") {
+		records = records[1:]
+	}
+
+	names := map[string]string{}
+	for i, record := range records {
+		original, name := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if original == "" || !IsValidChannelName(name) {
+			return nil, errors.Errorf("invalid row %d in the channel name map file: %q", i+1, strings.Join(record, ","))
+		}
+		if _, ok := names[original]; ok {
+			return nil, errors.Errorf("the channel %s appears more than once in the channel name map file", original)
+		}
+		names[original] = name
+	}
+
+	return names, nil
+}
+
+// UserAuth is the authentication service of a user and the identifier of
+// the user in that service.
+type UserAuth struct {
+	Service string
+	Data    string
+}
+
+// ParseUserAuthFile reads a CSV file with a Slack user id or username, the
+// auth data of the user and, optionally, their auth service, into a map
+// from the former to the latter. A first row whose second column is
+// "auth_data" is taken as a header.
+func ParseUserAuthFile(data io.Reader) (map[string]UserAuth, error) {
+	reader := csv.NewReader(data)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the auth file")
+	}
+
+	if len(records) > 0 && len(records[0]) > 1 && strings.EqualFold(records[0][1], "auth_data") {
+		records = records[1:]
+	}
+
+	auths := map[string]UserAuth{}
+	for i, record := range records {
+		if len(record) != 2 && len(record) != 3 {
+			return nil, errors.Errorf("invalid row %d in the auth file: %q, it should have two or three columns", i+1, strings.Join(record, ","))
+		}
+		user, auth := strings.TrimSpace(record[0]), UserAuth{Data: strings.TrimSpace(record[1])}
+		if len(record) == 3 {
+			auth.Service = strings.TrimSpace(record[2])
+		}
+		if user == "" || auth.Data == "" {
+			return nil, errors.Errorf("invalid row %d in the auth file: %q", i+1, strings.Join(record, ","))
+		}
+		if _, ok := auths[user]; ok {
+			return nil, errors.Errorf("the user %s appears more than once in the auth file", user)
+		}
+		auths[user] = auth
+	}
+
+	return auths, nil
+}
+
+// MentionReplacement replaces the matches of Pattern in the posts with
+// Replacement, which can refer to the groups of the pattern as in
+// regexp.Regexp.ReplaceAllString.
+type MentionReplacement struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// maxMentionPatternLength caps the size of the custom patterns. Go regular
+// expressions run in linear time, so this only bounds the cost of
+// compiling and matching each of them.
+const maxMentionPatternLength = 1000
+
+// ParseMentionReplacementsFile reads a CSV file with two columns, a
+// regular expression and its replacement, into the replacements to apply
+// in that order. A first row whose columns are "pattern" and
+// "replacement" is taken as a header.
+func ParseMentionReplacementsFile(data io.Reader) ([]MentionReplacement, error) {
+	reader := csv.NewReader(data)
+	reader.FieldsPerRecord = 2
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the replacements file")
+	}
+
+	if len(records) > 0 && strings.EqualFold(records[0][0], "pattern") && strings.EqualFold(records[0][1], "replacement") {
+		records = records[1:]
+	}
+
+	replacements := []MentionReplacement{}
+	for i, record := range records {
+		pattern, replacement := record[0], record[1]
+		if pattern == "" {
+			return nil, errors.Errorf("the pattern in row %d of the replacements file is empty", i+1)
+		}
+		if len(pattern) > maxMentionPatternLength {
+			return nil, errors.Errorf("the pattern in row %d of the replacements file is longer than %d characters", i+1, maxMentionPatternLength)
+		}
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern in row %d of the replacements file", i+1)
+		}
+		if r.MatchString("") {
+			return nil, errors.Errorf("the pattern in row %d of the replacements file matches empty text", i+1)
+		}
+		replacements = append(replacements, MentionReplacement{Pattern: r, Replacement: replacement})
+	}
+
+	return replacements, nil
+}
+
+func (t *Transformer) SlackParseUserGroups(data io.Reader) ([]SlackUserGroup, error) {
+	decoder := json.NewDecoder(data)
+
+	var userGroups []SlackUserGroup
+	if err := decoder.Decode(&userGroups); err != nil {
+		t.Logger.Warnf("Slack Import: Error occurred when parsing some Slack user groups. Import may work anyway. err=%v", err)
+		return userGroups, err
+	}
+	return userGroups, nil
+}
+
+func (t *Transformer) SlackParseSections(data io.Reader) ([]SlackSection, error) {
+	decoder := json.NewDecoder(data)
+
+	var sections []SlackSection
+	if err := decoder.Decode(&sections); err != nil {
+		t.Logger.Warnf("Slack Import: Error occurred when parsing the Slack sidebar sections. Import may work anyway. err=%v", err)
+		return sections, err
+	}
+	return sections, nil
+}
+
+func (t *Transformer) SlackParseIntegrationLogs(data io.Reader) ([]SlackIntegrationLog, error) {
+	decoder := json.NewDecoder(data)
+
+	var integrationLogs struct {
+		Logs []SlackIntegrationLog `json:"logs"`
+	}
+	if err := decoder.Decode(&integrationLogs); err != nil {
+		t.Logger.Warnf("Slack Import: Error occurred when parsing the Slack integration logs. Import may work anyway. err=%v", err)
+		return integrationLogs.Logs, err
+	}
+	return integrationLogs.Logs, nil
+}
+
+// SlackParseEmoji parses the custom emoji of the workspace, either in the
+// format of the emoji.list API response or as a plain map of names.
+func (t *Transformer) SlackParseEmoji(data io.Reader) (map[string]string, error) {
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Emoji map[string]string `json:"emoji"`
+	}
+	if err := json.Unmarshal(b, &response); err == nil && response.Emoji != nil {
+		return response.Emoji, nil
+	}
+
+	var emoji map[string]string
+	if err := json.Unmarshal(b, &emoji); err != nil {
+		t.Logger.Warnf("Slack Import: Error occurred when parsing the Slack custom emoji. Import may work anyway. err=%v", err)
+		return nil, err
+	}
+	return emoji, nil
+}
+
+func (t *Transformer) SlackParseWorkspace(data io.Reader) (*SlackWorkspace, error) {
+	decoder := json.NewDecoder(data)
+
+	var workspace SlackWorkspace
+	if err := decoder.Decode(&workspace); err != nil {
+		t.Logger.Warnf("Slack Import: Error occurred when parsing the Slack workspace metadata. Import may work anyway. err=%v", err)
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+var nonTeamNameCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// TeamNameFromWorkspace derives a Mattermost team name from the name of
+// the workspace, or from its domain if it has no name. It returns an
+// empty string if no valid team name can be derived.
+func TeamNameFromWorkspace(workspace *SlackWorkspace) string {
+	if workspace == nil {
+		return ""
+	}
+
+	for _, candidate := range []string{workspace.Name, workspace.Domain} {
+		name := strings.Trim(nonTeamNameCharacters.ReplaceAllString(strings.ToLower(candidate), "-"), "-")
+		if len(name) > model.TeamNameMaxLength {
+			name = strings.TrimRight(name[:model.TeamNameMaxLength], "-")
+		}
+		if model.IsValidTeamName(name) && !model.IsReservedTeamName(name) {
+			return name
+		}
+	}
+	return ""
+}
+
 func (t *Transformer) SlackParseChannels(data io.Reader, channelType model.ChannelType) ([]SlackChannel, error) {
 	decoder := json.NewDecoder(data)
 
@@ -183,6 +637,10 @@ func (t *Transformer) SlackParseChannels(data io.Reader, channelType model.Chann
 
 	for i := range channels {
 		channels[i].Type = channelType
+		// some exports list group messages along with the channels
+		if channels[i].IsMpim {
+			channels[i].Type = model.ChannelTypeGroup
+		}
 	}
 
 	return channels, nil
@@ -199,6 +657,111 @@ func (t *Transformer) SlackParsePosts(data io.Reader) ([]SlackPost, error) {
 	return posts, nil
 }
 
+// SlackConvertBotBlocks sets the text of the bot messages that carry
+// their content only in blocks to the text of those blocks, in Slack
+// markup, so it is converted along with the rest of the posts.
+func (t *Transformer) SlackConvertBotBlocks(posts map[string][]SlackPost) map[string][]SlackPost {
+	for channelName, channelPosts := range posts {
+		for postIdx := range channelPosts {
+			post := &posts[channelName][postIdx]
+			if !post.IsBotAuthored() || post.Text != "" || len(post.Blocks) == 0 {
+				continue
+			}
+			post.Text = blocksText(post.Blocks)
+		}
+	}
+
+	return posts
+}
+
+// blocksText renders the text of the header, section, context and rich
+// text blocks in Slack markup, one block per line. Other blocks, such as
+// images and actions, are skipped.
+func blocksText(blocks []*SlackBlock) string {
+	lines := []string{}
+	for _, block := range blocks {
+		var text string
+		switch block.Type {
+		case "header":
+			if block.Text != nil && block.Text.Text != "" {
+				text = "*" + block.Text.Text + "*"
+			}
+		case "section":
+			parts := []string{}
+			if block.Text != nil && block.Text.Text != "" {
+				parts = append(parts, block.Text.Text)
+			}
+			for _, field := range block.Fields {
+				if field.Text != "" {
+					parts = append(parts, field.Text)
+				}
+			}
+			text = strings.Join(parts, "\n")
+		case "context":
+			parts := []string{}
+			for _, element := range block.Elements {
+				if element.Text != "" {
+					parts = append(parts, element.Text)
+				}
+			}
+			text = strings.Join(parts, " ")
+		case "rich_text":
+			parts := []string{}
+			for _, element := range block.Elements {
+				if part := richTextElementText(element); part != "" {
+					parts = append(parts, part)
+				}
+			}
+			text = strings.Join(parts, "\n")
+		}
+
+		if text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// richTextElementText renders a rich text element and its children in
+// Slack markup.
+func richTextElementText(element *SlackBlockElement) string {
+	switch element.Type {
+	case "text":
+		return element.Text
+	case "link":
+		if element.Text == "" {
+			return "<" + element.URL + ">"
+		}
+		return "<" + element.URL + "|" + element.Text + ">"
+	case "user":
+		return "<@" + element.UserId + ">"
+	case "channel":
+		return "<#" + element.ChannelId + ">"
+	case "emoji":
+		return ":" + element.Name + ":"
+	case "rich_text_list":
+		items := []string{}
+		for _, item := range element.Elements {
+			items = append(items, "- "+richTextElementText(item))
+		}
+		return strings.Join(items, "\n")
+	}
+
+	var b strings.Builder
+	for _, child := range element.Elements {
+		b.WriteString(richTextElementText(child))
+	}
+	text := b.String()
+
+	switch element.Type {
+	case "rich_text_preformatted":
+		return "```\n" + text + "\n```"
+	case "rich_text_quote":
+		return ">" + strings.ReplaceAll(text, "\n", "\n>")
+	}
+	return text
+}
+
 func (t *Transformer) SlackConvertUserMentions(users []SlackUser, posts map[string][]SlackPost) map[string][]SlackPost {
 	var regexes = make(map[string]*regexp.Regexp, len(users))
 	for _, user := range users {
@@ -210,10 +773,17 @@ func (t *Transformer) SlackConvertUserMentions(users []SlackUser, posts map[stri
 		regexes["@"+user.Username] = r
 	}
 
-	// Special cases.
-	regexes["@here"], _ = regexp.Compile("<(!|@)here>")
-	regexes["@channel"], _ = regexp.Compile("<!channel>")
-	regexes["@all"], _ = regexp.Compile("<!everyone>")
+	// Special cases. Broadcast mentions are kept in code spans if quoted,
+	// so they are readable but don't notify.
+	broadcastMention := func(mention string) string {
+		if t.Options.QuoteBroadcastMentions {
+			return "`" + mention + "`"
+		}
+		return mention
+	}
+	regexes[broadcastMention("@here")], _ = regexp.Compile("<(!|@)here>")
+	regexes[broadcastMention("@channel")], _ = regexp.Compile("<!channel>")
+	regexes[broadcastMention("@all")], _ = regexp.Compile("<!everyone>")
 
 	convertCount := 0
 	for channelName, channelPosts := range posts {
@@ -237,6 +807,60 @@ func (t *Transformer) SlackConvertUserMentions(users []SlackUser, posts map[stri
 	return posts
 }
 
+// SlackConvertUserGroupMentions replaces the mentions of Slack user groups
+// with the mentions of each of their members, as Mattermost doesn't import
+// user groups.
+func (t *Transformer) SlackConvertUserGroupMentions(users []SlackUser, userGroups []SlackUserGroup, posts map[string][]SlackPost) map[string][]SlackPost {
+	usernamesById := make(map[string]string, len(users))
+	for _, user := range users {
+		usernamesById[user.Id] = user.Username
+	}
+
+	// groups with the same members share their replacement, so the
+	// regexes are kept in a slice rather than keyed by it
+	type userGroupMention struct {
+		regex    *regexp.Regexp
+		mentions string
+	}
+	userGroupMentions := make([]userGroupMention, 0, len(userGroups))
+	for _, userGroup := range userGroups {
+		r, err := regexp.Compile(`<!subteam\^` + regexp.QuoteMeta(userGroup.Id) + `(\|[^>]*)?>`)
+		if err != nil {
+			t.Logger.Infof("Slack Import: Unable to compile the user group mention matching regular expression. usergroup_id=%s", userGroup.Id)
+			continue
+		}
+
+		mentions := []string{}
+		for _, userId := range userGroup.Users {
+			if username, ok := usernamesById[userId]; ok {
+				mentions = append(mentions, "@"+username)
+			}
+		}
+		if len(mentions) == 0 {
+			mentions = append(mentions, "@"+userGroup.Handle)
+		}
+		userGroupMentions = append(userGroupMentions, userGroupMention{regex: r, mentions: strings.Join(mentions, " ")})
+	}
+
+	for channelName, channelPosts := range posts {
+		for postIdx, post := range channelPosts {
+			for _, userGroupMention := range userGroupMentions {
+				post.Text = userGroupMention.regex.ReplaceAllLiteralString(post.Text, userGroupMention.mentions)
+				posts[channelName][postIdx] = post
+
+				if post.Attachments != nil {
+					for _, attachment := range post.Attachments {
+						attachment.Fallback = userGroupMention.regex.ReplaceAllLiteralString(attachment.Fallback, userGroupMention.mentions)
+					}
+				}
+			}
+		}
+	}
+
+	t.Logger.Infof("Slack Import: Converted user group mentions")
+	return posts
+}
+
 func (t *Transformer) SlackConvertChannelMentions(channels []SlackChannel, posts map[string][]SlackPost) map[string][]SlackPost {
 	var regexes = make(map[string]*regexp.Regexp, len(channels))
 	for _, channel := range channels {
@@ -271,6 +895,27 @@ func (t *Transformer) SlackConvertChannelMentions(channels []SlackChannel, posts
 	return posts
 }
 
+// SlackConvertCustomMentions applies the replacements of
+// Options.MentionReplacements to the text of the posts and the fallback of
+// their attachments.
+func (t *Transformer) SlackConvertCustomMentions(posts map[string][]SlackPost) map[string][]SlackPost {
+	for channelName, channelPosts := range posts {
+		for postIdx := range channelPosts {
+			post := &posts[channelName][postIdx]
+			for _, replacement := range t.Options.MentionReplacements {
+				post.Text = replacement.Pattern.ReplaceAllString(post.Text, replacement.Replacement)
+				for _, attachment := range post.Attachments {
+					attachment.Fallback = replacement.Pattern.ReplaceAllString(attachment.Fallback, replacement.Replacement)
+				}
+			}
+		}
+	}
+
+	t.Logger.Infof("Slack Import: Converted custom mentions")
+
+	return posts
+}
+
 func (t *Transformer) SlackConvertPostsMarkup(posts map[string][]SlackPost) map[string][]SlackPost {
 	regexReplaceAllString := []struct {
 		regex *regexp.Regexp
@@ -346,16 +991,27 @@ func (t *Transformer) ParseSlackExportFile(zipReader *zip.Reader, skipConvertPos
 	slackExport.Posts = make(map[string][]SlackPost)
 	slackExport.Uploads = make(map[string]*zip.File)
 	numFiles := len(zipReader.File)
+	schemaProblems := []string{}
 
 	for i, file := range zipReader.File {
 		err := func(i int, file *zip.File) error {
 			t.Logger.Infof("Processing file %d of %d: %s", i+1, numFiles, file.Name)
 
-			reader, err := file.Open()
+			zipFileReader, err := file.Open()
 			if err != nil {
 				return err
 			}
-			defer reader.Close()
+			defer zipFileReader.Close()
+
+			var reader io.Reader = zipFileReader
+			if schema := schemaForFile(file.Name); t.Options.StrictParse && schema != nil && file.Name != "users.json" {
+				var problems []string
+				reader, problems, err = validateFileSchema(file.Name, reader, schema)
+				if err != nil {
+					return errors.Wrapf(err, "failed to read %s", file.Name)
+				}
+				schemaProblems = append(schemaProblems, problems...)
+			}
 
 			if file.Name == "channels.json" {
 				slackExport.PublicChannels, _ = t.SlackParseChannels(reader, model.ChannelTypeOpen)
@@ -369,14 +1025,34 @@ func (t *Transformer) ParseSlackExportFile(zipReader *zip.Reader, skipConvertPos
 			} else if file.Name == "mpims.json" {
 				slackExport.GroupChannels, _ = t.SlackParseChannels(reader, model.ChannelTypeGroup)
 				slackExport.Channels = append(slackExport.Channels, slackExport.GroupChannels...)
+			} else if file.Name == "usergroups.json" {
+				slackExport.UserGroups, _ = t.SlackParseUserGroups(reader)
+			} else if file.Name == "sections.json" {
+				slackExport.Sections, _ = t.SlackParseSections(reader)
+			} else if file.Name == "integration_logs.json" {
+				slackExport.IntegrationLogs, _ = t.SlackParseIntegrationLogs(reader)
+			} else if file.Name == "emoji.json" {
+				slackExport.Emoji, _ = t.SlackParseEmoji(reader)
+			} else if file.Name == "team.json" || file.Name == "workspace.json" {
+				slackExport.Workspace, _ = t.SlackParseWorkspace(reader)
 			} else if file.Name == "users.json" {
 				usersJSONFileName := os.Getenv("USERS_JSON_FILE")
 				if usersJSONFileName != "" {
-					reader.Close()
-					reader, err = os.Open(usersJSONFileName)
+					usersFile, err := os.Open(usersJSONFileName)
 					if err != nil {
 						return errors.Wrap(err, "failed to read users file from USERS_JSON_FILE")
 					}
+					defer usersFile.Close()
+					reader = usersFile
+				}
+
+				if t.Options.StrictParse {
+					var problems []string
+					reader, problems, err = validateFileSchema(file.Name, reader, usersSchema)
+					if err != nil {
+						return errors.Wrapf(err, "failed to read %s", file.Name)
+					}
+					schemaProblems = append(schemaProblems, problems...)
 				}
 
 				users, _ := t.SlackParseUsers(reader)
@@ -384,7 +1060,15 @@ func (t *Transformer) ParseSlackExportFile(zipReader *zip.Reader, skipConvertPos
 			} else {
 				spl := strings.Split(file.Name, "/")
 				if len(spl) == 2 && strings.HasSuffix(spl[1], ".json") {
-					newposts, _ := t.SlackParsePosts(reader)
+					newposts, err := t.SlackParsePosts(reader)
+					if err != nil && err != io.EOF {
+						if !t.Options.SkipCorruptFiles {
+							return errors.Wrapf(err, "failed to parse the posts file %s. Use --skip-corrupt to skip it", file.Name)
+						}
+						withCategory(t.Logger, WarningCategoryCorrupt).Warnf("Skipping the corrupt posts file %s", file.Name)
+						slackExport.CorruptFiles = append(slackExport.CorruptFiles, file.Name)
+						return nil
+					}
 					channel := spl[0]
 					if _, ok := slackExport.Posts[channel]; !ok {
 						slackExport.Posts[channel] = newposts
@@ -404,15 +1088,47 @@ func (t *Transformer) ParseSlackExportFile(zipReader *zip.Reader, skipConvertPos
 		}
 	}
 
+	if len(schemaProblems) > 0 {
+		for _, problem := range schemaProblems {
+			withCategory(t.Logger, WarningCategoryCorrupt).Warnf("Unexpected export format: %s", problem)
+		}
+		return nil, errors.Errorf("found %d unexpected fields in the export and --strict-parse is set. Check the log for details", len(schemaProblems))
+	}
+
+	if len(slackExport.CorruptFiles) > 0 {
+		t.Logger.Warnf("Skipped %d corrupt posts files: %s", len(slackExport.CorruptFiles), strings.Join(slackExport.CorruptFiles, ", "))
+	}
+
+	t.ReconcileConversations(&slackExport)
+
+	if t.Options.NamespaceGridUsernames {
+		t.NamespaceDuplicateUsernames(slackExport.Users)
+	}
+
+	slackExport.Posts = t.SlackConvertBotBlocks(slackExport.Posts)
+
 	if !skipConvertPosts {
-		t.Logger.Info("Converting post mentions and markup")
-		start := time.Now()
-		slackExport.Posts = t.SlackConvertUserMentions(slackExport.Users, slackExport.Posts)
-		slackExport.Posts = t.SlackConvertChannelMentions(slackExport.Channels, slackExport.Posts)
-		slackExport.Posts = t.SlackConvertPostsMarkup(slackExport.Posts)
-		elapsed := time.Since(start)
-		t.Logger.Debugf("Converting mentions finished (%s)", elapsed)
+		t.ConvertSlackExportPosts(&slackExport)
 	}
 
 	return &slackExport, nil
 }
+
+// ConvertSlackExportPosts converts the mentions and markup of the posts of
+// an export parsed without converting them, such as the exports merged by
+// MergeSlackExports.
+func (t *Transformer) ConvertSlackExportPosts(slackExport *SlackExport) {
+	t.Logger.Info("Converting post mentions and markup")
+	start := time.Now()
+	if t.Options.ExpandUserGroups {
+		slackExport.Posts = t.SlackConvertUserGroupMentions(slackExport.Users, slackExport.UserGroups, slackExport.Posts)
+	}
+	slackExport.Posts = t.SlackConvertUserMentions(slackExport.Users, slackExport.Posts)
+	slackExport.Posts = t.SlackConvertChannelMentions(slackExport.Channels, slackExport.Posts)
+	if len(t.Options.MentionReplacements) > 0 {
+		slackExport.Posts = t.SlackConvertCustomMentions(slackExport.Posts)
+	}
+	slackExport.Posts = t.SlackConvertPostsMarkup(slackExport.Posts)
+	elapsed := time.Since(start)
+	t.Logger.Debugf("Converting mentions finished (%s)", elapsed)
+}
@@ -1,12 +1,27 @@
 package slack
 
 import (
+	"archive/zip"
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mmetl/internal/testlib"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
 )
 
+func createZipReader(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+
+	data, err := testlib.ZipFiles(files)
+	require.NoError(t, err)
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	return zipReader
+}
+
 func TestSlackConvertUserMentions(t *testing.T) {
 	type TestCases struct {
 		mention  string
@@ -51,3 +66,483 @@ func TestSlackConvertUserMentions(t *testing.T) {
 		}
 	}
 }
+
+func TestSlackConvertUserMentionsQuoteBroadcast(t *testing.T) {
+	transformer := NewTransformer("test", logrus.New())
+	transformer.Options.QuoteBroadcastMentions = true
+
+	posts := map[string][]SlackPost{
+		"channelName": {
+			{Text: "<!here> <!channel> <!everyone> <@U100>"},
+		},
+	}
+	parsedPosts := transformer.SlackConvertUserMentions([]SlackUser{{Id: "U100", Username: "user1"}}, posts)
+	require.Equal(t, "`@here` `@channel` `@all` @user1", parsedPosts["channelName"][0].Text)
+
+	// Mattermost has no @everyone, so it is quoted as the @all it becomes
+	posts = map[string][]SlackPost{
+		"channelName": {
+			{Text: "<!everyone> meeting", Attachments: []*model.SlackAttachment{{Fallback: "<!everyone>"}}},
+		},
+	}
+	parsedPosts = transformer.SlackConvertUserMentions(nil, posts)
+	require.Equal(t, "`@all` meeting", parsedPosts["channelName"][0].Text)
+	require.Equal(t, "`@all`", parsedPosts["channelName"][0].Attachments[0].Fallback)
+}
+
+func TestParseSlackExportFileCorruptPosts(t *testing.T) {
+	files := map[string]string{
+		"channels.json":           `[{"id": "C1", "name": "general"}]`,
+		"users.json":              `[{"id": "U1", "name": "user1"}]`,
+		"general/2020-01-01.json": `[{"user": "U1", "text": "first", "ts": "1577836800.000000", "type": "message"}]`,
+		"general/2020-01-02.json": `[{"user": "U1", "text": "broken", "ts": `,
+		"general/2020-01-03.json": `[{"user": "U1", "text": "third", "ts": "1578009600.000000", "type": "message"}]`,
+		"general/2020-01-04.json": ``,
+	}
+
+	t.Run("a corrupt posts file fails the parsing by default", func(t *testing.T) {
+		transformer := NewTransformer("test", logrus.New())
+
+		_, err := transformer.ParseSlackExportFile(createZipReader(t, files), true)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "general/2020-01-02.json")
+	})
+
+	t.Run("corrupt posts files are skipped with --skip-corrupt", func(t *testing.T) {
+		transformer := NewTransformer("test", logrus.New())
+		transformer.Options.SkipCorruptFiles = true
+
+		slackExport, err := transformer.ParseSlackExportFile(createZipReader(t, files), true)
+		require.NoError(t, err)
+		require.Equal(t, []string{"general/2020-01-02.json"}, slackExport.CorruptFiles)
+
+		texts := []string{}
+		for _, post := range slackExport.Posts["general"] {
+			texts = append(texts, post.Text)
+		}
+		require.ElementsMatch(t, []string{"first", "third"}, texts)
+		require.Equal(t, 1, transformer.WarningCount(WarningCategoryCorrupt))
+	})
+}
+
+func TestParseSlackExportFileStrictParse(t *testing.T) {
+	files := map[string]string{
+		"channels.json": `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json": `[
+			{"id": "U1", "name": "user1", "profile": {"email": "user1@example.com"}},
+			{"id": "U2", "name": 42, "profile": {"email": "user2@example.com"}},
+			{"id": "U3", "name": "user3"}
+		]`,
+		"general/2020-01-01.json": `[{"user": "U1", "text": "first", "ts": "1577836800.000000", "type": "message"}]`,
+	}
+
+	t.Run("the export is parsed without --strict-parse", func(t *testing.T) {
+		transformer := NewTransformer("test", logrus.New())
+
+		slackExport, err := transformer.ParseSlackExportFile(createZipReader(t, files), true)
+		require.NoError(t, err)
+		require.Len(t, slackExport.Posts["general"], 1)
+	})
+
+	t.Run("the malformed users are reported with --strict-parse", func(t *testing.T) {
+		logger := logrus.New()
+		buf := &bytes.Buffer{}
+		logger.SetOutput(buf)
+		transformer := NewTransformer("test", logger)
+		transformer.Options.StrictParse = true
+
+		_, err := transformer.ParseSlackExportFile(createZipReader(t, files), true)
+		require.EqualError(t, err, "found 2 unexpected fields in the export and --strict-parse is set. Check the log for details")
+		require.Contains(t, buf.String(), `users.json: element 1 has the field \"name\" of type number instead of string`)
+		require.Contains(t, buf.String(), `users.json: element 2 is missing the field \"profile\"`)
+		require.Equal(t, 2, transformer.WarningCount(WarningCategoryCorrupt))
+	})
+
+	t.Run("a well formed export passes --strict-parse", func(t *testing.T) {
+		transformer := NewTransformer("test", logrus.New())
+		transformer.Options.StrictParse = true
+
+		wellFormed := map[string]string{
+			"channels.json":           files["channels.json"],
+			"users.json":              `[{"id": "U1", "name": "user1", "profile": {"email": "user1@example.com"}}]`,
+			"general/2020-01-01.json": files["general/2020-01-01.json"],
+		}
+
+		slackExport, err := transformer.ParseSlackExportFile(createZipReader(t, wellFormed), true)
+		require.NoError(t, err)
+		require.Len(t, slackExport.Users, 1)
+		require.Len(t, slackExport.Posts["general"], 1)
+	})
+}
+
+func TestValidateSchema(t *testing.T) {
+	testCases := []struct {
+		Name             string
+		Data             string
+		ExpectedProblems []string
+	}{
+		{"valid posts", `[{"type": "message", "ts": "1.0", "text": "hi", "files": []}]`, []string{}},
+		{"null optional fields are accepted", `[{"type": "message", "ts": "1.0", "thread_ts": null}]`, []string{}},
+		{"invalid json is left to the parser", `[{"type": `, nil},
+		{"not an array", `{"type": "message"}`, []string{"posts.json: expected an array of objects: json: cannot unmarshal object into Go value of type []interface {}"}},
+		{"not an object", `["message"]`, []string{"posts.json: element 0 is not an object"}},
+		{"missing and mistyped fields", `[{"type": "message", "ts": 1.0}, {"ts": "1.0", "files": {}}]`, []string{
+			`posts.json: element 0 has the field "ts" of type number instead of string`,
+			`posts.json: element 1 has the field "files" of type object instead of array`,
+			`posts.json: element 1 is missing the field "type"`,
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.ExpectedProblems, validateSchema("posts.json", []byte(tc.Data), postsSchema))
+		})
+	}
+}
+
+func TestParseUserEmailsFile(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		Data           string
+		ExpectedEmails map[string]string
+		ExpectedError  string
+	}{
+		{
+			Name:           "rows with ids and usernames",
+			Data:           "U1,user1@example.com\nuser2, user2@example.com\n",
+			ExpectedEmails: map[string]string{"U1": "user1@example.com", "user2": "user2@example.com"},
+		},
+		{
+			Name:           "the header is skipped",
+			Data:           "user,email\nU1,user1@example.com\n",
+			ExpectedEmails: map[string]string{"U1": "user1@example.com"},
+		},
+		{
+			Name:           "an empty file",
+			Data:           "",
+			ExpectedEmails: map[string]string{},
+		},
+		{
+			Name:          "rows must have two columns",
+			Data:          "U1,user1@example.com,extra\n",
+			ExpectedError: "failed to parse the users file",
+		},
+		{
+			Name:          "emails must be valid",
+			Data:          "U1,not-an-email\n",
+			ExpectedError: `invalid row 1 in the users file: "U1,not-an-email"`,
+		},
+		{
+			Name:          "users can't be repeated",
+			Data:          "U1,user1@example.com\nU1,other@example.com\n",
+			ExpectedError: "the user U1 appears more than once in the users file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			emails, err := ParseUserEmailsFile(strings.NewReader(tc.Data))
+			if tc.ExpectedError != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.ExpectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.ExpectedEmails, emails)
+		})
+	}
+}
+
+func TestParseChannelNameMapFile(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Data          string
+		ExpectedNames map[string]string
+		ExpectedError string
+	}{
+		{
+			Name:          "rows with names",
+			Data:          "general,town-square\nrandom, off-topic\n",
+			ExpectedNames: map[string]string{"general": "town-square", "random": "off-topic"},
+		},
+		{
+			Name:          "the header is skipped",
+			Data:          "original_name,new_name\ngeneral,town-square\n",
+			ExpectedNames: map[string]string{"general": "town-square"},
+		},
+		{
+			Name:          "new names must be valid",
+			Data:          "general,Town Square\n",
+			ExpectedError: `invalid row 1 in the channel name map file: "general,Town Square"`,
+		},
+		{
+			Name:          "channels can't be repeated",
+			Data:          "general,one\ngeneral,two\n",
+			ExpectedError: "the channel general appears more than once in the channel name map file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			names, err := ParseChannelNameMapFile(strings.NewReader(tc.Data))
+			if tc.ExpectedError != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.ExpectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.ExpectedNames, names)
+		})
+	}
+}
+
+func TestParseUserAuthFile(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Data          string
+		ExpectedAuth  map[string]UserAuth
+		ExpectedError string
+	}{
+		{
+			Name: "rows with and without a service",
+			Data: "U1,alice@example.com\nbob, bob-id, gitlab\n",
+			ExpectedAuth: map[string]UserAuth{
+				"U1":  {Data: "alice@example.com"},
+				"bob": {Service: "gitlab", Data: "bob-id"},
+			},
+		},
+		{
+			Name:         "the header is skipped",
+			Data:         "user,auth_data,auth_service\nU1,alice,saml\n",
+			ExpectedAuth: map[string]UserAuth{"U1": {Service: "saml", Data: "alice"}},
+		},
+		{
+			Name:          "rows must have two or three columns",
+			Data:          "U1\n",
+			ExpectedError: `invalid row 1 in the auth file: "U1"`,
+		},
+		{
+			Name:          "the auth data can't be empty",
+			Data:          "U1, \n",
+			ExpectedError: "invalid row 1 in the auth file",
+		},
+		{
+			Name:          "users can't be repeated",
+			Data:          "U1,alice\nU1,other\n",
+			ExpectedError: "the user U1 appears more than once in the auth file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			auth, err := ParseUserAuthFile(strings.NewReader(tc.Data))
+			if tc.ExpectedError != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.ExpectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.ExpectedAuth, auth)
+		})
+	}
+}
+
+func TestParseMentionReplacementsFile(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Data          string
+		ExpectedCount int
+		ExpectedError string
+	}{
+		{
+			Name:          "rows with patterns and replacements",
+			Data:          "<LEGACY:(\\d+)>,ticket #$1\n\"<JIRA\\|([A-Z]+-\\d+)>\",$1\n",
+			ExpectedCount: 2,
+		},
+		{
+			Name:          "the header is skipped",
+			Data:          "pattern,replacement\n<LEGACY>,legacy\n",
+			ExpectedCount: 1,
+		},
+		{
+			Name:          "patterns must compile",
+			Data:          "<LEGACY(,legacy\n",
+			ExpectedError: "invalid pattern in row 1 of the replacements file",
+		},
+		{
+			Name:          "patterns can't match empty text",
+			Data:          "<LEGACY>,legacy\n(foo)*,bar\n",
+			ExpectedError: "the pattern in row 2 of the replacements file matches empty text",
+		},
+		{
+			Name:          "patterns can't be too long",
+			Data:          strings.Repeat("a", 1001) + ",b\n",
+			ExpectedError: "the pattern in row 1 of the replacements file is longer than 1000 characters",
+		},
+		{
+			Name:          "big repetitions are rejected",
+			Data:          "(a{1000}){1000},b\n",
+			ExpectedError: "invalid pattern in row 1 of the replacements file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			replacements, err := ParseMentionReplacementsFile(strings.NewReader(tc.Data))
+			if tc.ExpectedError != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.ExpectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, replacements, tc.ExpectedCount)
+		})
+	}
+}
+
+func TestParseSlackExportFileCustomMentions(t *testing.T) {
+	zipReader := createZipReader(t, map[string]string{
+		"users.json":              `[{"id": "U1", "name": "alice", "profile": {"email": "alice@example.com"}}]`,
+		"channels.json":           `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"general/2020-01-01.json": `[{"user": "U1", "text": "<@U1> see <LEGACY:1234> in <#C1|general>", "ts": "1577836800.000000", "type": "message"}]`,
+	})
+
+	replacements, err := ParseMentionReplacementsFile(strings.NewReader(`<LEGACY:(\d+)>,ticket #$1`))
+	require.NoError(t, err)
+
+	transformer := NewTransformer("test", logrus.New())
+	transformer.Options.MentionReplacements = replacements
+	slackExport, err := transformer.ParseSlackExportFile(zipReader, false)
+	require.NoError(t, err)
+	require.Equal(t, "@alice see ticket #1234 in ~general", slackExport.Posts["general"][0].Text)
+}
+
+func TestTeamNameFromWorkspace(t *testing.T) {
+	testCases := []struct {
+		Name         string
+		Workspace    *SlackWorkspace
+		ExpectedName string
+	}{
+		{
+			Name:         "no workspace",
+			Workspace:    nil,
+			ExpectedName: "",
+		},
+		{
+			Name:         "the name is slugified",
+			Workspace:    &SlackWorkspace{Name: "  Acme Corp. (EU) ", Domain: "acme"},
+			ExpectedName: "acme-corp-eu",
+		},
+		{
+			Name:         "the domain is used if the name has no valid characters",
+			Workspace:    &SlackWorkspace{Name: "日本", Domain: "acme-jp"},
+			ExpectedName: "acme-jp",
+		},
+		{
+			Name:         "long names are truncated",
+			Workspace:    &SlackWorkspace{Name: strings.Repeat("a", 63) + " b"},
+			ExpectedName: strings.Repeat("a", 63),
+		},
+		{
+			Name:         "reserved names are rejected",
+			Workspace:    &SlackWorkspace{Name: "Admin"},
+			ExpectedName: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.ExpectedName, TeamNameFromWorkspace(tc.Workspace))
+		})
+	}
+}
+
+func TestParseSlackExportFileWorkspace(t *testing.T) {
+	zipReader := createZipReader(t, map[string]string{
+		"team.json": `{"id": "T1", "name": "Acme Corp", "domain": "acme"}`,
+	})
+
+	slackExport, err := NewTransformer("", logrus.New()).ParseSlackExportFile(zipReader, true)
+	require.NoError(t, err)
+	require.Equal(t, &SlackWorkspace{Id: "T1", Name: "Acme Corp", Domain: "acme"}, slackExport.Workspace)
+}
+
+func TestParseSlackExportFileIntegrationLogs(t *testing.T) {
+	zipReader := createZipReader(t, map[string]string{
+		"integration_logs.json": `{"logs": [
+			{"service_id": "B1", "service_type": "Jenkins CI", "user_id": "U1", "change_type": "added"},
+			{"app_id": "A1", "app_type": "Deploy Bot", "change_type": "added"}
+		]}`,
+	})
+
+	slackExport, err := NewTransformer("", logrus.New()).ParseSlackExportFile(zipReader, true)
+	require.NoError(t, err)
+	require.Equal(t, []SlackIntegrationLog{
+		{ServiceId: "B1", ServiceType: "Jenkins CI", ChangeType: "added"},
+		{AppId: "A1", AppType: "Deploy Bot", ChangeType: "added"},
+	}, slackExport.IntegrationLogs)
+}
+
+func TestSlackConvertUserGroupMentions(t *testing.T) {
+	users := []SlackUser{
+		{Id: "U1", Username: "user1"},
+		{Id: "U2", Username: "user2"},
+	}
+	userGroups := []SlackUserGroup{
+		{Id: "S1", Name: "Engineering", Handle: "engineering", Users: []string{"U1", "U2", "UNKNOWN"}},
+		{Id: "S2", Name: "Empty", Handle: "empty"},
+		{Id: "S4", Name: "Platform", Handle: "platform", Users: []string{"U1", "U2"}},
+		{Id: "S5", Name: "Other Empty", Handle: "empty"},
+	}
+
+	testCases := []struct {
+		text     string
+		expected string
+	}{
+		{text: "hey <!subteam^S1|@engineering>, ship it", expected: "hey @user1 @user2, ship it"},
+		{text: "hey <!subteam^S1>", expected: "hey @user1 @user2"},
+		{text: "hey <!subteam^S2|@empty>", expected: "hey @empty"},
+		{text: "hey <!subteam^S3|@other>", expected: "hey <!subteam^S3|@other>"},
+		{text: "<!subteam^S1> and <!subteam^S4|@platform>", expected: "@user1 @user2 and @user1 @user2"},
+		{text: "<!subteam^S2> and <!subteam^S5>", expected: "@empty and @empty"},
+	}
+
+	transformer := NewTransformer("test", logrus.New())
+	for _, tc := range testCases {
+		posts := map[string][]SlackPost{
+			"channelName": {
+				{
+					Text:        tc.text,
+					Attachments: []*model.SlackAttachment{{Fallback: tc.text}},
+				},
+			},
+		}
+
+		post := transformer.SlackConvertUserGroupMentions(users, userGroups, posts)["channelName"][0]
+		require.Equal(t, tc.expected, post.Text)
+		require.Equal(t, tc.expected, post.Attachments[0].Fallback)
+	}
+
+	t.Run("user groups are parsed and expanded with the flag", func(t *testing.T) {
+		files := map[string]string{
+			"channels.json":           `[{"id": "C1", "name": "general"}]`,
+			"users.json":              `[{"id": "U1", "name": "user1"}, {"id": "U2", "name": "user2"}]`,
+			"usergroups.json":         `[{"id": "S1", "name": "Engineering", "handle": "engineering", "users": ["U1", "U2"]}]`,
+			"general/2020-01-01.json": `[{"user": "U1", "text": "<!subteam^S1|@engineering> standup", "ts": "1577836800.000000", "type": "message"}]`,
+		}
+
+		for expand, expected := range map[bool]string{
+			true: "@user1 @user2 standup",
+			// without expanding, the markup conversion treats the mention as a link
+			false: "[@engineering](!subteam^S1) standup",
+		} {
+			transformer := NewTransformer("test", logrus.New())
+			transformer.Options.ExpandUserGroups = expand
+
+			slackExport, err := transformer.ParseSlackExportFile(createZipReader(t, files), false)
+			require.NoError(t, err)
+			require.Len(t, slackExport.UserGroups, 1)
+			require.Equal(t, expected, slackExport.Posts["general"][0].Text)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package slack
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+)
+
+// Kinds of the placeholder users created for the users missing from the
+// export.
+const (
+	PlaceholderKindMissing  = "missing"
+	PlaceholderKindExternal = "external"
+)
+
+// PlaceholderUser is a user created by the transformation as they are
+// referenced by the export but missing from its users, with the profile
+// that their posts carry, if any.
+type PlaceholderUser struct {
+	Id          string
+	Kind        string
+	Username    string
+	Email       string
+	Name        string
+	RealName    string
+	DisplayName string
+}
+
+func (t *Transformer) recordPlaceholderUser(userID, kind string) {
+	if t.placeholderKinds == nil {
+		t.placeholderKinds = map[string]string{}
+	}
+	t.placeholderKinds[userID] = kind
+}
+
+// PlaceholderUsers returns the placeholder users created so far, sorted
+// by id, with their current username and email and the
+// name, real name and display name of the first of the posts that
+// carries their profile.
+func (t *Transformer) PlaceholderUsers(posts map[string][]SlackPost) []PlaceholderUser {
+	profiles := map[string]*SlackPostUserProfile{}
+	for _, channelPosts := range posts {
+		for _, post := range channelPosts {
+			if post.UserProfile == nil || t.placeholderKinds[post.User] == "" {
+				continue
+			}
+			if previous, ok := profiles[post.User]; !ok || post.TimeStamp < previous.timeStamp {
+				profile := *post.UserProfile
+				profile.timeStamp = post.TimeStamp
+				profiles[post.User] = &profile
+			}
+		}
+	}
+
+	userIDs := make([]string, 0, len(t.placeholderKinds))
+	for userID := range t.placeholderKinds {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+
+	placeholders := make([]PlaceholderUser, 0, len(userIDs))
+	for _, userID := range userIDs {
+		placeholder := PlaceholderUser{Id: userID, Kind: t.placeholderKinds[userID]}
+		if user := t.Intermediate.UsersById[userID]; user != nil {
+			placeholder.Username = user.Username
+			placeholder.Email = user.Email
+		}
+		if profile := profiles[userID]; profile != nil {
+			placeholder.Name = profile.Name
+			placeholder.RealName = profile.RealName
+			placeholder.DisplayName = profile.DisplayName
+		}
+		placeholders = append(placeholders, placeholder)
+	}
+	return placeholders
+}
+
+// WritePlaceholderReport writes the placeholder users as a CSV file with
+// their Slack id, the kind of placeholder, their username and email in
+// the import and the profile found in their posts.
+func WritePlaceholderReport(w io.Writer, placeholders []PlaceholderUser) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"id", "kind", "username", "email", "name", "real_name", "display_name"}); err != nil {
+		return err
+	}
+	for _, placeholder := range placeholders {
+		record := []string{
+			placeholder.Id,
+			placeholder.Kind,
+			placeholder.Username,
+			placeholder.Email,
+			placeholder.Name,
+			placeholder.RealName,
+			placeholder.DisplayName,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
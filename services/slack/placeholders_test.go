@@ -0,0 +1,47 @@
+package slack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaceholderReport(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.TransformUsers([]SlackUser{
+		{Id: "U1", Username: "alice", Profile: SlackProfile{Email: "alice@example.com"}},
+	}, false, "")
+	slackTransformer.Intermediate.PublicChannels = []*IntermediateChannel{
+		{Id: "C1", Name: "general", OriginalName: "general", Type: model.ChannelTypeOpen},
+	}
+
+	slackExport := &SlackExport{
+		Posts: map[string][]SlackPost{
+			"general": {
+				{User: "U1", Text: "hello", TimeStamp: "1695176600.000000", Type: "message"},
+				// U2 is missing from the users, but their posts carry their profile
+				{User: "U2", Text: "hi", TimeStamp: "1695176700.000000", Type: "message", UserProfile: &SlackPostUserProfile{Name: "bob", RealName: "Bob Smith", DisplayName: "Bobby"}},
+				{User: "U2", Text: "again", TimeStamp: "1695176800.000000", Type: "message", UserProfile: &SlackPostUserProfile{Name: "bob", RealName: "Robert Smith", DisplayName: "Rob"}},
+				// U3 is missing and has no profile at all
+				{User: "U3", Text: "hey", TimeStamp: "1695176900.000000", Type: "message"},
+			},
+		},
+	}
+	require.NoError(t, slackTransformer.TransformPosts(slackExport, "", true, false, false))
+
+	placeholders := slackTransformer.PlaceholderUsers(slackExport.Posts)
+	require.Equal(t, []PlaceholderUser{
+		{Id: "U2", Kind: PlaceholderKindMissing, Username: "u2", Email: "U2@local", Name: "bob", RealName: "Bob Smith", DisplayName: "Bobby"},
+		{Id: "U3", Kind: PlaceholderKindMissing, Username: "u3", Email: "U3@local"},
+	}, placeholders)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WritePlaceholderReport(buf, placeholders))
+	assert.Equal(t, "id,kind,username,email,name,real_name,display_name\n"+
+		"U2,missing,u2,U2@local,bob,Bob Smith,Bobby\n"+
+		"U3,missing,u3,U3@local,,,\n", buf.String())
+}
@@ -0,0 +1,57 @@
+package slack
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Phases of a transformation reported through Options.Progress.
+const (
+	ProgressPhaseUsers    = "users"
+	ProgressPhaseChannels = "channels"
+	ProgressPhasePosts    = "posts"
+	ProgressPhaseExport   = "export"
+)
+
+// ProgressEvent reports that done of the total items of a phase are
+// complete. The users and channels phases count users and channels, the
+// posts phase the channels whose posts are transformed and the export
+// phase the posts written to the import file.
+type ProgressEvent struct {
+	Phase     string    `json:"phase"`
+	Done      int       `json:"done"`
+	Total     int       `json:"total"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// exportProgressInterval is the number of posts written between the
+// progress events of the export phase.
+const exportProgressInterval = 1000
+
+// reportProgress calls Options.Progress, if set, with an event for a
+// phase. The calls are serialized, as channels may be transformed
+// concurrently.
+func (t *Transformer) reportProgress(phase string, done, total int) {
+	if t.Options.Progress == nil {
+		return
+	}
+
+	t.progressMutex.Lock()
+	defer t.progressMutex.Unlock()
+	t.Options.Progress(ProgressEvent{Phase: phase, Done: done, Total: total, Timestamp: time.Now()})
+}
+
+// JSONProgressWriter returns a progress callback that writes each event
+// as a line of JSON to w, for wrapping tools to render a progress bar.
+// Write errors are ignored, as they shouldn't stop the transformation.
+func JSONProgressWriter(w io.Writer) func(ProgressEvent) {
+	var mutex sync.Mutex
+	encoder := json.NewEncoder(w)
+	return func(event ProgressEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		_ = encoder.Encode(event)
+	}
+}
@@ -0,0 +1,86 @@
+package slack
+
+import (
+	"encoding/csv"
+	"io"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	SanitizeEntityChannel = "channel"
+	SanitizeEntityUser    = "user"
+)
+
+// SanitizeChange is a field of a channel or user that was truncated or
+// renamed to be valid in Mattermost. Id is the original name of channels
+// and the Slack id of users. Users skipped as a whole are recorded with
+// the user field, their username as the original value and an empty new
+// value.
+type SanitizeChange struct {
+	Entity   string
+	Id       string
+	Field    string
+	Original string
+	New      string
+}
+
+// sanitizeChanges compares the original and new values of the fields of
+// an entity, given as field name, original value and new value, and
+// returns the ones that differ.
+func sanitizeChanges(entity, id string, fields ...[3]string) []SanitizeChange {
+	var changes []SanitizeChange
+	for _, field := range fields {
+		if field[1] != field[2] {
+			changes = append(changes, SanitizeChange{
+				Entity:   entity,
+				Id:       id,
+				Field:    field[0],
+				Original: field[1],
+				New:      field[2],
+			})
+		}
+	}
+	return changes
+}
+
+func (t *Transformer) recordSanitizeChanges(changes []SanitizeChange) {
+	t.sanitizeMutex.Lock()
+	defer t.sanitizeMutex.Unlock()
+	t.sanitizedFields = append(t.sanitizedFields, changes...)
+}
+
+// SanitizeChanges returns the truncations and renames made so far to the
+// channels and users, in the order they were made.
+func (t *Transformer) SanitizeChanges() []SanitizeChange {
+	t.sanitizeMutex.Lock()
+	defer t.sanitizeMutex.Unlock()
+	return slices.Clone(t.sanitizedFields)
+}
+
+// WriteSanitizeReport writes the sanitize changes as a CSV file with the
+// entity, its id, the field and the length and value of the field before
+// and after the change.
+func WriteSanitizeReport(w io.Writer, changes []SanitizeChange) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"entity", "id", "field", "original_length", "new_length", "original", "new"}); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		record := []string{
+			change.Entity,
+			change.Id,
+			change.Field,
+			strconv.Itoa(utf8.RuneCountInString(change.Original)),
+			strconv.Itoa(utf8.RuneCountInString(change.New)),
+			change.Original,
+			change.New,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
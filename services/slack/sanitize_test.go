@@ -0,0 +1,38 @@
+package slack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeReport(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Options.NormalizeUsernames = true
+	slackTransformer.TransformUsers([]SlackUser{
+		{Id: "U1", Username: "Alice", Profile: SlackProfile{Email: "alice@example.com", Title: strings.Repeat("p", 130)}},
+		{Id: "U2", Username: "bob", Profile: SlackProfile{Email: "bob@example.com"}},
+	}, false, "")
+
+	slackTransformer.TransformChannels([]SlackChannel{
+		{Id: "C1", Name: "general", Members: []string{"U1", "U2"}, Purpose: SlackChannelSub{Value: strings.Repeat("a", 300)}, Type: model.ChannelTypeOpen},
+		{Id: "C2", Name: "random", Members: []string{"U1"}, Purpose: SlackChannelSub{Value: "short"}, Type: model.ChannelTypeOpen},
+	})
+
+	changes := slackTransformer.SanitizeChanges()
+	require.Equal(t, []SanitizeChange{
+		{Entity: SanitizeEntityUser, Id: "U1", Field: "position", Original: strings.Repeat("p", 130), New: strings.Repeat("p", model.UserPositionMaxRunes)},
+		{Entity: SanitizeEntityUser, Id: "U1", Field: "username", Original: "Alice", New: "alice"},
+		{Entity: SanitizeEntityChannel, Id: "general", Field: "purpose", Original: strings.Repeat("a", 300), New: strings.Repeat("a", model.ChannelPurposeMaxRunes)},
+	}, changes)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteSanitizeReport(buf, changes[2:]))
+	assert.Equal(t, "entity,id,field,original_length,new_length,original,new\n"+
+		"channel,general,purpose,300,250,"+strings.Repeat("a", 300)+","+strings.Repeat("a", 250)+"\n", buf.String())
+}
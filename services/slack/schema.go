@@ -0,0 +1,151 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// jsonKind is the type of a JSON value as seen by the schema validation.
+type jsonKind string
+
+const (
+	jsonKindString  jsonKind = "string"
+	jsonKindNumber  jsonKind = "number"
+	jsonKindBoolean jsonKind = "boolean"
+	jsonKindObject  jsonKind = "object"
+	jsonKindArray   jsonKind = "array"
+)
+
+type schemaField struct {
+	Kind     jsonKind
+	Required bool
+}
+
+// exportSchema describes the fields expected in each element of one of
+// the JSON files of a Slack export. Fields not listed are not checked.
+type exportSchema map[string]schemaField
+
+var channelsSchema = exportSchema{
+	"id":      {Kind: jsonKindString, Required: true},
+	"name":    {Kind: jsonKindString},
+	"creator": {Kind: jsonKindString},
+	"members": {Kind: jsonKindArray},
+	"purpose": {Kind: jsonKindObject},
+	"topic":   {Kind: jsonKindObject},
+	"created": {Kind: jsonKindNumber},
+}
+
+var usersSchema = exportSchema{
+	"id":      {Kind: jsonKindString, Required: true},
+	"name":    {Kind: jsonKindString, Required: true},
+	"is_bot":  {Kind: jsonKindBoolean},
+	"deleted": {Kind: jsonKindBoolean},
+	"profile": {Kind: jsonKindObject, Required: true},
+}
+
+var postsSchema = exportSchema{
+	"type":        {Kind: jsonKindString, Required: true},
+	"ts":          {Kind: jsonKindString, Required: true},
+	"user":        {Kind: jsonKindString},
+	"text":        {Kind: jsonKindString},
+	"thread_ts":   {Kind: jsonKindString},
+	"subtype":     {Kind: jsonKindString},
+	"files":       {Kind: jsonKindArray},
+	"attachments": {Kind: jsonKindArray},
+	"reactions":   {Kind: jsonKindArray},
+	"reply_count": {Kind: jsonKindNumber},
+}
+
+// schemaForFile returns the schema of a file of the export, or nil if
+// the file isn't validated.
+func schemaForFile(fileName string) exportSchema {
+	switch fileName {
+	case "channels.json", "dms.json", "groups.json", "mpims.json":
+		return channelsSchema
+	case "users.json":
+		return usersSchema
+	}
+
+	spl := strings.Split(fileName, "/")
+	if len(spl) == 2 && strings.HasSuffix(spl[1], ".json") {
+		return postsSchema
+	}
+	return nil
+}
+
+func kindOf(value interface{}) jsonKind {
+	switch value.(type) {
+	case string:
+		return jsonKindString
+	case float64:
+		return jsonKindNumber
+	case bool:
+		return jsonKindBoolean
+	case map[string]interface{}:
+		return jsonKindObject
+	case []interface{}:
+		return jsonKindArray
+	}
+	return ""
+}
+
+// validateSchema checks the contents of a JSON file of the export against
+// a schema, returning a description of each missing or mistyped field.
+// Files that aren't valid JSON are left to the parser to report.
+func validateSchema(fileName string, data []byte, schema exportSchema) []string {
+	if !json.Valid(data) {
+		return nil
+	}
+
+	var elements []interface{}
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return []string{fmt.Sprintf("%s: expected an array of objects: %s", fileName, err)}
+	}
+
+	fieldNames := make([]string, 0, len(schema))
+	for name := range schema {
+		fieldNames = append(fieldNames, name)
+	}
+	sort.Strings(fieldNames)
+
+	problems := []string{}
+	for i, element := range elements {
+		object, ok := element.(map[string]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: element %d is not an object", fileName, i))
+			continue
+		}
+
+		for _, name := range fieldNames {
+			field := schema[name]
+			value, ok := object[name]
+			if !ok || value == nil {
+				if field.Required {
+					problems = append(problems, fmt.Sprintf("%s: element %d is missing the field %q", fileName, i, name))
+				}
+				continue
+			}
+
+			if kind := kindOf(value); kind != field.Kind {
+				problems = append(problems, fmt.Sprintf("%s: element %d has the field %q of type %s instead of %s", fileName, i, name, kind, field.Kind))
+			}
+		}
+	}
+
+	return problems
+}
+
+// validateFileSchema reads a file of the export and validates it against
+// its schema. It returns a reader with the contents of the file, so it can
+// be parsed afterwards, and the problems found.
+func validateFileSchema(fileName string, reader io.Reader, schema exportSchema) (io.Reader, []string, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.NewReader(data), validateSchema(fileName, data, schema), nil
+}
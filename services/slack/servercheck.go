@@ -0,0 +1,83 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// ServerUserLookup finds the users of a Mattermost server by username and
+// email. *model.Client4 implements it.
+type ServerUserLookup interface {
+	GetUserByUsername(ctx context.Context, userName, etag string) (*model.User, *model.Response, error)
+	GetUserByEmail(ctx context.Context, email, etag string) (*model.User, *model.Response, error)
+}
+
+// ServerConflict is a username or email of a user of the import that a
+// user of the target server already has. The import updates that user
+// instead of creating a new one.
+type ServerConflict struct {
+	UserId       string
+	Field        string
+	Value        string
+	ServerUserId string
+}
+
+// CheckUsersAgainstServer looks up the username and email of every user
+// of the import on the target server and returns the ones already taken,
+// sorted by user id. Lookups that fail other than by not finding the user
+// stop the check.
+func (t *Transformer) CheckUsersAgainstServer(ctx context.Context, client ServerUserLookup) ([]ServerConflict, error) {
+	userIds := make([]string, 0, len(t.Intermediate.UsersById))
+	for userId := range t.Intermediate.UsersById {
+		userIds = append(userIds, userId)
+	}
+	sort.Strings(userIds)
+
+	lookup := func(field, value string, get func(context.Context, string, string) (*model.User, *model.Response, error)) (*model.User, error) {
+		if value == "" {
+			return nil, nil
+		}
+		serverUser, resp, err := get(ctx, value, "")
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to look up the %s %s on the server", field, value)
+		}
+		return serverUser, nil
+	}
+
+	conflicts := []ServerConflict{}
+	for _, userId := range userIds {
+		user := t.Intermediate.UsersById[userId]
+		for _, check := range []struct {
+			field string
+			value string
+			get   func(context.Context, string, string) (*model.User, *model.Response, error)
+		}{
+			{"username", user.Username, client.GetUserByUsername},
+			{"email", user.Email, client.GetUserByEmail},
+		} {
+			serverUser, err := lookup(check.field, check.value, check.get)
+			if err != nil {
+				return nil, err
+			}
+			if serverUser == nil {
+				continue
+			}
+			withUser(withCategory(t.Logger, WarningCategoryOther), userId).Warnf("The %s %s is already used by the user %s of the server, who will be updated by the import instead of a new user being created", check.field, check.value, serverUser.Id)
+			conflicts = append(conflicts, ServerConflict{
+				UserId:       userId,
+				Field:        check.field,
+				Value:        check.value,
+				ServerUserId: serverUser.Id,
+			})
+		}
+	}
+
+	return conflicts, nil
+}
@@ -0,0 +1,63 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+type stubUserLookup struct {
+	byUsername map[string]*model.User
+	byEmail    map[string]*model.User
+	failEmail  string
+}
+
+func (s *stubUserLookup) GetUserByUsername(_ context.Context, userName, _ string) (*model.User, *model.Response, error) {
+	if user, ok := s.byUsername[userName]; ok {
+		return user, &model.Response{StatusCode: http.StatusOK}, nil
+	}
+	return nil, &model.Response{StatusCode: http.StatusNotFound}, errors.New("not found")
+}
+
+func (s *stubUserLookup) GetUserByEmail(_ context.Context, email, _ string) (*model.User, *model.Response, error) {
+	if email == s.failEmail {
+		return nil, &model.Response{StatusCode: http.StatusUnauthorized}, errors.New("unauthorized")
+	}
+	if user, ok := s.byEmail[email]; ok {
+		return user, &model.Response{StatusCode: http.StatusOK}, nil
+	}
+	return nil, &model.Response{StatusCode: http.StatusNotFound}, errors.New("not found")
+}
+
+func TestCheckUsersAgainstServer(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+	slackTransformer.Intermediate.UsersById = map[string]*IntermediateUser{
+		"U1": {Id: "U1", Username: "alice", Email: "alice@example.com"},
+		"U2": {Id: "U2", Username: "bob", Email: "bob@example.com"},
+		"U3": {Id: "U3", Username: "carol", Email: "carol@example.com"},
+	}
+
+	client := &stubUserLookup{
+		byUsername: map[string]*model.User{"alice": {Id: "server1"}, "carol": {Id: "server3"}},
+		byEmail:    map[string]*model.User{"carol@example.com": {Id: "server3"}, "bob@example.com": {Id: "server2"}},
+	}
+
+	conflicts, err := slackTransformer.CheckUsersAgainstServer(context.Background(), client)
+	require.NoError(t, err)
+	require.Equal(t, []ServerConflict{
+		{UserId: "U1", Field: "username", Value: "alice", ServerUserId: "server1"},
+		{UserId: "U2", Field: "email", Value: "bob@example.com", ServerUserId: "server2"},
+		{UserId: "U3", Field: "username", Value: "carol", ServerUserId: "server3"},
+		{UserId: "U3", Field: "email", Value: "carol@example.com", ServerUserId: "server3"},
+	}, conflicts)
+
+	// errors other than a missing user stop the check
+	client.failEmail = "bob@example.com"
+	_, err = slackTransformer.CheckUsersAgainstServer(context.Background(), client)
+	require.EqualError(t, err, "failed to look up the email bob@example.com on the server: unauthorized")
+}
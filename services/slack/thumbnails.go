@@ -0,0 +1,55 @@
+package slack
+
+import (
+	"encoding/csv"
+	"io"
+	"slices"
+)
+
+// The variants of a file that can be downloaded.
+const (
+	FileVariantOriginal  = "original"
+	FileVariantThumbnail = "thumbnail"
+)
+
+// DownloadedFile is a file downloaded while Options.PreferThumbnails is
+// set, with the variant that was downloaded and where it was written.
+type DownloadedFile struct {
+	FileId  string
+	Name    string
+	Variant string
+	URL     string
+	Path    string
+}
+
+func (t *Transformer) recordDownloadedFile(downloaded DownloadedFile) {
+	t.downloadsMutex.Lock()
+	defer t.downloadsMutex.Unlock()
+	t.downloadedFiles = append(t.downloadedFiles, downloaded)
+}
+
+// DownloadedFiles returns the files downloaded while PreferThumbnails is
+// set, in the order they were downloaded, so the variant used for each
+// of them can be audited.
+func (t *Transformer) DownloadedFiles() []DownloadedFile {
+	t.downloadsMutex.Lock()
+	defer t.downloadsMutex.Unlock()
+	return slices.Clone(t.downloadedFiles)
+}
+
+// WriteDownloadedFilesReport writes the downloaded files as a CSV file
+// with the id and name of each file, the variant downloaded, the URL it
+// was downloaded from and its path in the attachments directory.
+func WriteDownloadedFilesReport(w io.Writer, downloaded []DownloadedFile) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"file_id", "name", "variant", "url", "path"}); err != nil {
+		return err
+	}
+	for _, file := range downloaded {
+		if err := writer.Write([]string{file.FileId, file.Name, file.Variant, file.URL, file.Path}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -1,17 +1,539 @@
 package slack
 
-import log "github.com/sirupsen/logrus"
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// MinMessageLength is the smallest maximum message length accepted, to
+// avoid splitting messages into an unreasonable number of posts.
+const MinMessageLength = 100
+
+// Options contains the settings that alter how the export is transformed.
+// The zero value keeps the default behaviour.
+type Options struct {
+	// SpreadReactionTimestamps assigns each reaction of a post its own
+	// timestamp right after the post, instead of the post's timestamp.
+	SpreadReactionTimestamps bool
+
+	// ReactionUsersLimit caps the number of users imported for each emoji
+	// reacted to a post. The post notes how many reactions each capped
+	// emoji had in Slack. Zero imports every reaction.
+	ReactionUsersLimit int
+
+	// ThreadReplyLimit caps the number of replies imported for each
+	// thread, keeping the earliest ones and noting how many were left out
+	// in a last reply. Zero means no limit.
+	ThreadReplyLimit int
+
+	// UTF8Normalization is the Unicode normalization form, one of
+	// NormalizationForms, applied to the channel names and the paths of
+	// the attachments. By default, the names derived from the purpose of
+	// nameless channels and the names of the files are decomposed with
+	// NFKD before dropping their non-ASCII characters, so accented
+	// letters keep their base letter and ligatures are expanded, the
+	// paths are composed with NFC, and the channel names are kept as is.
+	// The compatibility forms, NFKC and NFKD, also turn fullwidth and
+	// other variants of ASCII characters into plain ASCII, while NFC and
+	// NFD leave them, and the letters of scripts without a decomposition
+	// are dropped by every form.
+	UTF8Normalization string
+
+	// Progress, if set, is called as the users, channels and posts are
+	// transformed and the posts exported, so the progress can be shown.
+	Progress func(ProgressEvent)
+
+	// ChannelTypes overrides the type of public and private channels by
+	// their Slack name, to import a public channel as private or the
+	// other way around.
+	ChannelTypes map[string]model.ChannelType
+
+	// ChannelPrefixTeams imports the public and private channels whose
+	// Slack name starts with one of the prefixes into the team of the
+	// prefix instead of the team of the transformation. The longest
+	// matching prefix wins, and the teams are created by the import.
+	ChannelPrefixTeams map[string]string
+
+	// SlackTeamTeams imports the public and private channels of an
+	// Enterprise Grid export into the team mapped to the Slack workspace
+	// id that most of their posts carry in their team attribute. The
+	// channels of unmapped workspaces stay in the team of the
+	// transformation, and ChannelPrefixTeams takes precedence.
+	SlackTeamTeams map[string]string
+
+	// ChannelNamePrefix is prepended to the name of every public and
+	// private channel, to avoid clashes with existing channels.
+	ChannelNamePrefix string
+
+	// ChannelPurposePrefix and ChannelPurposeSuffix are added to the
+	// purpose of every public and private channel, separated by a space,
+	// to tag the imported channels. The purpose is truncated to keep
+	// them whole.
+	ChannelPurposePrefix string
+	ChannelPurposeSuffix string
+
+	// ChannelMembersFromPosts adds the users that posted in each public
+	// and private channel to its members, for partial exports whose member
+	// lists are incomplete.
+	ChannelMembersFromPosts bool
+
+	// ChannelHeaderFromPurpose uses the purpose of the public and private
+	// channels without a topic as their header.
+	ChannelHeaderFromPurpose bool
+
+	// IncludeFileURLs appends a link to the Slack file to the message
+	// when the file itself can't be imported.
+	IncludeFileURLs bool
+
+	// MaxMessageLength is the number of runes after which messages are
+	// split into several posts. Defaults to the server limit.
+	MaxMessageLength int
+
+	// PreserveTimestampPrecision renumbers the timestamps of the posts of
+	// each channel once they are transformed, so posts whose timestamps
+	// collided keep the order of their original Slack timestamps.
+	PreserveTimestampPrecision bool
+
+	// MergeConsecutiveMessages merges the messages that an author sends
+	// within this time of their previous one, in the same channel or
+	// thread, into a single post. Zero disables merging.
+	MergeConsecutiveMessages time.Duration
+
+	// MessagePrefixTemplate is prepended to the message of every post and
+	// reply, with the placeholders of MessagePrefixPlaceholders replaced,
+	// to keep who said what and when once threads are flattened or
+	// channels merged. Empty adds no prefix.
+	MessagePrefixTemplate string
+
+	// SortChannels orders the exported channels, which drives their order
+	// in the sidebar, by ChannelSortName, ChannelSortCreated or
+	// ChannelSortPosts. The public and private channels are sorted
+	// together, and so are the group and direct channels. Empty keeps the
+	// order of the export.
+	SortChannels string
+
+	// PostCreateAtOffset is added to the creation time of every post,
+	// reply and reaction, to move the history into another time window.
+	// It can be negative. Zero keeps the original times.
+	PostCreateAtOffset time.Duration
+
+	// FileCaption is the caption given to the file shares without a
+	// message: FileCaptionNone, FileCaptionFilename or FileCaptionTitle.
+	// Empty means FileCaptionNone.
+	FileCaption string
+
+	// HuddleWithoutRoom is what is done with the huddles whose room data is
+	// missing from the export: HuddleWithoutRoomImport or
+	// HuddleWithoutRoomSkip. Empty means HuddleWithoutRoomImport.
+	HuddleWithoutRoom string
+
+	// SkipCorruptFiles skips the posts files that can't be parsed instead
+	// of failing, recording them in SlackExport.CorruptFiles.
+	SkipCorruptFiles bool
+
+	// ExpandUserGroups replaces user group mentions with the mentions of
+	// the group members, using usergroups.json.
+	ExpandUserGroups bool
+
+	// NamespaceGridUsernames appends the workspace to the usernames that
+	// different users of an Enterprise Grid export share, so they aren't
+	// merged into a single user when imported.
+	NamespaceGridUsernames bool
+
+	// UserRenames maps Slack usernames to the usernames to use in
+	// Mattermost instead.
+	UserRenames map[string]string
+
+	// ChannelRenames maps the names of public and private channels in
+	// Slack to their names in Mattermost, which are used as is, without
+	// ChannelNamePrefix.
+	ChannelRenames map[string]string
+
+	// NormalizeUsernames turns the usernames that Mattermost doesn't
+	// accept into valid ones, numbering them if they clash with another
+	// user.
+	NormalizeUsernames bool
+
+	// UserEmails maps Slack user ids or usernames to the email to use for
+	// the users that have no email in the export.
+	UserEmails map[string]string
+
+	// AuthService is the authentication service of the imported users,
+	// such as saml or gitlab, so their accounts are linked to the SSO
+	// provider. The auth data of each user is taken from UserAuth, and is
+	// their email otherwise.
+	AuthService string
+
+	// UserAuth maps Slack user ids or usernames to their auth data and,
+	// if set, an auth service that overrides AuthService.
+	UserAuth map[string]UserAuth
+
+	// MentionReplacements are applied in order to the posts after the
+	// user and channel mentions are converted.
+	MentionReplacements []MentionReplacement
+
+	// QuoteBroadcastMentions converts the @channel, @here and @all
+	// mentions, which Slack's @everyone becomes, to code spans, so they
+	// don't notify the channel members.
+	QuoteBroadcastMentions bool
+
+	// StrictParse validates the channels, users and posts files of the
+	// export against their expected format, failing the parse if fields
+	// are missing or have an unexpected type.
+	StrictParse bool
+
+	// ConcurrentChannels is the number of channels whose posts are
+	// transformed at the same time. Values below 1 transform one channel
+	// at a time.
+	ConcurrentChannels int
+
+	// PostLimit stops the transformation of posts once this many posts,
+	// counting replies, are produced, keeping threads whole. Zero keeps
+	// every post.
+	PostLimit int
+
+	// MinMembers skips the direct and group channels with fewer valid
+	// members. Channels with a single member are always skipped.
+	MinMembers int
+
+	// ChannelOnlyById restricts the import to the channels of any type
+	// with these Slack ids, leaving the rest and their posts out. Ids are
+	// stable while names can change or collide. Empty imports every
+	// channel.
+	ChannelOnlyById []string
+
+	// DiscardEmptyChannels removes the public and private channels that
+	// have neither posts nor members after the transformation.
+	DiscardEmptyChannels bool
+
+	// SkipChannelsWithoutPostsSince removes the public and private
+	// channels without posts since that time. The zero value keeps every
+	// channel.
+	SkipChannelsWithoutPostsSince time.Time
+
+	// ArchiveDeadDMs is the name of a private channel that receives the
+	// posts of the direct channels whose members are all deleted users.
+	// Those direct channels are kept if it is empty.
+	ArchiveDeadDMs string
+
+	// ArchiveDeadDMsAdmin is the username of the active user that owns
+	// the archive channel of ArchiveDeadDMs. It is required along with
+	// it.
+	ArchiveDeadDMsAdmin string
+
+	// ArchiveDirectChannels imports each direct and group channel as a
+	// private channel of its members, for servers that don't allow
+	// importing direct messages.
+	ArchiveDirectChannels bool
+
+	// SkipDirectChannels leaves the direct and group channels and their
+	// posts out of the import. It takes precedence over
+	// ArchiveDirectChannels.
+	SkipDirectChannels bool
+
+	// PlaceholderSeed makes the passwords of the placeholder users created
+	// for missing and external users derive from it instead of being
+	// random, so repeated runs over an export produce the same users.
+	PlaceholderSeed string
+
+	// AttachmentsByDate stores the attachments in a directory for the day
+	// of their post, in Location, instead of a single directory.
+	AttachmentsByDate bool
+
+	// Location is the timezone used to find the day of the posts. UTC is
+	// used if it's nil.
+	Location *time.Location
+
+	// AttachmentsDir is the directory where TransformReader writes the
+	// attachments of the export. Attachments are skipped if it is empty.
+	AttachmentsDir string
+
+	// AllowDownload lets TransformReader download the attachments that
+	// aren't included in the export. It requires AttachmentsDir.
+	AllowDownload bool
+
+	// PreferThumbnails downloads the largest thumbnail of the image files
+	// instead of the original. Files included in the export are copied
+	// as they are. The variant downloaded for each file is listed by
+	// DownloadedFiles.
+	PreferThumbnails bool
+
+	// AttachmentURLTemplate builds the download URL of the files that
+	// have none in the export, replacing {id} with the file id and
+	// {name} with its name. Used only when downloads are allowed.
+	AttachmentURLTemplate string
+
+	// SlackToken authorizes the downloads of the URLs built from
+	// AttachmentURLTemplate. It isn't sent with any other download.
+	SlackToken string
+
+	// ImportCategories marks the channels in the starred sidebar section
+	// of each user, from sections.json, as favorites.
+	ImportCategories bool
+
+	// OnlyActiveUsers leaves the deactivated users out of the import. Their
+	// posts are attributed to placeholder users unless
+	// DropInactiveUserPosts is set.
+	OnlyActiveUsers bool
+
+	// DropInactiveUserPosts drops the posts of the users left out by
+	// OnlyActiveUsers, along with the replies to their threads.
+	DropInactiveUserPosts bool
+
+	// ExcludeBots leaves the bot users and the posts of bots and apps out
+	// of the import. The human replies to a thread started by a bot are
+	// moved to a new thread started by the first of them, unless
+	// DropBotThreadReplies is set.
+	ExcludeBots bool
+
+	// SkipUsersWithoutEmail leaves out the users without an email address
+	// when no default email domain is given and empty emails aren't
+	// allowed, instead of exiting. Their posts are imported with a
+	// placeholder user, and they are recorded in the sanitize report.
+	SkipUsersWithoutEmail bool
+
+	// DropBotThreadReplies drops the replies to the threads started by a
+	// bot left out by ExcludeBots.
+	DropBotThreadReplies bool
+
+	// PromoteOrphanReplies imports the replies whose thread root is
+	// missing as standalone posts, keeping their author and timestamp.
+	// They are dropped otherwise.
+	PromoteOrphanReplies bool
+
+	// DropEmptyThreads drops the roots of the threads that have no
+	// replies left after filtering, such as the ones of the users and bots
+	// left out, and that are empty or system messages, as they would be
+	// meaningless stubs.
+	DropEmptyThreads bool
+
+	// TruncationNote adds a post before the oldest post of each public and
+	// private channel with its date, as the history of free workspaces is
+	// truncated in their exports.
+	TruncationNote bool
+
+	// SeedContextPost adds a post before the oldest post of each public
+	// and private channel with its topic and purpose in Slack, by the
+	// creator of the channel, so the context is kept in the history even
+	// if the header is changed later on.
+	SeedContextPost bool
+
+	// SummarizeReminders lists the reminders set up in each channel in a
+	// single post instead of dropping them.
+	SummarizeReminders bool
+
+	// ChannelTopicHistory adds a post to each channel that lists the
+	// changes of its topic, purpose and name in order, along with the
+	// posts of each change.
+	ChannelTopicHistory bool
+
+	// Checkpoint records the channels whose posts are transformed and the
+	// files downloaded, and skips the ones it already has.
+	Checkpoint *Checkpoint
+
+	// LinkCanvases adds links to the canvases and lists of the channels
+	// to their headers.
+	LinkCanvases bool
+
+	// AttachmentsSizeLimit is the maximum total size in bytes of the
+	// attachments copied or downloaded for the import. The files that
+	// would exceed it are skipped, linked from their post if
+	// IncludeFileURLs is set, and listed by SkippedAttachments. Zero means
+	// no limit.
+	AttachmentsSizeLimit int64
+
+	// AttachmentBaseURL links the attachments from their posts under this
+	// URL instead of importing them, for media hosted externally. The
+	// attachments to upload are listed in the attachment manifest.
+	AttachmentBaseURL string
+
+	// HashUsernames replaces the usernames with hashes salted with
+	// HashSalt, which are stable across runs with the same salt.
+	HashUsernames bool
+	HashSalt      string
+
+	// HashEmails hashes the local part of the emails too when
+	// HashUsernames is set.
+	HashEmails bool
+}
 
 type Transformer struct {
 	TeamName     string
 	Intermediate *Intermediate
 	Logger       log.FieldLogger
+	Options      Options
+
+	warnings *warningsLog
+
+	// renamedUsernames maps the usernames changed by Options.UserRenames
+	// and Options.NormalizeUsernames to their new version, so the
+	// mentions of the old ones are replaced.
+	renamedUsernames map[string]string
+
+	// channelSlackTeams holds the Slack workspace id that the posts of
+	// each channel belong to by original name, for Options.SlackTeamTeams.
+	channelSlackTeams map[string]string
+
+	// downloadedFiles holds the files downloaded while
+	// Options.PreferThumbnails is set, guarded by downloadsMutex.
+	downloadedFiles []DownloadedFile
+	downloadsMutex  sync.Mutex
+
+	// inactiveUsers holds the ids of the users left out by
+	// OnlyActiveUsers.
+	inactiveUsers map[string]bool
+
+	// botUsers holds the ids of the bot users left out by
+	// Options.ExcludeBots.
+	botUsers map[string]bool
+
+	// integrationNames holds the names of the apps and integrations of
+	// the export by their bot, app and service ids.
+	integrationNames map[string]string
+
+	// channelContexts holds the topic and purpose in Slack of the public
+	// and private channels by id, for Options.SeedContextPost.
+	channelContexts map[string]SlackChannel
+
+	// emojiAliases maps the custom emoji of the export that are aliases of
+	// standard emoji to the standard emoji.
+	emojiAliases map[string]string
+
+	// externalAttachments is the attachment manifest of
+	// Options.AttachmentBaseURL.
+	externalAttachments []ExternalAttachment
+
+	// sanitizedFields holds the changes made to make the channels and
+	// users valid, guarded by sanitizeMutex.
+	sanitizedFields []SanitizeChange
+	sanitizeMutex   sync.Mutex
+
+	// attachmentsSize is the size of the attachments counted against
+	// Options.AttachmentsSizeLimit, budgetedFiles the size counted for
+	// each file by id, -1 until known, and skippedAttachments the files
+	// that didn't fit, guarded by attachmentsMutex.
+	attachmentsSize    int64
+	budgetedFiles      map[string]int64
+	skippedAttachments []SkippedAttachment
+	attachmentsMutex   sync.Mutex
+
+	// progressMutex serializes the calls to Options.Progress.
+	progressMutex sync.Mutex
+
+	// placeholderKinds holds the kind of the placeholder users created
+	// by their id, guarded by usersMutex like the users themselves.
+	placeholderKinds map[string]string
+
+	// usersMutex guards Intermediate.UsersById while the posts of several
+	// channels are transformed concurrently.
+	usersMutex sync.RWMutex
+	fileLocks  sync.Map
 }
 
 func NewTransformer(teamName string, logger log.FieldLogger) *Transformer {
+	warnings := newWarningsLog()
+
 	return &Transformer{
 		TeamName:     teamName,
 		Intermediate: &Intermediate{},
-		Logger:       logger,
+		Logger:       withWarningsLog(logger, warnings),
+		warnings:     warnings,
+	}
+}
+
+// TransformReader parses and transforms a Slack export zip file read from
+// r, returning the intermediate data without writing anything to disk
+// except for the attachments. It allows embedding the transformation in
+// other programs.
+//
+// Attachments are only copied from the export, or downloaded if
+// AllowDownload is set, when opts.AttachmentsDir is configured.
+func (t *Transformer) TransformReader(r io.ReaderAt, size int64, opts Options) (*Intermediate, error) {
+	if opts.AttachmentsDir == "" && opts.AllowDownload {
+		return nil, errors.New("downloading attachments requires an attachments directory")
+	}
+	t.Options = opts
+
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the export as a zip file")
+	}
+
+	slackExport, err := t.ParseSlackExportFile(zipReader, false)
+	if err != nil {
+		return nil, err
+	}
+
+	skipAttachments := opts.AttachmentsDir == ""
+	if !skipAttachments {
+		if err := os.MkdirAll(path.Join(opts.AttachmentsDir, attachmentsInternal), 0755); err != nil {
+			return nil, errors.Wrap(err, "failed to create the attachments directory")
+		}
+	}
+
+	if err := t.Transform(slackExport, opts.AttachmentsDir, skipAttachments, false, opts.AllowDownload, false, ""); err != nil {
+		return nil, err
+	}
+
+	return t.Intermediate, nil
+}
+
+func (t *Transformer) maxMessageLength() int {
+	if t.Options.MaxMessageLength > 0 {
+		return t.Options.MaxMessageLength
+	}
+	return model.PostMessageMaxRunesV2
+}
+
+// Captions of the file shares without a message.
+const (
+	FileCaptionNone     = "none"
+	FileCaptionFilename = "filename"
+	FileCaptionTitle    = "title"
+)
+
+// Handlings of the huddles without room data. Imported huddles are
+// attributed to the author of the post, or to Slackbot if it is missing,
+// and start and end at the time of the post.
+const (
+	HuddleWithoutRoomImport = "import"
+	HuddleWithoutRoomSkip   = "skip"
+)
+
+// MessagePrefixPlaceholders are the placeholders of the message prefix
+// template: the username of the author, the day and time of the post in
+// Options.Location and the name of the channel.
+var MessagePrefixPlaceholders = []string{"{user}", "{date}", "{time}", "{channel}"}
+
+var messagePrefixPlaceholderRegexp = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ValidateMessagePrefixTemplate checks that a message prefix template
+// only uses known placeholders.
+func ValidateMessagePrefixTemplate(template string) error {
+	for _, placeholder := range messagePrefixPlaceholderRegexp.FindAllString(template, -1) {
+		if !slices.Contains(MessagePrefixPlaceholders, placeholder) {
+			return errors.Errorf("unknown placeholder %s in the message prefix template, it should be one of %s", placeholder, strings.Join(MessagePrefixPlaceholders, ", "))
+		}
+	}
+	return nil
+}
+
+// ValidateMaxMessageLength checks that a maximum message length is within
+// the range that the server accepts.
+func ValidateMaxMessageLength(maxMessageLength int) error {
+	if maxMessageLength < MinMessageLength || maxMessageLength > model.PostMessageMaxRunesV2 {
+		return errors.Errorf("the maximum message length must be between %d and %d", MinMessageLength, model.PostMessageMaxRunesV2)
 	}
+	return nil
 }
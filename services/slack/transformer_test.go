@@ -0,0 +1,101 @@
+package slack
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mmetl/internal/testlib"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMaxMessageLength(t *testing.T) {
+	testCases := []struct {
+		Name             string
+		MaxMessageLength int
+		ExpectError      bool
+	}{
+		{"server limit", model.PostMessageMaxRunesV2, false},
+		{"minimum", MinMessageLength, false},
+		{"in range", 4000, false},
+		{"above server limit", model.PostMessageMaxRunesV2 + 1, true},
+		{"below minimum", MinMessageLength - 1, true},
+		{"zero", 0, true},
+		{"negative", -1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := ValidateMaxMessageLength(tc.MaxMessageLength)
+			if tc.ExpectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTransformReader(t *testing.T) {
+	zipped, err := testlib.ZipFiles(map[string]string{
+		"channels.json":           `[{"id": "C1", "name": "general", "members": ["U1"]}]`,
+		"users.json":              `[{"id": "U1", "name": "john", "profile": {"real_name": "John Doe", "email": "john@example.com"}}]`,
+		"general/2020-01-01.json": `[{"user": "U1", "text": "hello <@U1>", "ts": "1577836800.000000", "type": "message", "subtype": "file_share", "files": [{"id": "F1", "name": "report.txt"}]}]`,
+		"__uploads/F1/report.txt": "file contents",
+	})
+	require.NoError(t, err)
+	data := bytes.NewReader(zipped)
+
+	t.Run("attachments are skipped without an attachments directory", func(t *testing.T) {
+		transformer := NewTransformer("test", log.New())
+
+		intermediate, err := transformer.TransformReader(data, int64(data.Len()), Options{})
+		require.NoError(t, err)
+		require.Len(t, intermediate.UsersById, 1)
+		require.Len(t, intermediate.PublicChannels, 1)
+		require.Len(t, intermediate.Posts, 1)
+		assert.Equal(t, "hello @john", intermediate.Posts[0].Message)
+		assert.Empty(t, intermediate.Posts[0].Attachments)
+	})
+
+	t.Run("attachments are written to the attachments directory", func(t *testing.T) {
+		transformer := NewTransformer("test", log.New())
+		attachmentsDir := t.TempDir()
+
+		intermediate, err := transformer.TransformReader(data, int64(data.Len()), Options{AttachmentsDir: attachmentsDir})
+		require.NoError(t, err)
+		require.Len(t, intermediate.Posts, 1)
+		require.Len(t, intermediate.Posts[0].Attachments, 1)
+
+		contents, err := os.ReadFile(filepath.Join(attachmentsDir, intermediate.Posts[0].Attachments[0]))
+		require.NoError(t, err)
+		assert.Equal(t, "file contents", string(contents))
+	})
+
+	t.Run("the options are applied", func(t *testing.T) {
+		transformer := NewTransformer("test", log.New())
+
+		intermediate, err := transformer.TransformReader(data, int64(data.Len()), Options{ChannelNamePrefix: "slack-"})
+		require.NoError(t, err)
+		require.Len(t, intermediate.PublicChannels, 1)
+		assert.Equal(t, "slack-general", intermediate.PublicChannels[0].Name)
+	})
+
+	t.Run("downloads require an attachments directory", func(t *testing.T) {
+		transformer := NewTransformer("test", log.New())
+
+		_, err := transformer.TransformReader(data, int64(data.Len()), Options{AllowDownload: true})
+		require.EqualError(t, err, "downloading attachments requires an attachments directory")
+	})
+
+	t.Run("the input must be a zip file", func(t *testing.T) {
+		transformer := NewTransformer("test", log.New())
+
+		_, err := transformer.TransformReader(bytes.NewReader([]byte("not a zip file")), 14, Options{})
+		require.Error(t, err)
+	})
+}
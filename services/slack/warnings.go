@@ -0,0 +1,217 @@
+package slack
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WarningCategory classifies the data-quality issues that the transformer
+// logs as warnings.
+type WarningCategory string
+
+const (
+	WarningCategoryTruncation  WarningCategory = "truncation"
+	WarningCategoryPlaceholder WarningCategory = "placeholder"
+	WarningCategoryFile        WarningCategory = "file"
+	WarningCategoryUnsupported WarningCategory = "unsupported"
+	WarningCategoryCorrupt     WarningCategory = "corrupt"
+	WarningCategoryOther       WarningCategory = "other"
+)
+
+var WarningCategories = []WarningCategory{
+	WarningCategoryTruncation,
+	WarningCategoryPlaceholder,
+	WarningCategoryFile,
+	WarningCategoryUnsupported,
+	WarningCategoryCorrupt,
+	WarningCategoryOther,
+}
+
+const (
+	warningCategoryKey = "warning_category"
+	warningChannelKey  = "channel"
+	warningUserKey     = "user"
+)
+
+// Warning is a data-quality issue found during a transformation. Channel
+// and User are set when the issue relates to a specific channel or user.
+type Warning struct {
+	Kind    WarningCategory
+	Channel string
+	User    string
+	Detail  string
+}
+
+// withCategory tags a log entry so the warnings hook can classify it.
+// Warnings logged without a category are counted as "other".
+func withCategory(logger log.FieldLogger, category WarningCategory) log.FieldLogger {
+	return logger.WithField(warningCategoryKey, category)
+}
+
+// withChannel tags a log entry with the channel it relates to.
+func withChannel(logger log.FieldLogger, channel string) log.FieldLogger {
+	return logger.WithField(warningChannelKey, channel)
+}
+
+// withUser tags a log entry with the user it relates to.
+func withUser(logger log.FieldLogger, user string) log.FieldLogger {
+	return logger.WithField(warningUserKey, user)
+}
+
+// warningsLog keeps track of the warnings and errors logged during a
+// transformation.
+type warningsLog struct {
+	mu       sync.Mutex
+	counts   map[WarningCategory]int
+	warnings []Warning
+}
+
+func newWarningsLog() *warningsLog {
+	return &warningsLog{counts: map[WarningCategory]int{}}
+}
+
+func (w *warningsLog) record(entry *log.Entry) {
+	category, ok := entry.Data[warningCategoryKey].(WarningCategory)
+	if !ok {
+		category = WarningCategoryOther
+	}
+
+	channel, _ := entry.Data[warningChannelKey].(string)
+	user, _ := entry.Data[warningUserKey].(string)
+	detail := entry.Message
+	if err, ok := entry.Data[log.ErrorKey].(error); ok {
+		detail += ": " + err.Error()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.counts[category]++
+	w.warnings = append(w.warnings, Warning{
+		Kind:    category,
+		Channel: channel,
+		User:    user,
+		Detail:  detail,
+	})
+}
+
+func (w *warningsLog) list() []Warning {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.warnings)
+}
+
+// since returns the warnings logged after the first n.
+func (w *warningsLog) since(n int) []Warning {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.warnings[n:])
+}
+
+func (w *warningsLog) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.warnings)
+}
+
+// restore adds warnings logged by a previous run, as if they were logged
+// again.
+func (w *warningsLog) restore(warnings []Warning) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, warning := range warnings {
+		w.counts[warning.Kind]++
+	}
+	w.warnings = append(w.warnings, warnings...)
+}
+
+func (w *warningsLog) count(categories ...WarningCategory) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(categories) == 0 {
+		total := 0
+		for _, count := range w.counts {
+			total += count
+		}
+		return total
+	}
+
+	total := 0
+	for _, category := range categories {
+		total += w.counts[category]
+	}
+	return total
+}
+
+// warningsLogKey is the context key of the warnings log that the entries
+// of a transformer are recorded in.
+type warningsLogKey struct{}
+
+// warningsHook is a logrus hook that records the warnings and errors in
+// the warnings log of the transformer that logged them, so transformers
+// sharing a logger don't count each other's warnings.
+type warningsHook struct{}
+
+func (warningsHook) Levels() []log.Level {
+	return []log.Level{log.WarnLevel, log.ErrorLevel}
+}
+
+func (warningsHook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if warnings, ok := entry.Context.Value(warningsLogKey{}).(*warningsLog); ok {
+		warnings.record(entry)
+	}
+	return nil
+}
+
+// withWarningsLog returns a logger that records its warnings and errors
+// in the given log. The hook is attached once to the underlying logrus
+// logger, and loggers of other types can't be tracked.
+func withWarningsLog(logger log.FieldLogger, warnings *warningsLog) log.FieldLogger {
+	var entry *log.Entry
+	switch l := logger.(type) {
+	case *log.Logger:
+		entry = log.NewEntry(l)
+	case *log.Entry:
+		entry = l
+	default:
+		logger.Warnf("Unable to count the warnings of the transformation with a logger of type %T", logger)
+		return logger
+	}
+
+	installWarningsHook(entry.Logger)
+
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return entry.WithContext(context.WithValue(ctx, warningsLogKey{}, warnings))
+}
+
+// installWarningsHook attaches the hook to the logger unless it already
+// has it.
+func installWarningsHook(logger *log.Logger) {
+	for _, hook := range logger.Hooks[log.WarnLevel] {
+		if _, ok := hook.(warningsHook); ok {
+			return
+		}
+	}
+	logger.AddHook(warningsHook{})
+}
+
+// WarningCount returns the number of warnings logged so far for the given
+// categories, or for all of them if none is provided.
+func (t *Transformer) WarningCount(categories ...WarningCategory) int {
+	return t.warnings.count(categories...)
+}
+
+// Warnings returns the warnings logged so far, in the order they were
+// logged. The logs remain the place to look for the full context.
+func (t *Transformer) Warnings() []Warning {
+	return t.warnings.list()
+}
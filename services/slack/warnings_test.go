@@ -0,0 +1,98 @@
+package slack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarningCount(t *testing.T) {
+	slackTransformer := NewTransformer("test", log.New())
+
+	withCategory(slackTransformer.Logger, WarningCategoryPlaceholder).Warn("placeholder")
+	withCategory(slackTransformer.Logger, WarningCategoryFile).Error("file")
+	slackTransformer.Logger.Warn("uncategorised")
+	slackTransformer.Logger.Info("not a warning")
+
+	require.Equal(t, 3, slackTransformer.WarningCount())
+	require.Equal(t, 1, slackTransformer.WarningCount(WarningCategoryPlaceholder))
+	require.Equal(t, 2, slackTransformer.WarningCount(WarningCategoryFile, WarningCategoryOther))
+	require.Zero(t, slackTransformer.WarningCount(WarningCategoryTruncation))
+}
+
+// fieldLogger hides the logrus type of a logger.
+type fieldLogger struct {
+	log.FieldLogger
+}
+
+func TestWarningCountSharedLogger(t *testing.T) {
+	t.Run("transformers sharing a logger count their own warnings", func(t *testing.T) {
+		logger := log.New()
+		first := NewTransformer("first", logger)
+		second := NewTransformer("second", logger.WithField("run", "second"))
+
+		first.Logger.Warn("first")
+		second.Logger.Warn("second")
+		second.Logger.Error("second")
+		logger.Warn("not from a transformer")
+
+		assert.Equal(t, 1, first.WarningCount())
+		assert.Equal(t, 2, second.WarningCount())
+		assert.Len(t, logger.Hooks[log.WarnLevel], 1)
+	})
+
+	t.Run("a logger of another type is reported", func(t *testing.T) {
+		logger, hook := test.NewNullLogger()
+		slackTransformer := NewTransformer("test", fieldLogger{logger})
+
+		require.NotNil(t, hook.LastEntry())
+		assert.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+		assert.Equal(t, "Unable to count the warnings of the transformation with a logger of type slack.fieldLogger", hook.LastEntry().Message)
+		assert.Zero(t, slackTransformer.WarningCount())
+	})
+}
+
+func TestWarnings(t *testing.T) {
+	t.Run("warnings keep their kind, channel, user and detail", func(t *testing.T) {
+		slackTransformer := NewTransformer("test", log.New())
+
+		withUser(withCategory(slackTransformer.Logger, WarningCategoryPlaceholder), "U1").Warn("placeholder")
+		withChannel(withCategory(slackTransformer.Logger, WarningCategoryFile), "general").WithError(errors.New("not found")).Error("file")
+		slackTransformer.Logger.Warn("uncategorised")
+		slackTransformer.Logger.Info("not a warning")
+
+		require.Equal(t, []Warning{
+			{Kind: WarningCategoryPlaceholder, User: "U1", Detail: "placeholder"},
+			{Kind: WarningCategoryFile, Channel: "general", Detail: "file: not found"},
+			{Kind: WarningCategoryOther, Detail: "uncategorised"},
+		}, slackTransformer.Warnings())
+	})
+
+	t.Run("a missing user is reported as a placeholder warning", func(t *testing.T) {
+		slackExport := &SlackExport{
+			Users: []SlackUser{
+				{Id: "U1", Username: "user1", Profile: SlackProfile{Email: "user1@example.com"}},
+			},
+			PublicChannels: []SlackChannel{
+				{Id: "C1", Name: "general", Members: []string{"U1"}, Type: model.ChannelTypeOpen},
+			},
+			Posts: map[string][]SlackPost{
+				"general": {{User: "U2", Text: "hello", TimeStamp: "1577836800.000000", Type: "message"}},
+			},
+		}
+
+		slackTransformer := NewTransformer("test", log.New())
+		require.NoError(t, slackTransformer.Transform(slackExport, "", true, false, false, false, ""))
+
+		assert.Contains(t, slackTransformer.Warnings(), Warning{
+			Kind:   WarningCategoryPlaceholder,
+			User:   "U2",
+			Detail: "Created a new user because the original user was missing from the import files. user=U2",
+		})
+	})
+}